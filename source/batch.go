@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// eachJob is one input file of appendEach and what it printed.
+type eachJob struct {
+	path   string
+	label  string
+	sha256 string
+	output bytes.Buffer
+	status int
+	done   chan struct{}
+}
+
+// appendEach appends every input file, with patterns expanded, to its own
+// copy of the template, saved under the name opts.OutputPath gives it, and
+// runs up to jobs files at a time. Each file's messages are held until it is
+// done and printed in input order, so they read the same whatever the number
+// of jobs. It returns the exit status: that of the first file that failed,
+// see runStatus, otherwise exitLineErrors if any lost lines.
+func appendEach(ctx context.Context, opts xlappend.Options, jobs int, messages *console) int {
+	todo, status := eachInputs(opts)
+
+	// Two inputs of the same name would be saved over each other
+	outputs := make(map[string]string)
+	for _, job := range todo {
+		name, err := xlappend.OutputName(opts.OutputPath, job.path)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if other, ok := outputs[name]; ok {
+			log.Fatalf("Input files %s and %s would both be saved as %s", other, job.path, name)
+		}
+		outputs[name] = job.path
+	}
+
+	slots := make(chan struct{}, jobs)
+	go func() {
+		for _, job := range todo {
+			slots <- struct{}{}
+			go func(job *eachJob) {
+				defer func() {
+					<-slots
+					close(job.done)
+				}()
+				job.run(ctx, opts, messages)
+			}(job)
+		}
+	}()
+	for _, job := range todo {
+		<-job.done
+		os.Stderr.Write(job.output.Bytes())
+		// The first failure decides the status, over lines lost before it
+		if status == 0 || status == exitLineErrors && job.status != 0 {
+			status = job.status
+		}
+	}
+	return status
+}
+
+// run appends the job's input file, writing its messages and summary, in
+// the format of messages, to job.output.
+func (job *eachJob) run(ctx context.Context, opts xlappend.Options, messages *console) {
+	output := messages.withOutput(&job.output)
+	opts.InputPaths = []string{job.path}
+	if opts.SourceLabels != nil {
+		opts.SourceLabels = []string{job.label}
+	}
+	if opts.VerifySHA256 != nil {
+		opts.VerifySHA256 = []string{job.sha256}
+	}
+	output.setOptions(&opts)
+	output.logf("Input file %s\n", job.path)
+	var importer xlappend.Importer
+	result, err := importer.Append(ctx, opts)
+	if err != nil {
+		// Failures are printed even when quiet, like fatal errors
+		output.errorf("Failed to append %s: %v\n", job.path, err)
+		job.status = runStatus(err)
+		return
+	}
+	output.summary("", opts, result)
+	output.logf("\n")
+	if lostLines(result) {
+		job.status = exitLineErrors
+	}
+}
+
+// eachInputs returns a job for every input file, with patterns expanded and
+// each carrying the source label and SHA256 hash given for its -i entry, and
+// the exit status so far: exitLineErrors when a pattern matches no files.
+func eachInputs(opts xlappend.Options) ([]*eachJob, int) {
+	status := 0
+	var todo []*eachJob
+	for i, pattern := range opts.InputPaths {
+		var label, digest string
+		if opts.SourceLabels != nil {
+			label = opts.SourceLabels[i]
+		}
+		if opts.VerifySHA256 != nil {
+			digest = opts.VerifySHA256[i]
+		}
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") && !xlappend.IsRemotePath(pattern) {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				log.Fatalf("invalid input pattern %s: %v", pattern, err)
+			}
+			sort.Strings(matches)
+		}
+		if digest != "" && len(matches) > 1 {
+			log.Fatalf("%s matches %d files, but one SHA256 hash is given for it", pattern, len(matches))
+		}
+		if len(matches) == 0 {
+			opts.Logf("No input files match %s\n", pattern)
+			status = exitLineErrors
+		}
+		for _, path := range matches {
+			todo = append(todo, &eachJob{path: path, label: label, sha256: digest, done: make(chan struct{})})
+		}
+	}
+	return todo, status
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// captureStderr returns what run writes to os.Stderr.
+func captureStderr(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	read := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		read <- string(b)
+	}()
+	defer func() { os.Stderr = stderr }()
+	run()
+	w.Close()
+	return <-read
+}
+
+func TestAppendEachParallel(t *testing.T) {
+	dir := t.TempDir()
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "T")
+	f.SetSheetRow("T", "A1", &[]string{"Name", "Path", "Owner"})
+	template := filepath.Join(dir, "template.xlsx")
+	if err := f.SaveAs(template); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Input n holds n rows; in.3.csv also has a line with too many fields
+	const inputs = 8
+	var paths []string
+	for n := 1; n <= inputs; n++ {
+		var b strings.Builder
+		b.WriteString("Name,Path,Owner\n")
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&b, "file%d-%d.exe,C:\\Temp,user%d\n", n, i, n)
+		}
+		if n == 3 {
+			b.WriteString("bad.exe,C:\\Temp,user3,extra\n")
+		}
+		path := filepath.Join(dir, fmt.Sprintf("in.%d.csv", n))
+		if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	out := filepath.Join(dir, "out") + string(filepath.Separator)
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var printed []string
+	for _, jobs := range []int{1, 4, inputs} {
+		messages, err := newConsole(io.Discard, "text", false, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := xlappend.Options{
+			InputPaths: paths, TemplatePath: template, SheetName: "T", StartRow: 2,
+			OutputPath: out, Force: true,
+		}
+		messages.setOptions(&opts)
+		var status int
+		stderr := captureStderr(t, func() { status = appendEach(context.Background(), opts, jobs, messages) })
+		if status != exitLineErrors {
+			t.Errorf("-j %d: exit status %d, want %d for the line lost", jobs, status, exitLineErrors)
+		}
+		printed = append(printed, stderr)
+
+		for n := 1; n <= inputs; n++ {
+			output := filepath.Join(out, fmt.Sprintf("in.%d.xlsx", n))
+			f, err := excelize.OpenFile(output)
+			if err != nil {
+				t.Fatalf("-j %d: %v", jobs, err)
+			}
+			rows, err := f.GetRows("T")
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != n+1 {
+				t.Errorf("-j %d: %s has %d rows, want %d", jobs, output, len(rows), n+1)
+				continue
+			}
+			for i := 1; i <= n; i++ {
+				if want := fmt.Sprintf("file%d-%d.exe", n, i); rows[i][0] != want {
+					t.Errorf("-j %d: %s row %d starts %q, want %q", jobs, output, i+1, rows[i][0], want)
+				}
+			}
+		}
+	}
+
+	// The messages are printed in input order, whatever the number of jobs
+	for i := 1; i < len(printed); i++ {
+		if printed[i] != printed[0] {
+			t.Errorf("messages differ between runs:\n%s\nand\n%s", printed[0], printed[i])
+		}
+	}
+	last := -1
+	for n := 1; n <= inputs; n++ {
+		at := strings.Index(printed[0], fmt.Sprintf("Input file %s\n", paths[n-1]))
+		if at < last {
+			t.Errorf("messages of %s are not in input order:\n%s", paths[n-1], printed[0])
+		}
+		last = at
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// benchSampleInterval is how often -bench looks at the heap for its peak.
+const benchSampleInterval = 50 * time.Millisecond
+
+// heapMetric is the runtime metric of the memory held by live and not yet
+// collected heap objects, which can be read without stopping the program.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// benchRun measures a run for -bench and writes the -cpuprofile and
+// -memprofile profiles of it.
+type benchRun struct {
+	report     bool // print the -bench report
+	start      time.Time
+	cpuProfile *os.File
+	memProfile string
+
+	mu       sync.Mutex // -each -j runs steps at once
+	timing   xlappend.Timing
+	lines    int
+	bytes    int64
+	rows     int
+	peakHeap uint64
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// startBench starts measuring a run, printing a report at the end if
+// report is set, and profiling it to the cpuProfile and memProfile files
+// that are given.
+func startBench(report bool, cpuProfile, memProfile string) (*benchRun, error) {
+	b := &benchRun{report: report, start: time.Now(), memProfile: memProfile}
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %v", err)
+		}
+		b.cpuProfile = f
+	}
+	if report {
+		b.stop, b.stopped = make(chan struct{}), make(chan struct{})
+		go b.sampleHeap()
+	}
+	return b, nil
+}
+
+// sampleHeap records the largest heap seen until the run is stopped.
+func (b *benchRun) sampleHeap() {
+	defer close(b.stopped)
+	sample := []metrics.Sample{{Name: heapMetric}}
+	ticker := time.NewTicker(benchSampleInterval)
+	defer ticker.Stop()
+	for {
+		metrics.Read(sample)
+		if sample[0].Value.Kind() == metrics.KindUint64 {
+			if heap := sample[0].Value.Uint64(); heap > b.peakHeap {
+				b.peakHeap = heap
+			}
+		}
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// progress returns the Options.Progress func counting the lines and bytes
+// each run or step read, which also calls next unless it is nil.
+func (b *benchRun) progress(next func(xlappend.Progress)) func(xlappend.Progress) {
+	return func(p xlappend.Progress) {
+		if p.Done {
+			b.mu.Lock()
+			b.lines += p.LinesRead
+			b.bytes += p.BytesRead
+			b.mu.Unlock()
+		}
+		if next != nil {
+			next(p)
+		}
+	}
+}
+
+// add counts the Timing and rows of the Result of a run or step.
+func (b *benchRun) add(result xlappend.Result) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timing.Open += result.Timing.Open
+	b.timing.Read += result.Timing.Read
+	b.timing.Write += result.Timing.Write
+	b.timing.Save += result.Timing.Save
+	b.rows += result.RowsAppended
+}
+
+// finish stops the measurements, writes the profiles and prints the
+// -bench report to c.
+func (b *benchRun) finish(c *console) {
+	if b == nil {
+		return
+	}
+	took := time.Since(b.start)
+	if b.cpuProfile != nil {
+		pprof.StopCPUProfile()
+		if err := b.cpuProfile.Close(); err != nil {
+			c.errorf("Warning: failed to write CPU profile: %v\n", err)
+		} else {
+			c.logf("CPU profile written to %s\n", b.cpuProfile.Name())
+		}
+	}
+	if b.memProfile != "" {
+		if err := writeHeapProfile(b.memProfile); err != nil {
+			c.errorf("Warning: failed to write memory profile: %v\n", err)
+		} else {
+			c.logf("Memory profile written to %s\n", b.memProfile)
+		}
+	}
+	if !b.report {
+		return
+	}
+	close(b.stop)
+	<-b.stopped
+	if c.quiet {
+		return
+	}
+	var gc runtime.MemStats
+	runtime.ReadMemStats(&gc)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.timing
+	if c.json != nil {
+		c.json.Info("Benchmark", "seconds", took.Seconds(), "open_seconds", t.Open.Seconds(),
+			"read_seconds", t.Read.Seconds(), "write_seconds", t.Write.Seconds(), "save_seconds", t.Save.Seconds(),
+			"lines_read", b.lines, "bytes_read", b.bytes, "rows_written", b.rows,
+			"peak_heap_bytes", b.peakHeap, "gc_cycles", gc.NumGC)
+		return
+	}
+	c.logf("\nBenchmark, in %s:\n", took.Round(time.Millisecond))
+	c.logf("  Opening the template: %s\n", t.Open.Round(time.Millisecond))
+	c.logf("  Reading the input: %s, %s lines (%s lines/s), %s (%s/s)\n", t.Read.Round(time.Millisecond),
+		groupDigits(b.lines), groupDigits(perSecond(float64(b.lines), t.Read)),
+		byteSize(float64(b.bytes)), byteSize(float64(perSecond(float64(b.bytes), t.Read))))
+	c.logf("  Writing the sheet: %s, %s rows (%s rows/s)\n", t.Write.Round(time.Millisecond),
+		groupDigits(b.rows), groupDigits(perSecond(float64(b.rows), t.Write)))
+	c.logf("  Saving the output: %s\n", t.Save.Round(time.Millisecond))
+	c.logf("  Peak heap: %s, %d garbage collections\n", byteSize(float64(b.peakHeap)), gc.NumGC)
+}
+
+// writeHeapProfile writes a profile of the memory the run allocated, and
+// of what it still holds, to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// Bring the in-use figures up to date
+	runtime.GC()
+	err = pprof.WriteHeapProfile(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// perSecond returns n per second of d, 0 for no time.
+func perSecond(n float64, d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(n / d.Seconds())
+}
+
+// byteSize returns n bytes in the largest unit under it, in units of 1024
+// as -max-mem counts them, as in "12.3 MB".
+func byteSize(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,14 @@
+#!/bin/sh
+# Builds the release binaries into the repository root, stamped with the
+# version, git commit and build date that -version prints. Set VERSION to
+# override the version taken from git describe.
+set -e
+cd "$(dirname "$0")"
+VERSION=${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo dev)}
+COMMIT=$(git rev-parse --short HEAD)
+DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+LDFLAGS="-X main.version=$VERSION -X main.commit=$COMMIT -X main.buildDate=$DATE"
+
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o ../csv2XLsheet .
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o ../csv2XLsheet.exe .
+GOOS=darwin GOARCH=amd64 go build -ldflags "$LDFLAGS" -o ../csv2XLsheet_mac .
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// appendClones appends every input file, with patterns expanded, to its own
+// copy of the -s template sheet, named after the file, in the one workbook
+// opts names, which is saved once. The copies are made one after another,
+// each from the template sheet as the template has it, so that every input
+// gets the sheet's header, formatting and table. It returns the exit status.
+func appendClones(ctx context.Context, opts xlappend.Options, messages *console) int {
+	todo, status := eachInputs(opts)
+	if len(todo) == 0 {
+		log.Fatal("No input files to append")
+	}
+	steps := make([]xlappend.Options, len(todo))
+	headings := make([]string, len(todo))
+	for i, job := range todo {
+		step := opts
+		step.InputPaths = []string{job.path}
+		if opts.SourceLabels != nil {
+			step.SourceLabels = []string{job.label}
+		}
+		if opts.VerifySHA256 != nil {
+			step.VerifySHA256 = []string{job.sha256}
+		}
+		step.SheetCopy = xlappend.InputToken
+		steps[i] = step
+		headings[i] = fmt.Sprintf("Input file %s\n", job.path)
+	}
+	if sheets := appendSheets(ctx, steps, headings, messages); sheets != 0 {
+		status = sheets
+	}
+	return status
+}
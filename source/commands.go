@@ -0,0 +1,291 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand of the CLI: import and merge read the -i inputs,
+// validate checks them, watch and serve take theirs as they come, and
+// completion prints a shell's completion script. Run without a command,
+// the program takes every flag, as it always has.
+type command struct {
+	name    string
+	args    string   // the arguments after the flags, for the usage line
+	summary string   // what the command does, for the help
+	without []string // flags the command does not take
+}
+
+// commands are the subcommands, in the order the help lists them.
+var commands = []*command{
+	{
+		name:    "import",
+		summary: "Append the -i inputs to the -s sheet of the -t template (the default: flags alone run an import)",
+		without: []string{"time-cols", "watch", "watch-pattern", "serve"},
+	},
+	{
+		name:    "merge",
+		summary: "Interleave the -i inputs by their -time-cols timestamps into one sorted Time, Source and Description timeline",
+		without: []string{"each", "j", "clone-sheet", "split-by", "rules", "job", "watch", "watch-pattern", "serve"},
+	},
+	{
+		name:    "validate",
+		summary: "Check the -i inputs against the sheet as an import would, saving nothing; -o is optional",
+		without: []string{"time-cols", "watch", "watch-pattern", "serve", "each", "j", "dry-run", "checkpoint", "resume",
+			"force", "backup", "password", "checksum", "manifest", "export-ndjson", "notify-url"},
+	},
+	{
+		name:    "watch",
+		args:    "DIR",
+		summary: "Append every new file arriving in the directory DIR to the -s sheet of the -o workbook, until Ctrl-C",
+		without: []string{"i", "time-cols", "watch", "serve", "each", "j", "clone-sheet", "split-by", "rules", "job", "checkpoint", "resume",
+			"sheet-copy", "mode", "verify-sha256", "o-format"},
+	},
+	{
+		name:    "serve",
+		args:    "ADDR",
+		summary: "Serve HTTP on ADDR, e.g. 'localhost:8080': POST files to /append to get them appended to the template",
+		without: []string{"i", "o", "time-cols", "watch", "watch-pattern", "serve", "each", "j", "clone-sheet", "split-by", "rules", "job",
+			"checkpoint", "resume", "verify-sha256", "o-format", "export-ndjson", "backup", "notify-url"},
+	},
+	{
+		name:    "completion",
+		args:    "bash|zsh|powershell",
+		summary: "Print the completion script of the shell, e.g. 'source <(csv2XLsheet completion bash)'",
+	},
+}
+
+// globalFlags are the flags every command takes.
+var globalFlags = []string{"h", "help", "version", "config", "dump-config", "v", "vv", "msg-format", "q", "quiet"}
+
+// completionShells are the shells completion writes a script for.
+var completionShells = []string{"bash", "zsh", "powershell"}
+
+// flagValues are the values offered for the flags that take one of a few.
+var flagValues = map[string][]string{
+	"f":          {"csv", "json", "jsonl", "sqlite", "parquet", "l2tcsv"},
+	"d":          {"csv", "tab", "auto", "bodyfile"},
+	"enc":        {"utf-8", "utf-16le", "utf-16be", "windows-1252", "latin1"},
+	"quote":      {"lazy", "strict", "none"},
+	"quotes":     {"keep", "strip", "rfc4180"},
+	"log-format": {"text", "csv", "json"},
+	"msg-format": {"text", "json"},
+	"mode":       {"append", "overwrite", "replace"},
+	"ragged":     {"error", "pad", "truncate"},
+	"checksum":   {"sha256", "sha1", "md5", "sha512"},
+	"locale":     {"us", "uk", "eu", "iso", "en-US", "en-GB", "de-DE", "fr-FR", "es-ES", "it-IT", "nl-NL", "pt-BR"},
+	"src-col":    {"prepend", "append"},
+	"sort-order": {"asc", "desc"},
+	"o-format":   {"xlsx", "csv"},
+}
+
+// findCommand returns the command name names, nil when it names none.
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// takes reports whether the command takes the flag name. Without a
+// command every flag is taken; completion takes only the global ones.
+func (c *command) takes(name string) bool {
+	if c == nil {
+		return true
+	}
+	for _, global := range globalFlags {
+		if name == global {
+			return true
+		}
+	}
+	if c.name == "completion" {
+		return false
+	}
+	for _, without := range c.without {
+		if name == without {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFlags stops the run when a flag set on the command line is not one
+// the command takes.
+func (c *command) checkFlags() error {
+	var err error
+	flag.Visit(func(fl *flag.Flag) {
+		if err == nil && !c.takes(fl.Name) {
+			err = fmt.Errorf("flag -%s does not apply to the %s command; see %s %s -h", fl.Name, c.name, programName(), c.name)
+		}
+	})
+	return err
+}
+
+// usageFlags returns those of flags the command takes.
+func (c *command) usageFlags(flags []string) []string {
+	var taken []string
+	for _, name := range flags {
+		if c.takes(strings.TrimPrefix(name, "-")) {
+			taken = append(taken, name)
+		}
+	}
+	return taken
+}
+
+// flagNames returns the names of the flags the command takes, sorted.
+func (c *command) flagNames() []string {
+	var names []string
+	flag.VisitAll(func(fl *flag.Flag) {
+		if c.takes(fl.Name) {
+			names = append(names, "-"+fl.Name)
+		}
+	})
+	if c.takes("h") {
+		names = append(names, "-h")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// programName returns the name the program is run by, for its messages
+// and completion scripts.
+func programName() string {
+	return strings.TrimSuffix(filepath.Base(flag.CommandLine.Name()), ".exe")
+}
+
+// writeCompletion writes the completion script of shell to w: the commands
+// as the first word, the flags of the command given, the values of the
+// flags taking one of a few, and file names otherwise.
+func writeCompletion(w io.Writer, shell string) error {
+	name := programName()
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	values := make([]string, 0, len(flagValues))
+	for fl := range flagValues {
+		values = append(values, fl)
+	}
+	sort.Strings(values)
+
+	switch shell {
+	case "bash":
+		fmt.Fprintf(w, "# bash completion for %s: source <(%s completion bash)\n", name, name)
+		fmt.Fprintf(w, "%s() {\n", fn)
+		fmt.Fprintf(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} cmd= words\n")
+		fmt.Fprintf(w, "\t(( COMP_CWORD > 1 )) && case ${COMP_WORDS[1]} in\n")
+		for _, c := range commands {
+			fmt.Fprintf(w, "\t%s) cmd=%s ;;\n", c.name, c.name)
+		}
+		fmt.Fprintf(w, "\tesac\n")
+		fmt.Fprintf(w, "\tcase $prev in\n")
+		for _, fl := range values {
+			fmt.Fprintf(w, "\t-%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", fl, strings.Join(flagValues[fl], " "))
+		}
+		fmt.Fprintf(w, "\tesac\n")
+		fmt.Fprintf(w, "\tcase $cmd in\n")
+		for _, c := range commands {
+			if c.name == "completion" {
+				fmt.Fprintf(w, "\tcompletion) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", strings.Join(completionShells, " "))
+				continue
+			}
+			fmt.Fprintf(w, "\t%s) words=%q ;;\n", c.name, strings.Join(c.flagNames(), " "))
+		}
+		fmt.Fprintf(w, "\t*) words=%q ;;\n", strings.Join(append(names, (*command)(nil).flagNames()...), " "))
+		fmt.Fprintf(w, "\tesac\n")
+		fmt.Fprintf(w, "\tif [[ $cur == -* || -z $cmd && $COMP_CWORD -eq 1 ]]; then\n")
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+		fmt.Fprintf(w, "\telse\n")
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		fmt.Fprintf(w, "\tfi\n")
+		fmt.Fprintf(w, "}\n")
+		fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, name)
+	case "zsh":
+		fmt.Fprintf(w, "#compdef %s\n", name)
+		fmt.Fprintf(w, "# zsh completion for %s: source <(%s completion zsh)\n", name, name)
+		fmt.Fprintf(w, "%s() {\n", fn)
+		fmt.Fprintf(w, "\tlocal -a words_\n")
+		fmt.Fprintf(w, "\tcase ${words[CURRENT-1]} in\n")
+		for _, fl := range values {
+			fmt.Fprintf(w, "\t-%s) compadd -- %s; return ;;\n", fl, strings.Join(flagValues[fl], " "))
+		}
+		fmt.Fprintf(w, "\tesac\n")
+		fmt.Fprintf(w, "\tcase ${words[2]} in\n")
+		for _, c := range commands {
+			if c.name == "completion" {
+				fmt.Fprintf(w, "\tcompletion) (( CURRENT == 3 )) && compadd -- %s; return ;;\n", strings.Join(completionShells, " "))
+				continue
+			}
+			fmt.Fprintf(w, "\t%s) words_=(%s) ;;\n", c.name, strings.Join(c.flagNames(), " "))
+		}
+		fmt.Fprintf(w, "\t*) words_=(%s)\n", strings.Join((*command)(nil).flagNames(), " "))
+		fmt.Fprintf(w, "\t\t(( CURRENT == 2 )) && [[ $PREFIX != -* ]] && { compadd -- %s; return } ;;\n", strings.Join(names, " "))
+		fmt.Fprintf(w, "\tesac\n")
+		fmt.Fprintf(w, "\tif [[ $PREFIX == -* ]]; then\n")
+		fmt.Fprintf(w, "\t\tcompadd -- $words_\n")
+		fmt.Fprintf(w, "\telse\n")
+		fmt.Fprintf(w, "\t\t_files\n")
+		fmt.Fprintf(w, "\tfi\n")
+		fmt.Fprintf(w, "}\n")
+		fmt.Fprintf(w, "compdef %s %s\n", fn, name)
+	case "powershell":
+		quote := func(words []string) string {
+			quoted := make([]string, len(words))
+			for i, word := range words {
+				quoted[i] = "'" + word + "'"
+			}
+			return "@(" + strings.Join(quoted, ", ") + ")"
+		}
+		fmt.Fprintf(w, "# PowerShell completion for %s: %s completion powershell | Out-String | Invoke-Expression\n", name, name)
+		fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName '%s', '%s.exe' -ScriptBlock {\n", name, name)
+		fmt.Fprintf(w, "\tparam($wordToComplete, $commandAst, $cursorPosition)\n")
+		fmt.Fprintf(w, "\t$words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })\n")
+		fmt.Fprintf(w, "\t$count = $words.Count\n")
+		fmt.Fprintf(w, "\tif ($wordToComplete -ne '') { $count-- }\n")
+		fmt.Fprintf(w, "\t$prev = if ($count -ge 1) { $words[$count - 1] } else { '' }\n")
+		fmt.Fprintf(w, "\t$cmd = if ($words.Count -gt 1) { $words[1] } else { '' }\n")
+		fmt.Fprintf(w, "\t$values = @{\n")
+		for _, fl := range values {
+			fmt.Fprintf(w, "\t\t'-%s' = %s\n", fl, quote(flagValues[fl]))
+		}
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\t$flags = @{\n")
+		for _, c := range commands {
+			if c.name != "completion" {
+				fmt.Fprintf(w, "\t\t'%s' = %s\n", c.name, quote(c.flagNames()))
+			}
+		}
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\tif ($values.ContainsKey($prev)) {\n")
+		fmt.Fprintf(w, "\t\t$candidates = $values[$prev]\n")
+		fmt.Fprintf(w, "\t} elseif ($cmd -eq 'completion') {\n")
+		fmt.Fprintf(w, "\t\t$candidates = %s\n", quote(completionShells))
+		fmt.Fprintf(w, "\t} elseif ($flags.ContainsKey($cmd)) {\n")
+		fmt.Fprintf(w, "\t\t$candidates = $flags[$cmd]\n")
+		fmt.Fprintf(w, "\t} elseif ($count -le 1 -and -not $wordToComplete.StartsWith('-')) {\n")
+		fmt.Fprintf(w, "\t\t$candidates = %s\n", quote(names))
+		fmt.Fprintf(w, "\t} else {\n")
+		fmt.Fprintf(w, "\t\t$candidates = %s\n", quote((*command)(nil).flagNames()))
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "\tif (-not $values.ContainsKey($prev) -and $cmd -ne 'completion' -and -not $wordToComplete.StartsWith('-') -and $count -gt 1) { return }\n")
+		fmt.Fprintf(w, "\t$candidates | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+		fmt.Fprintf(w, "\t\t[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+		fmt.Fprintf(w, "\t}\n")
+		fmt.Fprintf(w, "}\n")
+	default:
+		return fmt.Errorf("no completion for shell %s; give one of %s", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
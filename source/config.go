@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// configExcluded lists flags that control config handling itself, -version,
+// the passwords, -resume, which only makes sense for one run, and -quiet,
+// -textcols and -quotes, which are -q, -text and -quote with -strip-quotes
+// by other names, which are neither loaded from nor written to a config file.
+var configExcluded = map[string]bool{"config": true, "dump-config": true, "version": true, "password": true, "tpassword": true, "template-password": true, "resume": true, "quiet": true, "textcols": true, "quotes": true}
+
+// loadConfig sets flags from a JSON object keyed by flag name, skipping any
+// flag that was given explicitly on the command line, and any that is null
+// or an empty list, as an unset list flag is written.
+func loadConfig(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(fl *flag.Flag) { explicit[fl.Name] = true })
+	for name, value := range values {
+		if flag.Lookup(name) == nil || configExcluded[name] {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if explicit[name] || value == nil {
+			continue
+		}
+		// A list sets a repeatable flag once per element
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, v := range list {
+			if err := flag.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: option %q: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stringList is a repeatable flag collecting comma separated values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// Get returns the values, an empty list rather than nil when there are
+// none, so that writeConfig writes [] and not null.
+func (l *stringList) Get() interface{} {
+	return append([]string{}, *l...)
+}
+
+// writeConfig writes the value of every flag, including defaults, as a JSON
+// object that loadConfig accepts.
+func writeConfig(w io.Writer) error {
+	values := make(map[string]interface{})
+	flag.VisitAll(func(fl *flag.Flag) {
+		if !configExcluded[fl.Name] {
+			values[fl.Name] = fl.Value.(flag.Getter).Get()
+		}
+	})
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// repeatedString is a repeatable flag whose values are kept whole, for
+// values that may themselves contain commas.
+type repeatedString []string
+
+func (r *repeatedString) String() string {
+	return strings.Join(*r, "; ")
+}
+
+func (r *repeatedString) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// Get returns the values, an empty list when there are none, as
+// stringList.Get does.
+func (r *repeatedString) Get() interface{} {
+	return append([]string{}, *r...)
+}
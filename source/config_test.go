@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configFlags replaces the command line flags, for the duration of the
+// test, with a few of each kind of flag a config file holds.
+func configFlags(t *testing.T) (inputs, patterns *stringList, vars *repeatedString, sheet *string, force *bool) {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("csv2XLsheet", flag.ContinueOnError)
+	inputs, patterns, vars = new(stringList), new(stringList), new(repeatedString)
+	flag.Var(inputs, "i", "")
+	flag.Var(patterns, "watch-pattern", "")
+	flag.Var(vars, "var", "")
+	sheet = flag.String("s", "", "")
+	force = flag.Bool("force", false, "")
+	return inputs, patterns, vars, sheet, force
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{"defaults", nil},
+		{"set", []string{"-i", "a.csv,b.csv", "-var", "CASE=IR-1", "-var", "NOTE=a, b", "-watch-pattern", "*.csv", "-s", "TLN", "-force"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			inputs, patterns, vars, sheet, force := configFlags(t)
+			if err := flag.CommandLine.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			var dump bytes.Buffer
+			if err := writeConfig(&dump); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(dump.String(), "null") {
+				t.Errorf("dump holds null:\n%s", dump.String())
+			}
+			want := []interface{}{append([]string{}, *inputs...), append([]string{}, *patterns...), append([]string{}, *vars...), *sheet, *force}
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, dump.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			inputs, patterns, vars, sheet, force = configFlags(t)
+			if err := loadConfig(path); err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			got := []interface{}{append([]string{}, *inputs...), append([]string{}, *patterns...), append([]string{}, *vars...), *sheet, *force}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("loaded %q, want %q, from\n%s", got, want, dump.String())
+			}
+		})
+	}
+}
+
+func TestLoadConfigSkipsNull(t *testing.T) {
+	inputs, _, vars, _, _ := configFlags(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"i": null, "var": [], "s": ""}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(path); err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(*inputs) != 0 || len(*vars) != 0 {
+		t.Errorf("null and [] loaded as -i %q and -var %q", *inputs, *vars)
+	}
+}
@@ -1,209 +1,1161 @@
 package main
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
+	// The zone database for -tz-in and -tz-out where the system has none,
+	// as on Windows
+	_ "time/tzdata"
+
 	"github.com/xuri/excelize/v2"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// Exit statuses besides 0, so that scripts can tell how a run went without
+// reading its messages. Other fatal errors exit with 1 through log.Fatal,
+// and the flag package exits with 2 on an invalid command line, so these
+// start at 3 to stay apart from both.
+const (
+	exitLineErrors  = 3   // the output was saved, but some lines or input files were not appended
+	exitInput       = 4   // an input file could not be found, opened or read
+	exitTemplate    = 5   // the template could not be opened, or its sheet not used
+	exitSave        = 6   // the output, its checksum or manifest or the error log could not be written
+	exitInterrupted = 130 // Ctrl-C stopped the run, as a shell reports SIGINT
+)
+
+// Environment variables read for passwords not given on the command line,
+// which keeps them out of the shell history.
+const (
+	passwordEnv         = "CSV2XL_PASSWORD"
+	templatePasswordEnv = "CSV2XL_TEMPLATE_PASSWORD"
 )
 
+// intro is the first paragraph of the help.
+const intro = "Appends data from CSV/TSV files onto an existing Excel (XLSX,XLTX,XLSM,XLTM) sheet.\nWorks with tables, pivot tables and slicers.\nLine input errors are ignored and logged.\nField contents, including embedded quotation marks, are kept as parsed."
+
+// usageFlags are the flags in the order the usage line lists them.
+var usageFlags = strings.Split("-i,-f,-query,-t,-s,-create,-create-header,-sheet-copy,-clone-sheet,-split-by,-var,-split,-o,-o-format,-each,-watch,-watch-pattern,-serve,-rules,-job,-j,-force,-backup,-log,-log-format,-no-log,-d,-enc,-quote,-comment,-skip-blank,-r,-e,-n,-head,-sample,-c,-header-row,-insert,-mode,-chunk-size,-stream,-max-mem,-workers,-checkpoint,-resume,-relative-to,-dry-run,-strict,-ragged,-max-errors,-strict-exit,-checksum,-manifest,-export-ndjson,-notify-url,-verify-sha256,-password,-tpassword,-template-password,-cols,-drop-cols,-map,-flatten,-flatten-fields,-decode,-enrich,-where,-exclude,-dedupe,-dedupe-cols,-incremental,-keep-headers,-intersect-headers,-keep-unmatched,-lock-schema,-infer,-locale,-autofit,-autofit-max,-width,-freeze,-autofilter,-as-table,-check-print-area,-extend-print-area,-extend-validation,-coerce,-text,-textcols,-date-cols,-date-fmt,-date-layout,-tz-in,-tz-out,-formula,-style,-copy-style,-highlight,-highlight-color,-defang,-transforms,-sanitize-formulas,-link-cols,-iocs,-truncate-marker,-overflow-sheet,-summary,-summary-cols,-summary-top,-provenance,-validate,-src-col,-src-label,-annotate,-time-cols,-strip-quotes,-quotes,-trim,-reverse,-sort-by,-sort-order,-sort-sheet,-bench,-cpuprofile,-memprofile,-v,-vv,-msg-format,-q,-quiet,-config,-dump-config,-version,-h", ",")
+
 func main() {
 	// Define command-line flags
-	sourceFile := flag.String("i", "", "Path to the source CSV/TSV file (required)")
+	var sourceFiles stringList
+	flag.Var(&sourceFiles, "i", "Path or glob pattern of a source CSV/TSV file, a zip archive member as archive.zip:member, an https:// or s3:// URL, or - for standard input; repeat or comma separate for several, appended in order (default: standard input when it is piped)")
+	format := flag.String("f", "csv", "Format of the input files (options: 'csv' for delimited text, 'json' or 'jsonl' for a JSON array of objects or JSON Lines, 'parquet' for Parquet files, 'l2tcsv' for Plaso l2tcsv output) (default: 'csv')")
+	query := flag.String("query", "", "SQL query to run on each input SQLite database, whose result rows are appended like CSV lines under a header of the column names")
 	templateFile := flag.String("t", "", "Path to the Excel template file (required)")
 	sheetName := flag.String("s", "", "Sheet name to write data to (required)")
-	delimiter := flag.String("d", "csv", "Delimiter for the input file (options: 'csv', 'tab', or any single character) (default: 'csv')")
-	outputFile := flag.String("o", "", "Output file name (required)")
+	createSheet := flag.Bool("create", false, "Create the sheet given by -s when the template does not have it")
+	createHeader := flag.Bool("create-header", false, "With -create, start a created sheet with the first input line as a bold header row frozen above the data")
+	sheetCopy := flag.String("sheet-copy", "", "Append to a new copy of the -s sheet with this name, leaving the original as it is; {time} stands for the time of the run and {input} for the first input file's name, e.g. 'Run {time}'")
+	cloneSheet := flag.Bool("clone-sheet", false, "Append each input file to its own copy of the -s sheet, named after the file, all in one output workbook")
+	splitBy := flag.String("split-by", "", "Append the lines to a sheet for each value of this input column, by number or header name, copying the -s sheet for values without one, e.g. 'Computer'")
+	var vars repeatedString
+	flag.Var(&vars, "var", "NAME=VALUE replacing the {{NAME}} placeholders in the template's cells, headers and footers, e.g. 'CASE=IR-2024-117'; repeat for several")
+	split := flag.Bool("split", true, "Continue on new sheets named '<sheet> (2)', '<sheet> (3)', ... once the sheet reaches Excel's row limit; -split=false stops with an error instead (default: true)")
+	delimiter := flag.String("d", "csv", "Delimiter for the input file (options: 'csv', 'tab', 'auto', 'bodyfile' for TSK bodyfiles, or any character or characters, such as '||') (default: 'csv')")
+	encoding := flag.String("enc", "", "Character encoding of the input files (options: 'utf-8', 'utf-16le', 'utf-16be', 'windows-1252', 'latin1'; 'utf8', 'utf16le', 'utf16be' and 'cp1252' also work) (default: UTF-8, UTF-16 when a byte order mark says so, Windows-1252 when not valid UTF-8)")
+	quoting := flag.String("quote", "lazy", "How quotation marks are read (options: 'lazy' to accept stray quotes, 'strict' to log malformed quoting as read errors, 'none' for unquoted input) (default: 'lazy')")
+	comment := flag.String("comment", "", "Ignore input lines starting with this single character, e.g. '#'")
+	skipBlank := flag.Bool("skip-blank", false, "Ignore input lines whose fields are all empty, such as ',,,'")
+	outputFile := flag.String("o", "", "Output file name, or a directory to name it after the first input file; {input} in the name stands for that file's name (required)")
+	each := flag.Bool("each", false, "Append each input file to its own copy of the template, saved under the -o directory or {input} name")
+	watchDir := flag.String("watch", "", "Keep running and append every new file that arrives in this directory to the -s sheet of the -o workbook, one after another")
+	var watchPatterns stringList
+	flag.Var(&watchPatterns, "watch-pattern", "With -watch, the file names to append, comma separated globs (default: '*.csv,*.tsv')")
+	serveAddr := flag.String("serve", "", "Run an HTTP service on this address, e.g. 'localhost:8080', that appends CSV files POSTed to /append to the template and returns the workbook")
+	rulesFile := flag.String("rules", "", "JSON rules file giving the sheet each file found in the -i directories, such as KAPE module output, is appended to, all in one output workbook")
+	jobPath := flag.String("job", "", "YAML or JSON job file listing input files and the sheet each is appended to, with options of their own, all in one output workbook saved once")
+	jobs := flag.Int("j", 1, "With -each, process this many input files at a time (default: 1)")
+	force := flag.Bool("force", false, "Replace the output file if it already exists")
+	backup := flag.Bool("backup", false, "Replace the output file if it already exists, keeping it first as <output>.bak-<time>.xlsx")
+	logFile := flag.String("log", "", "Error log file, or - for standard error; {input} in the name stands for the first input file's name (default: <output>-errors.log)")
+	logFormat := flag.String("log-format", "text", "Error log format (options: 'text', 'csv', 'json' for one object per line)")
+	noLog := flag.Bool("no-log", false, "Print rejected lines to standard error instead of writing an error log file")
+	endRow := flag.Int("e", 0, "Stop after this line number, inclusive (default: 0, read to the end)")
+	maxRows := flag.Int("n", 0, "Append at most this many lines from each input file (default: 0, no limit)")
+	head := flag.Int("head", 0, "Append only the first N lines of the whole run, reading no further, to preview a huge import (default: 0, no limit)")
+	sample := flag.Int("sample", 0, "Append N lines picked at random from the whole run, in input order, to preview a huge import (default: 0, every line)")
+	startCol := flag.String("c", "A", "Write the first field to this sheet column, given as a letter or number (default: 'A')")
+	mode := flag.String("mode", "append", "How to treat existing rows (options: 'append', 'overwrite' to clear the sheet from the -r row down first, 'replace' to clear the data below the header row first) (default: 'append')")
+	insertRow := flag.Int("insert", 0, "Insert the rows above this sheet row, moving the rows from it on down, instead of appending below the last row (default: 0, append)")
+	headerRow := flag.Int("header-row", 0, "Sheet row holding the column headings, which sets how many columns rows may fill (default: 0, the table header or the widest of the first 5 rows)")
 	startRow := flag.Int("r", 1, "Start importing data from this line number (default: 1)")
+	chunkSize := flag.Int("chunk-size", 0, "Append rows to the sheet every N input lines instead of buffering the whole file (default: 0, buffer everything; 10000 with -stream)")
+	stream := flag.Bool("stream", false, "Write the sheet through excelize's StreamWriter to cut memory use on large inputs (cannot be used with -sort-sheet)")
+	maxMem := flag.String("max-mem", "", "Spill the rows buffered for the sheet to a temporary file once they take more than this much memory, e.g. '512M' or '2G' (default: no limit)")
+	workers := flag.Int("workers", 0, "Goroutines converting rows to cells, typing, highlighting and scanning them for -iocs, while the input is read and the sheet written (default: 0, one per CPU; 1 does it all in turn)")
+	checkpointRows := flag.Int("checkpoint", 0, "Save the output and <output>.checkpoint.json every N rows appended, so that -resume can finish an interrupted run (default: 0, no checkpoints)")
+	resume := flag.Bool("resume", false, "Carry on from the -o output's checkpoint, left by an interrupted -checkpoint run of the same command")
+	ragged := flag.String("ragged", "error", "Lines with too few or too many fields (options: 'error' to append short lines as they are and log long ones, 'pad' to pad short lines with empty fields, 'truncate' to also cut long lines to the sheet's width) (default: 'error')")
+	strict := flag.Bool("strict", false, "Treat lines whose field count differs from the first line of the file as read errors, and stop when slicers or pivot tables would miss the appended rows")
+	strictExit := flag.Bool("strict-exit", false, "Stop without saving at the first line that fails or input file that is skipped")
+	maxErrors := flag.Int("max-errors", 0, "Abort the run once more than N lines have failed (default: 0, unlimited)")
+	checksum := flag.String("checksum", "", "Write a <output>.<algorithm> checksum sidecar for the saved file (options: 'sha256', 'sha1', 'md5', 'sha512')")
+	columns := flag.String("cols", "", "Input columns to write, in order, as 1-based numbers or ranges; columns may repeat, e.g. '3,1,7,7,9-12'")
+	dropCols := flag.String("drop-cols", "", "Input columns to leave out, as 1-based numbers, ranges or header names, e.g. 'Payload,12-14'")
+	columnMap := flag.String("map", "", "JSON file naming the input column or constant value each sheet column is written from")
+	flatten := flag.String("flatten", "", "Input column, by number or header name, of JSON or Windows event XML payloads whose -flatten-fields are added as columns, e.g. 'Payload'")
+	flattenFields := flag.String("flatten-fields", "", "With -flatten, the payload fields added at the end of each line, as dotted paths, comma separated, e.g. 'EventData.TargetUserName,System.EventID'")
+	var decode repeatedString
+	flag.Var(&decode, "decode", "Decode the base64, hex or URL encoded values of an input column, by number or header name, as COL:ENCODING in place or COL:ENCODING:new into a column after it, e.g. 'CommandLine:base64:new'; repeat for several columns")
+	var enrich repeatedString
+	flag.Var(&enrich, "enrich", "Add the columns of a CSV lookup table after an input column, by number or header name, holding the table's row for its value, as COL:FILE, e.g. 'EventID:eventids.csv'; repeat for several tables")
+	var where repeatedString
+	flag.Var(&where, "where", "Append only lines where COLUMN OP VALUE holds, OP one of =, !=, contains, startswith, matches, >, <, >=, <=, joined by && and ||; repeat to require several")
+	var exclude repeatedString
+	flag.Var(&exclude, "exclude", "Skip the lines where an expression as for -where holds; repeat to skip on any of several")
+	dedupe := flag.Bool("dedupe", false, "Skip rows that are already on the sheet or earlier in the input")
+	dedupeCols := flag.String("dedupe-cols", "", "Compare only these 1-based written columns when deduplicating, e.g. '1,4' (implies -dedupe)")
+	incremental := flag.Bool("incremental", false, "Skip rows already on the sheet, as often as each is there, but append repeats within the input, for re-importing a growing log")
+	keepHeaders := flag.Bool("keep-headers", false, "Append lines repeating the header instead of skipping them")
+	intersectHeaders := flag.Bool("intersect-headers", false, "Write only the columns whose headers appear in both the input file and the sheet")
+	keepUnmatched := flag.Bool("keep-unmatched", false, "With -intersect-headers, add input columns missing from the sheet header as new columns instead of dropping them")
+	lockSchema := flag.Bool("lock-schema", false, "Treat the first input file's header as canonical and reconcile later files' columns to it by name")
+	locale := flag.String("locale", "", "Write numbers and dates as native cells displayed for this locale (options: 'us', 'uk', 'eu', 'iso'), or read and display them as a language tag such as 'de-DE' writes them")
+	infer := flag.Bool("infer", false, "Write values that look like numbers, timestamps or true/false as native cells with ISO display formats")
+	autoFit := flag.Bool("autofit", false, "Widen the written columns to fit their longest value, up to 80 characters")
+	autoFitMax := flag.Int("autofit-max", 0, "Widest column -autofit makes, in characters (default: 80)")
+	width := flag.Float64("width", 0, "Set every written column to this width in characters (default: 0, keep the template widths)")
+	freeze := flag.Int("freeze", 0, "Freeze this many rows at the top of the sheet, e.g. 1 for the header row (default: 0, keep the template panes)")
+	autoFilter := flag.Bool("autofilter", false, "Set an AutoFilter over the sheet's header row and data")
+	asTable := flag.String("as-table", "", "Put the sheet's header row and data in a new banded Excel table of this name, unless they are in a table already")
+	checkPrintArea := flag.Bool("check-print-area", false, "Warn when the appended data extends beyond the sheet's print area")
+	extendPrintArea := flag.Bool("extend-print-area", false, "Grow the sheet's print area to cover the appended data")
+	extendValidation := flag.Bool("extend-validation", false, "Grow the sheet's data validations, such as drop-down lists, that cover its last data row over the appended rows")
+	coerce := flag.String("coerce", "", "Per-column cell types, e.g. '1:text,3:int,5:date:2006-01-02,7:bool'")
+	sourceColumn := flag.String("src-col", "", "Add a column naming the input file of each row (options: 'prepend', 'append')")
+	annotate := flag.String("annotate", "", "Record the input file and line of each row: 'comment' in a comment on its first cell, or 'columns' in Source File and Source Line columns after the header")
+	var sourceLabels stringList
+	flag.Var(&sourceLabels, "src-label", "Value of the -src-col column for each -i entry, in order, instead of the file name")
+	var timeCols stringList
+	flag.Var(&timeCols, "time-cols", "With merge, the timestamp column of each -i entry, in order, or one for all, by number or header name")
+	manifest := flag.Bool("manifest", false, "Write <output>.manifest.json with the SHA256 of the saved file, the input hashes and the row and skipped line counts")
+	exportNDJSON := flag.String("export-ndjson", "", "Also write the appended rows to this file as newline-delimited JSON, one object a row keyed by the sheet header, for SIEM ingestion")
+	notifyURL := flag.String("notify-url", "", "POST a JSON summary of the run, with the output, row and error counts and duration, to this webhook when it finishes")
+	var verifyHashes stringList
+	flag.Var(&verifyHashes, "verify-sha256", "SHA256 each -i entry must have, in order, checked before anything is imported; the import is aborted if one does not match")
+	var formulas repeatedString
+	flag.Var(&formulas, "formula", "Fill this formula down the appended rows as COL=EXPR, {row} standing for each row's number, e.g. 'G=B{row}&\"@\"&C{row}'; repeat for several columns")
+	numberFormat := flag.String("style", "", "Number format code for the written cells that no type option formats, e.g. 'yyyy-mm-dd hh:mm' or '@'")
+	highlight := flag.String("highlight", "", "File of keywords or IOCs, one per line, whose cells are filled when a written value contains one, ignoring case")
+	highlightColor := flag.String("highlight-color", "", "RGB or ARGB hex fill colour of the -highlight hits, e.g. 'FFCC0000' (default: 'FFFF00', yellow)")
+	var linkCols repeatedString
+	flag.Var(&linkCols, "link-cols", "Link the cells of columns to a URL made from their value, as COLS=URL with {value} in the URL, e.g. 'SHA256=https://www.virustotal.com/gui/file/{value}'; repeat for several URLs")
+	defangCols := flag.String("defang", "", "Columns whose URLs, IP addresses and domains are defanged, as hxxp://evil[.]com: numbers or sheet header names, comma separated")
+	transforms := flag.String("transforms", "", "JSON file of regular expression find and replace rules applied to the values of columns before they are written")
+	sanitizeFormulas := flag.Bool("sanitize-formulas", false, "Prefix values starting with =, +, -, @, tab or carriage return with a quote so they never become formulas")
+	iocSheet := flag.String("iocs", "", "Sheet to list the IP addresses, domains, URLs and MD5, SHA-1 and SHA-256 hashes found in the written values on, with the cells they are in")
+	truncateMarker := flag.String("truncate-marker", "[truncated]", "Text ending a value cut to the 32,767 characters a cell holds")
+	overflowSheet := flag.String("overflow-sheet", "", "Sheet to write the full text of the values cut to fit in a cell on, with the cells they are in, e.g. 'Overflow'")
+	summary := flag.Bool("summary", false, "Write an overview of the import, with the rows from each input file, error counts, timestamp spans and -summary-cols value counts, to a 'Summary' sheet")
+	summaryCols := flag.String("summary-cols", "", "With -summary, columns whose most frequent values are listed, by number or sheet header name, e.g. 'Computer,EventID'")
+	summaryTop := flag.Int("summary-top", 0, "How many of the most frequent values -summary lists for each -summary-cols column (default: 10)")
+	provenance := flag.Bool("provenance", false, "Record each input file, its SHA256 and MD5, row counts, operator, host, tool version, command line and UTC time on a hidden 'Import Log' sheet")
+	copyStyle := flag.Bool("copy-style", false, "Give the written cells the styles of the last data row already on the sheet")
+	validate := flag.Bool("validate", false, "Convert values to the dates and numbers the number formats of the last data row show, and count the values that do not convert")
+	text := flag.String("text", "", "Columns always written as text, by number or sheet header name, e.g. '2,ZipCode'")
+	flag.StringVar(text, "textcols", "", "Same as -text")
+	dateCols := flag.String("date-cols", "", "Columns of timestamps in mixed layouts (epoch, ISO 8601, MM/DD/YYYY, syslog, ...) to write as Excel dates, by number or sheet header name")
+	dateLayout := flag.String("date-layout", "", "Go time layout to read the -date-cols values with before the recognised layouts, e.g. '02/01/2006 15:04:05' for day first dates")
+	tzIn := flag.String("tz-in", "", "Time zone of the timestamps that carry no offset: an IANA zone such as America/New_York, UTC, Local or +05:30 (default: UTC)")
+	tzOut := flag.String("tz-out", "", "Time zone to write the timestamps in, as for -tz-in (default: UTC)")
+	dateFormat := flag.String("date-fmt", "", "Display format of the -date-cols dates, e.g. 'yyyy-mm-dd hh:mm:ss.000' (default: 'yyyy-mm-dd hh:mm:ss', or the -locale date and time)")
+	trim := flag.Bool("trim", false, "Remove leading and trailing whitespace, byte order marks and zero-width spaces from every field")
+	stripQuotes := flag.Bool("strip-quotes", false, "Remove every quotation mark from the parsed fields (the behaviour of earlier versions)")
+	quotes := flag.String("quotes", "", "Quotation marks in one flag (options: 'keep' as -quote lazy, the default, 'strip' as -strip-quotes, 'rfc4180' as -quote strict)")
+	reverse := flag.Bool("reverse", false, "Append the input rows in reverse file order, last line first, after -n and -head picked them (buffers the whole file)")
+	sortBy := flag.String("sort-by", "", "Sort the appended rows by this column, by number or sheet header name, before writing them, e.g. 'Timestamp'")
+	sortOrder := flag.String("sort-order", "asc", "Order of -sort-by (options: 'asc', 'desc')")
+	sortSheet := flag.String("sort-sheet", "", "After appending, sort all data rows below the header by these columns, e.g. '3,1:desc'")
+	showVersion := flag.Bool("version", false, "Print the version, commit and build date of this build and exit")
+	bench := flag.Bool("bench", false, "Report the time spent opening, reading, writing and saving, the read and write throughput and the peak heap at the end")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the run to this file, for go tool pprof")
+	memProfile := flag.String("memprofile", "", "Write a memory profile of the run to this file at the end, for go tool pprof")
+	verbose := flag.Bool("v", false, "Verbose: also report each input file, detected delimiters, table resizing and per-file row counts")
+	veryVerbose := flag.Bool("vv", false, "Very verbose: as -v, and also report each line filtered out, duplicate skipped and chunk of rows written")
+	msgFormat := flag.String("msg-format", "text", "Format of the messages and summary on stderr (options: 'text', 'json' for one object per line)")
+	quiet := flag.Bool("q", false, "Quiet: print nothing but fatal errors")
+	flag.BoolVar(quiet, "quiet", false, "Same as -q")
+	configFile := flag.String("config", "", "JSON file of flag values, keyed by flag name; command-line flags take precedence")
+	dumpConfig := flag.Bool("dump-config", false, "Print the effective configuration as JSON and exit")
+	password := flag.String("password", "", "Encrypt the output workbook with this password (default: $"+passwordEnv+")")
+	templatePassword := flag.String("tpassword", "", "Password of an encrypted template (default: $"+templatePasswordEnv+")")
+	flag.StringVar(templatePassword, "template-password", "", "Same as -tpassword")
+	outputFormat := flag.String("o-format", "xlsx", "Format of the output file (options: 'xlsx' for the workbook, 'csv' for the appended rows as converted, mapped and filtered, as CSV) (default: 'xlsx')")
+	dryRun := flag.Bool("dry-run", false, "Read and check the input and report what would be appended, without saving the output file")
+	relativeTo := flag.String("relative-to", "", "Base directory for resolving relative input, template, output and other file paths")
+
+	// A command, such as merge, comes before the flags it takes
+	var cmd *command
+	if len(os.Args) > 1 {
+		if cmd = findCommand(os.Args[1]); cmd != nil {
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+	merge := cmd != nil && cmd.name == "merge"
 
-    // Customize the help message
-    flag.Usage = func() {
-        fmt.Println("Appends data from CSV/TSV files onto an existing Excel (XLSX,XLTX) sheet.\nWorks with tables, pivot tables and slicers.\nLine input errors are ignored and logged.\nQuotation marks are removed during processing.")
-        fmt.Printf("\nUsage: %s [-i,-t,-s,-o,-d,-r,-h]\n\n", os.Args[0])
-        fmt.Println("\nOptions:")
-        fmt.Println("  -i  Input Path to the source CSV/TSV file (required)")
-        fmt.Println("  -t  Path to the Excel XLSX/XLTX file (required)")
-        fmt.Println("  -s  Existing sheet name to append lines (required)")
-        fmt.Println("  -o  Output file name (required)")
-        fmt.Println("  -d  Delimiter of input file (options: 'csv', 'tab', or character(s)) (default: 'csv')")
-        fmt.Println("  -r  Start appending sheet from this line number (default: 1)")
-        fmt.Println("  -h  Show this help message")
-        fmt.Println("\n Example: Appends CSV file prc.csv to a sheet named Pf-Table\n in an excel template named PfSlicer.xltx starting at line 2\n and outputs a file named pfoutput.xlsx \n\n\tcsv2XLsheet -i prc.csv -t PfSlicer.xltx -s Pf-Table -r 2 -o pfoutput.xlsx\n")
-    }
+	// Customize the help message, listing only the flags of a command
+	flag.Usage = func() {
+		option := func(line string) {
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "  -"), "  ")
+			if cmd.takes(name) {
+				fmt.Println(line)
+			}
+		}
+		if cmd != nil {
+			fmt.Printf("Usage: %s %s [%s] %s\n\n%s\n", os.Args[0], cmd.name, strings.Join(cmd.usageFlags(usageFlags), ","), cmd.args, cmd.summary)
+		} else {
+			fmt.Println(intro)
+			fmt.Printf("\nUsage: %s [command] [%s]\n\n", os.Args[0], strings.Join(usageFlags, ","))
+			fmt.Println("\nRun without flags on a terminal to be asked for the input, template and sheet step by step.")
+			fmt.Println("\nCommands:")
+			for _, c := range commands {
+				fmt.Printf("  %s  %s\n", strings.TrimSpace(c.name+" "+c.args), c.summary)
+			}
+		}
+		fmt.Println("\nOptions:")
+		option("  -i  Input Path to the source CSV/TSV file or glob pattern, archive.zip:member for a zip member, an https:// or s3:// URL, or - for stdin; repeat or comma separate for several (default: stdin when piped)")
+		option("  -f  Input format (options: 'csv', 'json' or 'jsonl' for a JSON array of objects or one object per line, 'parquet', 'l2tcsv') (default: 'csv')")
+		option("  -query  SQL query whose result is appended from each input SQLite database, e.g. 'SELECT url, title FROM urls'")
+		option("  -t  Path to the Excel XLSX/XLTX file, or XLSM/XLTM with macros (required)")
+		option("  -s  Existing sheet name to append lines (required)")
+		option("  -create  Create the -s sheet when it does not exist in the template")
+		option("  -create-header  With -create, start a created sheet with the first input line as a bold, frozen header row")
+		option("  -sheet-copy  Copy the -s sheet to this new name and append there, e.g. 'Run {time}' ({time} is the run's date and time, {input} the first input's name)")
+		option("  -clone-sheet  Give each input file its own copy of the -s sheet, named after the file, in the one output workbook")
+		option("  -split-by  Give each value of this input column, by number or header name, its own sheet, copied from the -s sheet, e.g. 'Computer'")
+		option("  -var  Replace {{NAME}} in the template's cells, headers and footers, as NAME=VALUE, e.g. 'ANALYST=J. Doe' (repeatable)")
+		option("  -split  Continue on new sheets '<sheet> (2)', '<sheet> (3)', ... when the sheet reaches 1,048,576 rows; -split=false stops with an error instead (default: true)")
+		option("  -o  Output file name, or a directory for <input>.xlsx; {input} in the name is replaced by the first input's name; .ods saves OpenDocument through LibreOffice (required)")
+		option("  -o-format  Output format: 'xlsx' for the workbook, or 'csv' for the appended rows as converted, mapped and filtered; -t is then optional (default: 'xlsx')")
+		option("  -each  Write a separate output workbook for each input file, named by the -o directory or {input} (default: one workbook for all inputs)")
+		option("  -watch  Watch this directory and append each new file to the -s sheet of the -o workbook as it arrives, until Ctrl-C")
+		option("  -watch-pattern  With -watch, the files to append, comma separated globs such as '*_Output.csv' (default: '*.csv,*.tsv')")
+		option("  -serve  Serve HTTP on this address, e.g. 'localhost:8080': POST files to /append to get them appended to the template as a workbook")
+		option("  -rules  JSON rules file giving the sheet each file found in the -i directories, e.g. KAPE module output, is appended to, in one workbook")
+		option("  -job  YAML or JSON job file listing input files and the sheet each is appended to, with options of their own, in one workbook saved once")
+		option("  -j  With -each, process up to N input files at once (default: 1)")
+		option("  -force  Replace the output file if it already exists (default: refuse to)")
+		option("  -backup  Replace an existing output file only after keeping it as <output>.bak-<time>.xlsx, e.g. case42.bak-20261014-093000.xlsx")
+		option("  -log  Path of the error log, or - for stderr, {input} standing for the first input file's name (default: the output name with -errors.log)")
+		option("  -log-format  Format of the error log: 'text', 'csv' or 'json', one object per line (default: 'text')")
+		option("  -no-log  Print rejected lines and skipped files to standard error instead of an error log file")
+		option("  -d  Delimiter of input file (options: 'csv', 'tab', 'auto', 'bodyfile', or character(s)) (default: 'csv')")
+		option("  -enc  Encoding of input file (options: 'utf-8', 'utf-16le', 'utf-16be', 'windows-1252', 'latin1'; 'utf8', 'utf16le', 'utf16be' and 'cp1252' also work) (default: UTF-8, UTF-16 by byte order mark, Windows-1252 when not valid UTF-8)")
+		option("  -quote  Quote handling (options: 'lazy', 'strict', 'none' to read every quotation mark literally) (default: 'lazy')")
+		option("  -comment  Ignore input lines starting with this character, e.g. '#'")
+		option("  -skip-blank  Ignore input lines whose fields are all empty")
+		option("  -r  Start appending sheet from this line number (default: 1)")
+		option("  -e  Stop reading after this line number, inclusive (default: 0, read to the end)")
+		option("  -n  Append at most this many lines from each input file, starting at -r (default: 0, no limit)")
+		option("  -head  Append only the first N lines of all the input files together and stop reading, for a quick preview (default: 0, no limit)")
+		option("  -sample  Append N lines picked at random from all the input files, kept in input order, for a preview (default: 0, every line)")
+		option("  -c  Start writing each row at this sheet column, as a letter like 'C' or a number (default: 'A')")
+		option("  -header-row  Sheet row with the column headings, for templates with a title banner above them (default: the table header, else the widest of rows 1-5)")
+		option("  -insert  Insert the rows above this sheet row, moving the existing rows from it on down (default: 0, append at the bottom)")
+		option("  -mode  'append' below existing rows, 'overwrite' to clear the sheet from the -r row down and write there, or 'replace' to clear the data below the header row and write there (default: 'append')")
+		option("  -chunk-size  Append rows every N input lines to bound memory (default: 0, buffer the whole file; 10000 with -stream)")
+		option("  -stream  Stream rows into the sheet, appending every 10000 lines, to cut memory use on large inputs (not with -sort-sheet)")
+		option("  -max-mem  Spill the rows buffered for the sheet to a temporary file beyond this much memory, e.g. '512M' (default: no limit)")
+		option("  -workers  Goroutines converting rows to cells while the input is read and the sheet written (default: 0, one per CPU; 1 for none)")
+		option("  -checkpoint  Save the output and <output>.checkpoint.json every N rows, so an interrupted run can be resumed (default: 0, none)")
+		option("  -resume  Continue an interrupted -checkpoint run from the output's checkpoint; give the same command with -resume added")
+		option("  -relative-to  Base directory for relative input, template, output and other file paths (absolute paths are used as given)")
+		option("  -dry-run  Read and check the input and print the summary without saving the output file")
+		option("  -ragged  Lines with too few or too many fields: 'error' appends short ones and logs long ones, 'pad' pads short ones with empty fields, 'truncate' also cuts long ones to the sheet (default: 'error')")
+		option("  -strict  Log lines whose field count differs from the file's first line as read errors (default: any field count is read); stop when slicers or pivot tables would miss the appended rows")
+		option("  -max-errors  Abort without saving once more than N lines have failed (default: 0, unlimited)")
+		option("  -strict-exit  Stop without saving, exit status 1, at the first failed line or skipped file")
+		option("  -checksum  Write a checksum sidecar <output>.<algorithm> after saving (options: 'sha256', 'sha1', 'md5', 'sha512')")
+		option("  -manifest  Write <output>.manifest.json after saving, with the output's SHA256, the input hashes and the row and skipped line counts")
+		option("  -export-ndjson  Also write the appended rows to this file as newline-delimited JSON keyed by the sheet header, for Elastic or Splunk")
+		option("  -notify-url  POST a JSON completion summary to this webhook URL, e.g. a Slack or Teams incoming webhook, when the run finishes")
+		option("  -verify-sha256  SHA256 of each -i entry, in order, comma separated; nothing is imported unless every input matches")
+		option("  -password  Encrypt the output workbook with this password (default: $CSV2XL_PASSWORD)")
+		option("  -tpassword  Password of an encrypted template (default: $CSV2XL_TEMPLATE_PASSWORD)")
+		option("  -template-password  Same as -tpassword")
+		option("  -cols  Write only these 1-based input columns or ranges, in this order, e.g. '3,1,7,7,9-12' (columns may repeat)")
+		option("  -drop-cols  Leave out these input columns: 1-based numbers, ranges or header names, e.g. 'Payload,12-14'")
+		option("  -flatten  Expand the JSON or event XML payload in this input column, by number or header name, into -flatten-fields columns")
+		option("  -flatten-fields  Payload fields added as columns after the input's own, dotted paths such as 'EventData.TargetUserName', comma separated")
+		option("  -decode  Decode an input column's values: COL:ENCODING in place or COL:ENCODING:new after it, with base64, hex or url (repeatable)")
+		option("  -enrich  Add the columns of a CSV lookup table keyed on an input column after it, as COL:FILE, e.g. 'EventID:eventids.csv' (repeatable)")
+		option("  -map  JSON file mapping sheet columns to input columns, by number or header name, or to constant values")
+		option("  -where  Append only lines matching 'COLUMN OP VALUE', COLUMN a number or header name, OP one of =, !=, contains, startswith, matches, >, <, >=, <=; join with && and || (repeat to AND)")
+		option("  -exclude  Skip the lines matching an expression as for -where (repeat to skip on any)")
+		option("  -dedupe  Skip rows already on the sheet or earlier in the input")
+		option("  -dedupe-cols  Compare only these 1-based written columns when deduplicating, e.g. '1,4' (implies -dedupe)")
+		option("  -incremental  Skip rows already on the sheet, as often as each is there, but append repeats within the input, for re-importing a growing log")
+		option("  -keep-headers  Append lines repeating the header instead of skipping them")
+		option("  -intersect-headers  Align columns by header name, dropping input columns missing from the sheet header")
+		option("  -keep-unmatched  With -intersect-headers, add unmatched input columns after the last sheet column instead of dropping them")
+		option("  -lock-schema  Reconcile every input file's columns by name to the first file's header")
+		option("  -infer  Write numbers, timestamps and true/false as native cells instead of text (ISO display unless -locale is given)")
+		option("  -locale  Write numbers and dates as native cells formatted for 'us', 'uk', 'eu' or 'iso' display, or read as a tag such as 'de-DE' writes them")
+		option("  -autofit  Widen the written columns to fit their longest value, up to 80 characters")
+		option("  -autofit-max  Widest column -autofit makes, in characters (default: 80)")
+		option("  -width  Set every written column to this width in characters")
+		option("  -freeze  Freeze this many rows at the top of the sheet, e.g. 1 for the header row")
+		option("  -autofilter  Set an AutoFilter over the sheet's header row and data")
+		option("  -as-table  Put the sheet's header row and data in a new banded Excel table of this name, unless they are in a table already")
+		option("  -check-print-area  Warn when the appended data extends beyond the sheet's print area")
+		option("  -extend-print-area  Grow the sheet's print area to cover the appended data")
+		option("  -extend-validation  Grow the sheet's data validations, such as drop-down lists, that cover its last data row over the appended rows")
+		option("  -coerce  Per-column cell types: COL:text|int|float|bool|date[:layout], comma separated")
+		option("  -text  Columns always written as text, keeping leading zeros: numbers or sheet header names, comma separated")
+		option("  -textcols  Same as -text")
+		option("  -date-cols  Columns of timestamps to write as Excel dates from epoch, ISO 8601, MM/DD/YYYY, RFC 1123 or syslog layouts: numbers or sheet header names")
+		option("  -date-fmt  Number format code for the -date-cols dates (default: 'yyyy-mm-dd hh:mm:ss', or the -locale date and time)")
+		option("  -date-layout  Go time layout to read the -date-cols values with before the recognised layouts, e.g. '02/01/2006 15:04:05'")
+		option("  -tz-in  Time zone of the timestamps that carry no offset: an IANA zone such as America/New_York, UTC, Local or +05:30 (default: UTC)")
+		option("  -tz-out  Time zone to write the timestamps of -date-cols, -coerce date and typed inputs in (default: UTC)")
+		option("  -formula  Write a formula into column COL of every appended row, given as COL=EXPR with {row} for the row number (repeatable)")
+		option("  -style  Number format code for the written cells that have none from -infer, -locale, -coerce or -text, e.g. '@'")
+		option("  -copy-style  Give the written cells the styles (font, fill, borders, format) of the sheet's last data row")
+		option("  -highlight  File of keywords or IOCs, one per line, whose cells are filled when a written value contains one")
+		option("  -highlight-color  RGB or ARGB hex fill colour of the -highlight hits, e.g. 'FFCC0000' (default: 'FFFF00', yellow)")
+		option("  -defang  Columns whose URLs, IP addresses and domains are defanged, as hxxp://evil[.]com: numbers or sheet header names")
+		option("  -transforms  JSON file of regular expression find and replace rules applied to the values of columns before they are written")
+		option("  -sanitize-formulas  Prefix values starting with =, +, -, @, tab or carriage return with a quote so they never become formulas")
+		option("  -link-cols  Link the cells of columns, by number or sheet header name, to a URL made from their value: COLS=URL with {value} (repeatable)")
+		option("  -iocs  Sheet to list the IP addresses, domains, URLs and MD5, SHA-1 and SHA-256 hashes in the written values on, e.g. 'IOCs'")
+		option("  -truncate-marker  Text ending a value cut to the 32,767 characters a cell holds (default: '[truncated]')")
+		option("  -overflow-sheet  Sheet to write the full text of the values cut to fit in a cell on, instead of the error log, e.g. 'Overflow'")
+		option("  -summary  Write an overview of the import to a 'Summary' sheet: rows per input file, error counts, first and last timestamps per sheet")
+		option("  -summary-cols  With -summary, list the most frequent values of these columns, by number or sheet header name, e.g. 'Computer,EventID'")
+		option("  -summary-top  How many values -summary-cols lists for each column (default: 10)")
+		option("  -provenance  Record each input file, its SHA256 and MD5, row counts, operator, host, version and command line on a hidden 'Import Log' sheet")
+		option("  -validate  Write values as the dates or numbers the last data row's number formats show; count and log the values that do not match")
+		option("  -src-col  Add a column with each row's input file name: 'prepend' in the first column or 'append' after the header")
+		option("  -src-label  Labels to write in the -src-col column instead of file names, one per -i entry, comma separated")
+		option("  -annotate  Record each row's input file and line: 'comment' on its first cell, or 'columns' Source File and Source Line after the header")
+		option("  -time-cols  With merge, the timestamp column of each -i entry, by number or header name, comma separated; one applies to all")
+		option("  -strip-quotes  Remove every quotation mark from the parsed fields, as earlier versions always did")
+		option("  -quotes  Quotation marks in one flag: 'keep' as -quote lazy, 'strip' as -strip-quotes, 'rfc4180' as -quote strict")
+		option("  -trim  Remove leading and trailing whitespace from every field")
+		option("  -reverse  Append rows in reverse file order, last line first, after -n and -head picked them (buffers the whole file)")
+		option("  -sort-by  Sort the appended rows by this column, by number or sheet header name, before writing them, e.g. 'Timestamp'")
+		option("  -sort-order  Order of -sort-by: 'asc' or 'desc' (default: 'asc')")
+		option("  -sort-sheet  After appending, sort existing and new rows by COL[:asc|desc] keys, comma separated")
+		option("  -bench  Report the time spent opening the template, reading the input, writing the sheet and saving, with throughput and peak heap")
+		option("  -cpuprofile  Write a CPU profile of the run to this file, for 'go tool pprof'")
+		option("  -memprofile  Write a memory profile of the run to this file when it ends, for 'go tool pprof'")
+		option("  -v  Verbose: also report each input file, detected delimiters, table resizing and per-file row counts")
+		option("  -vv  Very verbose: as -v, and also report each line filtered out, duplicate skipped and chunk of rows written")
+		option("  -msg-format  Format of the messages and summary on stderr: 'text' or 'json', one object per line with a level (default: 'text')")
+		option("  -q  Quiet: print nothing but fatal errors (check the exit status)")
+		option("  -quiet  Same as -q")
+		option("  -config  JSON file of flag values keyed by flag name (command-line flags take precedence)")
+		option("  -dump-config  Print the effective configuration as JSON for use with -config, then exit")
+		option("  -version  Print the version, git commit and build date, then exit")
+		option("  -h  Show this help message")
+		fmt.Println("\n Exit status:")
+		fmt.Println("  0  Output saved and every selected line appended")
+		fmt.Println("  1  Fatal error: bad option, -max-errors or -strict-exit tripped; nothing saved")
+		fmt.Println("  2  The command line could not be parsed")
+		fmt.Printf("  %d  Output saved, but some lines had read errors or too many fields, or an input file was skipped\n", exitLineErrors)
+		fmt.Printf("  %d  An input file could not be found, opened or read; nothing saved\n", exitInput)
+		fmt.Printf("  %d  The template could not be opened, or its sheet not used; nothing saved\n", exitTemplate)
+		fmt.Printf("  %d  The output, its checksum or manifest or the error log could not be written\n", exitSave)
+		fmt.Printf("  %d  Interrupted with Ctrl-C; nothing saved but the last -checkpoint\n", exitInterrupted)
+		if cmd != nil {
+			return
+		}
+		fmt.Print("\n Example: Appends CSV file prc.csv to a sheet named Pf-Table\n in an excel template named PfSlicer.xltx starting at line 2\n and outputs a file named pfoutput.xlsx \n\n\tcsv2XLsheet -i prc.csv -t PfSlicer.xltx -s Pf-Table -r 2 -o pfoutput.xlsx\n\n")
+	}
 
 	// Parse command-line flags
 	flag.Parse()
 
-	// Check if no parameters are passed
-	if len(os.Args) == 1 {
-		flag.Usage()
+	// Report the build without needing the other flags
+	if *showVersion {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+
+	// Without parameters, ask for them on a terminal and show the usage
+	// otherwise
+	if len(os.Args) == 1 && cmd == nil {
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			flag.Usage()
+			os.Exit(0)
+		}
+		args, err := runWizard(os.Stdin, os.Stderr)
+		if err != nil && !errors.Is(err, errWizardQuit) {
+			log.Fatalf("Interactive mode: %v", err)
+		}
+		if args == nil {
+			os.Exit(0)
+		}
+		os.Args = append(os.Args, args...)
+		flag.Parse()
+	}
+
+	// A command takes its own flags, and watch, serve and completion an
+	// argument after them
+	if cmd != nil {
+		if err := cmd.checkFlags(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		args := flag.Args()
+		if cmd.args != "" && len(args) != 1 {
+			log.Fatalf("The %s command needs %s after its flags: %s %s [flags] %s", cmd.name, cmd.args, programName(), cmd.name, cmd.args)
+		} else if cmd.args == "" && len(args) > 0 {
+			log.Fatalf("The %s command takes no arguments after its flags, but was given %s", cmd.name, args[0])
+		}
+		switch cmd.name {
+		case "completion":
+			if err := writeCompletion(os.Stdout, args[0]); err != nil {
+				log.Fatalf("%v", err)
+			}
+			os.Exit(0)
+		case "watch":
+			*watchDir = args[0]
+		case "serve":
+			*serveAddr = args[0]
+		case "validate":
+			*dryRun = true
+		}
+	}
+
+	// Flags typed on the command line, before the config file sets others
+	given := make(map[string]bool)
+	flag.Visit(func(fl *flag.Flag) { given[fl.Name] = true })
+
+	// Fill in flags not given on the command line from the config file
+	if *configFile != "" {
+		if err := loadConfig(*configFile); err != nil {
+			log.Fatalf("Failed to load config file: %v", err)
+		}
+	}
+
+	// -quotes is shorthand for -quote and -strip-quotes, so takes neither on
+	// the command line. It overrides those a config file set, and is applied
+	// before -dump-config, which writes the pair in its place.
+	if *quotes != "" {
+		for _, name := range []string{"quote", "strip-quotes"} {
+			if given[name] {
+				log.Fatalf("Flag -quotes sets -quote and -strip-quotes and cannot be combined with -%s", name)
+			}
+		}
+		switch *quotes {
+		case "keep":
+			*quoting, *stripQuotes = "lazy", false
+		case "strip":
+			*quoting, *stripQuotes = "lazy", true
+		case "rfc4180":
+			*quoting, *stripQuotes = "strict", false
+		default:
+			log.Fatalf("Invalid quotes: %s", *quotes)
+		}
+	}
+
+	if *dumpConfig {
+		if err := writeConfig(os.Stdout); err != nil {
+			log.Fatalf("Failed to write config: %v", err)
+		}
 		os.Exit(0)
 	}
 
+	// Messages and the summary go to stderr, leaving stdout for data, and
+	// on a terminal a progress line shows while text messages are
+	var stderr io.Writer = os.Stderr
+	var progress *progressLine
+	if !*quiet && !*each && *msgFormat == "text" {
+		if progress = newProgressLine(); progress != nil {
+			stderr = progress
+			log.SetOutput(progress)
+		}
+	}
+	messages, err := newConsole(stderr, *msgFormat, *verbose, *veryVerbose, *quiet)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	messages.logToConsole()
+	if (*verbose || *veryVerbose) && *quiet {
+		log.Fatal("Flags -v (verbose) and -q (quiet) cannot be combined")
+	}
+	messages.verbosef("%s\n", versionString())
+
+	// -log - is -no-log by another name
+	if *logFile == "-" {
+		*logFile, *noLog = "", true
+	}
+
+	// A job file names the inputs and sheets, and may name the template
+	// and output the command line does not
+	var jobSpec *jobFile
+	if *jobPath != "" {
+		if len(sourceFiles) > 0 || *sheetName != "" || *each || *rulesFile != "" {
+			log.Fatal("Flag -job names the inputs and sheets itself and cannot be combined with -i, -s, -each or -rules")
+		}
+		var err error
+		if jobSpec, err = loadJobs(resolvePath(*relativeTo, *jobPath)); err != nil {
+			log.Fatalf("Failed to load job file: %v", err)
+		}
+		if *templateFile == "" {
+			*templateFile = jobSpec.Template
+		}
+		if *outputFile == "" {
+			*outputFile = jobSpec.Output
+		}
+	}
+
+	// A watch finds its inputs as they arrive and saves them all to one
+	// workbook, each file below the one before
+	if *watchDir != "" {
+		switch {
+		case len(sourceFiles) > 0 || *each || *rulesFile != "" || jobSpec != nil:
+			log.Fatal("Flag -watch finds its own inputs and cannot be combined with -i, -each, -rules or -job")
+		case xlappend.OutputIsDir(resolvePath(*relativeTo, *outputFile)) || strings.Contains(*outputFile, xlappend.InputToken):
+			log.Fatal("Flag -watch appends every file to one workbook, so -o must name a file")
+		case *logFile != "" && !strings.Contains(*logFile, xlappend.InputToken):
+			log.Fatal("Flag -watch needs -log to contain " + xlappend.InputToken + ", so that every file gets its own error log")
+		case *mode != "append" || *sheetCopy != "":
+			log.Fatal("Flag -watch appends each file below the one before and cannot be combined with -mode overwrite or replace or -sheet-copy")
+		case *exportNDJSON != "" && !strings.Contains(*exportNDJSON, xlappend.InputToken):
+			log.Fatal("Flag -watch needs -export-ndjson to contain " + xlappend.InputToken + ", so that every file gets its own export")
+		}
+	} else if len(watchPatterns) > 0 {
+		log.Fatal("Flag -watch-pattern needs -watch")
+	}
+	if len(watchPatterns) == 0 {
+		watchPatterns = stringList{"*.csv", "*.tsv"}
+	}
+
+	// A service takes its inputs, sheet and options from each request and
+	// sends the workbook back
+	if *serveAddr != "" {
+		switch {
+		case len(sourceFiles) > 0 || *outputFile != "" || *each || *watchDir != "" || *rulesFile != "" || jobSpec != nil:
+			log.Fatal("Flag -serve takes its inputs from each request and returns the workbook, so it cannot be combined with -i, -o, -each, -watch, -rules or -job")
+		case *templateFile == "":
+			flag.Usage()
+			log.Fatal("\nFlag -serve needs -t, the Excel template or a directory of them")
+		}
+	}
+
+	// A merge interleaves the inputs by time into one timeline, each row
+	// naming its input, sorted and with its timestamps written as dates
+	// unless told otherwise
+	if merge {
+		switch {
+		case len(timeCols) == 0:
+			log.Fatal("The merge command needs -time-cols, the timestamp column of each -i entry")
+		case *each || *cloneSheet || *splitBy != "" || *watchDir != "" || *serveAddr != "" || *rulesFile != "" || jobSpec != nil:
+			log.Fatal("The merge command writes its inputs to one sheet and cannot be combined with -each, -clone-sheet, -split-by, -watch, -serve, -rules or -job")
+		}
+		if *sortBy == "" {
+			*sortBy = "1"
+		}
+		if *dateCols == "" {
+			*dateCols = "1"
+		}
+	} else if len(timeCols) > 0 {
+		log.Fatal("Flag -time-cols needs the merge command")
+	}
+
+	// A CSV output needs no template, and holds the rows of a single run
+	if *outputFormat != "xlsx" && *outputFormat != "csv" {
+		log.Fatalf("Invalid output format: %s", *outputFormat)
+	}
+	csvOutput := *outputFormat == "csv"
+	if csvOutput && (*serveAddr != "" || *watchDir != "") {
+		log.Fatal("Flag -o-format csv writes the rows of one run and cannot be combined with -serve or -watch")
+	}
+	if *exportNDJSON != "" && (*serveAddr != "" || *cloneSheet || *rulesFile != "" || jobSpec != nil) {
+		log.Fatal("Flag -export-ndjson writes the rows of one sheet and cannot be combined with -serve, -clone-sheet, -rules or -job")
+	}
+
+	if *notifyURL != "" {
+		if *serveAddr != "" {
+			log.Fatal("Flag -notify-url reports the end of a run and cannot be combined with -serve")
+		}
+		if messages.notify, err = newNotifier(*notifyURL, *dryRun); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	// Without -i, read the input piped in on stdin
+	if info, err := os.Stdin.Stat(); len(sourceFiles) == 0 && jobSpec == nil && *watchDir == "" && *serveAddr == "" && err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		sourceFiles = stringList{xlappend.StdinPath}
+	}
+
+	// A validation saves nothing, so without -o it checks against the
+	// template itself and prints rejected lines instead of logging them
+	if cmd != nil && cmd.name == "validate" && *outputFile == "" && *templateFile != "" {
+		*outputFile, *force = *templateFile, true
+		if *logFile == "" {
+			*noLog = true
+		}
+	}
+
 	// Check required flags are provided
-	if *sourceFile == "" || *templateFile == "" || *outputFile == "" || *sheetName == "" {
+	if *serveAddr == "" && ((len(sourceFiles) == 0 && *watchDir == "" || *sheetName == "" && *rulesFile == "" && !(csvOutput && *templateFile == "")) && jobSpec == nil || *templateFile == "" && !csvOutput || *outputFile == "") {
 		flag.Usage()
-		log.Fatal("\nFlags -i (input file), -t (Excel template), -s (Sheet name), and -o (Output file) must be specified")
+		log.Fatal("\nFlags -i (input file, or - for stdin), -t (Excel template), -s (Sheet name), and -o (Output file) must be specified")
 	}
 
-	csvFile := *sourceFile
-	excelTemplate := *templateFile
-	targetSheetName := *sheetName
-	outputFileName := *outputFile
-
 	// Convert delimiter based on the given input
-	var delim rune
-	switch *delimiter {
-	case "csv":
-		delim = ','
-	case "tab":
-		delim = '\t'
-	default:
-		if utf8.RuneCountInString(*delimiter) == 1 {
-			delim, _ = utf8.DecodeRuneInString(*delimiter)
-		} else {
-			log.Fatalf("Invalid delimiter: %s", *delimiter)
+	delim, separator, err := parseDelimiter(*delimiter)
+	if err != nil {
+		log.Fatalf("Invalid delimiter: %s", *delimiter)
+	}
+
+	var commentChar rune
+	if *comment != "" {
+		if utf8.RuneCountInString(*comment) != 1 {
+			log.Fatalf("Invalid comment character: %s", *comment)
 		}
+		commentChar, _ = utf8.DecodeRuneInString(*comment)
 	}
 
-	// Create consolidated log file name
-	logFileName := strings.TrimSuffix(outputFileName, filepath.Ext(outputFileName)) + "-errors.log"
-	var logFile *os.File
-	var hasErrors bool
-	var errorCount, notAppendedCount int
+	// Accept the start column as an Excel column letter or a number
+	col, err := parseColumn(*startCol)
+	if err != nil {
+		log.Fatalf("Invalid start column: %s", *startCol)
+	}
 
-	// Open the input file
-	file, err := os.Open(csvFile)
+	maxMemory, err := parseSize(*maxMem)
 	if err != nil {
-		log.Fatalf("Failed to open input file: %v", err)
-	}
-	defer file.Close()
-
-	// Read the input data with the specified delimiter
-	reader := csv.NewReader(file)
-	reader.Comma = delim
-	reader.LazyQuotes = true
-	var csvData [][]string
-
-	// Process each line and handle errors
-	lineNumber := 0
-	for {
-		record, err := reader.Read()
-		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			// Open the error log file if it's not already open
-			if !hasErrors {
-				hasErrors = true
-				logFile, err = os.Create(logFileName)
-				if err != nil {
-					log.Fatalf("Failed to create error log file: %v", err)
-				}
-				defer logFile.Close()
-			}
-			// Write the erroneous line to the error log
-			rawLine := strings.Join(record, string(reader.Comma))
-			_, _ = logFile.WriteString(fmt.Sprintf("Error reading line: %s\n", rawLine))
-			errorCount++
-			continue
-		}
-		if lineNumber >= *startRow-1 {
-			// Sanitize each field by removing quotation marks
-			for i := range record {
-				record[i] = strings.ReplaceAll(record[i], "\"", "")
+		log.Fatalf("Invalid memory limit: %s", *maxMem)
+	}
+
+	if *mode != "append" && *mode != "overwrite" && *mode != "replace" {
+		log.Fatalf("Invalid mode: %s", *mode)
+	}
+
+	// Several inputs written into one workbook are appended one at a time
+	if *jobs < 1 {
+		log.Fatalf("Invalid number of jobs: %d", *jobs)
+	}
+	if *jobs > 1 && !*each {
+		log.Fatal("Flag -j needs -each: inputs appended to one workbook are read one after another")
+	}
+	if *each && !xlappend.OutputIsDir(resolvePath(*relativeTo, *outputFile)) && !strings.Contains(*outputFile, xlappend.InputToken) {
+		log.Fatal("Flag -each needs -o to be a directory or to contain " + xlappend.InputToken + ", so that every input gets its own output file")
+	}
+	if *each && *logFile != "" && !strings.Contains(*logFile, xlappend.InputToken) {
+		log.Fatal("Flag -each needs -log to contain " + xlappend.InputToken + ", so that every input gets its own error log")
+	}
+	if *each && *exportNDJSON != "" && !xlappend.OutputIsDir(resolvePath(*relativeTo, *exportNDJSON)) && !strings.Contains(*exportNDJSON, xlappend.InputToken) {
+		log.Fatal("Flag -each needs -export-ndjson to be a directory or to contain " + xlappend.InputToken + ", so that every input gets its own export")
+	}
+	var rules []*sheetRule
+	if *rulesFile != "" {
+		if *sheetName != "" || *each {
+			log.Fatal("Flag -rules names the sheets itself and cannot be combined with -s or -each")
+		}
+		if *logFile != "" && !strings.Contains(*logFile, sheetToken) {
+			log.Fatal("Flag -rules needs -log to contain " + sheetToken + ", so that every rule gets its own error log")
+		}
+		for _, path := range sourceFiles {
+			if path == xlappend.StdinPath {
+				log.Fatal("Flag -rules walks the -i directories, so standard input cannot be one of them")
 			}
-			csvData = append(csvData, record)
 		}
-		lineNumber++
+		if rules, err = loadRules(resolvePath(*relativeTo, *rulesFile)); err != nil {
+			log.Fatalf("Failed to load rules: %v", err)
+		}
 	}
 
-	// Open the existing Excel template
-	f, err := excelize.OpenFile(excelTemplate)
-	if err != nil {
-		log.Fatalf("Failed to open Excel template: %v", err)
+	// Cloning the sheet copies it for every input, under the input's name
+	if *cloneSheet {
+		switch {
+		case *each || jobSpec != nil || *rulesFile != "" || *watchDir != "" || *serveAddr != "":
+			log.Fatal("Flag -clone-sheet copies the -s sheet for each -i file and cannot be combined with -each, -job, -rules, -watch or -serve")
+		case *sheetCopy != "":
+			log.Fatal("Flag -clone-sheet names each copy after its input; drop -sheet-copy")
+		case csvOutput:
+			log.Fatal("Flag -clone-sheet writes several sheets, which a CSV output cannot hold; drop -o-format csv")
+		}
 	}
 
-	// Check if the specified sheet exists
-	sheetExists := false
-	for _, name := range f.GetSheetList() {
-		if name == targetSheetName {
-			sheetExists = true
-			break
+	// Splitting by a column gives each of its values a sheet
+	if *splitBy != "" {
+		switch {
+		case *each || *cloneSheet || jobSpec != nil || *rulesFile != "" || *watchDir != "" || *serveAddr != "":
+			log.Fatal("Flag -split-by gives each value of the column its own sheet and cannot be combined with -each, -clone-sheet, -job, -rules, -watch or -serve")
+		case *sheetCopy != "":
+			log.Fatal("Flag -split-by names each sheet after its value; drop -sheet-copy")
+		case csvOutput:
+			log.Fatal("Flag -split-by writes several sheets, which a CSV output cannot hold; drop -o-format csv")
+		case *exportNDJSON != "":
+			log.Fatal("Flag -export-ndjson writes the rows of one sheet and cannot be combined with -split-by")
 		}
 	}
 
-	if !sheetExists {
-		log.Fatalf("Sheet '%s' does not exist in the template file!", targetSheetName)
+	if (*checkpointRows != 0 || *resume) && (*each || *cloneSheet || *splitBy != "" || jobSpec != nil || *rulesFile != "" || *watchDir != "" || *serveAddr != "") {
+		log.Fatal("Flags -checkpoint and -resume checkpoint a single workbook and cannot be combined with -each, -clone-sheet, -split-by, -job, -rules, -watch or -serve")
+	}
+	if len(verifyHashes) > 0 && (jobSpec != nil || *rulesFile != "" || *watchDir != "" || *serveAddr != "") {
+		log.Fatal("Flag -verify-sha256 checks the -i files and cannot be combined with -job, -rules, -watch or -serve")
 	}
 
-	// Set the active sheet
-	sheetIndex, err := f.GetSheetIndex(targetSheetName)
-	if err != nil {
-		log.Fatalf("Failed to get sheet index: %v", err)
+	if *password == "" {
+		*password = os.Getenv(passwordEnv)
+	}
+	if *templatePassword == "" {
+		*templatePassword = os.Getenv(templatePasswordEnv)
 	}
-	f.SetActiveSheet(sheetIndex)
 
-	// Get the number of columns in the template sheet
-	rows, err := f.GetRows(targetSheetName)
+	inputPaths := make([]string, len(sourceFiles))
+	for i, path := range sourceFiles {
+		inputPaths[i] = path
+		if path != xlappend.StdinPath {
+			inputPaths[i] = resolvePath(*relativeTo, path)
+		}
+	}
+	errorLogPath := *logFile
+	if errorLogPath != "" {
+		errorLogPath = resolvePath(*relativeTo, errorLogPath)
+	}
+	if errorLogPath == "" && *watchDir != "" {
+		// Every watched file gets its own log beside the workbook
+		output := resolvePath(*relativeTo, *outputFile)
+		errorLogPath = strings.TrimSuffix(output, filepath.Ext(output)) + "-" + xlappend.InputToken + "-errors.log"
+	}
+
+	exportPath := *exportNDJSON
+	if exportPath != "" {
+		exportPath = resolvePath(*relativeTo, exportPath)
+	}
+
+	opts := xlappend.Options{
+		InputPaths:       inputPaths,
+		Format:           *format,
+		Query:            *query,
+		TemplatePath:     resolvePath(*relativeTo, *templateFile),
+		TemplatePass:     *templatePassword,
+		SheetName:        *sheetName,
+		CreateSheet:      *createSheet,
+		CreateHeader:     *createHeader,
+		SheetCopy:        *sheetCopy,
+		SplitBy:          *splitBy,
+		Vars:             vars,
+		Split:            *split,
+		OutputPath:       resolvePath(*relativeTo, *outputFile),
+		OutputFormat:     *outputFormat,
+		Force:            *force,
+		Backup:           *backup,
+		ErrorLogPath:     errorLogPath,
+		ErrorLogFmt:      *logFormat,
+		NoErrorLog:       *noLog,
+		Password:         *password,
+		DryRun:           *dryRun,
+		Delimiter:        delim,
+		Separator:        separator,
+		AutoDelimit:      *delimiter == "auto",
+		Bodyfile:         *delimiter == "bodyfile",
+		Encoding:         *encoding,
+		Comment:          commentChar,
+		Quoting:          *quoting,
+		Ragged:           *ragged,
+		SkipBlank:        *skipBlank,
+		StartRow:         *startRow,
+		StartCol:         col,
+		HeaderRow:        *headerRow,
+		EndRow:           *endRow,
+		MaxRows:          *maxRows,
+		Head:             *head,
+		Sample:           *sample,
+		Overwrite:        *mode == "overwrite",
+		Replace:          *mode == "replace",
+		InsertRow:        *insertRow,
+		ChunkSize:        *chunkSize,
+		Stream:           *stream,
+		MaxMemory:        maxMemory,
+		Workers:          *workers,
+		Checkpoint:       *checkpointRows,
+		Resume:           *resume,
+		Strict:           *strict,
+		MaxErrors:        *maxErrors,
+		StopOnError:      *strictExit,
+		Checksum:         *checksum,
+		Manifest:         *manifest,
+		ExportNDJSON:     exportPath,
+		Columns:          *columns,
+		DropColumns:      *dropCols,
+		Flatten:          *flatten,
+		FlattenFields:    *flattenFields,
+		Decode:           decode,
+		Enrich:           resolveEnrich(*relativeTo, enrich),
+		ColumnMap:        resolvePath(*relativeTo, *columnMap),
+		Where:            where,
+		Exclude:          exclude,
+		Dedupe:           *dedupe,
+		DedupeCols:       *dedupeCols,
+		Incremental:      *incremental,
+		KeepHeaders:      *keepHeaders,
+		IntersectHeaders: *intersectHeaders,
+		KeepUnmatched:    *keepUnmatched,
+		LockSchema:       *lockSchema,
+		Locale:           *locale,
+		Infer:            *infer,
+		Coerce:           *coerce,
+		TextColumns:      *text,
+		DateColumns:      *dateCols,
+		DateFormat:       *dateFormat,
+		DateLayout:       *dateLayout,
+		TimezoneIn:       *tzIn,
+		TimezoneOut:      *tzOut,
+		Formulas:         formulas,
+		NumberFormat:     *numberFormat,
+		CopyStyle:        *copyStyle,
+		HighlightPath:    resolvePath(*relativeTo, *highlight),
+		HighlightColor:   *highlightColor,
+		IOCSheet:         *iocSheet,
+		TruncateMarker:   *truncateMarker,
+		OverflowSheet:    *overflowSheet,
+		Summary:          *summary,
+		SummaryColumns:   *summaryCols,
+		SummaryTop:       *summaryTop,
+		Provenance:       *provenance,
+		Tool:             versionString(),
+		CommandLine:      commandLine(os.Args),
+		DefangColumns:    *defangCols,
+		TransformsPath:   resolvePath(*relativeTo, *transforms),
+		SanitizeFormulas: *sanitizeFormulas,
+		LinkColumns:      linkCols,
+		Validate:         *validate,
+		SourceColumn:     *sourceColumn,
+		SourceLabels:     sourceLabels,
+		Annotate:         *annotate,
+		TimeColumns:      timeCols,
+		VerifySHA256:     verifyHashes,
+		StripQuotes:      *stripQuotes,
+		Trim:             *trim,
+		Reverse:          *reverse,
+		SortSheet:        *sortSheet,
+		SortBy:           *sortBy,
+		SortOrder:        *sortOrder,
+		AutoFit:          *autoFit,
+		AutoFitMax:       *autoFitMax,
+		ColumnWidth:      *width,
+		FreezeRows:       *freeze,
+		AutoFilter:       *autoFilter,
+		TableName:        *asTable,
+		CheckPrintArea:   *checkPrintArea,
+		ExtendPrintArea:  *extendPrintArea,
+		ExtendValidation: *extendValidation,
+	}
+	messages.setOptions(&opts)
+	if progress != nil {
+		opts.Progress = progress.show
+	}
+	if *bench || *cpuProfile != "" || *memProfile != "" {
+		if messages.bench, err = startBench(*bench, *cpuProfile, *memProfile); err != nil {
+			log.Fatalf("%v", err)
+		}
+		opts.Progress = messages.bench.progress(opts.Progress)
+	}
+	// Ctrl-C stops reading the input and leaves the output unsaved, with
+	// the error log written so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *each {
+		messages.exit(appendEach(ctx, opts, *jobs, messages))
+	}
+	if *cloneSheet {
+		messages.exit(appendClones(ctx, opts, messages))
+	}
+	if *splitBy != "" {
+		messages.exit(appendSplit(ctx, opts, messages))
+	}
+	if *serveAddr != "" {
+		os.Exit(serveConversions(ctx, opts, *serveAddr, messages))
+	}
+	if *watchDir != "" {
+		messages.exit(appendWatch(ctx, opts, resolvePath(*relativeTo, *watchDir), watchPatterns, messages))
+	}
+	if rules != nil {
+		messages.exit(appendRules(ctx, opts, rules, *relativeTo, messages))
+	}
+	if jobSpec != nil {
+		messages.exit(appendJobs(ctx, opts, jobSpec.Jobs, *relativeTo, messages))
+	}
+	var importer xlappend.Importer
+	result, err := importer.Append(ctx, opts)
+	if err != nil && result.CheckpointFile != "" {
+		messages.failCheckpointed(err, result)
+	}
 	if err != nil {
-		log.Fatalf("Failed to get rows from sheet: %v", err)
+		messages.failRun(err)
+	}
+	messages.summary("", opts, result)
+
+	// Let scripts tell a clean run from one that lost lines
+	if lostLines(result) {
+		messages.exit(exitLineErrors)
+	}
+	messages.exit(0)
+}
+
+// runStatus returns the exit status of a run that failed with err.
+func runStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, xlappend.ErrInput):
+		return exitInput
+	case errors.Is(err, xlappend.ErrTemplate):
+		return exitTemplate
+	case errors.Is(err, xlappend.ErrSave):
+		return exitSave
+	}
+	return 1
+}
+
+// failRun reports err, from a run that failed without saving, and exits
+// with its runStatus.
+func (c *console) failRun(err error) {
+	if errors.Is(err, context.Canceled) {
+		log.Print("Interrupted: the output was not saved")
+	} else {
+		log.Print(err)
+	}
+	c.finish(runStatus(err), err)
+	os.Exit(runStatus(err))
+}
+
+// failCheckpointed reports err, from a -checkpoint run that failed after
+// saving a checkpoint, and how to finish it, and exits with its runStatus.
+func (c *console) failCheckpointed(err error, result xlappend.Result) {
+	if errors.Is(err, context.Canceled) {
+		log.Print("Interrupted")
+	} else {
+		log.Print(err)
+	}
+	log.Printf("%s holds the rows up to the last checkpoint, %s; run the same command with -resume to finish it", result.OutputPath, result.CheckpointFile)
+	c.finish(runStatus(err), err)
+	os.Exit(runStatus(err))
+}
+
+// printSummary reports the outcome of a run, with each outcome counted
+// separately.
+func printSummary(logf func(string, ...interface{}), opts xlappend.Options, result xlappend.Result) {
+	// A dry run reports the same counts for what it would have written
+	sheet := result.Sheets[0].Name
+	was := "was "
+	if opts.DryRun {
+		logf("Dry run: nothing was written to %s\n", result.OutputPath)
+		was = "would be "
+	} else if opts.OutputFormat == "csv" {
+		logf("Data successfully written to CSV file %s\n", result.OutputPath)
+	} else {
+		logf("Data successfully written to file %s, sheet %s\n", result.OutputPath, sheet)
 	}
-	var maxCols int
-	if len(rows) > 0 {
-		maxCols = len(rows[0]) // Assume first row gives the number of columns
+	if opts.OutputFormat == "csv" && opts.TemplatePath == "" {
+		// The sheet was only written through
+	} else if result.SheetCreated {
+		logf("Sheet %s %screated\n", sheet, was)
+	} else if result.CopiedFrom != "" {
+		logf("Sheet %s %scopied from %s\n", sheet, was, result.CopiedFrom)
+	} else if opts.Overwrite {
+		logf("Sheet %s %soverwritten\n", sheet, was)
+	} else if opts.Replace {
+		logf("Sheet %s %sreplaced below its header\n", sheet, was)
+	} else if opts.InsertRow > 0 {
+		logf("Sheet %s %sinserted into at row %d\n", sheet, was, opts.InsertRow)
 	} else {
-		// If there are no rows, assume a large number of columns
-		maxCols = 16384 // Excel's maximum number of columns
-	}
-
-	// Get the next empty row in the target sheet
-	nextRow := len(rows) + 1
-
-	// Append the input data to the Excel sheet
-	for i, row := range csvData {
-		numFields := len(row)
-
-		// Log lines with more fields than available columns
-		if numFields > maxCols {
-			// Open the error log file if it's not already open
-			if !hasErrors {
-				hasErrors = true
-				logFile, err = os.Create(logFileName)
-				if err != nil {
-					log.Fatalf("Failed to create error log file: %v", err)
-				}
-				defer logFile.Close()
+		logf("Sheet %s %sappended to\n", sheet, was)
+	}
+	if result.BackupFile != "" {
+		logf("Previous output kept as %s\n", result.BackupFile)
+	}
+	if result.ChecksumFile != "" {
+		logf("Checksum written to %s\n", result.ChecksumFile)
+	}
+	if result.ManifestFile != "" {
+		logf("Manifest written to %s\n", result.ManifestFile)
+	}
+	if result.ExportFile != "" {
+		logf("Rows exported to %s\n", result.ExportFile)
+	}
+
+	// Count each outcome separately
+	if len(result.Sheets) > 1 {
+		names := make([]string, 0, len(result.Sheets)-1)
+		for _, part := range result.Sheets[1:] {
+			names = append(names, part.Name)
+		}
+		logf("Sheet %s reached Excel's limit of %d rows; the rows continued on %s\n", sheet, excelize.TotalRows, strings.Join(names, ", "))
+	}
+	logf("Rows appended: %d\n", result.RowsAppended)
+	if result.ResumedRows > 0 {
+		logf("  before the run was resumed: %d\n", result.ResumedRows)
+	}
+	if len(result.Sheets) > 1 {
+		for _, part := range result.Sheets {
+			logf("  sheet %s: %d\n", part.Name, part.Rows)
+		}
+	}
+	for _, part := range result.Sheets {
+		if part.Range != "" {
+			logf("Cells %swritten: %s!%s\n", strings.TrimSuffix(was, "was "), part.Name, part.Range)
+		}
+	}
+	logf("Lines with read errors: %d\n", result.ErrorCount)
+	logf("Lines not appended (too many fields): %d\n", result.NotAppendedCount)
+	if opts.Ragged == "pad" || opts.Ragged == "truncate" {
+		logf("Rows padded (too few fields): %d\n", result.PaddedRows)
+	}
+	if opts.Ragged == "truncate" {
+		logf("Rows truncated (too many fields): %d\n", result.TruncatedRows)
+	}
+	if len(opts.Where) > 0 || len(opts.Exclude) > 0 {
+		logf("Lines filtered out by -where or -exclude: %d\n", result.FilteredOut)
+	}
+	if result.HeadReached {
+		logf("Reading stopped after the first %d lines, see -head\n", opts.Head)
+	}
+	if opts.Sample > 0 {
+		logf("Lines -sample picked the rows from: %d\n", result.SampledFrom)
+	}
+	if opts.Incremental {
+		logf("Rows already on the sheet skipped: %d\n", result.Duplicates)
+	} else if opts.Dedupe || opts.DedupeCols != "" {
+		logf("Duplicate rows skipped: %d\n", result.Duplicates)
+	}
+	if len(opts.Vars) > 0 {
+		logf("Template placeholders replaced by -var: %d\n", result.VarsReplaced)
+	}
+	if opts.TransformsPath != "" {
+		logf("Values changed by -transforms: %d\n", result.TransformedCells)
+	}
+	if opts.SanitizeFormulas {
+		logf("Values sanitized against formula injection: %d\n", result.SanitizedCells)
+	}
+	if result.RepeatedHeaders > 0 {
+		logf("Repeated header lines skipped: %d\n", result.RepeatedHeaders)
+	}
+	if opts.HighlightPath != "" {
+		logf("Rows with highlighted keywords: %d\n", result.HighlightedRows)
+	}
+	if result.TruncatedCells > 0 && opts.OverflowSheet != "" {
+		logf("Values cut to fit in a cell (in full on sheet %s): %d\n", opts.OverflowSheet, result.TruncatedCells)
+	} else if result.TruncatedCells > 0 {
+		logf("Values cut to fit in a cell (in full in the error log): %d\n", result.TruncatedCells)
+	}
+	if opts.IOCSheet != "" {
+		logf("Indicators found (listed on sheet %s): %d\n", opts.IOCSheet, result.IOCsFound)
+	}
+	if opts.Provenance && result.FilesRead > 0 {
+		logf("Input files recorded on hidden sheet %s: %d\n", xlappend.ImportLogSheet, result.FilesRead)
+	}
+	if result.CoerceFailures > 0 {
+		logf("Values not coerced (written as text): %d\n", result.CoerceFailures)
+	}
+	if result.FlattenFailures > 0 {
+		logf("Payloads not flattened (neither JSON nor XML): %d\n", result.FlattenFailures)
+	}
+	if result.DecodeFailures > 0 {
+		logf("Values not decoded: %d\n", result.DecodeFailures)
+	}
+	if result.EnrichMisses > 0 {
+		logf("Values not in the -enrich table: %d\n", result.EnrichMisses)
+	}
+	if len(result.TypeMismatches) > 0 {
+		cols := make([]int, 0, len(result.TypeMismatches))
+		total := 0
+		for col, n := range result.TypeMismatches {
+			cols = append(cols, col)
+			total += n
+		}
+		sort.Ints(cols)
+		logf("Type mismatches (written as text): %d\n", total)
+		for _, col := range cols {
+			name, _ := excelize.ColumnNumberToName(col)
+			logf("  column %s: %d\n", name, result.TypeMismatches[col])
+		}
+	}
+	if result.FilesRead > 1 || result.FilesSkipped > 0 {
+		logf("Input files read: %d, skipped: %d\n", result.FilesRead, result.FilesSkipped)
+	}
+	if len(result.Files) > 1 {
+		for _, file := range result.Files {
+			if file.Failed > 0 {
+				logf("  %s: %d appended, %d failed\n", file.Path, file.Rows, file.Failed)
+			} else {
+				logf("  %s: %d appended\n", file.Path, file.Rows)
 			}
-			// Write the line to the error log
-			rawLine := strings.Join(row, string(reader.Comma))
-			_, _ = logFile.WriteString(fmt.Sprintf("Not appended (too many fields): %s\n", rawLine))
-			notAppendedCount++
-			continue
 		}
+	}
+	if result.BlankSkipped > 0 {
+		logf("Blank lines skipped: %d\n", result.BlankSkipped)
+	}
+	if result.DroppedTrailing > 0 {
+		logf("Empty final records dropped: %d\n", result.DroppedTrailing)
+	}
+	if result.ErrorLog != "" {
+		logf("See the log at %s\n", result.ErrorLog)
+	}
+}
+
+// lostLines reports whether a run saved its output without some lines or
+// input files.
+func lostLines(result xlappend.Result) bool {
+	return result.ErrorCount+result.NotAppendedCount+result.FilesSkipped > 0
+}
 
-		for j, value := range row {
-			cell, _ := excelize.CoordinatesToCellName(j+1, nextRow+i)
-			f.SetCellValue(targetSheetName, cell, value)
+// commandLine returns the arguments the program was run with, for
+// -provenance, quoting those with spaces or quotes and hiding the values of
+// -password and -tpassword, however it is spelt, and of -notify-url, whose
+// webhook URLs carry their token in the path.
+func commandLine(args []string) string {
+	parts := make([]string, len(args))
+	hide := false
+	for i, arg := range args {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		secret := strings.HasPrefix(arg, "-") && (name == "password" || name == "tpassword" || name == "template-password" || name == "notify-url")
+		switch {
+		case hide:
+			arg, hide = "***", false
+		case secret && hasValue:
+			arg = arg[:strings.Index(arg, "=")+1] + "***"
+		case secret:
+			hide = true
 		}
+		if strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		parts[i] = arg
 	}
+	return strings.Join(parts, " ")
+}
 
-	// Save the updated Excel file
-	if err := f.SaveAs(outputFileName); err != nil {
-		log.Fatalf("Failed to save updated Excel file: %v", err)
+// resolvePath joins a relative path onto the base directory. Absolute paths,
+// URLs, an empty path and an empty base directory leave the path unchanged.
+func resolvePath(baseDir, path string) string {
+	if baseDir == "" || path == "" || filepath.IsAbs(path) || xlappend.IsRemotePath(path) {
+		return path
 	}
+	return filepath.Join(baseDir, path)
+}
 
-	fmt.Printf("Data successfully written to file %s, sheet %s\n", outputFileName, targetSheetName)
-
-	// Print summary messages if there were errors
-	if hasErrors {
-		fmt.Printf("%d lines encountered errors. See the log at %s\n", errorCount + notAppendedCount, logFileName)
+// resolveEnrich resolves the FILE of each -enrich COL:FILE directive as
+// resolvePath does, leaving directives that are not COL:FILE for
+// xlappend to report.
+func resolveEnrich(baseDir string, directives []string) []string {
+	resolved := make([]string, len(directives))
+	for i, directive := range directives {
+		if column, path, ok := strings.Cut(directive, ":"); ok {
+			directive = column + ":" + resolvePath(baseDir, strings.TrimSpace(path))
+		}
+		resolved[i] = directive
 	}
+	return resolved
 }
-
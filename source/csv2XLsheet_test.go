@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"my-go-project/pkg/xlappend"
+)
+
+func TestCommandLine(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-i", "in.csv", "-s", "TLN Slicer"}, `-i in.csv -s "TLN Slicer"`},
+		{[]string{"-password", "s3cret", "-i", "in.csv"}, "-password *** -i in.csv"},
+		{[]string{"--tpassword=s3cret"}, "--tpassword=***"},
+		{[]string{"-template-password", "s3cret"}, "-template-password ***"},
+		{[]string{"-notify-url", "https://hooks.slack.com/services/T000/B000/XXXX", "-q"}, "-notify-url *** -q"},
+		{[]string{"-notify-url=https://hooks.slack.com/services/T000/B000/XXXX"}, "-notify-url=***"},
+		// Only flags are hidden, not values that happen to spell one
+		{[]string{"-i", "password"}, "-i password"},
+	} {
+		if got := commandLine(tc.args); got != tc.want {
+			t.Errorf("commandLine(%q) = %s, want %s", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	base := filepath.Join("cases", "IR-17")
+	abs, _ := filepath.Abs("map.json")
+	for _, tc := range []struct{ path, want string }{
+		{"map.json", filepath.Join(base, "map.json")},
+		{abs, abs},
+		{"", ""},
+		{"https://example.com/in.csv", "https://example.com/in.csv"},
+	} {
+		if got := resolvePath(base, tc.path); got != tc.want {
+			t.Errorf("resolvePath(%q, %q) = %q, want %q", base, tc.path, got, tc.want)
+		}
+	}
+	if got := resolvePath("", "map.json"); got != "map.json" {
+		t.Errorf("resolvePath without a base = %q, want map.json", got)
+	}
+
+	got := resolveEnrich(base, []string{"EventID:eventids.csv", "DestPort: " + abs, "bad"})
+	want := []string{"EventID:" + filepath.Join(base, "eventids.csv"), "DestPort:" + abs, "bad"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveEnrich = %q, want %q", got, want)
+	}
+
+	// A job's files are resolved too
+	columnMap, transforms := "map.json", "rules.json"
+	var opts xlappend.Options
+	job := sheetOptions{ColumnMap: &columnMap, Transforms: &transforms}
+	if err := job.apply(&opts, base); err != nil {
+		t.Fatal(err)
+	}
+	if opts.ColumnMap != filepath.Join(base, "map.json") || opts.TransformsPath != filepath.Join(base, "rules.json") {
+		t.Errorf("job paths = %q, %q; want them under %s", opts.ColumnMap, opts.TransformsPath, base)
+	}
+}
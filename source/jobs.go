@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// sheetOptions are the options a -rules or -job entry may set for its own
+// input files, over those of the command line. Each is keyed by the name of
+// its flag.
+type sheetOptions struct {
+	Format           *string  `json:"f" yaml:"f"`
+	Query            *string  `json:"query" yaml:"query"`
+	Delimiter        *string  `json:"d" yaml:"d"`
+	Encoding         *string  `json:"enc" yaml:"enc"`
+	StartRow         *int     `json:"r" yaml:"r"`
+	EndRow           *int     `json:"e" yaml:"e"`
+	MaxRows          *int     `json:"n" yaml:"n"`
+	StartCol         *string  `json:"c" yaml:"c"`
+	HeaderRow        *int     `json:"header-row" yaml:"header-row"`
+	Mode             *string  `json:"mode" yaml:"mode"`
+	InsertRow        *int     `json:"insert" yaml:"insert"`
+	CreateSheet      *bool    `json:"create" yaml:"create"`
+	CreateHeader     *bool    `json:"create-header" yaml:"create-header"`
+	Columns          *string  `json:"cols" yaml:"cols"`
+	DropColumns      *string  `json:"drop-cols" yaml:"drop-cols"`
+	ColumnMap        *string  `json:"map" yaml:"map"`
+	IntersectHeaders *bool    `json:"intersect-headers" yaml:"intersect-headers"`
+	TextColumns      *string  `json:"text" yaml:"text"`
+	DateColumns      *string  `json:"date-cols" yaml:"date-cols"`
+	DateLayout       *string  `json:"date-layout" yaml:"date-layout"`
+	TimezoneIn       *string  `json:"tz-in" yaml:"tz-in"`
+	Coerce           *string  `json:"coerce" yaml:"coerce"`
+	Transforms       *string  `json:"transforms" yaml:"transforms"`
+	Formulas         []string `json:"formula" yaml:"formula"`
+}
+
+// apply sets the options that are given on opts, resolving the files they
+// name against relativeTo.
+func (o *sheetOptions) apply(opts *xlappend.Options, relativeTo string) error {
+	if o.Format != nil {
+		opts.Format = *o.Format
+	}
+	if o.Query != nil {
+		opts.Query = *o.Query
+	}
+	if o.Delimiter != nil {
+		delim, separator, err := parseDelimiter(*o.Delimiter)
+		if err != nil {
+			return err
+		}
+		opts.Delimiter, opts.Separator = delim, separator
+		opts.AutoDelimit = *o.Delimiter == "auto"
+		opts.Bodyfile = *o.Delimiter == "bodyfile"
+	}
+	if o.Encoding != nil {
+		opts.Encoding = *o.Encoding
+	}
+	if o.StartRow != nil {
+		opts.StartRow = *o.StartRow
+	}
+	if o.EndRow != nil {
+		opts.EndRow = *o.EndRow
+	}
+	if o.MaxRows != nil {
+		opts.MaxRows = *o.MaxRows
+	}
+	if o.StartCol != nil {
+		col, err := parseColumn(*o.StartCol)
+		if err != nil {
+			return err
+		}
+		opts.StartCol = col
+	}
+	if o.HeaderRow != nil {
+		opts.HeaderRow = *o.HeaderRow
+	}
+	if o.Mode != nil {
+		if *o.Mode != "append" && *o.Mode != "overwrite" && *o.Mode != "replace" {
+			return fmt.Errorf("invalid mode: %s", *o.Mode)
+		}
+		opts.Overwrite = *o.Mode == "overwrite"
+		opts.Replace = *o.Mode == "replace"
+	}
+	if o.InsertRow != nil {
+		opts.InsertRow = *o.InsertRow
+	}
+	if o.CreateSheet != nil {
+		opts.CreateSheet = *o.CreateSheet
+	}
+	if o.CreateHeader != nil {
+		opts.CreateHeader = *o.CreateHeader
+	}
+	if o.Columns != nil {
+		opts.Columns = *o.Columns
+	}
+	if o.DropColumns != nil {
+		opts.DropColumns = *o.DropColumns
+	}
+	if o.ColumnMap != nil {
+		opts.ColumnMap = resolvePath(relativeTo, *o.ColumnMap)
+	}
+	if o.IntersectHeaders != nil {
+		opts.IntersectHeaders = *o.IntersectHeaders
+	}
+	if o.TextColumns != nil {
+		opts.TextColumns = *o.TextColumns
+	}
+	if o.DateColumns != nil {
+		opts.DateColumns = *o.DateColumns
+	}
+	if o.DateLayout != nil {
+		opts.DateLayout = *o.DateLayout
+	}
+	if o.TimezoneIn != nil {
+		opts.TimezoneIn = *o.TimezoneIn
+	}
+	if o.Coerce != nil {
+		opts.Coerce = *o.Coerce
+	}
+	if o.Transforms != nil {
+		opts.TransformsPath = resolvePath(relativeTo, *o.Transforms)
+	}
+	if o.Formulas != nil {
+		opts.Formulas = o.Formulas
+	}
+	return nil
+}
+
+// parseDelimiter returns the delimiter rune a -d value names, or the
+// separator of a delimiter of several characters, such as '||': none for
+// 'auto' and 'bodyfile', which set options of their own.
+func parseDelimiter(name string) (rune, string, error) {
+	switch name {
+	case "csv":
+		return ',', "", nil
+	case "tab":
+		return '\t', "", nil
+	case "auto", "bodyfile":
+		return 0, "", nil
+	}
+	switch utf8.RuneCountInString(name) {
+	case 0:
+		return 0, "", fmt.Errorf("invalid delimiter: %s", name)
+	case 1:
+		delim, _ := utf8.DecodeRuneInString(name)
+		return delim, "", nil
+	}
+	return 0, name, nil
+}
+
+// parseColumn accepts a sheet column as an Excel column letter or a number.
+func parseColumn(name string) (int, error) {
+	col, err := strconv.Atoi(name)
+	if err != nil {
+		col, err = excelize.ColumnNameToNumber(name)
+	}
+	if err != nil || col < 1 || col > excelize.MaxColumns {
+		return 0, fmt.Errorf("invalid start column: %s", name)
+	}
+	return col, nil
+}
+
+// parseSize returns the number of bytes a size such as 512M or 2GB gives:
+// a whole number with an optional K, M or G suffix, in units of 1024, and
+// an optional B. An empty size is 0, no limit.
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	unit := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+	return n * unit, nil
+}
+
+// jobFile is a -job file: the inputs appended to each sheet of one
+// workbook, and optionally its template and output.
+type jobFile struct {
+	Template string      `yaml:"t"`
+	Output   string      `yaml:"o"`
+	Jobs     []*sheetJob `yaml:"jobs"`
+}
+
+// sheetJob is one entry of a -job file: its input files and the sheet they
+// are appended to, with the options that differ from the command line's
+// for them.
+type sheetJob struct {
+	Inputs       pathList `yaml:"i"`
+	Sheet        string   `yaml:"s"`
+	sheetOptions `yaml:",inline"`
+}
+
+// pathList is the i of a job, a single path or a list of them.
+type pathList []string
+
+func (l *pathList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = pathList{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+// loadJobs reads a -job file, YAML or JSON, listing the jobs in the order
+// their sheets are filled:
+//
+//	t: Analysis.xltx
+//	o: case17.xlsx
+//	jobs:
+//	  - i: exports/prefetch.csv
+//	    s: Prefetch
+//	    r: 2
+func loadJobs(file string) (*jobFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var jobs jobFile
+	if err := decoder.Decode(&jobs); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(jobs.Jobs) == 0 {
+		return nil, fmt.Errorf("%s has no jobs", file)
+	}
+	for i, job := range jobs.Jobs {
+		if len(job.Inputs) == 0 || job.Sheet == "" {
+			return nil, fmt.Errorf("%s: job %d needs an i and an s", file, i+1)
+		}
+		for _, path := range job.Inputs {
+			if path == xlappend.StdinPath {
+				return nil, fmt.Errorf("%s: job %d: standard input cannot be the input of a job", file, i+1)
+			}
+		}
+	}
+	return &jobs, nil
+}
+
+// appendJobs appends each job's files to its sheet, one job after another,
+// in the single workbook opts names, which is saved once. Every job's paths
+// are resolved against relativeTo. It returns the exit status.
+func appendJobs(ctx context.Context, opts xlappend.Options, jobs []*sheetJob, relativeTo string, messages *console) int {
+	steps := make([]xlappend.Options, len(jobs))
+	headings := make([]string, len(jobs))
+	for i, job := range jobs {
+		step := opts
+		step.InputPaths = make([]string, len(job.Inputs))
+		for j, path := range job.Inputs {
+			step.InputPaths[j] = resolvePath(relativeTo, path)
+		}
+		step.SourceLabels = nil
+		step.SheetName = job.Sheet
+		if err := job.apply(&step, relativeTo); err != nil {
+			log.Fatalf("Job %d: %v", i+1, err)
+		}
+		steps[i] = step
+		headings[i] = fmt.Sprintf("Job %d: sheet %s\n", i+1, job.Sheet)
+	}
+	return appendSheets(ctx, steps, headings, messages)
+}
+
+// appendSheets runs the steps in one workbook with AppendJobs and prints
+// each step's summary after its heading. It returns the exit status,
+// exitLineErrors if any step lost lines; a failed run exits, see console.failRun.
+func appendSheets(ctx context.Context, steps []xlappend.Options, headings []string, messages *console) int {
+	var importer xlappend.Importer
+	results, err := importer.AppendJobs(ctx, steps)
+	if err != nil {
+		messages.failRun(err)
+	}
+	status := 0
+	for i, result := range results {
+		messages.summary(headings[i], steps[i], result)
+		messages.logf("\n")
+		if lostLines(result) {
+			status = exitLineErrors
+		}
+	}
+	return status
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// levelDebug is the slog level of the -vv messages, below the -v ones,
+// which are slog's debug level.
+const levelDebug = slog.LevelDebug - 4
+
+// console writes the messages and summaries of a run to stderr, as text
+// or, with -msg-format json, one JSON object per line with a time, level
+// and msg, which pipeline orchestrators can parse. Warnings are those
+// messages starting with "Warning: ".
+type console struct {
+	out     io.Writer
+	format  string
+	json    *slog.Logger // nil for text
+	verbose bool         // print the -v messages
+	debug   bool         // print the -vv messages too
+	quiet   bool         // print nothing but failures
+	notify  *notifier    // the -notify-url webhook, nil without one
+	bench   *benchRun    // the -bench measurements and profiles, nil without them
+}
+
+// newConsole returns a console writing to out in format, "text" or "json".
+func newConsole(out io.Writer, format string, verbose, debug, quiet bool) (*console, error) {
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("invalid message format: %s", format)
+	}
+	c := &console{format: format, verbose: verbose || debug, debug: debug, quiet: quiet}
+	return c.withOutput(out), nil
+}
+
+// withOutput returns a copy of the console writing to out.
+func (c *console) withOutput(out io.Writer) *console {
+	copied := *c
+	copied.out = out
+	if c.format == "json" {
+		copied.json = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{
+			Level: levelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.LevelKey && a.Value.Any().(slog.Level) == levelDebug {
+					a.Value = slog.StringValue("TRACE")
+				}
+				return a
+			},
+		}))
+	}
+	return &copied
+}
+
+// print writes a message at level, a JSON message without its trailing
+// newline; blank lines, which only space out text, are left out of JSON.
+func (c *console) print(level slog.Level, format string, args ...interface{}) {
+	if c.json == nil {
+		fmt.Fprintf(c.out, format, args...)
+		return
+	}
+	msg := strings.TrimSpace(fmt.Sprintf(format, args...))
+	if msg == "" {
+		return
+	}
+	if level == slog.LevelInfo && strings.HasPrefix(msg, "Warning: ") {
+		level = slog.LevelWarn
+	}
+	c.json.Log(context.Background(), level, msg)
+}
+
+// logf writes an informational message or warning.
+func (c *console) logf(format string, args ...interface{}) {
+	if !c.quiet {
+		c.print(slog.LevelInfo, format, args...)
+	}
+}
+
+// verbosef writes a -v message.
+func (c *console) verbosef(format string, args ...interface{}) {
+	if c.verbose {
+		c.print(slog.LevelDebug, format, args...)
+	}
+}
+
+// debugf writes a -vv message.
+func (c *console) debugf(format string, args ...interface{}) {
+	if c.debug {
+		c.print(levelDebug, format, args...)
+	}
+}
+
+// errorf writes a failure, even when quiet.
+func (c *console) errorf(format string, args ...interface{}) {
+	c.print(slog.LevelError, format, args...)
+}
+
+// setOptions gives opts the console's message functions.
+func (c *console) setOptions(opts *xlappend.Options) {
+	opts.Logf = c.logf
+	opts.Verbosef = nil
+	if c.verbose {
+		opts.Verbosef = c.verbosef
+	}
+	opts.Debugf = nil
+	if c.debug {
+		opts.Debugf = c.debugf
+	}
+}
+
+// summary writes the outcome of a run, after heading when the run is one
+// step of several: printSummary's lines as text, or a single summary
+// object holding the whole Result as JSON.
+func (c *console) summary(heading string, opts xlappend.Options, result xlappend.Result) {
+	c.notify.add(result)
+	c.bench.add(result)
+	if c.quiet {
+		return
+	}
+	if c.json == nil {
+		c.logf("%s", heading)
+		printSummary(c.logf, opts, result)
+		return
+	}
+	attrs := []interface{}{"dry_run", opts.DryRun, "result", result}
+	if heading != "" {
+		attrs = append([]interface{}{"step", strings.TrimSpace(heading)}, attrs...)
+	}
+	c.json.Info("Summary", attrs...)
+}
+
+// exit finishes a run ending with status, see finish, and exits with it.
+func (c *console) exit(status int) {
+	c.finish(status, nil)
+	os.Exit(status)
+}
+
+// finish reports the -bench measurements of a run ending with status after
+// err, nil unless it failed, and sends its -notify-url completion.
+func (c *console) finish(status int, err error) {
+	c.bench.finish(c)
+	c.notify.send(status, err, c.errorf)
+}
+
+// Write writes the log package's fatal errors as JSON errors, see
+// logToConsole.
+func (c *console) Write(b []byte) (int, error) {
+	c.errorf("%s", b)
+	return len(b), nil
+}
+
+// logToConsole sends the log package's output, the fatal errors, through
+// a JSON console, whose objects carry their own time.
+func (c *console) logToConsole() {
+	if c.json != nil {
+		log.SetFlags(0)
+		log.SetOutput(c)
+	}
+}
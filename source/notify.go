@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// notifyTimeout bounds the -notify-url request, so that a webhook that
+// does not answer cannot hold up the exit of a batch import.
+const notifyTimeout = 15 * time.Second
+
+// completion is the JSON document -notify-url posts once the run is done.
+// Text sums it up in a line, which is what Slack and Teams incoming
+// webhooks show; the other fields are for tooling.
+type completion struct {
+	Text         string    `json:"text"`
+	Status       string    `json:"status"` // "ok", "lines_lost" or "failed"
+	ExitStatus   int       `json:"exit_status"`
+	Error        string    `json:"error,omitempty"`
+	DryRun       bool      `json:"dry_run"`
+	Host         string    `json:"host"`
+	Tool         string    `json:"tool"`
+	Started      string    `json:"started"`
+	Finished     string    `json:"finished"`
+	Duration     float64   `json:"duration_seconds"`
+	Outputs      []string  `json:"outputs"`
+	FilesRead    int       `json:"files_read"`
+	FilesSkipped int       `json:"files_skipped"`
+	RowsAppended int       `json:"rows_appended"`
+	ReadErrors   int       `json:"lines_with_read_errors"`
+	NotAppended  int       `json:"lines_not_appended"`
+	FilteredOut  int       `json:"lines_filtered_out"`
+	Duplicates   int       `json:"duplicates_skipped"`
+	ErrorLogs    []string  `json:"error_logs,omitempty"`
+	start        time.Time // when the run started
+}
+
+// notifier gathers the Results of a run, from every step of an -each,
+// -job or -watch run, for the completion it posts to url.
+type notifier struct {
+	url  string
+	mu   sync.Mutex // -each -j runs steps at once
+	done completion
+}
+
+// newNotifier returns a notifier posting to rawURL, which must be an HTTP
+// or HTTPS URL, for a run starting now.
+func newNotifier(rawURL string, dryRun bool) (*notifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid -notify-url %q: give an http or https URL", rawURL)
+	}
+	host, _ := os.Hostname()
+	return &notifier{url: rawURL, done: completion{DryRun: dryRun, Host: host, Tool: versionString(), start: time.Now()}}, nil
+}
+
+// add counts the Result of a run or step.
+func (n *notifier) add(result xlappend.Result) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d := &n.done
+	if result.OutputPath != "" && !contains(d.Outputs, result.OutputPath) {
+		d.Outputs = append(d.Outputs, result.OutputPath)
+	}
+	if result.ErrorLog != "" && !contains(d.ErrorLogs, result.ErrorLog) {
+		d.ErrorLogs = append(d.ErrorLogs, result.ErrorLog)
+	}
+	d.FilesRead += result.FilesRead
+	d.FilesSkipped += result.FilesSkipped
+	d.RowsAppended += result.RowsAppended
+	d.ReadErrors += result.ErrorCount
+	d.NotAppended += result.NotAppendedCount
+	d.FilteredOut += result.FilteredOut
+	d.Duplicates += result.Duplicates
+}
+
+// send posts the completion of the run, which exits with status after err,
+// nil unless the run failed. A notification that cannot be sent is
+// reported, even with -q, but leaves the exit status alone.
+func (n *notifier) send(status int, err error, warnf func(string, ...interface{})) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	d := n.done
+	n.mu.Unlock()
+	finished := time.Now()
+	d.ExitStatus = status
+	d.Started = d.start.UTC().Format(time.RFC3339)
+	d.Finished = finished.UTC().Format(time.RFC3339)
+	d.Duration = finished.Sub(d.start).Round(time.Millisecond).Seconds()
+	if d.Outputs == nil {
+		d.Outputs = []string{}
+	}
+	d.Text = d.summary(err, finished.Sub(d.start).Round(time.Second))
+
+	body, _ := json.Marshal(d)
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if reqErr == nil {
+		req.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		if resp, reqErr = http.DefaultClient.Do(req); reqErr == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				reqErr = fmt.Errorf("the webhook answered %s", resp.Status)
+			}
+		}
+	}
+	if reqErr != nil {
+		warnf("Warning: failed to send the completion notice: %v\n", reqErr)
+	}
+}
+
+// summary sets the status of the completion and returns the line of text
+// summing it up, as in "csv2XLsheet on ws17: 12,498 rows appended to
+// case42.xlsx from 3 files in 1m12s".
+func (d *completion) summary(err error, took time.Duration) string {
+	prefix := "csv2XLsheet"
+	if d.Host != "" {
+		prefix += " on " + d.Host
+	}
+	if d.DryRun {
+		prefix += " (dry run)"
+	}
+	if err != nil {
+		d.Status, d.Error = "failed", err.Error()
+		return fmt.Sprintf("%s failed after %s: %v", prefix, took, err)
+	}
+	d.Status = "ok"
+	if d.ExitStatus != 0 {
+		d.Status = "lines_lost"
+	}
+	text := fmt.Sprintf("%s: %s rows appended to %s from %s in %s", prefix, groupDigits(d.RowsAppended),
+		strings.Join(d.Outputs, ", "), plural(d.FilesRead, "file"), took)
+	if lost := d.ReadErrors + d.NotAppended; lost > 0 {
+		text += fmt.Sprintf("; %s lost, see %s", plural(lost, "line"), strings.Join(d.ErrorLogs, ", "))
+	}
+	if d.FilesSkipped > 0 {
+		text += fmt.Sprintf("; %s skipped", plural(d.FilesSkipped, "file"))
+	}
+	if d.ExitStatus != 0 && d.ReadErrors+d.NotAppended == 0 && d.FilesSkipped == 0 {
+		text += fmt.Sprintf("; exit status %d", d.ExitStatus)
+	}
+	return text
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// plural returns n and noun, with an s unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return groupDigits(n) + " " + noun + "s"
+}
+
+// groupDigits returns n with its thousands separated by commas.
+func groupDigits(n int) string {
+	s := fmt.Sprint(n)
+	if n < 0 {
+		return "-" + groupDigits(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,33 @@
+package xlappend
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxComments is the most comments Annotate "comment" adds to a sheet. Each
+// is a note shape of its own, which makes a sheet with many of them slow to
+// write, open and save; Annotate "columns" has no such limit.
+const maxComments = 50000
+
+// annotateRow notes the input file and line of the row being written in a
+// comment on its first cell, for Annotate "comment", so that a row can be
+// traced back to the line of evidence it came from. The rows past
+// maxComments are left without, with a warning.
+func (a *sheetAppender) annotateRow(sheet, fileName string, line int) error {
+	if a.sheetComments == maxComments {
+		a.opts.Logf("Warning: sheet %s has %d comments, the most -annotate comment adds; the rest of its rows are not annotated, use -annotate columns\n", a.sheet, maxComments)
+	}
+	if a.sheetComments++; a.sheetComments > maxComments {
+		return nil
+	}
+	cell, _ := excelize.CoordinatesToCellName(a.colOffset+1, a.nextRow)
+	return a.f.AddComment(sheet, excelize.Comment{
+		Cell:   cell,
+		Author: "Source",
+		Text:   fmt.Sprintf("%s, line %d", fileName, line),
+		Width:  220,
+		Height: 30,
+	})
+}
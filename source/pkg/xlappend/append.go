@@ -0,0 +1,2936 @@
+// Package xlappend appends delimited and JSON input files to a sheet of an
+// Excel workbook or template, such as the slicer templates csv2XLsheet
+// ships with, and saves the result as a new workbook. It is the library
+// behind the csv2XLsheet command, which only parses flags into Options and
+// prints the Result.
+package xlappend
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Options configures an Importer's Append.
+type Options struct {
+	InputPaths   []string // CSV/TSV files, glob patterns or URLs, see IsRemotePath, appended in order; StdinPath reads Stdin
+	Format       string   // input format: "csv" (the default), "json", also as "jsonl", see jsonReader, "sqlite", "parquet" or "l2tcsv", see L2tcsv
+	Query        string   // SQL query whose result is read from SQLite input; implies Format "sqlite"
+	TemplatePath string   // Excel XLSX/XLTX workbook to append to
+	TemplatePass string   // password of an encrypted template, empty for none
+	SheetName    string   // existing sheet that receives the rows
+	CreateSheet  bool     // create SheetName when the template does not have it
+	CreateHeader bool     // with CreateSheet, start a created sheet with the first input line as a bold, frozen header, see writeHeader
+	SheetCopy    string   // append to a copy of SheetName with this name, {time} standing for the run's time and {input} for the first input file's name; see copySheet
+	Vars         []string // NAME=VALUE, replacing {{NAME}} in the template's cells, headers and footers, see replaceVars
+	Split        bool     // continue on new sheets once SheetName is full, see nextSheet
+	SplitBy      string   // input column, by number or header name, whose values each get a sheet of their own, see SplitJobs
+	SplitValue   string   // with SplitBy, append only the lines whose SplitBy column holds this value
+	OutputPath   string   // file or directory the updated workbook is saved to, see outputPath; a .ods file is converted by LibreOffice, see saveODS
+	OutputFormat string   // "csv" to write the appended rows to OutputPath as CSV instead of the workbook, see saveCSV; "xlsx" or empty for the workbook
+	Force        bool     // replace an existing output file
+	Backup       bool     // replace an existing output file, keeping it as a backup first, see backupOutput
+	ErrorLogPath string   // error log file, {input} standing for the first input's name; next to the output when empty
+	ErrorLogFmt  string   // error log format, see logFormats; text when empty
+	NoErrorLog   bool     // write error log entries to standard error instead of a file
+	Password     string   // encrypt the saved workbook with this password, empty for none
+	DryRun       bool     // do everything but save the workbook and its checksum
+	Delimiter    rune     // field separator, ',' when zero
+	Separator    string   // field separator of several characters, such as "||", instead of Delimiter, see separatorReplacer
+	Encoding     string   // input encoding, see inputEncodings; empty detects it, see decodeInput
+	AutoDelimit  bool     // detect the delimiter from the input, see detectDelimiter
+	Bodyfile     bool     // read TSK bodyfiles, setting the delimiter and quoting, see bodyfileReader
+	L2tcsv       bool     // read Plaso l2tcsv output, set by Format "l2tcsv", with Split, see l2tcsvReader
+	Comment      rune     // lines starting with this character are ignored, none when zero
+	Quoting      string   // quote handling: "lazy" (the default), "strict" or "none" to read quotation marks literally
+	Ragged       string   // lines with too few or too many fields: "error" (the default), "pad" or "truncate", see fitRecord
+	SkipBlank    bool     // ignore lines whose fields are all empty or whitespace
+	StartRow     int      // first input line to append, 1 when zero
+	StartCol     int      // sheet column the first field is written to, 1 when zero
+	HeaderRow    int      // sheet row holding the column headings; 0 finds it, see measureSheet
+	EndRow       int      // last input line to read, 0 for the end of the file
+	MaxRows      int      // most lines to append from each file, 0 for no limit
+	Head         int      // most lines to append from all the files together, reading no further, 0 for no limit
+	Sample       int      // lines to append picked at random from all those selected, in input order, see sampleRow; 0 appends all
+	Overwrite    bool     // clear the sheet from row StartRow down and write there instead of appending, fitting its table to the new rows
+	Replace      bool     // clear the data rows below the sheet's header row and write there, fitting its table to the new rows
+	InsertRow    int      // insert the rows above this sheet row, moving the rows below down, see insertRows; 0 appends
+
+	ChunkSize        int      // append every ChunkSize rows; 0 buffers the whole file, or streamChunkSize rows with Stream
+	Stream           bool     // write the sheet through a StreamWriter, see newSheetStream
+	MaxMemory        int64    // spill the buffered rows to a temporary file once they hold more than MaxMemory bytes, see spillRows; 0 for no limit
+	Workers          int      // goroutines converting rows while others are read and written, see convertRows; 0 for one per CPU, 1 for none
+	MaxErrors        int      // abort once more than MaxErrors lines fail; 0 is unlimited
+	StopOnError      bool     // abort at the first line that fails or input file that is skipped
+	Checksum         string   // checksum sidecar algorithm, empty for none
+	Manifest         bool     // write <output>.manifest.json, with the hashes of the output and inputs and the counts, see writeManifest
+	ExportNDJSON     string   // also write the appended rows to this file as newline-delimited JSON, see exportRow; InputToken stands for the first input's name
+	Checkpoint       int      // save the workbook and its checkpoint every Checkpoint rows, so that Resume can finish a run cut short; 0 for none, see takeCheckpoint
+	Resume           bool     // carry on from the checkpoint of OutputPath, appending to the output left by the run cut short; see restoreCheckpoint
+	Columns          string   // input columns to keep, in order, see parseColumns
+	DropColumns      string   // input columns to leave out, by number, range or header name, see dropColumns
+	ColumnMap        string   // file placing input columns and constants in sheet columns, see loadColumnMap
+	Flatten          string   // input column, by number or header name, of JSON or XML payloads the FlattenFields are read from, see flattenRecord
+	FlattenFields    string   // dotted paths of the Flatten payload's fields added as input columns, comma separated, e.g. EventData.TargetUserName
+	Decode           []string // input columns whose base64, hex or URL encoded values are decoded, see parseDecode
+	Enrich           []string // input columns whose values are looked up in a table adding its columns, see parseEnrich
+	Where            []string // row expressions that must all hold, see parseFilterExpr
+	Exclude          []string // row expressions any of which skips the line
+	Dedupe           bool     // skip rows already on the sheet or earlier in the input
+	KeepHeaders      bool     // append the lines repeating a header instead of skipping them, see repeatsHeader
+	DedupeCols       string   // compare only these written columns when deduplicating; implies Dedupe unless Incremental
+	Incremental      bool     // skip rows already on the sheet, each as many times as it is there, but not repeats within the input
+	IntersectHeaders bool     // align columns by header name, see intersectColumns
+	KeepUnmatched    bool     // add input columns missing from the sheet header as new columns
+	LockSchema       bool     // reconcile every file's columns to the first file's header
+	Locale           string   // display locale for native numbers and dates, see localeFormats
+	Infer            bool     // write numbers and dates as native cells, see localeFormat.cellValue
+	Coerce           string   // per-column cell types, see parseCoerce
+	TextColumns      string   // columns always written as text, by number or sheet header name
+	DateColumns      string   // columns of timestamps in any layout parseTimestamp knows, written as dates
+	DateFormat       string   // number format code of the DateColumns dates, the locale's when empty
+	DateLayout       string   // Go time layout the DateColumns values are parsed with before parseTimestamp's layouts
+	TimezoneIn       string   // zone of the timestamps without an offset, see parseZone, UTC when empty
+	TimezoneOut      string   // zone the timestamps are written in, see timeZones, UTC when empty
+	Formulas         []string // formulas filled down the appended rows, see parseFormula
+	NumberFormat     string   // number format code for written cells no type gives a format to
+	CopyStyle        bool     // give written cells the styles of the last data row already on the sheet
+	HighlightPath    string   // file of keywords whose cells are filled, see loadHighlights
+	HighlightColor   string   // RGB or ARGB hex fill of the HighlightPath hits, yellow when empty
+	IOCSheet         string   // sheet listing the indicators of compromise in the written values, see extractIOCs
+	Provenance       bool     // record each input file, its hashes and the run on the hidden ImportLogSheet, see writeImportLog
+	Tool             string   // program and version Provenance records, such as "csv2XLsheet 1.4.0"
+	CommandLine      string   // command line Provenance records
+	DefangColumns    string   // columns whose URLs, IP addresses and domains are defanged, by number or sheet header name, see defang
+	TransformsPath   string   // file of regular expression replacements made in the values of columns, see loadTransforms
+	SanitizeFormulas bool     // prefix the values a spreadsheet would read as a formula with a quote, see sanitizeFormula
+	TruncateMarker   string   // text ending a value cut to fit in a cell, see fitCell
+	OverflowSheet    string   // sheet the full text of the values cut to fit in a cell is written to, see writeOverflowSheet
+	Summary          bool     // write an overview of the import to the SummarySheet, see writeSummary
+	SummaryColumns   string   // columns whose most frequent values Summary lists, by number or sheet header name
+	SummaryTop       int      // how many values Summary lists for each of the SummaryColumns, 10 when 0
+	LinkColumns      []string // columns whose cells link to a URL made from their value, see parseLinkColumns
+	Validate         bool     // convert values to the types the last data row's number formats show, see templateColumnType
+	SourceColumn     string   // "prepend" or "append" a column naming each row's input, empty for none
+	SourceLabels     []string // source column values for each InputPaths entry; file base names when nil
+	Annotate         string   // "comment" or "columns" to record each row's input file and line, see annotateRow, empty for neither
+	TimeColumns      []string // timestamp column of each InputPaths entry, or one for all, to merge the inputs into a timeline; see timelineRecord
+	VerifySHA256     []string // SHA256 each InputPaths entry must have before it is read, empty to read it unchecked; see verifyInputs
+	StripQuotes      bool     // remove every quotation mark from the parsed fields
+	Trim             bool     // remove surrounding whitespace from the parsed fields, see trimField
+	Strict           bool     // treat lines whose field count differs from the first line as read errors, and data source warnings as errors
+	Reverse          bool     // append rows in reverse file order
+	SortSheet        string   // sort keys for the whole data region, see parseSortKeys
+	SortBy           string   // column, by number or sheet header name, the appended rows are sorted by before writing, see sortBuffered
+	SortOrder        string   // "asc", the default, or "desc" for SortBy
+	AutoFit          bool     // widen the written columns to fit their contents, see fitColumnWidths
+	AutoFitMax       int      // characters AutoFit widens a column to at most, maxAutoFitWidth when 0
+	ColumnWidth      float64  // width given to every written column, 0 to leave widths alone
+	FreezeRows       int      // rows kept in view at the top of the written sheets, 0 to leave their panes alone
+	AutoFilter       bool     // set an AutoFilter over the header and data of the written sheets, see setView
+	TableName        string   // name of a table to put the header and data of the sheet in, see addDataTable
+	ExtendValidation bool     // grow the sheet's data validations over the appended rows, see extendValidations
+	CheckPrintArea   bool     // warn when data extends past the print area
+	ExtendPrintArea  bool     // grow the print area to cover the data
+
+	// Progress, unless nil, is called about every progressInterval while
+	// the input is read, and once more when it has all been read.
+	Progress func(Progress)
+
+	// Stdin is the input read for StdinPath, os.Stdin when nil.
+	Stdin io.Reader
+
+	// Logf receives informational messages, Verbosef the progress details
+	// of each step and Debugf those of each line and chunk of rows. Nil
+	// discards them.
+	Logf     func(format string, args ...interface{})
+	Verbosef func(format string, args ...interface{})
+	Debugf   func(format string, args ...interface{})
+}
+
+// Result reports what Append did with the input lines.
+type Result struct {
+	RowsAppended     int         // rows written to the sheet
+	ErrorCount       int         // lines the CSV reader could not parse
+	NotAppendedCount int         // lines with more fields than the sheet has columns
+	PaddedRows       int         // rows Ragged padded with empty fields to the width of their file's first line
+	TruncatedRows    int         // rows Ragged cut to the sheet's width instead of not appending them
+	CoerceFailures   int         // values -coerce could not convert, written as text
+	FlattenFailures  int         // Flatten payloads that could not be read as JSON or XML, their fields left empty
+	DecodeFailures   int         // Decode values that did not decode to text, kept as they are
+	EnrichMisses     int         // values of the Enrich columns their table does not have
+	TypeMismatches   map[int]int // values Validate could not convert, written as text, by sheet column
+	FilteredOut      int         // lines skipped because they did not match -where or matched -exclude
+	SampledFrom      int         // lines selected, of which Sample were appended
+	HeadReached      bool        // reading stopped after the first Head lines
+	Duplicates       int         // rows skipped by Dedupe
+	RepeatedHeaders  int         // lines skipped for repeating the first line of the run or of their file
+	HighlightedRows  int         // rows with a cell HighlightPath filled
+	SanitizedCells   int         // values SanitizeFormulas prefixed
+	TransformedCells int         // values changed by the TransformsPath rules
+	VarsReplaced     int         // template placeholders the Vars replaced
+	TruncatedCells   int         // values cut to fit in a cell, see fitCell
+	IOCsFound        int         // distinct indicators found in the written values for IOCSheet
+	DroppedTrailing  int         // blank final records dropped, at most one per file
+	BlankSkipped     int         // blank lines ignored because of SkipBlank
+	Delimiter        rune        // delimiter used to read the last input file, 0 for a Separator
+	SheetCreated     bool        // the sheet was created rather than appended to
+	CopiedFrom       string      // template sheet that SheetCopy copied, empty without a copy
+	Sheets           []SheetRows // rows appended to SheetName and each sheet Split added
+	FilesRead        int         // input files appended
+	Files            []FileRows  // rows appended from each input file read, in order
+	FilesSkipped     int         // input files that could not be opened or matched nothing
+	OutputPath       string      // file the workbook was saved as, with OutputPath resolved
+	ErrorLog         string      // path of the error log, empty if nothing was logged
+	ChecksumFile     string      // path of the checksum sidecar, if one was written
+	BackupFile       string      // path the output replaced was kept as, see Options.Backup
+	ManifestFile     string      // path of the manifest, if one was written
+	ExportFile       string      // path of the NDJSON export, if one was written
+	CheckpointFile   string      // path of the last checkpoint, empty once the output is saved complete
+	ResumedRows      int         // rows of RowsAppended the run Resume carried on from had appended
+	Timing           Timing      // how long the parts of the run took
+}
+
+// maxLoggedDuplicates is how many skipped duplicate rows are reported
+// through Verbosef.
+const maxLoggedDuplicates = 5
+
+// oleMagic starts an OLE compound file, the container of encrypted
+// workbooks.
+const oleMagic = "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"
+
+// headerScanRows is how many rows at the top of a sheet without a table are
+// looked at for its width, since row 1 is often a narrow title banner.
+const headerScanRows = 5
+
+// streamChunkSize is the ChunkSize a stream uses when none is given, so that
+// the input is not buffered whole while its rows go out to a temporary file.
+const streamChunkSize = 10000
+
+// sourceHeading heads the column added by SourceColumn "append", and
+// lineHeading the one after it Annotate "columns" adds.
+const (
+	sourceHeading = "Source File"
+	lineHeading   = "Source Line"
+)
+
+// gzipMagic starts every gzip stream.
+const gzipMagic = "\x1f\x8b"
+
+// utf8BOM is the UTF-8 encoded byte order mark some Windows tools write at
+// the start of a file.
+const utf8BOM = "\ufeff"
+
+// Importer appends input files to Excel workbooks. The zero value is ready
+// to use. An Importer keeps no state between calls, so several Appends may
+// run at once, each with its own output file.
+type Importer struct{}
+
+// Append appends the input files, in order, to an existing sheet of the
+// template workbook and saves the result to opts.OutputPath. Lines that
+// cannot be read or do not fit the sheet, and input files that cannot be
+// opened, are written to the error log, see Options.ErrorLogPath, and
+// counted in the Result; they do not cause an error. Once ctx is done the
+// input is no longer read and ctx's error is returned without saving.
+// The returned Result is valid even when an error is returned.
+func (im *Importer) Append(ctx context.Context, opts Options) (Result, error) {
+	a, err := newSheetAppender(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	a.ctx = ctx
+	err = a.run()
+	if closeErr := a.errLog.Close(); closeErr != nil && err == nil {
+		err = withKind(ErrSave, fmt.Errorf("failed to write error log: %v", closeErr))
+	}
+	a.result.ErrorLog = a.errLog.Path()
+	return a.result, err
+}
+
+// AppendJobs appends the input files of each job to the job's sheet, as
+// Append does, one job after another in a single workbook. The workbook is
+// opened once, from the first job's template, and saved once, after the
+// last job, so the first job's template, Vars, output, password, checksum,
+// manifest and dry run options are those of the whole run; the other jobs'
+// are ignored.
+// Jobs whose error logs have the same path, as they do by default, share
+// one log, whose text entries then start with their input file. Of jobs
+// splitting their input by the same SplitBy column, as SplitJobs makes them,
+// only the first logs and counts the lines that fail before they are split,
+// such as those that cannot be read. It returns
+// a Result for each job; when an error is returned, the jobs after the
+// failed one have none.
+func (im *Importer) AppendJobs(ctx context.Context, jobs []Options) ([]Result, error) {
+	if len(jobs) == 0 {
+		return nil, errors.New("no jobs to run")
+	}
+	appenders := make([]*sheetAppender, len(jobs))
+	logs := make(map[string]*errorLog)
+	for i, opts := range jobs {
+		if opts.Checkpoint > 0 || opts.Resume {
+			return nil, fmt.Errorf("job %d: checkpoints are only taken of a single Append", i+1)
+		}
+		if opts.OutputFormat == "csv" {
+			return nil, fmt.Errorf("job %d: a CSV output holds a single sheet, so it is only written by a single Append", i+1)
+		}
+		if opts.ExportNDJSON != "" {
+			return nil, fmt.Errorf("job %d: an NDJSON export holds the rows of a single sheet, so it is only written by a single Append", i+1)
+		}
+		if i > 0 {
+			first := appenders[0].opts
+			opts.TemplatePath, opts.TemplatePass = first.TemplatePath, first.TemplatePass
+			opts.OutputPath, opts.Force = first.OutputPath, true
+			opts.Password, opts.Checksum, opts.DryRun = first.Password, first.Checksum, first.DryRun
+			opts.Manifest, opts.Backup = first.Manifest, first.Backup
+		}
+		a, err := newSheetAppender(opts)
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %v", i+1, err)
+		}
+		a.ctx = ctx
+		a.splitRest = i > 0 && opts.SplitBy != "" && opts.SplitBy == jobs[i-1].SplitBy
+		if l, ok := logs[a.errLog.path]; ok {
+			a.errLog, l.nameFiles = l, true
+		} else {
+			logs[a.errLog.path] = a.errLog
+		}
+		appenders[i] = a
+	}
+
+	results, err := runJobs(appenders)
+	for _, l := range logs {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = withKind(ErrSave, fmt.Errorf("failed to write error log: %v", closeErr))
+		}
+	}
+	for i := range results {
+		results[i].ErrorLog = appenders[i].errLog.Path()
+	}
+	return results, err
+}
+
+// runJobs appends each job to the workbook of the first and saves it,
+// returning the Results of the jobs done.
+func runJobs(appenders []*sheetAppender) ([]Result, error) {
+	for _, a := range appenders {
+		if err := a.expandInputs(); err != nil {
+			return nil, withKind(ErrInput, fmt.Errorf("sheet %s: %v", a.opts.SheetName, err))
+		}
+		if err := a.verifyInputs(); err != nil {
+			return nil, withKind(ErrInput, fmt.Errorf("sheet %s: %v", a.opts.SheetName, err))
+		}
+	}
+	first, last := appenders[0], appenders[len(appenders)-1]
+	if err := first.openTemplate(); err != nil {
+		return nil, withKind(ErrTemplate, err)
+	}
+	defer first.f.Close()
+	var results []Result
+	for _, a := range appenders {
+		a.f = first.f
+		if err := a.appendSheet(); err != nil {
+			return append(results, a.result), fmt.Errorf("sheet %s: %w", a.opts.SheetName, err)
+		}
+		if a != last {
+			results = append(results, a.result)
+		}
+	}
+	last.earlier = appenders[:len(appenders)-1]
+	err := last.save()
+	return append(results, last.result), err
+}
+
+// AppendCSVToSheet appends the input files as Append does, without a way
+// to cancel it.
+func AppendCSVToSheet(opts Options) (Result, error) {
+	var im Importer
+	return im.Append(context.Background(), opts)
+}
+
+// styleKey identifies a style derived by cellStyle.
+type styleKey struct {
+	base int
+	code string
+}
+
+// SheetRows is the number of rows appended to one sheet.
+type SheetRows struct {
+	Name  string
+	Rows  int
+	Range string // cells the rows were written to, such as A4:H950; empty without rows
+
+	// Earliest and Latest are the first and last of the timestamps written
+	// as dates, zero without any
+	Earliest, Latest time.Time
+
+	firstRow int
+}
+
+// FileRows is what was appended from one input file.
+type FileRows struct {
+	Path   string // input path, or stdin
+	Rows   int    // rows appended
+	Failed int    // lines with read errors or too many fields
+}
+
+// recordReader reads the records of one input file: a *csv.Reader, or a
+// *jsonReader for JSON input.
+type recordReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line, column int)
+}
+
+// typedReader is a recordReader for input whose columns have types of their
+// own, such as Parquet. Its cells are written as those types unless an
+// option types the column, see writtenTypes.
+type typedReader interface {
+	inputTypes() []columnType
+}
+
+// sheetAppender holds the state of a single Append run.
+type sheetAppender struct {
+	ctx         context.Context
+	opts        Options
+	localeFmt   localeFormat
+	displayFmt  localeFormat
+	zones       timeZones
+	columnTypes map[int]columnType
+	formulas    []formulaColumn
+	sortKeys    []sortKey
+	errLog      *errorLog
+	result      Result
+
+	f             *excelize.File
+	sheet         string
+	tables        []excelize.Table
+	header        []sheetCell
+	headerWidths  []float64
+	stream        *excelize.StreamWriter
+	inputs        []string
+	inputLabels   []string
+	inputHashes   []string // SHA256 each input must have, see verifyInputs
+	inputTimeCols []string // TimeColumns entry of each input
+	reader        recordReader
+	rawInput      rawLineSource
+	delim         rune
+	maxCols       int
+	headerRow     int
+	clearedHeader int // the header row -mode overwrite cleared, whose table is fitted to the rows written
+	colOffset     int
+	lastCol       int
+	nextRow       int
+	templateRows  int
+	templateCols  int
+
+	templateHeader  []string
+	canonicalHeader []string
+	columnMap       []int
+	schemaMap       []int
+	selectMap       []int
+	dropped         map[int]bool
+	mapping         []mappedColumn
+	mapCols         []int
+	dedupeCols      []int
+	seen            map[string]int // rows on the sheet, or written, by rowSignature, see skipSeen
+	filters         []filterExpr
+	flattenPaths    []flattenPath // the FlattenFields
+	flattenCol      int           // index into the records of the file being read of its Flatten column
+	flattenHeader   string        // that column's header, empty when the file has none
+	decodes         []decodeColumn
+	decodeCols      map[int]*decodeColumn // the decodes by input column of the file being read
+	enriches        []enrichColumn
+	enrichCols      map[int][]*enrichColumn // the enriches by input column of the file being read
+	sourceCol       int
+	sourceLabel     string
+	tableHeader     []string
+	sawHeader       bool
+	sawFields       bool
+	wroteHeader     bool
+	inputName       string
+	readsStdin      bool
+	inputFile       string
+	logPrefix       string
+	numFmtStyles    map[styleKey]int
+	highlight       *regexp.Regexp
+	highlightColor  string
+	highlightStyles map[int]int
+	iocs            *iocIndex
+	overflow        []overflowValue  // values cut to fit in a cell, for OverflowSheet
+	sortCol         int              // index into the written rows of the SortBy column
+	timeCol         int              // index into the records of the file being read of its TimeColumns column
+	timeHeader      []string         // its header, for timelineRecord
+	summaryCols     []int            // indexes into the written rows of the SummaryColumns
+	summaryNames    []string         // their sheet header names, or column letters
+	valueCounts     []map[string]int // how often each value was written to them
+	progress        *progressMeter
+	digest          *inputDigest     // hashes of the input file being read, for Provenance and Manifest
+	inputRecords    []inputRecord    // hashes and lines of the input files read, for Provenance and Manifest
+	earlier         []*sheetAppender // the AppendJobs jobs before this last one, for Manifest
+	resume          *checkpoint      // checkpoint Resume carries on from
+	checkpointRows  int              // RowsAppended at the last checkpoint
+	inputIndex      int              // index into inputs of the file being read
+	records         int              // records of the file being read handled so far
+	inputFields     int              // fields of its first record, see fitRecord
+	fileHeader      []string         // its first record, see repeatsHeader
+	runHeader       []string         // the first record of the run
+	skipRecords     int              // records of it the run resumed had handled already
+	defangCols      map[int]bool
+	transforms      []transformRule
+	vars            map[string]string
+	splitBy         *rowFilter      // the SplitBy column, holding SplitValue
+	splitValues     map[string]bool // the SplitBy values of the lines read, when SplitJobs reads them
+	splitRest       bool            // an earlier job split the same input and logged the lines failing before the split
+	linkDirectives  []linkColumns
+	links           map[int]string
+	linkStyles      map[int]int
+	sheetLinks      int
+	sheetComments   int
+	export          *ndjsonExport
+	exportHeader    []string // the sheet header from the start column on, keying the export
+	rowStyles       []int
+	contentWidths   map[int]int
+	csvData         [][]string
+	rowFiles        []int                // index into result.Files of the input of each csvData row
+	rowLines        []int                // input line each csvData row starts on, for the error log
+	bufferedBytes   int64                // estimated memory held by csvData, see MaxMemory
+	spill           *rowSpill            // rows moved to disk, see spillRows
+	fileTypes       []map[int]columnType // column types of each input in result.Files, see typedReader
+	lineNumber      int
+	selected        int
+	taken           int           // lines selected from every input file, for Head and Sample
+	flushing        time.Duration // time spent in flushRows, left out of Timing.Read
+	sampleOrder     []int         // the number in taken of each csvData row, see sampleRow
+}
+
+// newSheetAppender validates opts and fills in defaults.
+func newSheetAppender(opts Options) (*sheetAppender, error) {
+	switch opts.OutputFormat {
+	case "", "xlsx", "csv":
+	default:
+		return nil, fmt.Errorf("invalid output format: %s", opts.OutputFormat)
+	}
+	// A CSV output may be written through an empty workbook instead
+	if opts.OutputFormat == "csv" && opts.TemplatePath == "" {
+		opts.CreateSheet = true
+		if opts.SheetName == "" {
+			opts.SheetName = csvSheet
+		}
+	}
+	if len(opts.InputPaths) == 0 || opts.TemplatePath == "" && opts.OutputFormat != "csv" || opts.SheetName == "" || opts.OutputPath == "" {
+		return nil, errors.New("input file, template, sheet name and output file must be specified")
+	}
+	if opts.OutputFormat == "csv" {
+		switch {
+		case opts.Password != "":
+			return nil, errors.New("a CSV output is not encrypted; drop -password")
+		case opts.Checkpoint > 0 || opts.Resume:
+			return nil, errors.New("a resumed run reopens its output, which a CSV output is not; drop -checkpoint")
+		case opts.IOCSheet != "" || opts.OverflowSheet != "" || opts.Summary || opts.Provenance:
+			return nil, errors.New("a CSV output holds the appended rows only; drop -iocs, -overflow-sheet, -summary and -provenance")
+		case opts.Annotate == "comment":
+			return nil, errors.New("a CSV output has no comments; use -annotate columns")
+		}
+		// A directory gets the CSV named after the first input
+		if OutputIsDir(opts.OutputPath) {
+			opts.OutputPath = filepath.Join(opts.OutputPath, InputToken+".csv")
+		}
+	}
+	if opts.Separator != "" {
+		switch {
+		case strings.ContainsAny(opts.Separator, "\"\r\n"+separatorStandIn):
+			return nil, fmt.Errorf("invalid delimiter: %q", opts.Separator)
+		case opts.Format != "csv" || opts.AutoDelimit || opts.Bodyfile || opts.L2tcsv:
+			return nil, errors.New("a delimiter of several characters only applies to delimited input")
+		}
+		opts.Delimiter = []rune(separatorStandIn)[0]
+	}
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.Overwrite && opts.Replace {
+		return nil, errors.New("the sheet is either overwritten from the start row or replaced below its header, not both")
+	}
+	switch {
+	case opts.InsertRow < 0:
+		return nil, fmt.Errorf("invalid insert row: %d", opts.InsertRow)
+	case opts.InsertRow > 0 && (opts.Overwrite || opts.Replace):
+		return nil, errors.New("inserted rows move the existing rows down rather than replacing them; drop -insert or -mode")
+	case opts.InsertRow > 0 && opts.Stream:
+		return nil, errors.New("a streamed sheet cannot have rows inserted; drop -insert or -stream")
+	case opts.InsertRow > 0 && opts.SortSheet != "":
+		return nil, errors.New("sorting the sheet puts the inserted rows in order with the rest; drop -insert or -sort-sheet")
+	}
+	switch {
+	case opts.IOCSheet != "" && opts.IOCSheet == opts.SheetName:
+		return nil, errors.New("the indicators need a sheet of their own; name another -iocs sheet")
+	case opts.IOCSheet != "" && opts.SortSheet != "":
+		return nil, errors.New("the indicators refer to the rows as written, which sorting the sheet moves; drop -iocs or -sort-sheet")
+	case opts.OverflowSheet != "" && (opts.OverflowSheet == opts.SheetName || opts.OverflowSheet == opts.IOCSheet):
+		return nil, errors.New("the truncated values need a sheet of their own; name another -overflow-sheet")
+	case opts.OverflowSheet != "" && opts.SortSheet != "":
+		return nil, errors.New("the truncated values refer to the rows as written, which sorting the sheet moves; drop -overflow-sheet or -sort-sheet")
+	case opts.Provenance && (opts.SheetName == ImportLogSheet || opts.IOCSheet == ImportLogSheet || opts.OverflowSheet == ImportLogSheet):
+		return nil, fmt.Errorf("the %s sheet is kept for -provenance; name another sheet", ImportLogSheet)
+	case opts.Summary && (opts.SheetName == SummarySheet || opts.IOCSheet == SummarySheet || opts.OverflowSheet == SummarySheet):
+		return nil, fmt.Errorf("the %s sheet is kept for -summary; name another sheet", SummarySheet)
+	case !opts.Summary && (opts.SummaryColumns != "" || opts.SummaryTop != 0):
+		return nil, errors.New("value counts are listed on the summary sheet; add -summary")
+	case opts.SummaryTop < 0:
+		return nil, fmt.Errorf("invalid summary length: %d", opts.SummaryTop)
+	}
+	if opts.CreateHeader && !opts.CreateSheet {
+		return nil, errors.New("a header row is only written to a sheet that is created; add -create or drop -create-header")
+	}
+	if opts.StartRow == 0 {
+		opts.StartRow = 1
+	}
+	if opts.StartCol == 0 {
+		opts.StartCol = 1
+	}
+	if opts.Query != "" && (opts.Format == "" || opts.Format == "csv") {
+		opts.Format = "sqlite"
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = "csv"
+	case "jsonl", "ndjson":
+		opts.Format = "json"
+	case "l2tcsv":
+		opts.Format, opts.L2tcsv = "csv", true
+	case "csv", "json", "sqlite", "parquet":
+	default:
+		return nil, fmt.Errorf("invalid input format: %s", opts.Format)
+	}
+	if (opts.Format == "sqlite") != (opts.Query != "") {
+		return nil, errors.New("-query reads SQLite databases and is the only way to read them")
+	}
+	for _, path := range opts.InputPaths {
+		if !IsRemotePath(path) {
+			continue
+		}
+		if _, _, isZip := splitZipPath(remoteName(path)); isZip {
+			return nil, fmt.Errorf("zip archives are read from files, which %s is not; download it first", inputName(path))
+		}
+		if opts.Format == "sqlite" || opts.Format == "parquet" {
+			return nil, fmt.Errorf("%s input is read from files, which %s is not; download it first", opts.Format, inputName(path))
+		}
+	}
+	for _, path := range opts.InputPaths {
+		_, _, isZip := splitZipPath(path)
+		if !isZip && path != StdinPath {
+			continue
+		}
+		switch opts.Format {
+		case "sqlite":
+			return nil, fmt.Errorf("a SQLite database is queried in place, so %s has to be a file on disk", path)
+		case "parquet":
+			return nil, fmt.Errorf("a Parquet file is read from its end first, so %s has to be a file on disk", path)
+		}
+	}
+	switch opts.Quoting {
+	case "":
+		opts.Quoting = "lazy"
+	case "lazy", "strict", "none":
+	default:
+		return nil, fmt.Errorf("invalid quoting: %s", opts.Quoting)
+	}
+	switch opts.Ragged {
+	case "":
+		opts.Ragged = "error"
+	case "error", "pad", "truncate":
+	default:
+		return nil, fmt.Errorf("invalid ragged line handling: %s", opts.Ragged)
+	}
+	if opts.Bodyfile {
+		if opts.Format != "csv" || opts.AutoDelimit || opts.Quoting == "strict" {
+			return nil, errors.New("a bodyfile is pipe delimited text without quoting")
+		}
+		opts.Delimiter = '|'
+		opts.Quoting = "none"
+	}
+	// A super timeline easily outgrows one sheet
+	if opts.L2tcsv {
+		if opts.Bodyfile || opts.AutoDelimit || opts.Delimiter != ',' {
+			return nil, errors.New("l2tcsv input is comma delimited")
+		}
+		opts.Split = true
+	}
+	if opts.Format != "csv" && (opts.AutoDelimit || opts.Comment != 0 || opts.Quoting != "lazy" || opts.Strict || opts.Ragged != "error") {
+		return nil, errors.New("delimiter detection, comment lines, quote handling, -strict and -ragged only apply to delimited input")
+	}
+	if opts.Comment == opts.Delimiter || opts.Comment == '\r' || opts.Comment == '\n' {
+		return nil, fmt.Errorf("invalid comment character: %q", opts.Comment)
+	}
+	if opts.HeaderRow < 0 || opts.HeaderRow > excelize.TotalRows {
+		return nil, fmt.Errorf("invalid header row: %d", opts.HeaderRow)
+	}
+	if opts.StartCol < 0 || opts.StartCol > excelize.MaxColumns {
+		return nil, fmt.Errorf("invalid start column: %d", opts.StartCol)
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...interface{}) {}
+	}
+	if opts.Verbosef == nil {
+		opts.Verbosef = func(string, ...interface{}) {}
+	}
+	if opts.Debugf == nil {
+		opts.Debugf = func(string, ...interface{}) {}
+	}
+	if opts.EndRow < 0 || (opts.EndRow > 0 && opts.EndRow < opts.StartRow) {
+		return nil, fmt.Errorf("invalid end line: %d", opts.EndRow)
+	}
+	if opts.MaxRows < 0 {
+		return nil, fmt.Errorf("invalid row limit: %d", opts.MaxRows)
+	}
+	if opts.Head < 0 {
+		return nil, fmt.Errorf("invalid -head line count: %d", opts.Head)
+	}
+	if opts.Sample < 0 {
+		return nil, fmt.Errorf("invalid -sample size: %d", opts.Sample)
+	}
+	if opts.ChunkSize < 0 {
+		return nil, fmt.Errorf("invalid chunk size: %d", opts.ChunkSize)
+	}
+	if opts.Sample > 0 {
+		switch {
+		case opts.MaxMemory > 0:
+			return nil, errors.New("-sample keeps the rows it picks in memory, so they cannot be spilled to disk; drop -max-mem or -sample")
+		case opts.ChunkSize > 0:
+			opts.Logf("-sample writes its rows once every input is read; ignoring -chunk-size\n")
+			opts.ChunkSize = 0
+		}
+	}
+	if opts.Reverse && opts.ChunkSize > 0 {
+		opts.Logf("-reverse buffers the whole input file; ignoring -chunk-size\n")
+		opts.ChunkSize = 0
+	}
+	if opts.SortOrder != "" && opts.SortOrder != "asc" && opts.SortOrder != "desc" {
+		return nil, fmt.Errorf("unknown sort order %q", opts.SortOrder)
+	}
+	if opts.SortBy != "" {
+		switch {
+		case opts.Reverse:
+			return nil, errors.New("-reverse and -sort-by both set the order of the rows; drop one")
+		case opts.MaxMemory > 0:
+			return nil, errors.New("-sort-by sorts the rows in memory, so they cannot be spilled to disk; drop -max-mem or -sort-by")
+		case opts.ChunkSize > 0:
+			opts.Logf("-sort-by buffers every input file; ignoring -chunk-size\n")
+			opts.ChunkSize = 0
+		}
+	}
+	if opts.Stream && opts.ChunkSize == 0 && !opts.Reverse && opts.SortBy == "" && opts.Sample == 0 {
+		opts.ChunkSize = streamChunkSize
+	}
+	if opts.MaxMemory < 0 {
+		return nil, fmt.Errorf("invalid memory limit: %d", opts.MaxMemory)
+	}
+	if opts.MaxMemory > 0 && opts.Reverse {
+		return nil, errors.New("-reverse writes the rows backwards from memory, so they cannot be spilled to disk; drop -max-mem or -reverse")
+	}
+	if opts.MaxMemory > 0 && opts.InsertRow > 0 {
+		return nil, errors.New("-insert makes room for the rows buffered in memory, so they cannot be spilled to disk; drop -max-mem or -insert")
+	}
+	if opts.Workers < 0 {
+		return nil, fmt.Errorf("invalid number of workers: %d", opts.Workers)
+	}
+	if opts.Checkpoint < 0 {
+		return nil, fmt.Errorf("invalid checkpoint interval: %d", opts.Checkpoint)
+	}
+	if opts.Checkpoint > 0 || opts.Resume {
+		switch {
+		case opts.DryRun:
+			return nil, errors.New("a dry run saves nothing to resume from; drop -checkpoint and -resume or -dry-run")
+		case opts.Stream || opts.Reverse || opts.SortBy != "":
+			return nil, errors.New("a streamed, reversed or sorted sheet is only written at the end, so it cannot be checkpointed; drop -stream, -reverse or -sort-by")
+		case opts.Sample > 0:
+			return nil, errors.New("a sample is only written once every input is read, so it cannot be checkpointed; drop -sample")
+		case opts.Overwrite || opts.Replace || opts.InsertRow > 0:
+			return nil, errors.New("a checkpointed run appends below the rows already on the sheet; drop -mode or -insert")
+		case opts.IOCSheet != "":
+			return nil, errors.New("the indicators are gathered as the rows are written, so a checkpoint would lose them; drop -iocs")
+		case opts.OverflowSheet != "":
+			return nil, errors.New("the truncated values are gathered as the rows are written, so a checkpoint would lose them; drop -overflow-sheet")
+		case opts.SummaryColumns != "":
+			return nil, errors.New("the values are counted as the rows are written, so a checkpoint would lose them; drop -summary-cols")
+		case opts.ExportNDJSON != "":
+			return nil, errors.New("the rows are exported as they are written, so a checkpoint would lose them; drop -export-ndjson")
+		}
+		for _, path := range opts.InputPaths {
+			if path == StdinPath {
+				return nil, errors.New("standard input cannot be read again to resume from a checkpoint; save it to a file first")
+			}
+		}
+	}
+	// Rows are only saved once they are flushed to the sheet
+	if opts.Checkpoint > 0 && (opts.ChunkSize == 0 || opts.ChunkSize > opts.Checkpoint) {
+		opts.ChunkSize = opts.Checkpoint
+	}
+	if opts.Resume {
+		opts.Force = true
+	}
+	if opts.MaxErrors < 0 {
+		return nil, fmt.Errorf("invalid max errors: %d", opts.MaxErrors)
+	}
+	if _, ok := inputEncodings[opts.Encoding]; opts.Encoding != "" && !ok {
+		return nil, fmt.Errorf("invalid input encoding: %s", opts.Encoding)
+	}
+	if opts.Checksum != "" && newChecksumHash(opts.Checksum) == nil {
+		return nil, fmt.Errorf("invalid checksum algorithm: %s", opts.Checksum)
+	}
+	if opts.ErrorLogFmt == "" {
+		opts.ErrorLogFmt = "text"
+	}
+	if !logFormats[opts.ErrorLogFmt] {
+		return nil, fmt.Errorf("invalid error log format: %s", opts.ErrorLogFmt)
+	}
+	if opts.NoErrorLog && opts.ErrorLogPath != "" {
+		return nil, errors.New("an error log path cannot be given with -no-log")
+	}
+
+	a := &sheetAppender{opts: opts, colOffset: opts.StartCol - 1, numFmtStyles: make(map[styleKey]int)}
+	var ok bool
+	if a.localeFmt, ok = lookupLocale(opts.Locale); opts.Locale != "" && !ok {
+		return nil, fmt.Errorf("invalid locale: %s", opts.Locale)
+	}
+	var err error
+	if a.columnTypes, err = parseCoerce(opts.Coerce); err != nil {
+		return nil, fmt.Errorf("invalid coerce directive: %v", err)
+	}
+	// Coerced and inferred numbers and dates use the ISO formats unless a
+	// locale is given
+	a.displayFmt = a.localeFmt
+	if opts.Locale == "" {
+		a.displayFmt = localeFormats["iso"]
+	}
+	if a.sortKeys, err = parseSortKeys(opts.SortSheet); err != nil {
+		return nil, fmt.Errorf("invalid sort keys: %v", err)
+	}
+	if a.selectMap, err = parseColumns(opts.Columns); err != nil {
+		return nil, fmt.Errorf("invalid column list: %v", err)
+	}
+	if a.mapping, err = loadColumnMap(opts.ColumnMap); err != nil {
+		return nil, fmt.Errorf("invalid column map: %v", err)
+	}
+	if opts.Columns != "" && opts.DropColumns != "" {
+		return nil, errors.New("-cols and -drop-cols cannot be combined; list only the kept columns with -cols")
+	}
+	if a.mapping != nil && (opts.Columns != "" || opts.DropColumns != "" || opts.IntersectHeaders || opts.LockSchema) {
+		return nil, errors.New("a column map places the input columns itself; drop -cols, -drop-cols, -intersect-headers and -lock-schema or -map")
+	}
+	if a.mapping != nil && opts.SourceColumn == "prepend" {
+		return nil, errors.New("a column map names the sheet columns itself; use -src-col append")
+	}
+	switch {
+	case opts.Flatten != "" && strings.TrimSpace(opts.FlattenFields) == "":
+		return nil, errors.New("-flatten needs the fields to add as columns; give them with -flatten-fields")
+	case opts.Flatten == "" && opts.FlattenFields != "":
+		return nil, errors.New("-flatten-fields are read from the payloads of a column; name it with -flatten")
+	case opts.Flatten != "":
+		if a.flattenPaths, err = parseFlattenFields(opts.FlattenFields); err != nil {
+			return nil, fmt.Errorf("invalid -flatten-fields: %v", err)
+		}
+	}
+	if a.vars, err = parseVars(opts.Vars); err != nil {
+		return nil, fmt.Errorf("invalid -var: %v", err)
+	}
+	for _, directive := range opts.Decode {
+		dc, err := parseDecode(directive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -decode: %v", err)
+		}
+		a.decodes = append(a.decodes, dc)
+	}
+	for _, directive := range opts.Enrich {
+		ec, err := parseEnrich(directive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -enrich: %v", err)
+		}
+		a.enriches = append(a.enriches, ec)
+	}
+	if opts.SplitBy != "" {
+		for _, path := range opts.InputPaths {
+			if path == StdinPath {
+				return nil, errors.New("standard input cannot be read again for each sheet of -split-by; save it to a file first")
+			}
+		}
+		if opts.OutputFormat == "csv" {
+			return nil, errors.New("a CSV output holds a single sheet; drop -split-by")
+		}
+		a.splitBy = &rowFilter{column: strings.TrimSpace(opts.SplitBy), op: "=", value: opts.SplitValue}
+	}
+	for _, expr := range opts.Where {
+		fe, err := parseFilterExpr(expr, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -where predicate: %v", err)
+		}
+		a.filters = append(a.filters, fe)
+	}
+	for _, expr := range opts.Exclude {
+		fe, err := parseFilterExpr(expr, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude predicate: %v", err)
+		}
+		a.filters = append(a.filters, fe)
+	}
+	for _, directive := range opts.Formulas {
+		fc, err := parseFormula(directive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid formula: %v", err)
+		}
+		a.formulas = append(a.formulas, fc)
+	}
+	if opts.HighlightColor != "" && opts.HighlightPath == "" {
+		return nil, errors.New("a highlight colour needs a highlight file")
+	}
+	if opts.HighlightPath != "" {
+		if a.highlight, err = loadHighlights(opts.HighlightPath); err != nil {
+			return nil, fmt.Errorf("invalid highlight file: %v", err)
+		}
+		a.highlightColor = defaultHighlightColor
+		if opts.HighlightColor != "" {
+			if a.highlightColor, err = parseColor(opts.HighlightColor); err != nil {
+				return nil, err
+			}
+		}
+		a.highlightStyles = make(map[int]int)
+	}
+	if opts.TransformsPath != "" {
+		if a.transforms, err = loadTransforms(opts.TransformsPath); err != nil {
+			return nil, fmt.Errorf("invalid transforms file: %v", err)
+		}
+	}
+	if opts.IOCSheet != "" {
+		a.iocs = newIOCIndex()
+	}
+	if len(opts.LinkColumns) > 0 && opts.Stream {
+		return nil, errors.New("a streamed sheet cannot have links; drop -link-cols or -stream")
+	}
+	for _, directive := range opts.LinkColumns {
+		lc, err := parseLinkColumns(directive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link columns: %v", err)
+		}
+		a.linkDirectives = append(a.linkDirectives, lc)
+	}
+	if opts.Incremental && opts.Dedupe {
+		return nil, errors.New("-dedupe also skips rows repeated within the input, which -incremental appends; drop one")
+	}
+	if opts.Incremental && opts.Resume {
+		return nil, errors.New("a resumed run cannot tell the rows it appended from those already on the sheet; drop -incremental")
+	}
+	if opts.Dedupe || opts.DedupeCols != "" || opts.Incremental {
+		if a.dedupeCols, err = parseColumns(opts.DedupeCols); err != nil {
+			return nil, fmt.Errorf("invalid dedupe columns: %v", err)
+		}
+		a.seen = make(map[string]int)
+	}
+	if opts.Stream && opts.KeepUnmatched {
+		return nil, errors.New("a streamed sheet header cannot be extended; drop -keep-unmatched or -stream")
+	}
+	switch opts.SourceColumn {
+	case "", "prepend", "append":
+	default:
+		return nil, fmt.Errorf("invalid source column position: %s", opts.SourceColumn)
+	}
+	if opts.SourceLabels != nil && opts.SourceColumn == "" && opts.TimeColumns == nil {
+		return nil, errors.New("source labels need a source column position")
+	}
+	if len(opts.TimeColumns) > 1 && len(opts.TimeColumns) != len(opts.InputPaths) {
+		return nil, fmt.Errorf("%d timestamp columns given for %d input files", len(opts.TimeColumns), len(opts.InputPaths))
+	}
+	if opts.TimeColumns != nil && opts.SourceColumn != "" {
+		return nil, errors.New("a merged timeline has its own source column; drop -src-col")
+	}
+	if opts.TimeColumns != nil && (opts.IntersectHeaders || opts.LockSchema || opts.ColumnMap != "") {
+		return nil, errors.New("the inputs of a merged timeline are not aligned by header; drop -intersect-headers, -lock-schema and -map")
+	}
+	if opts.SourceLabels != nil && len(opts.SourceLabels) != len(opts.InputPaths) {
+		return nil, fmt.Errorf("%d source labels given for %d input files", len(opts.SourceLabels), len(opts.InputPaths))
+	}
+	if opts.VerifySHA256 != nil && len(opts.VerifySHA256) != len(opts.InputPaths) {
+		return nil, fmt.Errorf("%d SHA256 hashes given for %d input files", len(opts.VerifySHA256), len(opts.InputPaths))
+	}
+	for i, digest := range opts.VerifySHA256 {
+		if digest != "" && !isSHA256(digest) {
+			return nil, fmt.Errorf("invalid SHA256 hash for %s: %s", inputName(opts.InputPaths[i]), digest)
+		}
+	}
+	if opts.SourceColumn == "append" && opts.KeepUnmatched {
+		return nil, errors.New("unmatched columns and an appended source column would share the columns after the header; use -src-col prepend")
+	}
+	switch {
+	case opts.Annotate != "" && opts.Annotate != "comment" && opts.Annotate != "columns":
+		return nil, fmt.Errorf("invalid annotation: %s; use comment or columns", opts.Annotate)
+	case opts.Annotate == "columns" && opts.SourceColumn != "":
+		return nil, errors.New("-annotate columns names each row's input file itself; drop -src-col")
+	case opts.Annotate == "columns" && opts.Dedupe && opts.DedupeCols == "":
+		return nil, errors.New("the line numbers of -annotate columns make every row unique; name the columns compared with -dedupe-cols")
+	case opts.Annotate == "columns" && opts.KeepUnmatched:
+		return nil, errors.New("unmatched columns and the annotation columns would share the columns after the header; use -annotate comment")
+	case opts.Annotate == "comment" && opts.Stream:
+		return nil, errors.New("a streamed sheet cannot have comments added; use -annotate columns or drop -stream")
+	case opts.Annotate == "comment" && opts.SortSheet != "":
+		return nil, errors.New("the comments stay on the rows as written, which sorting the sheet moves; use -annotate columns or drop -sort-sheet")
+	}
+	if opts.DateFormat != "" && opts.DateColumns == "" {
+		return nil, errors.New("a date format needs date columns")
+	}
+	if opts.DateLayout != "" && opts.DateColumns == "" {
+		return nil, errors.New("a date layout needs date columns")
+	}
+	if opts.TimezoneIn != "" || opts.TimezoneOut != "" {
+		if a.zones, err = newTimeZones(opts.TimezoneIn, opts.TimezoneOut); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ColumnWidth < 0 || opts.ColumnWidth > excelize.MaxColumnWidth {
+		return nil, fmt.Errorf("invalid column width: %v", opts.ColumnWidth)
+	}
+	if opts.AutoFitMax < 0 || opts.AutoFitMax > excelize.MaxColumnWidth-2 {
+		return nil, fmt.Errorf("invalid autofit maximum: %d", opts.AutoFitMax)
+	}
+	if opts.AutoFitMax > 0 && !opts.AutoFit {
+		return nil, errors.New("an autofit maximum needs -autofit")
+	}
+	if opts.AutoFit && opts.ColumnWidth > 0 {
+		return nil, errors.New("columns are either fitted to their contents or given a fixed width; drop -autofit or -width")
+	}
+	if opts.Stream && (opts.AutoFit || opts.ColumnWidth > 0) {
+		return nil, errors.New("a streamed sheet takes its column widths before the first row; drop -autofit/-width or -stream")
+	}
+	if opts.AutoFit || opts.ColumnWidth > 0 {
+		a.contentWidths = make(map[int]int)
+	}
+	if opts.FreezeRows < 0 || opts.FreezeRows >= excelize.TotalRows {
+		return nil, fmt.Errorf("invalid number of frozen rows: %d", opts.FreezeRows)
+	}
+	if opts.Stream && opts.AutoFilter {
+		return nil, errors.New("a streamed sheet cannot be given an AutoFilter; drop -autofilter or -stream")
+	}
+	if opts.Stream && opts.ExtendValidation {
+		return nil, errors.New("a streamed sheet cannot be read back to extend its data validations; drop -extend-validation or -stream")
+	}
+	if opts.InsertRow > 0 && opts.ExtendValidation {
+		return nil, errors.New("inserted rows take the data validations of the rows they are inserted among; drop -extend-validation or -insert")
+	}
+	if opts.Stream && opts.TableName != "" {
+		return nil, errors.New("a streamed sheet cannot be given a table; drop -as-table or -stream")
+	}
+	if opts.Stream && len(a.sortKeys) > 0 {
+		return nil, errors.New("a streamed sheet cannot be sorted; drop -sort-sheet or -stream")
+	}
+
+	// Name the output and, after it, the consolidated log file
+	if opts.OutputPath, err = outputPath(opts.OutputPath, opts.InputPaths, opts.Force || opts.Backup); err != nil {
+		return nil, err
+	}
+	a.opts.OutputPath = opts.OutputPath
+	a.result.OutputPath = opts.OutputPath
+	if opts.ExportNDJSON != "" {
+		if a.opts.ExportNDJSON, err = exportPath(opts.ExportNDJSON, opts.InputPaths, opts.OutputPath, opts.Force); err != nil {
+			return nil, err
+		}
+	}
+	if opts.OutputFormat == "csv" {
+		// Written as CSV whatever its extension
+	} else if err := checkOutputFormat(opts.OutputPath); err != nil {
+		return nil, err
+	} else if isODS(opts.OutputPath) {
+		switch {
+		case opts.Password != "":
+			return nil, errors.New("an OpenDocument spreadsheet is saved unencrypted; drop -password or save as .xlsx")
+		case opts.Checkpoint > 0 || opts.Resume:
+			return nil, errors.New("a resumed run reopens its output, which cannot be read back as OpenDocument; drop -checkpoint or save as .xlsx")
+		}
+		// Fail before reading the input rather than once it is all in
+		if !opts.DryRun {
+			if _, err := sofficePath(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	logFileName := opts.ErrorLogPath
+	switch {
+	case opts.NoErrorLog:
+		logFileName = ""
+	case logFileName == "":
+		logFileName = strings.TrimSuffix(opts.OutputPath, filepath.Ext(opts.OutputPath)) + "-errors.log"
+	case strings.Contains(logFileName, InputToken):
+		name, err := inputStem(opts.InputPaths[0])
+		if err != nil {
+			return nil, err
+		}
+		logFileName = strings.ReplaceAll(logFileName, InputToken, name)
+	}
+	a.errLog = newErrorLog(logFileName, opts.ErrorLogFmt)
+
+	// A resumed run appends to the output as its checkpoint left it, whose
+	// sheet may be the copy the run made
+	if opts.Resume {
+		if a.resume, err = loadCheckpoint(opts.OutputPath); err != nil {
+			return nil, err
+		}
+		a.opts.TemplatePath, a.opts.TemplatePass = opts.OutputPath, opts.Password
+		a.opts.SheetName, a.opts.SheetCopy = a.resume.Result.Sheets[0].Name, ""
+		if err := a.errLog.resumeFrom(a.resume.ErrorLogBytes); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// run performs the import and saves the output workbook.
+func (a *sheetAppender) run() error {
+	if err := a.expandInputs(); err != nil {
+		return withKind(ErrInput, err)
+	}
+	if err := a.verifyInputs(); err != nil {
+		return withKind(ErrInput, err)
+	}
+	if err := a.checkCSVOutput(); err != nil {
+		return withKind(ErrInput, err)
+	}
+	if err := a.openTemplate(); err != nil {
+		return withKind(ErrTemplate, err)
+	}
+	defer a.f.Close()
+	if err := a.openExport(); err != nil {
+		return withKind(ErrSave, err)
+	}
+	defer a.closeExport()
+	if err := a.appendSheet(); err != nil {
+		return err
+	}
+	return a.save()
+}
+
+// openTemplate opens the existing Excel template, or starts an empty
+// workbook for a CSV output without one.
+func (a *sheetAppender) openTemplate() error {
+	defer timeTo(&a.result.Timing.Open)()
+	if a.opts.TemplatePath == "" {
+		a.f = excelize.NewFile()
+		return nil
+	}
+	var err error
+	a.f, err = excelize.OpenFile(a.opts.TemplatePath, excelize.Options{Password: a.opts.TemplatePass})
+	if err != nil {
+		return templateOpenError(a.opts.TemplatePath, a.opts.TemplatePass, err)
+	}
+	if err := a.checkMacros(); err != nil {
+		return withKind(ErrTemplate, err)
+	}
+	return a.replaceVars()
+}
+
+// appendSheet appends the input files to the sheet of the open workbook
+// a.f and updates the tables, pivot caches and print area that cover it.
+func (a *sheetAppender) appendSheet() error {
+	start, read := time.Now(), a.result.Timing.Read
+	defer func() { a.result.Timing.Write += time.Since(start) - (a.result.Timing.Read - read) }()
+	var err error
+	if err := a.prepareSheet(); err != nil {
+		return withKind(ErrTemplate, err)
+	}
+	if a.resume != nil {
+		if err := a.restoreCheckpoint(); err != nil {
+			return err
+		}
+	}
+	if a.opts.Stream {
+		if a.stream, err = newSheetStream(a.f, a.opts.SheetName, a.templateRows, a.templateCols, a.streamPanes()); err != nil {
+			return fmt.Errorf("failed to start streaming the sheet: %v", err)
+		}
+	}
+
+	// Append each input file in turn, continuing from the last written row
+	if len(a.inputs) > 1 {
+		a.opts.Verbosef("Appending %d input files\n", len(a.inputs))
+	}
+	a.startProgress()
+	defer a.closeSpill()
+	for i, path := range a.inputs {
+		if a.resume != nil && i < a.resume.NextInput {
+			continue
+		}
+		if a.opts.Head > 0 && a.taken >= a.opts.Head {
+			a.opts.Verbosef("Read the first %d lines for -head; skipping %s and the files after it\n", a.opts.Head, path)
+			break
+		}
+		a.inputIndex = i
+		if err := a.appendFile(path, a.inputLabels[i]); err != nil {
+			return err
+		}
+		a.skipRecords = 0
+	}
+	if a.result.FilesRead == 0 {
+		return withKind(ErrInput, errors.New("none of the input files could be read"))
+	}
+	if a.opts.Sample > 0 {
+		a.orderSample()
+	}
+	if a.opts.Reverse {
+		for i, j := 0, len(a.csvData)-1; i < j; i, j = i+1, j-1 {
+			a.csvData[i], a.csvData[j] = a.csvData[j], a.csvData[i]
+			a.rowFiles[i], a.rowFiles[j] = a.rowFiles[j], a.rowFiles[i]
+			a.rowLines[i], a.rowLines[j] = a.rowLines[j], a.rowLines[i]
+		}
+		if err := a.flushRows(); err != nil {
+			return err
+		}
+	} else if a.opts.SortBy != "" {
+		a.sortBuffered()
+		if err := a.flushRows(); err != nil {
+			return err
+		}
+	} else if a.opts.Sample > 0 {
+		if err := a.flushRows(); err != nil {
+			return err
+		}
+	}
+
+	a.reportProgress(true)
+
+	if a.stream != nil {
+		if err := a.stream.Flush(); err != nil {
+			return fmt.Errorf("failed to finish streaming the sheet: %v", err)
+		}
+	}
+
+	// Sort the whole data region, keeping the header row in place
+	if len(a.sortKeys) > 0 {
+		firstDataRow := a.headerRow + 1
+		if err := sortSheetRows(a.f, a.opts.SheetName, firstDataRow, a.nextRow-1, a.lastCol, a.sortKeys); err != nil {
+			return fmt.Errorf("failed to sort sheet: %v", err)
+		}
+	}
+
+	// Size the columns that received data, on every sheet of a split
+	if a.contentWidths != nil {
+		for i, part := range a.result.Sheets {
+			headerRow := a.headerRow
+			if i > 0 && a.header != nil {
+				headerRow = 1
+			} else if i > 0 {
+				headerRow = 0
+			}
+			maxChars := a.opts.AutoFitMax
+			if maxChars == 0 {
+				maxChars = maxAutoFitWidth
+			}
+			changed, err := fitColumnWidths(a.f, part.Name, a.contentWidths, headerRow, a.opts.ColumnWidth, maxChars)
+			if err != nil {
+				return fmt.Errorf("failed to set column widths: %v", err)
+			}
+			a.opts.Verbosef("Set the width of %d of %d written columns of sheet %s\n", changed, len(a.contentWidths), part.Name)
+		}
+	}
+
+	// The table and print area stay on the first sheet, which a split
+	// filled to the last row
+	lastRow := a.nextRow - 1
+	if len(a.result.Sheets) > 1 {
+		lastRow = excelize.TotalRows
+	} else if a.opts.InsertRow > 0 {
+		lastRow = a.templateRows + a.result.RowsAppended
+	}
+
+	// Grow the table on the sheet header, and pivot cache ranges ending
+	// with the old data, so slicers and pivot tables see the new rows. A
+	// sheet rewritten from its header row down keeps that row's table,
+	// which now heads the input's own header.
+	tableRow := a.headerRow
+	if tableRow == 0 {
+		tableRow = a.clearedHeader
+	}
+	if table := headerTable(a.tables, tableRow, a.colOffset+1); table != nil && (a.templateRows > 0 || a.clearedHeader > 0) {
+		if err := extendTable(a.f, table, lastRow, a.tableHeader, a.opts.Replace || a.opts.Overwrite, a.opts.Logf, a.opts.Verbosef); err != nil {
+			return fmt.Errorf("failed to extend table: %v", err)
+		}
+	}
+	if a.templateRows > 0 {
+		if err := a.extendPivotCaches(lastRow); err != nil {
+			return fmt.Errorf("failed to extend pivot cache source: %v", err)
+		}
+	}
+	if a.opts.ExtendValidation {
+		if err := a.extendValidations(lastRow); err != nil {
+			return fmt.Errorf("failed to extend data validations: %v", err)
+		}
+	}
+	if a.opts.TableName != "" {
+		if err := a.addDataTable(lastRow); err != nil {
+			return fmt.Errorf("failed to add table %s: %v", a.opts.TableName, err)
+		}
+	}
+
+	if a.opts.FreezeRows > 0 || a.opts.AutoFilter {
+		if err := a.setView(lastRow); err != nil {
+			return err
+		}
+	}
+
+	// Compare the final data extent with the print area
+	if a.opts.CheckPrintArea || a.opts.ExtendPrintArea {
+		if err := fitPrintArea(a.f, a.opts.SheetName, a.lastCol, lastRow, a.opts.ExtendPrintArea, a.opts.Logf); err != nil {
+			return fmt.Errorf("failed to update print area: %v", err)
+		}
+	}
+
+	for i := range a.result.Sheets {
+		if part := &a.result.Sheets[i]; part.Rows > 0 {
+			topLeft, _ := excelize.CoordinatesToCellName(a.colOffset+1, part.firstRow)
+			bottomRight, _ := excelize.CoordinatesToCellName(max(a.lastCol, a.colOffset+1), part.firstRow+part.Rows-1)
+			part.Range = topLeft + ":" + bottomRight
+		}
+	}
+
+	if a.iocs != nil {
+		a.result.IOCsFound = len(a.iocs.order)
+		if err := a.writeIOCSheet(); err != nil {
+			return fmt.Errorf("failed to write the indicators to sheet %s: %v", a.opts.IOCSheet, err)
+		}
+	}
+	if a.opts.OverflowSheet != "" && len(a.overflow) > 0 {
+		if err := a.writeOverflowSheet(); err != nil {
+			return fmt.Errorf("failed to write the truncated values to sheet %s: %v", a.opts.OverflowSheet, err)
+		}
+	}
+	if a.opts.Summary {
+		if err := a.writeSummary(); err != nil {
+			return fmt.Errorf("failed to write the summary to sheet %s: %v", SummarySheet, err)
+		}
+	}
+	if a.opts.Provenance {
+		if err := a.writeImportLog(); err != nil {
+			return fmt.Errorf("failed to record the import on sheet %s: %v", ImportLogSheet, err)
+		}
+	}
+	return nil
+}
+
+// save saves the workbook, unless this is a dry run, and writes its
+// checksum and manifest.
+func (a *sheetAppender) save() error {
+	defer timeTo(&a.result.Timing.Save)()
+	if a.opts.DryRun {
+		return nil
+	}
+	if err := a.ctx.Err(); err != nil {
+		return err
+	}
+
+	// Save the updated Excel file, replacing the output only once the new
+	// one is complete
+	if err := a.backupOutput(); err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to back up %s: %v", a.opts.OutputPath, err))
+	}
+	if a.opts.OutputFormat == "csv" {
+		if err := a.saveCSV(); err != nil {
+			return withKind(ErrSave, fmt.Errorf("failed to save CSV file: %v", err))
+		}
+	} else if err := saveWorkbook(a.f, a.opts.OutputPath, a.opts.Password); err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to save updated Excel file: %v", err))
+	}
+
+	// Write the checksum sidecar once the output file is complete
+	if a.opts.Checksum != "" {
+		sidecar, err := writeChecksum(a.opts.OutputPath, a.opts.Checksum)
+		if err != nil {
+			return withKind(ErrSave, fmt.Errorf("failed to write checksum file: %v", err))
+		}
+		a.result.ChecksumFile = sidecar
+	}
+	if a.opts.Manifest {
+		manifest, err := a.writeManifest()
+		if err != nil {
+			return withKind(ErrSave, fmt.Errorf("failed to write manifest: %v", err))
+		}
+		a.result.ManifestFile = manifest
+	}
+	if a.export != nil {
+		export, err := a.saveExport()
+		if err != nil {
+			return withKind(ErrSave, fmt.Errorf("failed to write NDJSON export: %v", err))
+		}
+		a.result.ExportFile = export
+	}
+	if err := a.removeCheckpoint(); err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to remove checkpoint: %v", err))
+	}
+	return nil
+}
+
+// templateOpenError explains a failure to open the template at path. An
+// encrypted workbook is an OLE compound file, which excelize reports as an
+// unsupported format or a broken zip file whenever it cannot decrypt it, so
+// the file is checked for one. excelize also blames the password for any
+// file that is not a zip archive when a password is given.
+func templateOpenError(path, password string, err error) error {
+	var encrypted bool
+	if file, openErr := os.Open(path); openErr == nil {
+		magic := make([]byte, len(oleMagic))
+		if _, readErr := io.ReadFull(file, magic); readErr == nil && string(magic) == oleMagic {
+			encrypted = true
+		}
+		file.Close()
+	}
+	switch {
+	case encrypted && password == "":
+		return fmt.Errorf("the Excel template %s is password protected; give its password with -tpassword", path)
+	case encrypted:
+		return fmt.Errorf("failed to open Excel template %s: the template password is not correct", path)
+	case errors.Is(err, excelize.ErrWorkbookPassword):
+		return fmt.Errorf("failed to open Excel template %s: not an XLSX workbook", path)
+	}
+	return fmt.Errorf("failed to open Excel template: %v", err)
+}
+
+// addColumnTypes gives ct to each column of the comma separated columns,
+// each a 1-based written column number or a name from header. A column
+// -coerce or another list already typed differently is an error.
+func (a *sheetAppender) addColumnTypes(columns string, ct columnType, header []string) error {
+	for _, part := range strings.Split(columns, ",") {
+		j, err := resolveColumn(strings.TrimSpace(part), header)
+		if err != nil {
+			return err
+		}
+		if j >= excelize.MaxColumns {
+			return fmt.Errorf("invalid column %q", part)
+		}
+		if given, ok := a.columnTypes[j+1]; ok && given.kind != ct.kind {
+			return fmt.Errorf("column %d is already given the type %s", j+1, given.kind)
+		}
+		a.columnTypes[j+1] = ct
+	}
+	return nil
+}
+
+// expandInputs expands glob patterns in the input paths, keeping the given
+// order, and gives every file the source label of its path. A zip archive
+// is expanded to the members its path selects, see zipMembers. Patterns
+// that match nothing are logged and skipped.
+func (a *sheetAppender) expandInputs() error {
+	for i, path := range a.opts.InputPaths {
+		var label, digest, timeCol string
+		if len(a.opts.TimeColumns) > 1 {
+			timeCol = a.opts.TimeColumns[i]
+		}
+		if a.opts.SourceLabels != nil {
+			label = a.opts.SourceLabels[i]
+		}
+		if a.opts.VerifySHA256 != nil {
+			digest = a.opts.VerifySHA256[i]
+		}
+		if path == StdinPath && a.readsStdin {
+			return errors.New("standard input can only be read once")
+		}
+		if path == StdinPath {
+			a.readsStdin = true
+		}
+		var matches []string
+		var err error
+		archive, member, isZip := splitZipPath(path)
+		switch {
+		case IsRemotePath(path):
+			a.inputs = append(a.inputs, path)
+			a.inputLabels = append(a.inputLabels, label)
+			a.inputHashes = append(a.inputHashes, digest)
+			a.inputTimeCols = append(a.inputTimeCols, timeCol)
+			continue
+		case isZip:
+			archives := []string{archive}
+			if strings.ContainsAny(archive, "*?[") {
+				if archives, err = filepath.Glob(archive); err != nil {
+					return fmt.Errorf("invalid input pattern %s: %v", archive, err)
+				}
+				sort.Strings(archives)
+			}
+			for _, archive := range archives {
+				members, err := zipMembers(archive, member)
+				if err != nil {
+					return fmt.Errorf("failed to read zip archive: %v", err)
+				}
+				matches = append(matches, members...)
+			}
+		case !strings.ContainsAny(path, "*?["):
+			a.inputs = append(a.inputs, path)
+			a.inputLabels = append(a.inputLabels, label)
+			a.inputHashes = append(a.inputHashes, digest)
+			a.inputTimeCols = append(a.inputTimeCols, timeCol)
+			continue
+		default:
+			if matches, err = filepath.Glob(path); err != nil {
+				return fmt.Errorf("invalid input pattern %s: %v", path, err)
+			}
+		}
+		// A resumed run's log has the pattern already
+		if len(matches) == 0 && a.resume == nil {
+			if err := a.errLog.Log(logEntry{Kind: logSkippedPattern, Reason: "no matching files", Text: path}); err != nil {
+				return err
+			}
+		}
+		if len(matches) == 0 {
+			a.opts.Logf("No input files match %s\n", path)
+			a.result.FilesSkipped++
+			continue
+		}
+		if !isZip {
+			sort.Strings(matches)
+		}
+		if digest != "" && len(matches) > 1 {
+			return fmt.Errorf("%s matches %d files, but one SHA256 hash is given for it", path, len(matches))
+		}
+		a.inputs = append(a.inputs, matches...)
+		for range matches {
+			a.inputLabels = append(a.inputLabels, label)
+			a.inputHashes = append(a.inputHashes, digest)
+			a.inputTimeCols = append(a.inputTimeCols, timeCol)
+		}
+	}
+	return nil
+}
+
+// appendFile reads one input file, or standard input for StdinPath, and
+// appends its selected lines, with label, or the file name when it is
+// empty, in the source column. When there are several inputs, a file that
+// cannot be opened is logged and skipped.
+func (a *sheetAppender) appendFile(path, label string) error {
+	// Standard input is left open for the caller
+	var file io.ReadCloser
+	var err error
+	archive, member, isZip := splitZipPath(path)
+	switch {
+	case IsRemotePath(path):
+		file, err = openRemote(a.ctx, path)
+	case isZip:
+		file, err = openZipMember(archive, member)
+	case path != StdinPath:
+		file, err = os.Open(path)
+	case a.opts.Stdin != nil:
+		file = io.NopCloser(a.opts.Stdin)
+	default:
+		file = io.NopCloser(os.Stdin)
+	}
+	path = inputName(path)
+	if err != nil && len(a.inputs) == 1 {
+		return withKind(ErrInput, fmt.Errorf("failed to open input file: %v", err))
+	}
+	if err != nil {
+		if err := a.errLog.Log(logEntry{Kind: logSkippedFile, Reason: err.Error()}); err != nil {
+			return err
+		}
+		a.opts.Logf("Failed to open input file, skipping: %v\n", err)
+		a.result.FilesSkipped++
+		if a.opts.StopOnError {
+			return fmt.Errorf("aborting: an input file was skipped and -strict-exit is set. See %s", a.errLog.Where())
+		}
+		return nil
+	}
+	defer file.Close()
+	// The run resumed counted the file it was part way through
+	if a.skipRecords == 0 {
+		a.result.FilesRead++
+		a.result.Files = append(a.result.Files, FileRows{Path: path})
+		a.fileTypes = append(a.fileTypes, nil)
+	}
+	a.opts.Verbosef("Reading %s\n", path)
+	// Name the file in logged lines once there is more than one
+	a.inputFile = filepath.Base(path)
+	if len(a.inputs) > 1 {
+		a.logPrefix = a.inputFile + ": "
+		a.errLog.nameFiles = true
+	}
+
+	// A database is queried by path and a Parquet file read out of order,
+	// rather than either being read as a stream
+	input := bufio.NewReaderSize(a.countBytes(a.hashInput(file)), sniffBytes)
+	magic, _ := input.Peek(len(sqliteMagic))
+	if a.opts.Format == "sqlite" {
+		if string(magic) != sqliteMagic {
+			return withKind(ErrInput, fmt.Errorf("%s is not a SQLite database", path))
+		}
+		reader, err := newSQLiteReader(a.ctx, path, a.opts.Query)
+		if err != nil {
+			return withKind(ErrInput, fmt.Errorf("failed to query SQLite database %s: %v", path, err))
+		}
+		defer reader.Close()
+		a.delim = a.opts.Delimiter
+		a.reader = reader
+		a.rawInput = reader
+		return a.readInput(path, label)
+	}
+	if string(magic) == sqliteMagic {
+		return withKind(ErrInput, fmt.Errorf("%s is a SQLite database; give -query to read it", path))
+	}
+	if a.opts.Format == "parquet" {
+		if !strings.HasPrefix(string(magic), parquetMagic) {
+			return withKind(ErrInput, fmt.Errorf("%s is not a Parquet file", path))
+		}
+		reader, err := newParquetReader(file.(*os.File))
+		if err != nil {
+			return withKind(ErrInput, fmt.Errorf("failed to read Parquet file %s: %v", path, err))
+		}
+		defer reader.Close()
+		a.delim = a.opts.Delimiter
+		a.reader = reader
+		a.rawInput = reader
+		return a.readInput(path, label)
+	}
+	if strings.HasPrefix(string(magic), parquetMagic) {
+		return withKind(ErrInput, fmt.Errorf("%s is a Parquet file; give -f parquet to read it", path))
+	}
+
+	// Decompress gzip input, recognised by its magic bytes whatever its name
+	gzipName := strings.HasSuffix(strings.ToLower(path), ".gz")
+	if magic, _ := input.Peek(len(gzipMagic)); string(magic) == gzipMagic {
+		zr, err := gzip.NewReader(input)
+		if err != nil {
+			return withKind(ErrInput, fmt.Errorf("failed to read compressed input file %s: %v", path, err))
+		}
+		defer zr.Close()
+		if gzipName {
+			a.opts.Verbosef("Decompressing %s\n", path)
+		} else {
+			a.opts.Logf("%s is gzip compressed; decompressing\n", path)
+		}
+		input = bufio.NewReaderSize(zr, sniffBytes)
+	} else if gzipName {
+		a.opts.Logf("%s is not gzip compressed; reading it as is\n", path)
+	}
+
+	// Decode the input to UTF-8 before anything looks at its contents
+	if decoded, detected := decodeInput(input, a.opts.Encoding); decoded != io.Reader(input) {
+		if detected == "windows-1252" {
+			a.opts.Logf("%s is not valid UTF-8; reading it as windows-1252 (-enc chooses the encoding)\n", path)
+		} else if detected != "" {
+			a.opts.Verbosef("Detected %s byte order mark in %s\n", detected, path)
+		}
+		input = bufio.NewReaderSize(decoded, sniffBytes)
+	}
+
+	a.delim = a.opts.Delimiter
+	if a.opts.Format == "json" {
+		reader, err := newJSONReader(input)
+		if err != nil {
+			return withKind(ErrInput, fmt.Errorf("failed to read input file %s: %v", path, err))
+		}
+		a.reader = reader
+		a.rawInput = reader
+	} else if a.opts.Bodyfile {
+		a.reader = bodyfileReader{a.csvReader(path, input)}
+	} else if a.opts.L2tcsv {
+		a.reader = l2tcsvReader{a.csvReader(path, input)}
+	} else {
+		a.reader = a.csvReader(path, input)
+	}
+	return a.readInput(path, label)
+}
+
+// readInput appends the selected lines of the input file at path from
+// a.reader, with label in the source column, see appendFile.
+func (a *sheetAppender) readInput(path, label string) error {
+	a.result.Delimiter = a.delim
+	if a.opts.Separator != "" {
+		a.result.Delimiter = 0
+	}
+	a.lineNumber = 0
+	a.selected = 0
+	a.records = 0
+	if a.skipRecords > 0 {
+		a.selected = a.resume.Selected
+	}
+	a.sawHeader = false
+	a.sawFields = false
+	a.inputName = path
+	a.sourceLabel = label
+	if label == "" {
+		a.sourceLabel = filepath.Base(path)
+	}
+	rowsBefore := a.result.RowsAppended
+	start, flushing := time.Now(), a.flushing
+	err := a.readRecords()
+	a.result.Timing.Read += time.Since(start) - (a.flushing - flushing)
+	if err != nil {
+		return err
+	}
+	if err := a.finishDigest(); err != nil {
+		return withKind(ErrInput, fmt.Errorf("failed to hash input file %s: %v", path, err))
+	}
+	if a.opts.Reverse || a.opts.SortBy != "" || a.opts.Sample > 0 {
+		a.opts.Verbosef("%s: %d lines read\n", path, a.lineNumber)
+		return nil
+	}
+	if err := a.flushRows(); err != nil {
+		return err
+	}
+	a.opts.Verbosef("%s: %d lines read, %d rows appended\n", path, a.lineNumber, a.result.RowsAppended-rowsBefore)
+	return a.takeCheckpoint(true)
+}
+
+// csvReader returns a reader for the delimited input of path, detecting its
+// delimiter first when asked to. The lines read are recorded for the error
+// log in rawInput.
+func (a *sheetAppender) csvReader(path string, input *bufio.Reader) *csv.Reader {
+	lines := newLineRecorder(input)
+	a.rawInput = lines
+	input = bufio.NewReaderSize(lines, sniffBytes)
+	// Without quoting, quotation marks are hidden from the CSV reader
+	if a.opts.Quoting == "none" {
+		input = bufio.NewReaderSize(hideQuotes(lines), sniffBytes)
+	}
+	if a.opts.Separator != "" {
+		input = bufio.NewReaderSize(replaceSeparator(input, a.opts.Separator), sniffBytes)
+	}
+
+	// Sniff the delimiter from the start of the input without consuming it
+	if a.opts.AutoDelimit {
+		sample, _ := input.Peek(sniffBytes)
+		delim, ok := detectDelimiter(sample)
+		if ok {
+			a.opts.Verbosef("Detected delimiter for %s: %s\n", path, delimiterName(delim))
+		} else {
+			a.opts.Logf("Could not detect the delimiter of %s reliably; using %s\n", path, delimiterName(delim))
+		}
+		a.delim = delim
+	}
+
+	// Read the input data with the specified delimiter
+	reader := csv.NewReader(input)
+	reader.Comma = a.delim
+	reader.LazyQuotes = a.opts.Quoting != "strict"
+	reader.Comment = a.opts.Comment
+	// Lines may have any number of fields unless -strict holds them all to
+	// the field count of the first line
+	reader.FieldsPerRecord = -1
+	if a.opts.Strict {
+		reader.FieldsPerRecord = 0
+	}
+	return reader
+}
+
+// prepareSheet checks the target sheet and works out where and how wide the
+// appended rows may be.
+func (a *sheetAppender) prepareSheet() error {
+	sheet := a.opts.SheetName
+
+	// Check if the specified sheet exists
+	sheetExists := false
+	for _, name := range a.f.GetSheetList() {
+		if name == sheet {
+			sheetExists = true
+			break
+		}
+	}
+	if !sheetExists && (!a.opts.CreateSheet || a.opts.SheetCopy != "") {
+		return fmt.Errorf("sheet '%s' does not exist in the template file", sheet)
+	}
+
+	// Append to a copy, leaving the template sheet as it is for the next run
+	if a.opts.SheetCopy != "" {
+		var input string
+		if len(a.opts.InputPaths) > 0 {
+			input = a.opts.InputPaths[0]
+		}
+		name := sheetCopyName(a.opts.SheetCopy, input, time.Now())
+		if strings.Contains(a.opts.SheetCopy, InputToken) {
+			name = unusedSheetName(a.f, name)
+		}
+		if err := copySheet(a.f, sheet, name, a.opts.Logf, a.opts.Verbosef); err != nil {
+			return fmt.Errorf("failed to copy sheet '%s': %v", sheet, err)
+		}
+		a.opts.Logf("Copied sheet %s to %s\n", sheet, name)
+		a.result.CopiedFrom = sheet
+		sheet = name
+		a.opts.SheetName = name
+	}
+	if !sheetExists {
+		if _, err := a.f.NewSheet(sheet); err != nil {
+			return fmt.Errorf("failed to create sheet '%s': %v", sheet, err)
+		}
+		if a.opts.TemplatePath != "" {
+			a.opts.Logf("Created sheet %s\n", sheet)
+		}
+		a.result.SheetCreated = true
+	}
+
+	// Set the active sheet
+	sheetIndex, err := a.f.GetSheetIndex(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to get sheet index: %v", err)
+	}
+	a.f.SetActiveSheet(sheetIndex)
+
+	// Get the number of columns in the template sheet
+	rows, err := a.f.GetRows(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to get rows from sheet: %v", err)
+	}
+	if a.tables, err = a.f.GetTables(sheet); err != nil {
+		return fmt.Errorf("failed to get tables from sheet: %v", err)
+	}
+	if err := a.measureSheet(rows); err != nil {
+		return err
+	}
+
+	// Clear the rows that will be rewritten in overwrite mode, keeping their
+	// formatting. Rows above the start row, such as a header, are kept, and
+	// in replace mode the rows down to the header row.
+	if a.opts.Overwrite || a.opts.Replace {
+		keep := a.opts.StartRow - 1
+		if a.opts.Replace {
+			keep = a.headerRow
+		}
+		if a.opts.IntersectHeaders && keep < a.headerRow {
+			keep = a.headerRow
+		}
+		if keep > len(rows) {
+			keep = len(rows)
+		}
+		// A stream rewrites the sheet from the kept rows anyway
+		if !a.opts.Stream {
+			for r := keep; r < len(rows); r++ {
+				for c := a.colOffset; c < len(rows[r]); c++ {
+					cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+					if err := a.f.SetCellValue(sheet, cell, nil); err != nil {
+						return fmt.Errorf("failed to clear sheet: %v", err)
+					}
+				}
+			}
+		}
+		a.opts.Logf("Cleared %d existing rows of sheet %s from row %d\n", len(rows)-keep, sheet, keep+1)
+		rows = rows[:keep]
+		if a.headerRow > keep {
+			a.clearedHeader, a.headerRow = a.headerRow, 0
+		}
+	}
+
+	// Give the appended source columns headings after the header, unless an
+	// earlier run already added them
+	if headings := a.sourceHeadings(); headings != nil && a.headerRow > 0 {
+		header := rows[a.headerRow-1]
+		if !hasSuffix(header[min(a.colOffset, len(header)):], headings) {
+			for len(header) < a.colOffset {
+				header = append(header, "")
+			}
+			for _, heading := range headings {
+				header = append(header, heading)
+				cell, _ := excelize.CoordinatesToCellName(len(header), a.headerRow)
+				if err := a.f.SetCellValue(sheet, cell, heading); err != nil {
+					return fmt.Errorf("failed to add source column heading: %v", err)
+				}
+			}
+			rows[a.headerRow-1] = header
+		}
+		a.sourceCol = len(header) - len(headings) + 1
+		a.tableHeader = header
+		if len(header) > a.maxCols {
+			a.maxCols = len(header)
+			a.lastCol = a.maxCols
+		}
+	}
+
+	// Keep the sheet header, from the start column on, for aligning input
+	// columns by name
+	if a.opts.IntersectHeaders {
+		if a.headerRow == 0 || len(rows[a.headerRow-1]) <= a.colOffset {
+			return fmt.Errorf("sheet '%s' has no header row to match -intersect-headers against", sheet)
+		}
+		a.templateHeader = rows[a.headerRow-1][a.colOffset:]
+		if a.opts.SourceColumn == "prepend" {
+			a.templateHeader = a.templateHeader[1:]
+		} else {
+			a.templateHeader = a.templateHeader[:len(a.templateHeader)-len(a.sourceHeadings())]
+		}
+	}
+
+	// Columns forced to text or dates may be named by the sheet header
+	var header []string
+	if a.headerRow > 0 && len(rows[a.headerRow-1]) > a.colOffset {
+		header = rows[a.headerRow-1][a.colOffset:]
+	}
+	if a.opts.TextColumns != "" {
+		if err := a.addColumnTypes(a.opts.TextColumns, columnType{kind: "text"}, header); err != nil {
+			return fmt.Errorf("invalid text columns: %v", err)
+		}
+	}
+	if a.opts.DateColumns != "" {
+		if err := a.addColumnTypes(a.opts.DateColumns, columnType{kind: "timestamp", layout: a.opts.DateLayout, format: a.opts.DateFormat}, header); err != nil {
+			return fmt.Errorf("invalid date columns: %v", err)
+		}
+	}
+	if a.opts.DefangColumns != "" {
+		a.defangCols = make(map[int]bool)
+		for _, part := range strings.Split(a.opts.DefangColumns, ",") {
+			j, err := resolveColumn(strings.TrimSpace(part), header)
+			if err != nil {
+				return fmt.Errorf("invalid defang columns: %v", err)
+			}
+			a.defangCols[j+1] = true
+		}
+	}
+	a.exportHeader = header
+	if err := a.resolveTransforms(header); err != nil {
+		return fmt.Errorf("invalid transforms file: %v", err)
+	}
+	if a.opts.SortBy != "" {
+		j, err := resolveColumn(strings.TrimSpace(a.opts.SortBy), header)
+		if err != nil {
+			return fmt.Errorf("invalid sort column: %v", err)
+		}
+		a.sortCol = j
+	}
+	if a.opts.SummaryColumns != "" {
+		for _, part := range strings.Split(a.opts.SummaryColumns, ",") {
+			j, err := resolveColumn(strings.TrimSpace(part), header)
+			if err != nil {
+				return fmt.Errorf("invalid summary columns: %v", err)
+			}
+			name, _ := excelize.ColumnNumberToName(a.colOffset + j + 1)
+			name = "column " + name
+			if j < len(header) && strings.TrimSpace(header[j]) != "" {
+				name = strings.TrimSpace(header[j])
+			}
+			a.summaryCols = append(a.summaryCols, j)
+			a.summaryNames = append(a.summaryNames, name)
+			a.valueCounts = append(a.valueCounts, make(map[string]int))
+		}
+	}
+	if len(a.linkDirectives) > 0 {
+		a.links = make(map[int]string)
+		a.linkStyles = make(map[int]int)
+		for _, lc := range a.linkDirectives {
+			for _, column := range lc.columns {
+				j, err := resolveColumn(column, header)
+				if err != nil {
+					return fmt.Errorf("invalid link columns: %v", err)
+				}
+				a.links[j+1] = lc.url
+			}
+		}
+	}
+	if a.mapping != nil {
+		if err := a.resolveMapSheet(header); err != nil {
+			return fmt.Errorf("invalid column map: %v", err)
+		}
+	}
+
+	// Remember the data rows already on the sheet, as stored, to skip
+	// duplicates. A key column past the header would make every key alike.
+	if a.seen != nil {
+		for _, col := range a.dedupeCols {
+			if header != nil && col >= len(header) {
+				return fmt.Errorf("invalid dedupe columns: column %d is past the %d columns of the header of sheet '%s'", col+1, len(header), sheet)
+			}
+		}
+		raw, err := a.f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return fmt.Errorf("failed to get rows from sheet: %v", err)
+		}
+		for _, row := range raw[min(a.headerRow, len(rows)):len(rows)] {
+			if len(row) > a.colOffset {
+				a.seen[rowSignature(row[a.colOffset:], a.dedupeCols)]++
+			}
+		}
+	}
+
+	// Get the next empty row in the target sheet, or the row to insert at
+	a.nextRow = len(rows) + 1
+	if a.opts.InsertRow > 0 {
+		if a.opts.InsertRow <= a.headerRow {
+			return fmt.Errorf("cannot insert rows at row %d, at or above the header in row %d of sheet '%s'", a.opts.InsertRow, a.headerRow, sheet)
+		}
+		if a.opts.InsertRow > a.nextRow {
+			return fmt.Errorf("cannot insert rows at row %d: sheet '%s' ends at row %d", a.opts.InsertRow, sheet, len(rows))
+		}
+		a.nextRow = a.opts.InsertRow
+	}
+	a.templateRows = len(rows)
+	for _, row := range rows {
+		if len(row) > a.templateCols {
+			a.templateCols = len(row)
+		}
+	}
+	a.sheet = sheet
+	a.result.Sheets = []SheetRows{{Name: sheet}}
+
+	// Warn when slicers and pivot tables will not see the appended rows
+	if err := a.checkDataSources(); err != nil {
+		return err
+	}
+
+	// Take the styles of the last data row, below the header, for the rows
+	// about to be written
+	if (a.opts.CopyStyle || a.opts.Validate) && len(rows) <= a.headerRow {
+		a.opts.Logf("Sheet %s has no data row to copy cell styles from\n", sheet)
+	} else if a.opts.CopyStyle || a.opts.Validate {
+		for c := 1; c <= a.templateCols; c++ {
+			cell, _ := excelize.CoordinatesToCellName(c, len(rows))
+			style, err := a.f.GetCellStyle(sheet, cell)
+			if err != nil {
+				return fmt.Errorf("failed to get cell styles: %v", err)
+			}
+			a.rowStyles = append(a.rowStyles, style)
+		}
+		a.opts.Verbosef("Copying cell styles from row %d\n", len(rows))
+		if a.opts.Validate {
+			if err := a.addTemplateTypes(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Keep the header row to start any sheets added by a split, since a
+	// streamed sheet cannot be read back
+	if a.opts.Split && len(rows) > 0 {
+		if err := a.keepHeader(len(rows[0])); err != nil {
+			return fmt.Errorf("failed to read sheet header: %v", err)
+		}
+	}
+	return nil
+}
+
+// measureSheet works out how many columns the appended rows may fill and
+// which row holds the column headings. An explicit HeaderRow gives both.
+// Otherwise a table on the sheet does, taking the one reaching furthest
+// right, and failing that the widest of the first headerScanRows rows gives
+// the width with the headings on row 1. An empty sheet takes any width.
+func (a *sheetAppender) measureSheet(rows [][]string) error {
+	sheet := a.opts.SheetName
+	var table *excelize.Table
+	for i := range a.tables {
+		_, _, col2, _, err := tableRange(&a.tables[i])
+		if err != nil {
+			return err
+		}
+		if table == nil || col2 > a.maxCols {
+			table = &a.tables[i]
+			a.maxCols = col2
+		}
+	}
+	switch {
+	case a.opts.HeaderRow > 0:
+		if a.opts.HeaderRow > len(rows) || len(rows[a.opts.HeaderRow-1]) == 0 {
+			return fmt.Errorf("header row %d of sheet '%s' is empty", a.opts.HeaderRow, sheet)
+		}
+		a.headerRow = a.opts.HeaderRow
+		a.maxCols = len(rows[a.headerRow-1])
+		a.opts.Verbosef("Sheet %s is %d columns wide, from header row %d\n", sheet, a.maxCols, a.headerRow)
+	case table != nil:
+		_, a.headerRow, _, _, _ = tableRange(table)
+		a.opts.Verbosef("Sheet %s is %d columns wide, from table %s (%s)\n", sheet, a.maxCols, table.Name, table.Range)
+	case len(rows) > 0:
+		widest := 0
+		for r := 1; r < len(rows) && r < headerScanRows; r++ {
+			if len(rows[r]) > len(rows[widest]) {
+				widest = r
+			}
+		}
+		a.headerRow = 1
+		a.maxCols = len(rows[widest])
+		a.opts.Verbosef("Sheet %s is %d columns wide, from row %d, the widest of its first rows\n", sheet, a.maxCols, widest+1)
+	default:
+		// If there are no rows, assume a large number of columns
+		a.maxCols = excelize.MaxColumns
+		return nil
+	}
+	a.lastCol = a.maxCols
+	return nil
+}
+
+// readRecords reads every record of the current input file and buffers the
+// selected ones.
+func (a *sheetAppender) readRecords() error {
+	// A blank record is held back until the next read so that a single empty
+	// record at the very end of the file can be dropped. Row counts are then
+	// the same whether or not the file ends with a stray blank line.
+	var heldRecord []string
+	var heldErr error
+	var heldLine int
+	var holding, readFirst bool
+	next, stop := a.readAhead()
+	defer stop()
+	for {
+		// Give up between records once the caller cancels
+		select {
+		case <-a.ctx.Done():
+			return a.ctx.Err()
+		default:
+		}
+		// Stop reading once past the last line or row wanted
+		if (a.opts.EndRow > 0 && a.lineNumber >= a.opts.EndRow) || (a.opts.MaxRows > 0 && a.selected >= a.opts.MaxRows) {
+			if holding {
+				return a.processRecord(heldRecord, heldErr, heldLine)
+			}
+			break
+		}
+		if a.opts.Head > 0 && a.taken >= a.opts.Head {
+			a.result.HeadReached = true
+			if holding {
+				return a.processRecord(heldRecord, heldErr, heldLine)
+			}
+			break
+		}
+		pr := next()
+		record, err := pr.record, pr.err
+		if errors.Is(err, io.EOF) {
+			if holding {
+				a.result.DroppedTrailing++
+			}
+			break
+		}
+		a.tickProgress(a.inputName)
+		// Only parse errors, csv.ErrFieldCount under -strict and malformed
+		// quoting, are confined to a line; a failing read, such as corrupt
+		// compressed input, would fail again on every call
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return withKind(ErrInput, fmt.Errorf("failed to read input file %s: %v", a.inputName, err))
+		}
+		// A UTF-8 byte order mark is otherwise kept as an invisible prefix
+		// of the first field, breaking exact matches on that value
+		if !readFirst && len(record) > 0 {
+			readFirst = true
+			if strings.HasPrefix(record[0], utf8BOM) {
+				record[0] = strings.TrimPrefix(record[0], utf8BOM)
+				a.opts.Verbosef("Removed a byte order mark from the first field\n")
+			}
+		}
+		// Skipped blank lines are not counted, like empty and comment lines
+		if a.opts.SkipBlank && isBlankRecord(record) {
+			if a.records >= a.skipRecords {
+				a.result.BlankSkipped++
+			}
+			continue
+		}
+		line := pr.line
+		if holding {
+			if err := a.processRecord(heldRecord, heldErr, heldLine); err != nil {
+				return err
+			}
+			holding = false
+		}
+		// Only delimited input has stray blank lines; a JSON object, query
+		// result or Parquet row without values is still a row
+		if isBlankRecord(record) && a.opts.Format == "csv" {
+			heldRecord, heldErr, heldLine, holding = record, err, line, true
+			continue
+		}
+		if err := a.processRecord(record, err, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordLine returns the input line number on which the record reader just
+// read, or the one that failed to parse, starts.
+func recordLine(reader recordReader, record []string, err error) int {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine
+	}
+	if record == nil {
+		return 0
+	}
+	line, _ := reader.FieldPos(0)
+	return line
+}
+
+// processRecord handles a single result of reader.Read.
+func (a *sheetAppender) processRecord(record []string, err error, line int) error {
+	// Earlier lines are not needed for the error log any more
+	a.rawInput.forget(line)
+	a.records++
+	var padded bool
+	record, padded, err = a.fitRecord(record, err)
+	if err != nil && (a.records <= a.skipRecords || a.splitRest) {
+		return nil
+	}
+	if err != nil {
+		// Write the erroneous lines to the error log as they are in the
+		// file. The reader returns the fields of a line with the wrong
+		// number of fields but nothing for other parse errors, which may
+		// run over several lines.
+		last := line
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			err = parseErr.Err
+			if parseErr.Line > last {
+				last = parseErr.Line
+			}
+		}
+		entry := logEntry{Kind: logReadError, File: a.inputFile, Line: line, Reason: err.Error()}
+		raw := a.rawInput.rawLines(line, last)
+		switch {
+		case len(raw) == 1:
+			entry.Text = raw[0]
+		case len(raw) > 1:
+			entry.LastLine = line + len(raw) - 1
+			if len(raw) > maxLoggedLines {
+				entry.More = len(raw) - maxLoggedLines
+				raw = raw[:maxLoggedLines]
+			}
+			entry.Text = strings.Join(raw, "\n")
+		case record != nil:
+			entry.Text = strings.Join(record, a.delimiter())
+		}
+		if a.opts.Quoting == "none" {
+			entry.Reason = strings.ReplaceAll(entry.Reason, quoteStandIn, "\"")
+			entry.Text = strings.ReplaceAll(entry.Text, quoteStandIn, "\"")
+		}
+		if err := a.errLog.Log(entry); err != nil {
+			return err
+		}
+		a.result.ErrorCount++
+		a.result.Files[len(a.result.Files)-1].Failed++
+		return a.checkMaxErrors()
+	}
+	// Trim before anything else, so filters and header names see the
+	// trimmed values
+	if a.opts.Trim {
+		for i := range record {
+			record[i] = trimField(record[i])
+		}
+	}
+	// Payload fields become columns of their own, encoded values are
+	// decoded and looked up values added before anything else sees the line
+	if a.opts.Flatten != "" {
+		if record, err = a.flattenRecord(record, line); err != nil {
+			return err
+		}
+	}
+	if a.decodes != nil {
+		if record, err = a.decodeRecord(record, line); err != nil {
+			return err
+		}
+	}
+	if a.enriches != nil {
+		if record, err = a.enrichRecord(record); err != nil {
+			return err
+		}
+	}
+	if !a.sawFields {
+		a.sawFields = true
+		if err := a.checkFirstLine(record); err != nil {
+			return err
+		}
+	}
+	input := record
+	repeated := a.repeatsHeader(record)
+
+	// Select and reorder the input columns before anything else sees them
+	if a.selectMap != nil {
+		record = remapRecord(record, a.selectMap)
+	} else if a.dropped != nil {
+		record = remapRecord(record, keptColumns(len(record), a.dropped))
+	}
+	if a.mapping != nil {
+		record = a.mapRecord(record)
+	}
+
+	// The first line of each file of a merged timeline is its header, and a
+	// created sheet starts with the timeline's own
+	if a.opts.TimeColumns != nil && !a.sawHeader {
+		a.sawHeader = true
+		a.lineNumber++
+		if err := a.readTimelineHeader(record); err != nil {
+			return err
+		}
+		if a.opts.CreateHeader && a.result.SheetCreated && !a.wroteHeader {
+			a.wroteHeader = true
+			if err := a.writeHeader(timelineHeader); err != nil {
+				return fmt.Errorf("failed to write sheet header: %v", err)
+			}
+		}
+		return nil
+	}
+
+	// A created sheet starts with the first line of the first input
+	if a.opts.CreateHeader && a.result.SheetCreated && !a.wroteHeader {
+		a.wroteHeader = true
+		if err := a.writeHeader(record); err != nil {
+			return fmt.Errorf("failed to write sheet header: %v", err)
+		}
+		if !a.opts.LockSchema {
+			a.lineNumber++
+			return nil
+		}
+	}
+
+	// The first line of each file holds its headers when aligning by name
+	if (a.opts.IntersectHeaders || a.opts.LockSchema) && !a.sawHeader {
+		a.sawHeader = true
+		a.lineNumber++
+		return a.readHeader(record)
+	}
+	if a.records <= a.skipRecords {
+		// Appended, filtered out or logged by the run resumed
+	} else if a.lineNumber >= a.opts.StartRow-1 && a.splitBy != nil && a.splitValues == nil && !a.splitBy.match(input) {
+		// A line of another value's sheet
+	} else if a.lineNumber >= a.opts.StartRow-1 && repeated {
+		a.opts.Debugf(a.logPrefix+"Line %d repeats the header; skipped\n", line)
+		a.result.RepeatedHeaders++
+	} else if a.lineNumber >= a.opts.StartRow-1 && !a.matchFilters(input) {
+		a.opts.Debugf(a.logPrefix+"Line %d filtered out\n", line)
+		a.result.FilteredOut++
+	} else if a.lineNumber >= a.opts.StartRow-1 && a.splitValues != nil {
+		a.splitValues[a.splitBy.field(input)] = true
+	} else if a.lineNumber >= a.opts.StartRow-1 {
+		if a.opts.TimeColumns != nil {
+			record = a.timelineRecord(record)
+		}
+		if a.schemaMap != nil {
+			record = remapRecord(record, a.schemaMap)
+		}
+		if a.columnMap != nil {
+			record = remapRecord(record, a.columnMap)
+		}
+		if tr, ok := a.reader.(typedReader); ok && a.fileTypes[len(a.fileTypes)-1] == nil {
+			a.fileTypes[len(a.fileTypes)-1] = a.writtenTypes(tr.inputTypes())
+		}
+		// Remove quotation marks left in the parsed fields only when asked,
+		// since embedded quotes are often part of the evidence
+		if a.opts.StripQuotes {
+			for i := range record {
+				record[i] = strings.ReplaceAll(record[i], "\"", "")
+			}
+		}
+		if a.opts.SourceColumn != "" || a.opts.Annotate == "columns" {
+			record = a.addSource(record, line)
+		}
+		for j := range record {
+			if a.transforms != nil {
+				if value, ok := a.transform(j, record[j]); ok {
+					record[j] = value
+					a.result.TransformedCells++
+				}
+			}
+			if a.defangCols[j+1] {
+				record[j] = defang(record[j])
+			}
+			if a.opts.SanitizeFormulas {
+				if value, ok := sanitizeFormula(record[j]); ok {
+					record[j] = value
+					a.result.SanitizedCells++
+				}
+			}
+		}
+		a.taken++
+		if a.opts.Sample > 0 {
+			a.sampleRow(record, line)
+		} else {
+			a.csvData = append(a.csvData, record)
+			a.rowFiles = append(a.rowFiles, len(a.result.Files)-1)
+			a.rowLines = append(a.rowLines, line)
+			a.bufferedBytes += recordBytes(record)
+		}
+		a.selected++
+		if padded {
+			a.result.PaddedRows++
+		}
+		if a.opts.ChunkSize > 0 && len(a.csvData) >= a.opts.ChunkSize {
+			if err := a.flushRows(); err != nil {
+				return err
+			}
+			if err := a.takeCheckpoint(false); err != nil {
+				return err
+			}
+		} else if a.opts.MaxMemory > 0 && a.bufferedBytes > a.opts.MaxMemory {
+			if err := a.spillRows(); err != nil {
+				return err
+			}
+		}
+	}
+	a.lineNumber++
+	return nil
+}
+
+// writeHeader writes the first input line, with the columns selected as
+// for the data, as row 1 of the sheet that was created, in bold and frozen
+// above the rows that follow. The line is not appended again, and an added
+// source column is headed sourceHeading, and the annotation columns too.
+func (a *sheetAppender) writeHeader(record []string) error {
+	header := append([]string(nil), record...)
+	if a.opts.SourceColumn == "prepend" {
+		header = append([]string{sourceHeading}, header...)
+	} else if headings := a.sourceHeadings(); headings != nil {
+		header = a.addSource(header, 0)
+		copy(header[len(header)-len(headings):], headings)
+	}
+	if a.colOffset+len(header) > a.maxCols {
+		return fmt.Errorf("the header has %d fields, more than the sheet's %d columns", len(header), a.maxCols-a.colOffset)
+	}
+	style, err := a.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	panes := frozenPanes(max(a.opts.FreezeRows, 1))
+	cells := make([]interface{}, a.colOffset+len(header))
+	for j, value := range header {
+		cells[a.colOffset+j] = excelize.Cell{StyleID: style, Value: value}
+		if a.contentWidths != nil && textWidth(value) > a.contentWidths[a.colOffset+j+1] {
+			a.contentWidths[a.colOffset+j+1] = textWidth(value)
+		}
+	}
+	if a.stream != nil {
+		if err := a.stream.SetPanes(panes); err != nil {
+			return err
+		}
+		if err := a.stream.SetRow("A1", cells); err != nil {
+			return err
+		}
+	} else {
+		for j, value := range header {
+			cell, _ := excelize.CoordinatesToCellName(a.colOffset+j+1, 1)
+			if err := a.f.SetCellValue(a.sheet, cell, value); err != nil {
+				return err
+			}
+			if err := a.f.SetCellStyle(a.sheet, cell, cell, style); err != nil {
+				return err
+			}
+		}
+		if err := a.f.SetPanes(a.sheet, panes); err != nil {
+			return err
+		}
+	}
+
+	// Sheets added by a split start with the same header
+	if a.opts.Split {
+		a.header = make([]sheetCell, a.colOffset, len(cells))
+		for _, value := range header {
+			a.header = append(a.header, sheetCell{value: value, kind: excelize.CellTypeSharedString, style: style})
+		}
+	}
+	if a.colOffset+len(header) > a.lastCol {
+		a.lastCol = a.colOffset + len(header)
+	}
+	a.exportHeader = header
+	a.headerRow = 1
+	a.nextRow = 2
+	return nil
+}
+
+// writtenTypes returns the types of an input's columns, see typedReader,
+// keyed by the 1-based written column each ends up in once -cols, -map and
+// the header alignment have moved it.
+func (a *sheetAppender) writtenTypes(types []columnType) map[int]columnType {
+	cols := make([]int, len(types))
+	for i := range cols {
+		cols[i] = i
+	}
+	if a.dropped != nil {
+		cols = remapColumns(cols, keptColumns(len(cols), a.dropped))
+	}
+	for _, columnMap := range [][]int{a.selectMap, a.mapCols, a.schemaMap, a.columnMap} {
+		if columnMap != nil {
+			cols = remapColumns(cols, columnMap)
+		}
+	}
+	if a.opts.SourceColumn == "prepend" {
+		cols = append([]int{-1}, cols...)
+	}
+	written := make(map[int]columnType)
+	for i, j := range cols {
+		if j >= 0 && types[j].kind != "" {
+			written[i+1] = types[j]
+		}
+	}
+	return written
+}
+
+// addSource adds the source label of the current file to record, first or
+// in the source column after the header, followed by line, the input line
+// of the record, in the column after it for Annotate "columns". Without a
+// header the source columns follow the first appended row. A record wider
+// than the header keeps all its fields, so flushRows rejects it as too wide.
+func (a *sheetAppender) addSource(record []string, line int) []string {
+	if a.opts.SourceColumn == "prepend" {
+		return append([]string{a.sourceLabel}, record...)
+	}
+	values := []string{a.sourceLabel}
+	if a.opts.Annotate == "columns" {
+		values = append(values, strconv.Itoa(line))
+	}
+	if a.sourceCol == 0 {
+		a.sourceCol = a.colOffset + len(record) + 1
+		a.maxCols = a.sourceCol + len(values) - 1
+	}
+	for a.colOffset+len(record) < a.sourceCol-1 {
+		record = append(record, "")
+	}
+	return append(record, values...)
+}
+
+// sourceHeadings returns the headings of the columns addSource adds after
+// the header, nil when it adds none there.
+func (a *sheetAppender) sourceHeadings() []string {
+	switch {
+	case a.opts.Annotate == "columns":
+		return []string{sourceHeading, lineHeading}
+	case a.opts.SourceColumn == "append":
+		return []string{sourceHeading}
+	}
+	return nil
+}
+
+// hasSuffix reports whether row ends with the values of suffix.
+func hasSuffix(row, suffix []string) bool {
+	if len(row) < len(suffix) {
+		return false
+	}
+	for i, value := range suffix {
+		if row[len(row)-len(suffix)+i] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFirstLine checks the -cols list against the first line of the
+// current input file and resolves -drop-cols, -where, -exclude and -map
+// column names from it.
+func (a *sheetAppender) checkFirstLine(record []string) error {
+	for _, j := range a.selectMap {
+		if j >= len(record) {
+			return fmt.Errorf("column %d of -cols is out of range: %s has %d fields on its first line", j+1, a.inputName, len(record))
+		}
+	}
+	if a.opts.DropColumns != "" {
+		var err error
+		if a.dropped, err = dropColumns(a.opts.DropColumns, record); err != nil {
+			return fmt.Errorf("-drop-cols %s: %v of %s", a.opts.DropColumns, err, a.inputName)
+		}
+	}
+	for _, fe := range a.filters {
+		if err := fe.resolve(record); err != nil {
+			name := "-where"
+			if fe.exclude {
+				name = "-exclude"
+			}
+			return fmt.Errorf("%s %s: %v of %s", name, fe.text, err, a.inputName)
+		}
+	}
+	if a.splitBy != nil {
+		if err := a.resolveSplit(record); err != nil {
+			return err
+		}
+	}
+	if a.mapping != nil {
+		return a.resolveMapSources(record)
+	}
+	return nil
+}
+
+// matchFilters reports whether record satisfies every -where expression
+// and none of the -exclude ones.
+func (a *sheetAppender) matchFilters(record []string) bool {
+	for _, fe := range a.filters {
+		if fe.match(record) == fe.exclude {
+			return false
+		}
+	}
+	return true
+}
+
+// readHeader sets up the column mappings from the header line of the current
+// input file. With LockSchema the first file's header becomes the canonical
+// schema and later files are reconciled to it by name; with
+// IntersectHeaders the resulting columns are then aligned to the sheet
+// header.
+func (a *sheetAppender) readHeader(header []string) error {
+	a.schemaMap = nil
+	if a.opts.LockSchema {
+		if a.canonicalHeader == nil {
+			a.canonicalHeader = append([]string(nil), header...)
+		} else {
+			var dropped, blank []string
+			a.schemaMap, dropped, blank = intersectColumns(header, a.canonicalHeader)
+			a.logColumns("Columns not in the first file's header (dropped)", dropped)
+			a.logColumns("First file's columns missing (left blank)", blank)
+			if len(dropped) == 0 && len(blank) == 0 {
+				a.opts.Verbosef(a.logPrefix+"Schema matches the first file (%d columns)\n", len(header))
+			}
+		}
+		// The sheet mapping follows the canonical header, so it only changes once
+		if a.columnMap != nil {
+			return nil
+		}
+		header = a.canonicalHeader
+	}
+	if !a.opts.IntersectHeaders {
+		return nil
+	}
+	var dropped, blank []string
+	a.columnMap, dropped, blank = intersectColumns(header, a.templateHeader)
+	a.logColumns("Sheet columns not in input header (left blank)", blank)
+	if !a.opts.KeepUnmatched {
+		a.logColumns("Input columns not in sheet header (dropped)", dropped)
+		return nil
+	}
+
+	// Give each unmatched input column a new sheet column after the header,
+	// which later files then match by name
+	for _, j := range unmatchedColumns(a.columnMap, len(header)) {
+		a.columnMap = append(a.columnMap, j)
+		a.templateHeader = append(a.templateHeader, header[j])
+		cell, _ := excelize.CoordinatesToCellName(a.colOffset+len(a.templateHeader), 1)
+		if err := a.f.SetCellValue(a.opts.SheetName, cell, header[j]); err != nil {
+			return err
+		}
+	}
+	a.maxCols = a.colOffset + len(a.templateHeader)
+	a.logColumns("Input columns not in sheet header (added after the last column)", dropped)
+	return nil
+}
+
+// logColumns reports a list of column names, if there are any.
+func (a *sheetAppender) logColumns(label string, names []string) {
+	if len(names) > 0 {
+		a.opts.Logf(a.logPrefix+"%s: %s\n", label, strings.Join(names, ", "))
+	}
+}
+
+// flushRows appends the buffered input data, first any of it spilled to
+// disk, to the Excel sheet and releases the buffer.
+func (a *sheetAppender) flushRows() error {
+	defer timeTo(&a.flushing)()
+	// Make room for the rows among the existing ones first
+	if a.opts.InsertRow > 0 {
+		if n := a.insertCount(); n > 0 {
+			if err := a.insertRows(n); err != nil {
+				return fmt.Errorf("failed to insert rows: %v", err)
+			}
+		}
+	}
+	rowsBefore := a.result.RowsAppended
+	if err := a.writeSpilled(); err != nil {
+		return err
+	}
+	if err := a.writeRows(); err != nil {
+		return err
+	}
+	if n := a.result.RowsAppended - rowsBefore; n > 0 {
+		a.opts.Debugf("Wrote %d rows, up to row %d of sheet %s\n", n, a.nextRow-1, a.sheet)
+	}
+	a.csvData = a.csvData[:0]
+	a.rowFiles = a.rowFiles[:0]
+	a.rowLines = a.rowLines[:0]
+	a.bufferedBytes = 0
+	return nil
+}
+
+// writeRows writes the buffered rows to the sheet, see flushRows.
+func (a *sheetAppender) writeRows() error {
+	converted, stop := a.convertRows()
+	defer stop()
+	for i, row := range a.csvData {
+		cells := converted()
+		file := &a.result.Files[a.rowFiles[i]]
+		fileName, line := filepath.Base(file.Path), a.rowLines[i]
+		// Log lines with more fields than available columns
+		if a.colOffset+len(row) > a.maxCols && a.opts.Ragged == "truncate" {
+			row = a.sheetFields(row)
+			a.result.TruncatedRows++
+		} else if a.colOffset+len(row) > a.maxCols {
+			rawLine := strings.Join(row, a.delimiter())
+			if err := a.errLog.Log(logEntry{Kind: logNotAppended, File: fileName, Line: line, Reason: "too many fields", Text: rawLine}); err != nil {
+				return err
+			}
+			a.result.NotAppendedCount++
+			file.Failed++
+			if err := a.checkMaxErrors(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Skip rows already on the sheet or earlier in the input
+		if a.seen != nil && a.skipSeen(a.seen, rowSignature(row, a.dedupeCols)) {
+			if a.result.Duplicates < maxLoggedDuplicates {
+				a.opts.Verbosef(a.logPrefix+"Duplicate row skipped: %s\n", strings.Join(rowKey(row, a.dedupeCols), a.delimiter()))
+			} else {
+				a.opts.Debugf(a.logPrefix+"Duplicate row skipped: %s\n", strings.Join(rowKey(row, a.dedupeCols), a.delimiter()))
+			}
+			a.result.Duplicates++
+			continue
+		}
+
+		// Excel sheets have a fixed number of rows
+		if a.nextRow > excelize.TotalRows {
+			if err := a.nextSheet(); err != nil {
+				return err
+			}
+		}
+		// The first row written to an empty sheet is its header
+		if a.opts.Split && a.nextRow == 1 && len(a.result.Sheets) == 1 {
+			a.header = make([]sheetCell, a.colOffset, a.colOffset+len(row))
+			for _, value := range row {
+				a.header = append(a.header, sheetCell{value: value, kind: excelize.CellTypeSharedString})
+			}
+		}
+		sheet := a.sheet
+
+		if a.colOffset+len(row) > a.lastCol {
+			a.lastCol = a.colOffset + len(row)
+		}
+		// A streamed row is written from column A, so that formula columns
+		// before the start column fit in it
+		var streamed []interface{}
+		if a.stream != nil {
+			streamed = make([]interface{}, a.colOffset+len(row))
+		}
+		highlighted := false
+		for j, value := range row {
+			cell, _ := excelize.CoordinatesToCellName(a.colOffset+j+1, a.nextRow)
+			c := cells[j]
+			// Record every written column, even one holding only empty values
+			if a.contentWidths != nil && c.width >= a.contentWidths[a.colOffset+j+1] {
+				a.contentWidths[a.colOffset+j+1] = c.width
+			}
+			typed := c.typed
+			if s, ok := typed.(string); ok {
+				if cut, truncated := a.fitCell(s); truncated {
+					if err := a.logTruncated(cell, fileName, line, s); err != nil {
+						return err
+					}
+					typed = cut
+				}
+			}
+			if ct := a.columnTypes[j+1]; c.err != nil && ct.validated {
+				name, _ := excelize.ColumnNumberToName(a.colOffset + j + 1)
+				reason := fmt.Sprintf("column %s, expected %s", name, ct.kind)
+				if err := a.errLog.Log(logEntry{Kind: logTypeMismatch, File: fileName, Line: line, Reason: reason, Text: value}); err != nil {
+					return err
+				}
+				a.result.TypeMismatches[a.colOffset+j+1]++
+			} else if c.err != nil {
+				reason := fmt.Sprintf("column %d as %s", j+1, ct.kind)
+				if err := a.errLog.Log(logEntry{Kind: logNotCoerced, File: fileName, Line: line, Reason: reason, Text: value}); err != nil {
+					return err
+				}
+				a.result.CoerceFailures++
+			}
+			style, err := a.cellStyle(a.copiedStyle(a.colOffset+j+1), c.code)
+			if err != nil {
+				return err
+			}
+			if len(c.iocs) > 0 {
+				a.addIOCs(c.iocs, cell)
+			}
+			// Fill the cells holding a -highlight keyword
+			if c.highlight {
+				if style, err = a.highlightStyle(style); err != nil {
+					return err
+				}
+				highlighted = true
+			}
+			link, linked := a.links[j+1]
+			if linked && value != "" {
+				if style, err = a.linkStyle(style); err != nil {
+					return err
+				}
+			}
+			if t, ok := typed.(time.Time); ok {
+				a.result.Sheets[len(a.result.Sheets)-1].noteTime(t)
+			}
+			if typed == nil && style == 0 {
+				continue
+			}
+			if streamed != nil {
+				streamed[a.colOffset+j] = excelize.Cell{StyleID: style, Value: typed}
+				continue
+			}
+			if typed != nil {
+				if err := a.f.SetCellValue(sheet, cell, typed); err != nil {
+					return err
+				}
+			}
+			if style != 0 {
+				if err := a.f.SetCellStyle(sheet, cell, cell, style); err != nil {
+					return err
+				}
+			}
+			if linked && value != "" {
+				if err := a.setLink(cell, link, value); err != nil {
+					return fmt.Errorf("failed to link cell %s: %v", cell, err)
+				}
+			}
+		}
+
+		// Formulas take the place of any field written to their column
+		for _, fc := range a.formulas {
+			if fc.col > a.lastCol {
+				a.lastCol = fc.col
+			}
+			style, err := a.cellStyle(a.copiedStyle(fc.col), a.opts.NumberFormat)
+			if err != nil {
+				return err
+			}
+			if streamed != nil {
+				for len(streamed) < fc.col {
+					streamed = append(streamed, nil)
+				}
+				streamed[fc.col-1] = excelize.Cell{StyleID: style, Formula: fc.at(a.nextRow)}
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(fc.col, a.nextRow)
+			if err := a.f.SetCellFormula(sheet, cell, fc.at(a.nextRow)); err != nil {
+				return err
+			}
+			if style != 0 {
+				if err := a.f.SetCellStyle(sheet, cell, cell, style); err != nil {
+					return err
+				}
+			}
+		}
+		if streamed != nil {
+			cell, _ := excelize.CoordinatesToCellName(1, a.nextRow)
+			if err := a.stream.SetRow(cell, streamed); err != nil {
+				return err
+			}
+		}
+		if a.opts.Annotate == "comment" {
+			if err := a.annotateRow(sheet, fileName, line); err != nil {
+				return fmt.Errorf("failed to annotate row %d: %v", a.nextRow, err)
+			}
+		}
+		if a.export != nil {
+			if err := a.exportRow(row, cells); err != nil {
+				return fmt.Errorf("failed to write NDJSON export: %v", err)
+			}
+		}
+		if highlighted {
+			a.result.HighlightedRows++
+		}
+		if a.summaryCols != nil {
+			a.countValues(row)
+		}
+		part := &a.result.Sheets[len(a.result.Sheets)-1]
+		if part.Rows == 0 {
+			part.firstRow = a.nextRow
+		}
+		a.nextRow++
+		a.result.RowsAppended++
+		part.Rows++
+		file.Rows++
+	}
+	return nil
+}
+
+// cellStyle returns style base with its number format replaced by code,
+// creating the style on first use. An empty code leaves base as it is.
+func (a *sheetAppender) cellStyle(base int, code string) (int, error) {
+	if code == "" {
+		return base, nil
+	}
+	key := styleKey{base, code}
+	style, ok := a.numFmtStyles[key]
+	if ok {
+		return style, nil
+	}
+	spec := &excelize.Style{}
+	if base != 0 {
+		var err error
+		if spec, err = a.f.GetStyle(base); err != nil {
+			return 0, fmt.Errorf("failed to read cell style: %v", err)
+		}
+		spec.NumFmt = 0
+	}
+	spec.CustomNumFmt = &code
+	style, err := a.f.NewStyle(spec)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create cell style: %v", err)
+	}
+	a.numFmtStyles[key] = style
+	return style, nil
+}
+
+// copiedStyle returns the style CopyStyle gives sheet column col, 0 when
+// there is none. Without CopyStyle only the columns Validate typed keep
+// their style, for its number format.
+func (a *sheetAppender) copiedStyle(col int) int {
+	if col > len(a.rowStyles) {
+		return 0
+	}
+	if !a.opts.CopyStyle && !a.columnTypes[col-a.colOffset].validated {
+		return 0
+	}
+	return a.rowStyles[col-1]
+}
+
+// addTemplateTypes gives each written column whose style in the last data
+// row shows a date or number the type Validate expects, unless -coerce,
+// -text or -date-cols already typed it.
+func (a *sheetAppender) addTemplateTypes() error {
+	a.result.TypeMismatches = make(map[int]int)
+	for c := a.colOffset + 1; c <= len(a.rowStyles); c++ {
+		if _, ok := a.columnTypes[c-a.colOffset]; ok || a.rowStyles[c-1] == 0 {
+			continue
+		}
+		style, err := a.f.GetStyle(a.rowStyles[c-1])
+		if err != nil {
+			return fmt.Errorf("failed to read cell style: %v", err)
+		}
+		ct, ok := templateColumnType(style.NumFmt, style.CustomNumFmt)
+		if !ok {
+			continue
+		}
+		a.columnTypes[c-a.colOffset] = ct
+		name, _ := excelize.ColumnNumberToName(c)
+		a.opts.Verbosef("Validating column %s as %s\n", name, ct.kind)
+	}
+	return nil
+}
+
+// checkMaxErrors aborts the run before saving once the error count passes
+// the MaxErrors threshold, or at the first failed line with StopOnError.
+func (a *sheetAppender) checkMaxErrors() error {
+	failed := a.result.ErrorCount + a.result.NotAppendedCount
+	if a.opts.StopOnError && failed > 0 {
+		return fmt.Errorf("aborting: a line failed and -strict-exit is set (%d read errors, %d not appended). See %s",
+			a.result.ErrorCount, a.result.NotAppendedCount, a.errLog.Where())
+	}
+	if a.opts.MaxErrors > 0 && failed > a.opts.MaxErrors {
+		return fmt.Errorf("aborting: %d lines failed, exceeding -max-errors %d (%d read errors, %d not appended). See %s",
+			failed, a.opts.MaxErrors, a.result.ErrorCount, a.result.NotAppendedCount, a.errLog.Where())
+	}
+	return nil
+}
+
+// isBlankRecord reports whether record has fields and all of them are empty
+// or whitespace, as produced by a line such as "," or " ".
+func isBlankRecord(record []string) bool {
+	if len(record) == 0 {
+		return false
+	}
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// trimField removes whitespace from both ends of field, along with byte
+// order marks and zero-width spaces, which exporters leave at the start of
+// files and which unicode does not count as space.
+func trimField(field string) string {
+	return strings.TrimFunc(field, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '\ufeff' || r == '\u200b'
+	})
+}
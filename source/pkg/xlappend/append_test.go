@@ -0,0 +1,295 @@
+package xlappend
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// newTemplate saves a workbook in dir whose sheet holds rows, the first of
+// them the header, and returns its path.
+func newTemplate(t testing.TB, dir, sheet string, rows ...[]string) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		t.Fatal(err)
+	}
+	for r, row := range rows {
+		for c, value := range row {
+			cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+			if err := f.SetCellStr(sheet, cell, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	path := filepath.Join(dir, "template.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeInput writes content to the file name in dir and returns its path.
+func writeInput(t testing.TB, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sheetRows returns the values of the rows of sheet in the workbook at path.
+func sheetRows(t testing.TB, path, sheet string) [][]string {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// appendInput appends the input at path to sheet T of a template headed
+// Name,Path,Owner, with opts, and returns the Result and the rows of the
+// saved sheet.
+func appendInput(t testing.TB, dir, input string, opts Options) (Result, [][]string) {
+	t.Helper()
+	opts.InputPaths = []string{input}
+	opts.TemplatePath = newTemplate(t, dir, "T", []string{"Name", "Path", "Owner"})
+	opts.SheetName = "T"
+	if opts.StartRow == 0 {
+		opts.StartRow = 2
+	}
+	opts.OutputPath = filepath.Join(dir, "out.xlsx")
+	opts.Force = true
+	var im Importer
+	result, err := im.Append(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	return result, sheetRows(t, opts.OutputPath, "T")
+}
+
+func TestAppendLastLineWithoutNewline(t *testing.T) {
+	for _, tc := range []struct {
+		name, content string
+	}{
+		{"newline", "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\ncmd.exe,C:\\Temp,bob\n"},
+		{"no newline", "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\ncmd.exe,C:\\Temp,bob"},
+		{"quoted last field", "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\ncmd.exe,C:\\Temp,\"bob\""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			result, rows := appendInput(t, dir, writeInput(t, dir, "in.csv", tc.content), Options{})
+			want := [][]string{
+				{"Name", "Path", "Owner"},
+				{"svchost.exe", "C:\\Windows", "SYSTEM"},
+				{"cmd.exe", "C:\\Temp", "bob"},
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("sheet rows = %q, want %q", rows, want)
+			}
+			if result.RowsAppended != 2 || result.ErrorCount != 0 || result.NotAppendedCount != 0 {
+				t.Errorf("Result = %d appended, %d read errors, %d not appended; want 2, 0, 0",
+					result.RowsAppended, result.ErrorCount, result.NotAppendedCount)
+			}
+			if result.ErrorLog != "" {
+				t.Errorf("error log %s written for a clean input", result.ErrorLog)
+			}
+		})
+	}
+}
+
+// readLog returns the entries of the json error log at path.
+func readLog(t testing.TB, path string) []logEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []logEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e logEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("error log line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAppendLineEndings(t *testing.T) {
+	lines := []string{"Name,Path,Owner", "svchost.exe,C:\\Windows,SYSTEM", "cmd.exe,C:\\Temp,bob,extra", "nc.exe,C:\\Users\\bob,bob"}
+	for _, tc := range []struct {
+		name    string
+		content string
+		dropped int // empty final records dropped; blank lines are not records
+	}{
+		{"LF", strings.Join(lines, "\n") + "\n", 0},
+		{"CRLF", strings.Join(lines, "\r\n") + "\r\n", 0},
+		{"mixed", lines[0] + "\r\n" + lines[1] + "\n" + lines[2] + "\r\n" + lines[3] + "\n", 0},
+		{"LF without a final newline", strings.Join(lines, "\n"), 0},
+		{"CRLF without a final newline", strings.Join(lines, "\r\n"), 0},
+		{"LF blank final line", strings.Join(lines, "\n") + "\n\n", 0},
+		{"CRLF blank final line", strings.Join(lines, "\r\n") + "\r\n\r\n", 0},
+		{"LF empty final record", strings.Join(lines, "\n") + "\n,,\n", 1},
+		{"CRLF empty final record", strings.Join(lines, "\r\n") + "\r\n,,\r\n", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			result, rows := appendInput(t, dir, writeInput(t, dir, "in.csv", tc.content), Options{ErrorLogFmt: "json"})
+			want := [][]string{
+				{"Name", "Path", "Owner"},
+				{"svchost.exe", "C:\\Windows", "SYSTEM"},
+				{"nc.exe", "C:\\Users\\bob", "bob"},
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("sheet rows = %q, want %q", rows, want)
+			}
+			if result.RowsAppended != 2 || result.NotAppendedCount != 1 || result.DroppedTrailing != tc.dropped {
+				t.Errorf("Result = %d appended, %d not appended, %d dropped; want 2, 1, %d",
+					result.RowsAppended, result.NotAppendedCount, result.DroppedTrailing, tc.dropped)
+			}
+			if result.ErrorLog == "" {
+				t.Fatal("no error log for the line with too many fields")
+			}
+			entries := readLog(t, result.ErrorLog)
+			if len(entries) != 1 || entries[0].Kind != logNotAppended || entries[0].Line != 3 || entries[0].Text != lines[2] {
+				t.Errorf("error log = %+v, want one %s entry for line 3, %q", entries, logNotAppended, lines[2])
+			}
+		})
+	}
+}
+
+// appendCounts are the Result counts TestImporterAppend compares.
+type appendCounts struct {
+	rows, readErrors, notAppended, filtered int
+}
+
+func TestImporterAppend(t *testing.T) {
+	header := []string{"Name", "Path", "Owner"}
+	for _, tc := range []struct {
+		name    string
+		content string
+		opts    Options
+		rows    [][]string
+		counts  appendCounts
+	}{
+		{
+			name:    "comma",
+			content: "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\ncmd.exe,C:\\Temp,bob\n",
+			rows:    [][]string{header, {"svchost.exe", "C:\\Windows", "SYSTEM"}, {"cmd.exe", "C:\\Temp", "bob"}},
+			counts:  appendCounts{rows: 2},
+		},
+		{
+			name:    "semicolon",
+			content: "Name;Path;Owner\nsvchost.exe;C:\\Windows;SYSTEM\n",
+			opts:    Options{Delimiter: ';'},
+			rows:    [][]string{header, {"svchost.exe", "C:\\Windows", "SYSTEM"}},
+			counts:  appendCounts{rows: 1},
+		},
+		{
+			name:    "header included",
+			content: "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\n",
+			opts:    Options{StartRow: 1},
+			rows:    [][]string{header, header, {"svchost.exe", "C:\\Windows", "SYSTEM"}},
+			counts:  appendCounts{rows: 2},
+		},
+		{
+			name:    "row limit",
+			content: "Name,Path,Owner\na,1,x\nb,2,y\nc,3,z\n",
+			opts:    Options{MaxRows: 2},
+			rows:    [][]string{header, {"a", "1", "x"}, {"b", "2", "y"}},
+			counts:  appendCounts{rows: 2},
+		},
+		{
+			name:    "second column",
+			content: "Path,Owner\nC:\\Windows,SYSTEM\n",
+			opts:    Options{StartCol: 2},
+			rows:    [][]string{header, {"", "C:\\Windows", "SYSTEM"}},
+			counts:  appendCounts{rows: 1},
+		},
+		{
+			name:    "too many fields",
+			content: "Name,Path,Owner\na,1,x\nb,2,y,extra\n",
+			rows:    [][]string{header, {"a", "1", "x"}},
+			counts:  appendCounts{rows: 1, notAppended: 1},
+		},
+		{
+			name:    "unterminated quote",
+			content: "Name,Path,Owner\na,1,x\n\"b,2,y\n",
+			opts:    Options{Quoting: "strict"},
+			rows:    [][]string{header, {"a", "1", "x"}},
+			counts:  appendCounts{rows: 1, readErrors: 1},
+		},
+		{
+			name:    "filtered",
+			content: "Name,Path,Owner\na,1,x\nb,2,y\n",
+			opts:    Options{Where: []string{"Owner=y"}},
+			rows:    [][]string{header, {"b", "2", "y"}},
+			counts:  appendCounts{rows: 1, filtered: 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			result, rows := appendInput(t, dir, writeInput(t, dir, "in.csv", tc.content), tc.opts)
+			if !reflect.DeepEqual(rows, tc.rows) {
+				t.Errorf("sheet rows = %q, want %q", rows, tc.rows)
+			}
+			got := appendCounts{result.RowsAppended, result.ErrorCount, result.NotAppendedCount, result.FilteredOut}
+			if got != tc.counts {
+				t.Errorf("Result counts = %+v, want %+v", got, tc.counts)
+			}
+			if result.FilesRead != 1 || result.OutputPath != filepath.Join(dir, "out.xlsx") {
+				t.Errorf("Result read %d files and saved %s, want 1 and out.xlsx", result.FilesRead, result.OutputPath)
+			}
+		})
+	}
+}
+
+func TestAppendReverseAfterRowLimit(t *testing.T) {
+	dir := t.TempDir()
+	first := writeInput(t, dir, "a.csv", "Name,Path,Owner\na1,p,o\na2,p,o\na3,p,o\n")
+	second := writeInput(t, dir, "b.csv", "Name,Path,Owner\nb1,p,o\nb2,p,o\nb3,p,o\n")
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"reverse", Options{Reverse: true}, []string{"b3", "b2", "b1", "a3", "a2", "a1"}},
+		// -n picks the first lines of each file, which are then reversed
+		{"row limit", Options{Reverse: true, MaxRows: 2}, []string{"b2", "b1", "a2", "a1"}},
+		{"head", Options{Reverse: true, Head: 4}, []string{"b1", "a3", "a2", "a1"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.InputPaths = []string{first, second}
+			opts.TemplatePath = newTemplate(t, dir, "T", []string{"Name", "Path", "Owner"})
+			opts.SheetName, opts.StartRow = "T", 2
+			opts.OutputPath, opts.Force = filepath.Join(dir, "out.xlsx"), true
+			var im Importer
+			if _, err := im.Append(context.Background(), opts); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			var names []string
+			for _, row := range sheetRows(t, opts.OutputPath, "T")[1:] {
+				names = append(names, row[0])
+			}
+			if !reflect.DeepEqual(names, tc.want) {
+				t.Errorf("rows appended = %q, want %q", names, tc.want)
+			}
+		})
+	}
+}
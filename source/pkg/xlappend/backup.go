@@ -0,0 +1,71 @@
+package xlappend
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupName returns the name Backup keeps the output path as for a run at
+// now, as case42.bak-20261014-093000.xlsx for case42.xlsx, keeping the
+// extension so that the backup opens as the output did.
+func backupName(path string, now time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".bak-" + now.Format("20060102-150405") + ext
+}
+
+// backupOutput keeps the file at the output path, before the first save
+// of the run replaces it, under backupName. The backup is a hard link, so
+// that the save, renaming the new file over the path, leaves the old one
+// untouched under its new name, or a copy on file systems without links,
+// such as FAT formatted drives. A resumed run keeps the backup of the run
+// it carries on from.
+func (a *sheetAppender) backupOutput() error {
+	if !a.opts.Backup || a.result.BackupFile != "" || a.resume != nil {
+		return nil
+	}
+	path := a.opts.OutputPath
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	backup := backupName(path, time.Now())
+	if err := os.Link(path, backup); err != nil {
+		if _, statErr := os.Lstat(backup); statErr == nil {
+			return err
+		}
+		if err := copyFile(path, backup, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	a.result.BackupFile = backup
+	a.opts.Verbosef("Keeping the previous %s as %s\n", filepath.Base(path), filepath.Base(backup))
+	return nil
+}
+
+// copyFile copies the file from to the new file to, with permissions mode.
+func copyFile(from, to string, mode os.FileMode) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(to)
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package xlappend
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// benchLines is the length of the input the benchmarks append, a timeline
+// of five columns.
+const benchLines = 50000
+
+// benchmarkAppend appends benchLines lines to an empty template with opts,
+// once per iteration, generating the input and template in b.TempDir().
+func benchmarkAppend(b *testing.B, opts Options) {
+	b.Helper()
+	dir := b.TempDir()
+	var input strings.Builder
+	input.WriteString("Date,Time,Source,Host,Description\n")
+	for i := 0; i < benchLines; i++ {
+		fmt.Fprintf(&input, "2024-03-%02d,%02d:%02d:%02d,EVTX,WKS%03d,Event %d logged by C:\\Windows\\System32\\svchost.exe\n",
+			i%28+1, i/3600%24, i/60%60, i%60, i%250, i)
+	}
+	opts.InputPaths = []string{writeInput(b, dir, "in.csv", input.String())}
+	opts.TemplatePath = newTemplate(b, dir, "TLN", []string{"Date", "Time", "Source", "Host", "Description"})
+	opts.SheetName = "TLN"
+	opts.StartRow = 2
+	opts.OutputPath = filepath.Join(dir, "out.xlsx")
+	opts.Force = true
+	b.SetBytes(int64(input.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var im Importer
+		result, err := im.Append(context.Background(), opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if result.RowsAppended != benchLines {
+			b.Fatalf("RowsAppended = %d, want %d", result.RowsAppended, benchLines)
+		}
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	benchmarkAppend(b, Options{})
+}
+
+func BenchmarkAppendStream(b *testing.B) {
+	for _, chunk := range []int{0, 1000} {
+		b.Run(fmt.Sprintf("chunk=%d", chunk), func(b *testing.B) {
+			benchmarkAppend(b, Options{Stream: true, ChunkSize: chunk})
+		})
+	}
+}
+
+func BenchmarkAppendChunkSize(b *testing.B) {
+	for _, chunk := range []int{0, 1000, 10000} {
+		b.Run(fmt.Sprintf("chunk=%d", chunk), func(b *testing.B) {
+			benchmarkAppend(b, Options{ChunkSize: chunk})
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package xlappend
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bodyfileFields is the number of fields on a line of a TSK 3 bodyfile:
+// MD5|name|inode|mode_as_string|UID|GID|size|atime|mtime|ctime|crtime.
+const bodyfileFields = 11
+
+// bodyfileTimes is the index of atime, the first of the four MACB
+// timestamps that end a bodyfile line.
+const bodyfileTimes = 7
+
+// bodyfileReader reads a bodyfile, as fls, ils and many other tools write
+// for mactime, from a pipe delimited reader without quoting. A file name
+// may itself hold pipes, so the name is every field between the MD5 and
+// the last nine. The MACB times, epoch seconds, are returned as
+// yyyy-mm-dd hh:mm:ss UTC and 0, for a time the file system does not keep,
+// as empty.
+type bodyfileReader struct {
+	*csv.Reader
+}
+
+// Read returns the next bodyfile line as its eleven fields. A line with
+// fewer is a read error confined to that line.
+func (r bodyfileReader) Read() ([]string, error) {
+	record, err := r.Reader.Read()
+	if err != nil {
+		return record, err
+	}
+	if len(record) < bodyfileFields {
+		line, _ := r.FieldPos(0)
+		return nil, &csv.ParseError{StartLine: line, Line: line, Err: fmt.Errorf("a bodyfile line has %d fields, not %d", len(record), bodyfileFields)}
+	}
+	if extra := len(record) - bodyfileFields; extra > 0 {
+		name := strings.Join(record[1:2+extra], "|")
+		record = append([]string{record[0], name}, record[2+extra:]...)
+	}
+	for i := bodyfileTimes; i < bodyfileFields; i++ {
+		record[i] = bodyfileTime(record[i])
+	}
+	return record, nil
+}
+
+// bodyfileTime returns the text of a bodyfile timestamp, whole or
+// fractional epoch seconds. A value that is not a number is left as it is.
+func bodyfileTime(value string) string {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	switch {
+	case err != nil || math.IsInf(seconds, 0) || math.IsNaN(seconds):
+		return value
+	case seconds == 0:
+		return ""
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC().Format("2006-01-02 15:04:05.999999")
+}
+
+// inputTypes gives the UID, GID and size integer cells and the MACB times
+// date and time cells.
+func (r bodyfileReader) inputTypes() []columnType {
+	types := make([]columnType, bodyfileFields)
+	for _, i := range []int{4, 5, 6} {
+		types[i] = columnType{kind: "int"}
+	}
+	for i := bodyfileTimes; i < bodyfileFields; i++ {
+		types[i] = columnType{kind: "timestamp", utc: true}
+	}
+	return types
+}
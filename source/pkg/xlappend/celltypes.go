@@ -0,0 +1,483 @@
+package xlappend
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// localeFormat holds the custom number format codes applied to native
+// cells for a -locale display setting and, for a language tag such as
+// de-DE, how the input writes its numbers and dates.
+type localeFormat struct {
+	date, dateTime, integer, decimal string
+
+	decimalSep string   // decimal separator of the input's numbers, empty for the plain numbers numberPattern matches
+	groupSeps  string   // characters that may group the thousands of the input's numbers
+	layouts    []string // the input's date layouts, tried before dateLayouts
+}
+
+// localeFormats maps -locale names to their number format codes. Excel
+// substitutes the opener's own thousands and decimal separators when it
+// renders "," and ".", so these codes fix date field order, digit grouping
+// and precision rather than the separator characters themselves.
+var localeFormats = map[string]localeFormat{
+	"us":  {date: "m/d/yyyy", dateTime: "m/d/yyyy h:mm:ss AM/PM", integer: "#,##0", decimal: "#,##0.0#########"},
+	"uk":  {date: "dd/mm/yyyy", dateTime: "dd/mm/yyyy hh:mm:ss", integer: "#,##0", decimal: "#,##0.0#########"},
+	"eu":  {date: "dd.mm.yyyy", dateTime: "dd.mm.yyyy hh:mm:ss", integer: "#,##0", decimal: "#,##0.0#########"},
+	"iso": {date: "yyyy-mm-dd", dateTime: "yyyy-mm-dd hh:mm:ss", integer: "0", decimal: "0.0#########"},
+}
+
+// A languageTag gives the conventions of a -locale language tag: the
+// localeFormats entry its numbers and dates are displayed with, its number
+// separators and the Go layout of its dates, with the day and month of one
+// or two digits.
+type languageTag struct {
+	display, decimalSep, groupSeps, date string
+}
+
+// spaces are the characters locales that group thousands with a space
+// write: a space, a no-break space or a narrow no-break space.
+const spaces = " \u00a0\u202f"
+
+// languageTags are the language tags -locale takes, in lower case; the
+// input numbers and dates of these are read as the locale writes them.
+var languageTags = map[string]languageTag{
+	"en-us": {"us", ".", ",", "1/2/2006"},
+	"en-gb": {"uk", ".", ",", "2/1/2006"},
+	"en-ie": {"uk", ".", ",", "2/1/2006"},
+	"en-au": {"uk", ".", ",", "2/1/2006"},
+	"en-nz": {"uk", ".", ",", "2/1/2006"},
+	"en-in": {"uk", ".", ",", "2/1/2006"},
+	"en-ca": {"iso", ".", ",", "2006-1-2"},
+	"de-de": {"eu", ",", ".", "2.1.2006"},
+	"de-at": {"eu", ",", ".", "2.1.2006"},
+	"de-ch": {"eu", ".", "'\u2019", "2.1.2006"},
+	"fr-fr": {"uk", ",", spaces, "2/1/2006"},
+	"fr-be": {"uk", ",", spaces, "2/1/2006"},
+	"fr-ca": {"iso", ",", spaces, "2006-1-2"},
+	"es-es": {"uk", ",", ".", "2/1/2006"},
+	"es-mx": {"uk", ".", ",", "2/1/2006"},
+	"it-it": {"uk", ",", ".", "2/1/2006"},
+	"pt-pt": {"uk", ",", spaces, "2/1/2006"},
+	"pt-br": {"uk", ",", ".", "2/1/2006"},
+	"nl-nl": {"eu", ",", ".", "2-1-2006"},
+	"nl-be": {"uk", ",", ".", "2/1/2006"},
+	"da-dk": {"eu", ",", ".", "2.1.2006"},
+	"nb-no": {"eu", ",", spaces, "2.1.2006"},
+	"sv-se": {"iso", ",", spaces, "2006-1-2"},
+	"fi-fi": {"eu", ",", spaces, "2.1.2006"},
+	"pl-pl": {"eu", ",", spaces, "2.1.2006"},
+	"cs-cz": {"eu", ",", spaces, "2.1.2006"},
+	"ru-ru": {"eu", ",", spaces, "2.1.2006"},
+	"uk-ua": {"eu", ",", spaces, "2.1.2006"},
+	"tr-tr": {"eu", ",", ".", "2.1.2006"},
+	"ja-jp": {"iso", ".", ",", "2006/1/2"},
+	"zh-cn": {"iso", ".", ",", "2006/1/2"},
+}
+
+// lookupLocale returns the format of a -locale name: us, uk, eu or iso,
+// which set the display alone, or a language tag of languageTags, in any
+// case and with - or _, which also sets how the input is read.
+func lookupLocale(name string) (localeFormat, bool) {
+	if lf, ok := localeFormats[name]; ok {
+		return lf, true
+	}
+	tag, ok := languageTags[strings.ToLower(strings.ReplaceAll(name, "_", "-"))]
+	if !ok {
+		return localeFormat{}, false
+	}
+	lf := localeFormats[tag.display]
+	lf.decimalSep, lf.groupSeps = tag.decimalSep, tag.groupSeps
+	lf.layouts = []string{tag.date + " 15:04:05", tag.date + " 15:04", tag.date}
+	if tag.display == "us" {
+		lf.layouts = append(lf.layouts, tag.date+" 3:04:05 PM", tag.date+" 3:04 PM")
+	}
+	return lf, true
+}
+
+// number returns value, a number as the locale's input writes it, such as
+// 1.234,5 for de-DE, as the plain number numberPattern matches, and reports
+// whether it is one. Thousands must be grouped in threes, and a value that
+// looks like an IPv4 address is not a number even where dots group them.
+// Without a language tag value is returned as it is.
+func (lf localeFormat) number(value string) (string, bool) {
+	if lf.decimalSep == "" {
+		return value, true
+	}
+	sign, digits := "", value
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(digits, lf.decimalSep)
+	if hasFrac && (frac == "" || strings.Trim(frac, "0123456789") != "") {
+		return "", false
+	}
+	if strings.ContainsAny(whole, lf.groupSeps) {
+		if !hasFrac && strings.Count(whole, ".") == 3 && ipv4Pattern.FindString(whole) == whole {
+			return "", false
+		}
+		groups := []string{""}
+		for _, r := range whole {
+			switch {
+			case r >= '0' && r <= '9':
+				groups[len(groups)-1] += string(r)
+			case strings.ContainsRune(lf.groupSeps, r):
+				groups = append(groups, "")
+			default:
+				return "", false
+			}
+		}
+		for i, group := range groups {
+			if group == "" || i == 0 && len(group) > 3 || i > 0 && len(group) != 3 {
+				return "", false
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	if hasFrac {
+		return sign + whole + "." + frac, true
+	}
+	return sign + whole, true
+}
+
+// plainNumber returns value, trimmed, as a plain number when the locale
+// reads it as one, and as it is otherwise, for strconv to reject.
+func (lf localeFormat) plainNumber(value string) string {
+	value = strings.TrimSpace(value)
+	if plain, ok := lf.number(value); ok {
+		return plain
+	}
+	return value
+}
+
+// parseDate parses value in the locale's input date layouts, in loc, and
+// reports whether it has a time of day.
+func (lf localeFormat) parseDate(value string, loc *time.Location) (time.Time, bool, bool) {
+	for _, layout := range lf.layouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(value), loc); err == nil {
+			return t, hasClock(layout), true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// numberPattern matches plain decimal numbers. Values with leading zeros,
+// exponents or thousands separators are deliberately left as text.
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// dateLayouts are the timestamp layouts recognised by -infer and -locale.
+// Fractional seconds are accepted after the seconds field of any layout.
+// Slash separated dates are only recognised year first, since day and month
+// order is ambiguous otherwise.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+}
+
+// timestampLayouts are the layouts -date-cols recognises besides
+// dateLayouts and epoch times: month first US dates, RFC 1123 as in HTTP
+// and mail headers, and syslog timestamps, which have no year.
+var timestampLayouts = append(append([]string(nil), dateLayouts...),
+	"01/02/2006 15:04:05",
+	"01/02/2006 3:04:05 PM",
+	"01/02/2006 15:04",
+	"01/02/2006",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Jan _2 2006 15:04:05",
+	time.Stamp,
+)
+
+// epochPattern matches Unix times in seconds, with an optional fraction, or
+// in milliseconds, from 2001 to 2286.
+var epochPattern = regexp.MustCompile(`^(1[0-9]{9})(\.[0-9]+)?$|^(1[0-9]{12})$`)
+
+// parseTimestamp parses value as an epoch time or in any of
+// timestampLayouts, and reports whether it has a time of day. Epoch times
+// are UTC and values without an offset are read in now's location. A syslog
+// timestamp without a year is given the year that puts it within the last
+// year before now.
+func parseTimestamp(value string, now time.Time) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if m := epochPattern.FindStringSubmatch(value); m != nil {
+		if m[3] != "" {
+			ms, _ := strconv.ParseInt(m[3], 10, 64)
+			return time.UnixMilli(ms).UTC(), true, nil
+		}
+		seconds, _ := strconv.ParseFloat(value, 64)
+		whole := int64(seconds)
+		return time.Unix(whole, int64((seconds-float64(whole))*1e9)).UTC(), true, nil
+	}
+	for _, layout := range timestampLayouts {
+		t, err := time.ParseInLocation(layout, value, now.Location())
+		if err != nil {
+			continue
+		}
+		if layout == time.Stamp {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.AddDate(0, 0, 1)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, hasClock(layout), nil
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a recognised timestamp", value)
+}
+
+// hasClock reports whether a time layout has a time of day.
+func hasClock(layout string) bool {
+	return strings.Contains(layout, "04")
+}
+
+// timeZones are the -tz-in and -tz-out zones timestamps are converted
+// between. Excel stores no zone, so a cell holds the time as a clock in the
+// out zone shows it. The zero value reads times as UTC and converts nothing.
+type timeZones struct {
+	in, out *time.Location
+}
+
+// newTimeZones returns the zones named in and out, UTC for an empty name.
+func newTimeZones(in, out string) (timeZones, error) {
+	tz := timeZones{in: time.UTC, out: time.UTC}
+	var err error
+	if in != "" {
+		if tz.in, err = parseZone(in); err != nil {
+			return tz, fmt.Errorf("invalid time zone: %s", in)
+		}
+	}
+	if out != "" {
+		if tz.out, err = parseZone(out); err != nil {
+			return tz, fmt.Errorf("invalid time zone: %s", out)
+		}
+	}
+	return tz, nil
+}
+
+// parseZone returns the location a -tz-in or -tz-out value names: an IANA
+// zone such as Europe/Berlin, UTC, Local, or a fixed offset such as +05:30.
+func parseZone(name string) (*time.Location, error) {
+	if t, err := time.Parse("-07:00", name); err == nil {
+		return t.Location(), nil
+	}
+	return time.LoadLocation(name)
+}
+
+// source returns the location the values of ct without an offset are in.
+func (tz timeZones) source(ct columnType) *time.Location {
+	if tz.in == nil || ct.utc {
+		return time.UTC
+	}
+	return tz.in
+}
+
+// convert returns t in the out zone.
+func (tz timeZones) convert(t time.Time) time.Time {
+	if tz.out == nil {
+		return t
+	}
+	return t.In(tz.out)
+}
+
+// cellValue converts value to a native number, time or boolean when it is
+// recognisable as one and returns the format code to display it with. Only
+// the words true and false, in any case, are booleans: 1 and 0 stay numbers.
+// Other values are returned unchanged with an empty format code.
+func (lf localeFormat) cellValue(value string) (interface{}, string) {
+	if plain, ok := lf.number(value); ok {
+		if m := numberPattern.FindStringSubmatch(plain); m != nil && len(plain) <= 15 {
+			if m[2] == "" {
+				if n, err := strconv.ParseInt(plain, 10, 64); err == nil {
+					return n, lf.integer
+				}
+			} else if n, err := strconv.ParseFloat(plain, 64); err == nil {
+				return n, lf.decimal
+			}
+		}
+	}
+	if t, clock, ok := lf.parseDate(value, time.UTC); ok {
+		if clock {
+			return t, lf.dateTime
+		}
+		return t, lf.date
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "2006-01-02" || layout == "2006/01/02" {
+				return t, lf.date
+			}
+			return t, lf.dateTime
+		}
+	}
+	if strings.EqualFold(value, "true") || strings.EqualFold(value, "false") {
+		return strings.EqualFold(value, "true"), ""
+	}
+	return value, ""
+}
+
+// columnType is the -coerce directive for a single column.
+type columnType struct {
+	kind      string // text, int, float, bool or date, timestamp for -date-cols, or number
+	layout    string // Go time layout for date, empty to try dateLayouts, or tried first for timestamp
+	format    string // number format code of a timestamp, empty for the locale's
+	validated bool   // the type comes from the template's number format, see templateColumnType
+	utc       bool   // the input stores the timestamps in UTC, whatever -tz-in says
+}
+
+// parseCoerce parses a -coerce directive such as
+// "1:text,3:int,5:date:2006-01-02,7:bool" into types keyed by 1-based
+// column number. Everything after "date:" is the time layout, so layouts
+// may contain colons but not commas.
+func parseCoerce(directive string) (map[int]columnType, error) {
+	columnTypes := make(map[int]columnType)
+	if directive == "" {
+		return columnTypes, nil
+	}
+	for _, part := range strings.Split(directive, ",") {
+		fields := strings.SplitN(strings.TrimSpace(part), ":", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%q is not COLUMN:TYPE", part)
+		}
+		col, err := strconv.Atoi(fields[0])
+		if err != nil || col < 1 || col > excelize.MaxColumns {
+			return nil, fmt.Errorf("invalid column %q", fields[0])
+		}
+		ct := columnType{kind: fields[1]}
+		switch ct.kind {
+		case "text", "int", "float", "bool":
+			if len(fields) == 3 {
+				return nil, fmt.Errorf("type %s takes no layout in %q", ct.kind, part)
+			}
+		case "date":
+			if len(fields) == 3 {
+				ct.layout = fields[2]
+			}
+		default:
+			return nil, fmt.Errorf("unknown type %q", ct.kind)
+		}
+		if _, dup := columnTypes[col]; dup {
+			return nil, fmt.Errorf("column %d is listed twice", col)
+		}
+		columnTypes[col] = ct
+	}
+	return columnTypes, nil
+}
+
+// cellValue converts value to the column's type and returns the number
+// format code to display it with. Dates and timestamps with a time of day
+// are converted between the zones of tz. Empty values are left empty.
+func (ct columnType) cellValue(value string, lf localeFormat, tz timeZones) (interface{}, string, error) {
+	if value == "" {
+		return value, "", nil
+	}
+	switch ct.kind {
+	case "text":
+		return value, "@", nil
+	case "int":
+		n, err := strconv.ParseInt(lf.plainNumber(value), 10, 64)
+		return n, lf.integer, err
+	case "float":
+		n, err := strconv.ParseFloat(lf.plainNumber(value), 64)
+		return n, lf.decimal, err
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		return b, "", err
+	case "number":
+		n, err := strconv.ParseFloat(lf.plainNumber(value), 64)
+		if err == nil && (math.IsNaN(n) || math.IsInf(n, 0)) {
+			err = fmt.Errorf("%q is not a finite number", value)
+		}
+		return n, lf.decimal, err
+	case "timestamp":
+		loc := tz.source(ct)
+		t, err := time.ParseInLocation(ct.layout, strings.TrimSpace(value), loc)
+		clock := hasClock(ct.layout)
+		if ct.layout == "" || err != nil {
+			var ok bool
+			if t, clock, ok = lf.parseDate(value, loc); ok {
+				err = nil
+			} else {
+				t, clock, err = parseTimestamp(value, time.Now().In(loc))
+			}
+		}
+		if clock {
+			t = tz.convert(t)
+		}
+		if ct.format == "" {
+			return t, lf.dateTime, err
+		}
+		return t, ct.format, err
+	}
+
+	layouts := append(append([]string(nil), lf.layouts...), dateLayouts...)
+	if ct.layout != "" {
+		layouts = []string{ct.layout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(value), tz.source(ct)); err == nil {
+			if hasClock(layout) {
+				t = tz.convert(t)
+			}
+			if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+				return t, lf.date, nil
+			}
+			return t, lf.dateTime, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%q does not match the date layout", value)
+}
+
+// numFmtDates are the built-in number formats that display dates or times,
+// including the East Asian date formats, and numFmtText is the "@" format.
+var numFmtDates = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true, 50: true, 51: true, 52: true, 53: true, 54: true, 55: true,
+	56: true, 57: true, 58: true,
+}
+
+const numFmtText = 49
+
+// formatSections matches the parts of a number format code that display
+// literally or set a colour, locale or condition: quoted text, escaped
+// characters, padding and fill characters, and bracketed sections.
+var formatSections = regexp.MustCompile(`"[^"]*"|\\.|[_*].|\[[^\]]*\]`)
+
+// templateColumnType returns the type -validate expects in a column whose
+// cells have the number format id, or the code custom when it is not nil:
+// timestamp for date and time formats and number for numeric ones. General
+// and text formats take any value, so they give no type.
+func templateColumnType(id int, custom *string) (columnType, bool) {
+	if custom == nil {
+		switch {
+		case id == 0 || id == numFmtText:
+			return columnType{}, false
+		case numFmtDates[id]:
+			return columnType{kind: "timestamp", validated: true}, true
+		}
+		return columnType{kind: "number", validated: true}, true
+	}
+
+	// Only the first section, for positive numbers, decides
+	code := strings.ToLower(formatSections.ReplaceAllString(*custom, ""))
+	code = strings.SplitN(code, ";", 2)[0]
+	switch {
+	case code == "general" || strings.Contains(code, "@"):
+		return columnType{}, false
+	case strings.ContainsAny(code, "ymdhs"):
+		return columnType{kind: "timestamp", validated: true}, true
+	case strings.ContainsAny(code, "0#?"):
+		return columnType{kind: "number", validated: true}, true
+	}
+	return columnType{}, false
+}
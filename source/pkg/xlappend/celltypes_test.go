@@ -0,0 +1,92 @@
+package xlappend
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseCoerce(t *testing.T) {
+	for _, tc := range []struct {
+		directive string
+		want      map[int]columnType
+		err       string
+	}{
+		// Valid directives
+		{"", map[int]columnType{}, ""},
+		{"1:text", map[int]columnType{1: {kind: "text"}}, ""},
+		{"1:text,3:int,5:date:2006-01-02,7:bool", map[int]columnType{
+			1: {kind: "text"}, 3: {kind: "int"}, 5: {kind: "date", layout: "2006-01-02"}, 7: {kind: "bool"},
+		}, ""},
+		{" 2:float , 4:date ", map[int]columnType{2: {kind: "float"}, 4: {kind: "date"}}, ""},
+		{"6:date:2006-01-02 15:04:05", map[int]columnType{6: {kind: "date", layout: "2006-01-02 15:04:05"}}, ""},
+		{"16384:text", map[int]columnType{16384: {kind: "text"}}, ""},
+
+		// Unknown types
+		{"1:string", nil, `unknown type "string"`},
+		{"1:text,2:Int", nil, `unknown type "Int"`},
+		{"3:timestamp", nil, `unknown type "timestamp"`},
+
+		// Malformed directives
+		{"1", nil, `"1" is not COLUMN:TYPE`},
+		{"1:text,,2:int", nil, `"" is not COLUMN:TYPE`},
+		{"A:text", nil, `invalid column "A"`},
+		{"0:int", nil, `invalid column "0"`},
+		{"16385:int", nil, `invalid column "16385"`},
+		{"2:int:06", nil, `type int takes no layout in "2:int:06"`},
+		{"1:text,1:int", nil, "column 1 is listed twice"},
+	} {
+		got, err := parseCoerce(tc.directive)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("parseCoerce(%q) error = %v, want %q", tc.directive, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCoerce(%q): %v", tc.directive, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseCoerce(%q) = %+v, want %+v", tc.directive, got, tc.want)
+		}
+	}
+}
+
+func TestAppendCoerce(t *testing.T) {
+	dir := t.TempDir()
+	input := writeInput(t, dir, "in.csv", "Name,Path,Owner\n7,2024-01-02,true\nseven,02/01/2024,yes\n")
+	result, _ := appendInput(t, dir, input, Options{Coerce: "1:int,2:date:2006-01-02,3:bool", ErrorLogFmt: "json"})
+
+	f, err := excelize.OpenFile(filepath.Join(dir, "out.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, tc := range []struct {
+		cell, value string
+		kind        excelize.CellType
+	}{
+		// Numbers and dates are written without a cell type, as Excel does
+		{"A2", "7", excelize.CellTypeUnset},
+		{"B2", "45293", excelize.CellTypeUnset},
+		{"C2", "1", excelize.CellTypeBool},
+		// Values that do not convert are written as text
+		{"A3", "seven", excelize.CellTypeSharedString},
+		{"B3", "02/01/2024", excelize.CellTypeSharedString},
+		{"C3", "yes", excelize.CellTypeSharedString},
+	} {
+		value, _ := f.GetCellValue("T", tc.cell, excelize.Options{RawCellValue: true})
+		kind, _ := f.GetCellType("T", tc.cell)
+		if value != tc.value || kind != tc.kind {
+			t.Errorf("cell %s = %q of type %v, want %q of type %v", tc.cell, value, kind, tc.value, tc.kind)
+		}
+	}
+	if result.CoerceFailures != 3 {
+		t.Errorf("CoerceFailures = %d, want 3", result.CoerceFailures)
+	}
+	entries := readLog(t, result.ErrorLog)
+	if len(entries) != 3 || entries[0].Kind != logNotCoerced || entries[0].Line != 3 {
+		t.Errorf("error log = %+v, want three %s entries for line 3", entries, logNotCoerced)
+	}
+}
@@ -0,0 +1,273 @@
+package xlappend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// checkpointSuffix is added to the output path to name its checkpoint.
+const checkpointSuffix = ".checkpoint.json"
+
+// checkpoint is where a run with Checkpoint had got to when it last saved
+// the workbook, for Resume to carry on from. It is written next to the
+// output and removed once the output is saved complete.
+type checkpoint struct {
+	Output        string             `json:"output"`
+	Template      string             `json:"template"`
+	SHA256        string             `json:"sha256"` // of the output as the checkpoint saved it
+	Saved         string             `json:"saved"`  // UTC time of the checkpoint
+	Inputs        []string           `json:"inputs"` // the input files, globs expanded
+	NextInput     int                `json:"next_input"`
+	Records       int                `json:"records"`  // records of the next input already handled
+	Selected      int                `json:"selected"` // lines of it appended, for MaxRows
+	NextRow       int                `json:"next_row"`
+	HeaderRow     int                `json:"header_row"`
+	MaxCols       int                `json:"max_cols"`
+	LastCol       int                `json:"last_col"`
+	TemplateRows  int                `json:"template_rows"`
+	TemplateCols  int                `json:"template_cols"`
+	FirstRows     []int              `json:"first_rows"`       // first row written on each of Result.Sheets
+	Schema        []string           `json:"schema,omitempty"` // the header LockSchema holds later files to
+	Widths        map[int]int        `json:"widths,omitempty"` // widest value of each written column, for AutoFit
+	Digests       []checkpointDigest `json:"digests,omitempty"`
+	ErrorLogBytes int64              `json:"error_log_bytes"`
+	Result        Result             `json:"result"` // the counts so far
+}
+
+// checkpointDigest is an inputRecord of an input file read to its end.
+type checkpointDigest struct {
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+	Bytes  int64  `json:"bytes"`
+	Lines  int    `json:"lines"`
+}
+
+// CheckpointPath returns the path of the checkpoint Checkpoint writes for
+// the output file output.
+func CheckpointPath(output string) string {
+	return output + checkpointSuffix
+}
+
+// takeCheckpoint saves the workbook as it is and writes its checkpoint,
+// once Checkpoint rows have been appended since the last one. It is called
+// after rows are flushed, in the middle of an input file or, with done, at
+// its end. The workbook saved lacks what is only done once every row is
+// in, such as the table grown over the rows and the sheet sorted.
+func (a *sheetAppender) takeCheckpoint(done bool) error {
+	if a.opts.Checkpoint == 0 || a.result.RowsAppended-a.checkpointRows < a.opts.Checkpoint {
+		return nil
+	}
+	if err := a.ctx.Err(); err != nil {
+		return err
+	}
+	if err := a.backupOutput(); err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to back up %s: %v", a.opts.OutputPath, err))
+	}
+	if err := saveWorkbook(a.f, a.opts.OutputPath, a.opts.Password); err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to save checkpoint: %v", err))
+	}
+	logBytes, err := a.errLog.flush()
+	if err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to write error log: %v", err))
+	}
+	digest, _, err := fileDigest(a.opts.OutputPath, "sha256")
+	if err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to save checkpoint: %v", err))
+	}
+	cp := checkpoint{
+		Output:        a.opts.OutputPath,
+		Template:      a.templatePath(),
+		SHA256:        digest,
+		Saved:         time.Now().UTC().Format(time.RFC3339),
+		Inputs:        a.inputs,
+		NextInput:     a.inputIndex,
+		Records:       a.records,
+		Selected:      a.selected,
+		NextRow:       a.nextRow,
+		HeaderRow:     a.headerRow,
+		MaxCols:       a.maxCols,
+		LastCol:       a.lastCol,
+		TemplateRows:  a.templateRows,
+		TemplateCols:  a.templateCols,
+		Schema:        a.canonicalHeader,
+		Widths:        a.contentWidths,
+		ErrorLogBytes: logBytes,
+		Result:        a.result,
+	}
+	if done {
+		cp.NextInput, cp.Records, cp.Selected = a.inputIndex+1, 0, 0
+	}
+	cp.Result.ErrorLog = a.errLog.Path()
+	for _, part := range a.result.Sheets {
+		cp.FirstRows = append(cp.FirstRows, part.firstRow)
+	}
+	for _, record := range a.inputRecords {
+		cp.Digests = append(cp.Digests, checkpointDigest{record.sha256, record.md5, record.size, record.lines})
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := CheckpointPath(a.opts.OutputPath)
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return withKind(ErrSave, fmt.Errorf("failed to save checkpoint: %v", err))
+	}
+	a.checkpointRows = a.result.RowsAppended
+	a.result.CheckpointFile = path
+	a.opts.Verbosef("Checkpoint: %d rows saved to %s\n", a.result.RowsAppended, a.opts.OutputPath)
+	return nil
+}
+
+// templatePath returns the template the workbook started from: for a
+// resumed run, not the output it opens but the template of the run it
+// carries on.
+func (a *sheetAppender) templatePath() string {
+	if a.resume != nil {
+		return a.resume.Template
+	}
+	return a.opts.TemplatePath
+}
+
+// writeFileAtomic writes data to path through a temporary file renamed over
+// it, so that path holds either its old or its new contents.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadCheckpoint reads the checkpoint of the output file output for
+// Resume, checking that the output is still the workbook it saved: one
+// saved again after it, as by a checkpoint interrupted between the
+// workbook and the checkpoint, already holds rows the checkpoint does not
+// know of.
+func loadCheckpoint(output string) (*checkpoint, error) {
+	path := CheckpointPath(output)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("nothing to resume: there is no checkpoint at %s", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	cp := new(checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %v", path, err)
+	}
+	if len(cp.Result.Sheets) == 0 || len(cp.FirstRows) != len(cp.Result.Sheets) {
+		return nil, fmt.Errorf("invalid checkpoint %s: no sheets", path)
+	}
+	digest, _, err := fileDigest(output, "sha256")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checkpointed output: %v", err)
+	}
+	if digest != cp.SHA256 {
+		return nil, fmt.Errorf("%s has changed since its checkpoint was written, so the run cannot be resumed", output)
+	}
+	return cp, nil
+}
+
+// restoreCheckpoint returns the appender, with the checkpointed workbook
+// open and measured as its template, to where the run being resumed had
+// got to, see Resume. The input files it had read to their end are then
+// skipped and the records of the next one it had handled are read again,
+// for its header and hashes, but not appended.
+func (a *sheetAppender) restoreCheckpoint() error {
+	cp := a.resume
+	if len(cp.Inputs) != len(a.inputs) {
+		return withKind(ErrInput, errors.New("the input files are not those of the interrupted run"))
+	}
+	for i := range cp.Inputs {
+		if cp.Inputs[i] != a.inputs[i] {
+			return withKind(ErrInput, fmt.Errorf("the input files are not those of the interrupted run: %s is now %s", inputName(cp.Inputs[i]), inputName(a.inputs[i])))
+		}
+	}
+	output := a.result.OutputPath
+	a.result = cp.Result
+	a.result.OutputPath = output
+	a.result.ResumedRows = cp.Result.RowsAppended
+	if a.opts.Validate && a.result.TypeMismatches == nil {
+		a.result.TypeMismatches = make(map[int]int)
+	}
+	for i := range a.result.Sheets {
+		a.result.Sheets[i].firstRow = cp.FirstRows[i]
+	}
+	last := a.result.Sheets[len(a.result.Sheets)-1]
+	a.sheet = last.Name
+	a.nextRow, a.headerRow, a.maxCols, a.lastCol = cp.NextRow, cp.HeaderRow, cp.MaxCols, cp.LastCol
+	a.templateRows, a.templateCols = cp.TemplateRows, cp.TemplateCols
+	a.canonicalHeader = cp.Schema
+	a.wroteHeader = true
+	a.skipRecords = cp.Records
+	a.checkpointRows = cp.Result.RowsAppended
+	if a.contentWidths != nil && cp.Widths != nil {
+		a.contentWidths = cp.Widths
+	}
+	a.fileTypes = make([]map[int]columnType, len(a.result.Files))
+	if a.opts.Provenance || a.opts.Manifest {
+		for _, d := range cp.Digests {
+			a.inputRecords = append(a.inputRecords, inputRecord{d.SHA256, d.MD5, d.Bytes, d.Lines})
+		}
+	}
+
+	// prepareSheet only saw the rows of the first sheet of a split, which
+	// start with a copy of its header
+	if a.seen != nil {
+		for _, part := range a.result.Sheets[1:] {
+			raw, err := a.f.GetRows(part.Name, excelize.Options{RawCellValue: true})
+			if err != nil {
+				return fmt.Errorf("failed to get rows from sheet: %v", err)
+			}
+			if a.header != nil && len(raw) > 0 {
+				raw = raw[1:]
+			}
+			for _, row := range raw {
+				if len(row) > a.colOffset {
+					a.seen[rowSignature(row[a.colOffset:], a.dedupeCols)]++
+				}
+			}
+		}
+	}
+	a.opts.Logf("Resuming from the checkpoint of %s: %d rows appended, continuing with %s\n", cp.Saved, cp.Result.RowsAppended, a.resumeInput())
+	return nil
+}
+
+// resumeInput names the input file a resumed run continues with.
+func (a *sheetAppender) resumeInput() string {
+	cp := a.resume
+	switch {
+	case cp.NextInput >= len(a.inputs):
+		return "no input files left"
+	case cp.Records > 0:
+		return fmt.Sprintf("%s after its first %d records", inputName(a.inputs[cp.NextInput]), cp.Records)
+	}
+	return inputName(a.inputs[cp.NextInput])
+}
+
+// removeCheckpoint removes the checkpoint of a run whose output has been
+// saved complete.
+func (a *sheetAppender) removeCheckpoint() error {
+	if a.opts.Checkpoint == 0 && a.resume == nil {
+		return nil
+	}
+	if err := os.Remove(CheckpointPath(a.opts.OutputPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	a.result.CheckpointFile = ""
+	return nil
+}
@@ -0,0 +1,109 @@
+package xlappend
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// newChecksumHash returns a hash for the named algorithm, or nil if the
+// algorithm is not supported.
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha256":
+		return sha256.New()
+	case "sha1":
+		return sha1.New()
+	case "md5":
+		return md5.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// fileDigest returns the hex digest of the file at path with the named
+// algorithm, and the file's size.
+func fileDigest(path, algorithm string) (string, int64, error) {
+	h := newChecksumHash(algorithm)
+	if h == nil {
+		return "", 0, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// writeChecksum hashes the file at path and writes a sidecar named
+// <path>.<algorithm> in the "<digest>  <filename>" format understood by
+// sha256sum -c and friends. It returns the sidecar path.
+func writeChecksum(path, algorithm string) (string, error) {
+	digest, _, err := fileDigest(path, algorithm)
+	if err != nil {
+		return "", err
+	}
+	sidecar := path + "." + algorithm
+	line := fmt.Sprintf("%s  %s\n", digest, filepath.Base(path))
+	return sidecar, os.WriteFile(sidecar, []byte(line), 0644)
+}
+
+// isSHA256 reports whether digest is a hex encoded SHA256, in either case.
+func isSHA256(digest string) bool {
+	_, err := hex.DecodeString(digest)
+	return err == nil && len(digest) == 2*sha256.Size
+}
+
+// verifyInputs hashes every input file VerifySHA256 gives a hash for, a zip
+// member as it is extracted, before anything is read from it or the
+// template is opened, and returns an error naming the first that does
+// not match, so that altered evidence is never imported.
+func (a *sheetAppender) verifyInputs() error {
+	for i, want := range a.inputHashes {
+		if want == "" {
+			continue
+		}
+		path := a.inputs[i]
+		if path == StdinPath {
+			return errors.New("standard input cannot be hashed before it is read; give -verify-sha256 a file")
+		}
+		var file io.ReadCloser
+		var err error
+		if IsRemotePath(path) {
+			file, err = openRemote(a.ctx, path)
+		} else if archive, member, isZip := splitZipPath(path); isZip {
+			file, err = openZipMember(archive, member)
+		} else {
+			file, err = os.Open(path)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open input file to verify it: %v", err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to hash input file %s: %v", inputName(path), err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != strings.ToLower(want) {
+			return fmt.Errorf("input file %s does not match its -verify-sha256 hash: its SHA256 is %s, not %s", inputName(path), got, strings.ToLower(want))
+		}
+		a.opts.Verbosef("Verified the SHA256 of %s\n", inputName(path))
+	}
+	return nil
+}
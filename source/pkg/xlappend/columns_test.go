@@ -0,0 +1,68 @@
+package xlappend
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveColumn(t *testing.T) {
+	header := []string{"Name", " Path ", "Owner"}
+	for _, tc := range []struct {
+		column string
+		header []string
+		want   int
+		err    bool
+	}{
+		{"1", header, 0, false},
+		{"3", header, 2, false},
+		{"path", header, 1, false},
+		{"4", header, 0, true},
+		{"0", header, 0, true},
+		{"-1", header, 0, true},
+		{"Host", header, 0, true},
+		// Without a header any column number is taken
+		{"9", nil, 8, false},
+	} {
+		col, err := resolveColumn(tc.column, tc.header)
+		if (err != nil) != tc.err || err == nil && col != tc.want {
+			t.Errorf("resolveColumn(%q, %q) = %d, %v; want %d, error %t", tc.column, tc.header, col, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestAppendColumnPastHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		err  string
+	}{
+		{"sort-by", Options{SortBy: "99"}, "invalid sort column"},
+		{"text", Options{TextColumns: "9"}, "invalid text columns"},
+		{"date-cols", Options{DateColumns: "2,9"}, "invalid date columns"},
+		{"summary-cols", Options{Summary: true, SummaryColumns: "9"}, "invalid summary columns"},
+		{"defang", Options{DefangColumns: "9"}, "invalid defang columns"},
+		{"where", Options{Where: []string{"9=x"}}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := tc.opts
+			opts.InputPaths = []string{writeInput(t, dir, "in.csv", "Name,Path,Owner\na.exe,p,o\n")}
+			opts.TemplatePath = newTemplate(t, dir, "T", []string{"Name", "Path", "Owner"})
+			opts.SheetName, opts.StartRow, opts.OutputPath = "T", 2, filepath.Join(dir, "out.xlsx")
+			var im Importer
+			result, err := im.Append(context.Background(), opts)
+			if tc.err == "" {
+				// A field past the end of a line compares as empty
+				if err != nil || result.FilteredOut != 1 {
+					t.Errorf("Append: %v, %d filtered out; want no error, 1 filtered out", err, result.FilteredOut)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) || !strings.Contains(err.Error(), "not in the header") {
+				t.Errorf("Append error = %v, want %s ... not in the header", err, tc.err)
+			}
+		})
+	}
+}
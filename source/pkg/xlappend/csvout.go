@@ -0,0 +1,117 @@
+package xlappend
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// csvSheet is the sheet a CSV output without a template is written through,
+// when no SheetName is given.
+const csvSheet = "Data"
+
+// checkCSVOutput returns an error when a CSV output would replace one of
+// the input files, as an output directory holding the inputs, or -o {input}.csv,
+// easily makes it do.
+func (a *sheetAppender) checkCSVOutput() error {
+	if a.opts.OutputFormat != "csv" {
+		return nil
+	}
+	out, err := os.Stat(a.opts.OutputPath)
+	if err != nil {
+		return nil
+	}
+	for _, path := range a.inputs {
+		if in, err := os.Stat(path); err == nil && os.SameFile(in, out) {
+			return fmt.Errorf("the CSV output %s would replace its input; name another output", a.opts.OutputPath)
+		}
+	}
+	return nil
+}
+
+// saveCSV writes the rows appended, as the sheet shows them, to the output
+// path as CSV instead of saving the workbook: the sheet's header row first,
+// when it has one, and then the rows of SheetName and every sheet Split
+// continued on, from the start column to the last written one. The values
+// are those converted for the sheet, dates and numbers in the number format
+// of their cells, so that the CSV has the input as mapped, filtered and
+// normalised by the run. As with saveWorkbook, the file is written through
+// a temporary file renamed over path, and keeps the permissions of the file
+// it replaces.
+func (a *sheetAppender) saveCSV() error {
+	path := a.opts.OutputPath
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = path
+		}
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	out := bufio.NewWriter(tmp)
+	w := csv.NewWriter(out)
+
+	width := max(a.lastCol-a.colOffset, 0)
+	if a.headerRow > 0 {
+		if err := a.copyCSVRows(w, a.result.Sheets[0].Name, a.headerRow, a.headerRow, width); err != nil {
+			return err
+		}
+	}
+	for _, part := range a.result.Sheets {
+		if part.Rows > 0 {
+			if err := a.copyCSVRows(w, part.Name, part.firstRow, part.firstRow+part.Rows-1, width); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	err = w.Error()
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyCSVRows writes rows first to last of sheet to w, width cells each
+// from the start column on.
+func (a *sheetAppender) copyCSVRows(w *csv.Writer, sheet string, first, last, width int) error {
+	rows, err := a.f.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for row := 1; row <= last && rows.Next(); row++ {
+		if row < first {
+			continue
+		}
+		cells, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		record := make([]string, width)
+		if len(cells) > a.colOffset {
+			copy(record, cells[a.colOffset:])
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return rows.Error()
+}
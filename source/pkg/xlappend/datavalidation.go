@@ -0,0 +1,61 @@
+package xlappend
+
+import (
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// extendValidations grows the data validations of the target sheet, such
+// as the drop-down list of a triage column, down to lastRow, so that the
+// appended rows get them too. A range is grown when it reaches the last row
+// of the template's data, or starts just below it, and ends above lastRow;
+// ranges over whole columns, or reaching past the new rows already, are
+// left as they are. Validations held in the worksheet's extension list,
+// which excelize does not read, such as lists on another sheet saved by
+// newer versions of Excel, are not grown.
+func (a *sheetAppender) extendValidations(lastRow int) error {
+	sheet := a.opts.SheetName
+	dvs, err := a.f.GetDataValidations(sheet)
+	if err != nil || len(dvs) == 0 || a.templateRows == 0 {
+		return err
+	}
+	grown := 0
+	for _, dv := range dvs {
+		refs := strings.Fields(dv.Sqref)
+		for i, ref := range refs {
+			col1, row1, col2, row2, err := rangeCoordinates(ref)
+			if err != nil || row1 > a.templateRows+1 || row2 < a.templateRows || row2 >= lastRow {
+				continue
+			}
+			topLeft, _ := excelize.CoordinatesToCellName(col1, row1)
+			bottomRight, _ := excelize.CoordinatesToCellName(col2, lastRow)
+			a.opts.Verbosef("Data validation of %s!%s extended to %s:%s\n", sheet, ref, topLeft, bottomRight)
+			refs[i] = topLeft + ":" + bottomRight
+			grown++
+		}
+		dv.Sqref = strings.Join(refs, " ")
+	}
+	if grown == 0 {
+		return nil
+	}
+
+	// excelize cannot change a validation's range, so they are all added
+	// again, in order. GetDataValidations unescapes the formulas and
+	// AddDataValidation writes them as they are.
+	if err := a.f.DeleteDataValidation(sheet); err != nil {
+		return err
+	}
+	for _, dv := range dvs {
+		dv.Formula1, dv.Formula2 = formulaEscaper.Replace(dv.Formula1), formulaEscaper.Replace(dv.Formula2)
+		if err := a.f.AddDataValidation(sheet, dv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formulaEscaper escapes a validation formula for the text of its XML
+// element. Quotes are left alone, since excelize reads back &quot; but not
+// the &#34; of xml.EscapeText.
+var formulaEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
@@ -0,0 +1,208 @@
+package xlappend
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decodings are the encodings a -decode directive may name.
+var decodings = map[string]bool{"base64": true, "hex": true, "url": true}
+
+// encodedCommand matches the -EncodedCommand argument of a PowerShell
+// command line, under any abbreviation PowerShell accepts, such as -enc or
+// -e, with the base64 script as its submatch.
+var encodedCommand = regexp.MustCompile(`(?i)(?:^|\s)[-/](?:ec|e(?:n(?:c(?:o(?:d(?:e(?:d(?:c(?:o(?:m(?:m(?:a(?:n(?:d)?)?)?)?)?)?)?)?)?)?)?)?)?)\s+"?([A-Za-z0-9+/]{8,}={0,2})"?`)
+
+// decodeColumn is a -decode directive: the input column whose values are
+// decoded and how.
+type decodeColumn struct {
+	column   string // input column number or header name
+	encoding string // base64, hex or url
+	add      bool   // write the decoded text to a new column after the column instead of in place
+	header   string // the column's header in that file, empty when it has none
+}
+
+// parseDecode parses a -decode directive, COL:ENCODING to decode the values
+// of input column COL in place, or COL:ENCODING:new to add the decoded text
+// as a new column after COL, as in CommandLine:base64:new.
+func parseDecode(directive string) (decodeColumn, error) {
+	var dc decodeColumn
+	rest := strings.TrimSpace(directive)
+	if i := strings.LastIndex(rest, ":"); i >= 0 && strings.EqualFold(strings.TrimSpace(rest[i+1:]), "new") {
+		rest, dc.add = rest[:i], true
+	}
+	i := strings.LastIndex(rest, ":")
+	if i < 0 || strings.TrimSpace(rest[:i]) == "" {
+		return dc, fmt.Errorf("%q is not COL:ENCODING", directive)
+	}
+	dc.column = strings.TrimSpace(rest[:i])
+	dc.encoding = strings.ToLower(strings.TrimSpace(rest[i+1:]))
+	if !decodings[dc.encoding] {
+		return dc, fmt.Errorf("unknown encoding %q in %s; use base64, hex or url", rest[i+1:], directive)
+	}
+	return dc, nil
+}
+
+// decodeRecord returns record with the values of the Decode columns
+// decoded, in place or in a column added after theirs. The columns are
+// looked up in the first line of each file, which is its header when a
+// column is named or its field in the column does not decode; the header
+// line and the lines repeating it keep their fields, and an added column
+// is named after its column with " (decoded)", so that filters, header
+// matching and a created header see it. A value that does not decode is
+// logged, unless empty, and kept as it is, leaving an added column empty.
+func (a *sheetAppender) decodeRecord(record []string, line int) ([]string, error) {
+	if !a.sawFields {
+		a.decodeCols = make(map[int]*decodeColumn)
+		for i := range a.decodes {
+			dc := &a.decodes[i]
+			j, err := resolveColumn(dc.column, record)
+			if err == nil && j >= len(record) {
+				err = fmt.Errorf("invalid column %q", dc.column)
+			}
+			if err == nil && a.decodeCols[j] != nil {
+				err = fmt.Errorf("column %d is decoded twice", j+1)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("-decode %s: %v of %s", dc.column, err, a.inputName)
+			}
+			dc.header = ""
+			if _, err := strconv.Atoi(dc.column); err != nil {
+				dc.header = record[j]
+			} else if _, err := decodeValue(record[j], dc.encoding); err != nil {
+				dc.header = record[j]
+			}
+			a.decodeCols[j] = dc
+		}
+	}
+	decoded := make([]string, 0, len(record)+len(a.decodes))
+	for j, value := range record {
+		dc := a.decodeCols[j]
+		if dc == nil {
+			decoded = append(decoded, value)
+			continue
+		}
+		text := value
+		switch {
+		case dc.header != "" && value == dc.header:
+			if dc.add {
+				text = strings.TrimSpace(dc.header) + " (decoded)"
+			}
+		case strings.TrimSpace(value) == "":
+		default:
+			var err error
+			if text, err = decodeValue(value, dc.encoding); err != nil {
+				text = ""
+				if !dc.add {
+					text = value
+				}
+				if a.lineNumber >= a.opts.StartRow-1 && a.records > a.skipRecords && !a.splitRest {
+					reason := fmt.Sprintf("column %d: %v", j+1, err)
+					if err := a.errLog.Log(logEntry{Kind: logNotDecoded, File: a.inputFile, Line: line, Reason: reason, Text: value}); err != nil {
+						return nil, err
+					}
+					a.result.DecodeFailures++
+				}
+			}
+		}
+		if dc.add {
+			decoded = append(decoded, value, text)
+		} else {
+			decoded = append(decoded, text)
+		}
+	}
+	return decoded, nil
+}
+
+// decodeValue returns the text value encodes in encoding. A base64 value
+// that is a PowerShell command line, rather than the encoded text alone,
+// has the script of its -EncodedCommand decoded where it stands. Decoded
+// bytes are read as UTF-16, as PowerShell encodes its scripts, or UTF-8,
+// and those that are neither, or hold control characters, are not text.
+func decodeValue(value, encoding string) (string, error) {
+	text := strings.TrimSpace(value)
+	switch encoding {
+	case "url":
+		decoded, err := url.QueryUnescape(text)
+		if err != nil {
+			return "", errors.New("not valid URL encoding")
+		}
+		return decoded, nil
+	case "hex":
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X")
+		data, err := hex.DecodeString(text)
+		if err != nil {
+			return "", errors.New("not valid hex")
+		}
+		return decodedText(data)
+	}
+	if data, ok := decodeBase64(text); ok {
+		return decodedText(data)
+	}
+	m := encodedCommand.FindStringSubmatchIndex(text)
+	if m == nil {
+		return "", errors.New("not valid base64")
+	}
+	data, ok := decodeBase64(text[m[2]:m[3]])
+	if !ok {
+		return "", errors.New("not valid base64")
+	}
+	script, err := decodedText(data)
+	if err != nil {
+		return "", err
+	}
+	return text[:m[2]] + script + text[m[3]:], nil
+}
+
+// decodeBase64 decodes text in standard or URL-safe base64, padded or not.
+func decodeBase64(text string) ([]byte, bool) {
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := encoding.DecodeString(text); err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// decodedText returns data as text, decoding it from UTF-16LE when it has
+// a byte order mark or every other byte is zero, as in ASCII text so
+// encoded, and taking it as UTF-8 otherwise.
+func decodedText(data []byte) (string, error) {
+	var text string
+	if len(data) >= 2 && len(data)%2 == 0 && (data[0] == 0xFF && data[1] == 0xFE || isUTF16LE(data)) {
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+		text = strings.TrimPrefix(string(utf16.Decode(units)), "\ufeff")
+	} else if utf8.Valid(data) {
+		text = string(data)
+	} else {
+		return "", errors.New("decodes to binary data, not text")
+	}
+	for _, r := range text {
+		if r == utf8.RuneError || r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0x7F {
+			return "", errors.New("decodes to binary data, not text")
+		}
+	}
+	return text, nil
+}
+
+// isUTF16LE reports whether the odd bytes of data, the high bytes of its
+// UTF-16LE code units, are all zero.
+func isUTF16LE(data []byte) bool {
+	for i := 1; i < len(data); i += 2 {
+		if data[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package xlappend
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendDedupe(t *testing.T) {
+	const input = "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\ncmd.exe,C:\\Temp,bob\ncmd.exe,C:\\Temp,alice\n"
+	for _, tc := range []struct {
+		name    string
+		opts    Options
+		want    []string
+		skipped int
+	}{
+		{"whole rows", Options{Dedupe: true}, []string{"cmd.exe", "cmd.exe"}, 1},
+		{"key columns", Options{DedupeCols: "1,2"}, []string{}, 3},
+		{"owner only", Options{DedupeCols: "3"}, []string{"cmd.exe", "cmd.exe"}, 1},
+		// The sheet header is not a row to skip the input's own header against
+		{"input header", Options{Dedupe: true, StartRow: 1}, []string{"Name", "cmd.exe", "cmd.exe"}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := tc.opts
+			opts.InputPaths = []string{writeInput(t, dir, "in.csv", input)}
+			opts.TemplatePath = newTemplate(t, dir, "T",
+				[]string{"Name", "Path", "Owner"},
+				[]string{"svchost.exe", "C:\\Windows", "SYSTEM"},
+				[]string{"cmd.exe", "C:\\Temp", "SYSTEM"})
+			opts.SheetName, opts.OutputPath = "T", filepath.Join(dir, "out.xlsx")
+			if opts.StartRow == 0 {
+				opts.StartRow = 2
+			}
+			var im Importer
+			result, err := im.Append(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			names := []string{}
+			for _, row := range sheetRows(t, opts.OutputPath, "T")[3:] {
+				names = append(names, row[0])
+			}
+			if !reflect.DeepEqual(names, tc.want) || result.Duplicates != tc.skipped {
+				t.Errorf("appended %q, %d duplicates skipped; want %q, %d", names, result.Duplicates, tc.want, tc.skipped)
+			}
+		})
+	}
+}
+
+func TestAppendDedupeColumnPastHeader(t *testing.T) {
+	dir := t.TempDir()
+	input := writeInput(t, dir, "in.csv", "Name,Path,Owner\na.exe,p,o\nb.exe,p,o\nc.exe,p,o\n")
+	var im Importer
+	_, err := im.Append(context.Background(), Options{
+		InputPaths: []string{input}, TemplatePath: newTemplate(t, dir, "T", []string{"Name", "Path", "Owner"}),
+		SheetName: "T", StartRow: 2, OutputPath: filepath.Join(dir, "out.xlsx"), DedupeCols: "6",
+	})
+	if err == nil || !strings.Contains(err.Error(), "column 6 is past the 3 columns") {
+		t.Errorf("Append with -dedupe-cols 6 on 3 columns: error %v, want one naming column 6", err)
+	}
+}
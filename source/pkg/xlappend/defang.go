@@ -0,0 +1,55 @@
+package xlappend
+
+import (
+	"strconv"
+	"strings"
+)
+
+// defangedSchemes are the URL schemes -defang rewrites.
+var defangedSchemes = map[string]string{"http": "hxxp", "https": "hxxps", "ftp": "fxp"}
+
+// defang rewrites the URLs, IPv4 addresses and domains in value so that
+// they are no longer live links: the scheme of http://evil.com/a.exe
+// becomes hxxp and the dots of its host [.], giving hxxp://evil[.]com/a.exe.
+// Domains are recognised as -iocs recognises them, so file names keep their
+// dots. Defanged text is left as it is, so defang may be applied twice.
+func defang(value string) string {
+	value = urlPattern.ReplaceAllStringFunc(value, func(url string) string {
+		scheme, rest, _ := strings.Cut(url, "://")
+		host, path := rest, ""
+		if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+			host, path = rest[:i], rest[i:]
+		}
+		return defangedSchemes[strings.ToLower(scheme)] + "://" + strings.ReplaceAll(host, ".", "[.]") + path
+	})
+	value = ipv4Pattern.ReplaceAllStringFunc(value, func(ip string) string {
+		return strings.ReplaceAll(ip, ".", "[.]")
+	})
+	return domainPattern.ReplaceAllStringFunc(value, func(domain string) string {
+		if !isDomainTLD(domain[strings.LastIndex(domain, ".")+1:]) {
+			return domain
+		}
+		return strings.ReplaceAll(domain, ".", "[.]")
+	})
+}
+
+// formulaTriggers are the first characters that make a spreadsheet read a
+// value typed or pasted into a cell, or a field of a CSV it opens, as a
+// formula.
+const formulaTriggers = "=+-@\t\r"
+
+// sanitizeFormula returns value prefixed with a single quote, and true, when
+// it starts with one of the formulaTriggers, so that hostile input such as
+// =HYPERLINK(...) or @SUM(...) stays text when the sheet is edited or saved
+// as CSV. The values are written as text cells, which Excel does not
+// evaluate when it opens the workbook, but a cell re-entered or exported is
+// read afresh. Numbers such as -5 or +1.5 are left as they are.
+func sanitizeFormula(value string) (string, bool) {
+	if value == "" || !strings.ContainsRune(formulaTriggers, rune(value[0])) {
+		return value, false
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, false
+	}
+	return "'" + value, true
+}
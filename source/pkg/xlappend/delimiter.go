@@ -0,0 +1,96 @@
+package xlappend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+)
+
+// sniffLines is the number of non-empty lines examined by detectDelimiter.
+const sniffLines = 10
+
+// sniffBytes is the most input peeked at for delimiter detection.
+const sniffBytes = 64 * 1024
+
+// delimiterCandidates are the delimiters -d auto chooses between, in order
+// of preference.
+var delimiterCandidates = []rune{',', '\t', ';', '|'}
+
+// detectDelimiter picks the candidate delimiter that splits the first
+// non-empty lines of sample into the same number of fields on every line,
+// preferring the one that yields the most fields. It returns a comma with
+// ok set to false when no candidate splits the lines consistently or two
+// candidates tie.
+func detectDelimiter(sample []byte) (delim rune, ok bool) {
+	// Only look at whole lines, dropping a final line cut off by the sample size
+	if len(sample) == sniffBytes {
+		if i := bytes.LastIndexByte(sample, '\n'); i > 0 {
+			sample = sample[:i+1]
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(string(sample), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+		if len(lines) == sniffLines {
+			break
+		}
+	}
+	text := strings.Join(lines, "\n")
+
+	best, bestFields, tied := ',', 1, false
+	for _, candidate := range delimiterCandidates {
+		fields := consistentFields(text, candidate)
+		switch {
+		case fields > bestFields:
+			best, bestFields, tied = candidate, fields, false
+		case fields == bestFields && fields > 1:
+			tied = true
+		}
+	}
+	if bestFields == 1 || tied {
+		return ',', false
+	}
+	return best, true
+}
+
+// DetectDelimiter returns the delimiter -d auto picks for an input starting
+// with sample, a comma with ok set to false when it cannot tell; only the
+// first 64 KiB of sample are examined, see detectDelimiter.
+func DetectDelimiter(sample []byte) (delim rune, ok bool) {
+	if len(sample) > sniffBytes {
+		sample = sample[:sniffBytes]
+	}
+	return detectDelimiter(sample)
+}
+
+// consistentFields returns the field count of every record in text when
+// split by delim, or 0 when the records do not all have the same count.
+func consistentFields(text string, delim rune) int {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delim
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return 0
+	}
+	for _, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			return 0
+		}
+	}
+	return len(records[0])
+}
+
+// delimiterName describes a delimiter for log messages.
+func delimiterName(delim rune) string {
+	switch delim {
+	case '\t':
+		return "tab"
+	case ',':
+		return "comma"
+	}
+	return "'" + string(delim) + "'"
+}
@@ -0,0 +1,67 @@
+package xlappend
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// inputEncodings maps -enc names to their encodings, with the spellings
+// without a hyphen as aliases. UTF-16 decoders keep a byte order mark as
+// U+FEFF, which readRecords strips like a UTF-8 one.
+var inputEncodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf8":         unicode.UTF8,
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf16le":      unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf16be":      unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+	"latin1":       charmap.ISO8859_1,
+}
+
+// decodeInput returns r decoded to UTF-8 from the named -enc encoding.
+// With no encoding named, UTF-16 input is recognised by its byte order
+// mark and input whose first sniffBytes are not valid UTF-8 is read as
+// Windows-1252, the usual encoding of older Windows tools' exports; the
+// name of the encoding chosen is returned as detected. Anything else is
+// read as UTF-8 unchanged.
+func decodeInput(r *bufio.Reader, name string) (decoded io.Reader, detected string) {
+	if name == "" {
+		mark, _ := r.Peek(2)
+		switch {
+		case bytes.Equal(mark, []byte{0xff, 0xfe}):
+			name = "utf-16le"
+		case bytes.Equal(mark, []byte{0xfe, 0xff}):
+			name = "utf-16be"
+		case !validUTF8Prefix(r):
+			name = "windows-1252"
+		default:
+			return r, ""
+		}
+		detected = name
+	}
+	return transform.NewReader(r, inputEncodings[name].NewDecoder()), detected
+}
+
+// validUTF8Prefix reports whether the first sniffBytes of r are valid
+// UTF-8, ignoring a character cut off at the end of them.
+func validUTF8Prefix(r *bufio.Reader) bool {
+	head, _ := r.Peek(sniffBytes)
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) {
+				head = head[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(head)
+}
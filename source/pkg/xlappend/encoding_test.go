@@ -0,0 +1,67 @@
+package xlappend
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Bytes returns s encoded as UTF-16 in order, after a byte order mark.
+func utf16Bytes(s string, order binary.ByteOrder) string {
+	var b strings.Builder
+	for _, u := range utf16.Encode([]rune("\ufeff" + s)) {
+		var pair [2]byte
+		order.PutUint16(pair[:], u)
+		b.Write(pair[:])
+	}
+	return b.String()
+}
+
+func TestAppendByteOrderMark(t *testing.T) {
+	const content = "Name,Path,Owner\nsvchost.exe,C:\\Windows,SYSTEM\n"
+	for _, tc := range []struct {
+		name, content string
+	}{
+		{"none", content},
+		{"UTF-8", utf8BOM + content},
+		{"UTF-16LE", utf16Bytes(content, binary.LittleEndian)},
+		{"UTF-16BE", utf16Bytes(content, binary.BigEndian)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// From line 1, so that the input's header, which the mark
+			// starts, is written to the sheet
+			result, rows := appendInput(t, dir, writeInput(t, dir, "in.csv", tc.content), Options{StartRow: 1})
+			want := [][]string{
+				{"Name", "Path", "Owner"},
+				{"Name", "Path", "Owner"},
+				{"svchost.exe", "C:\\Windows", "SYSTEM"},
+			}
+			if !reflect.DeepEqual(rows, want) {
+				t.Errorf("sheet rows = %q, want %q", rows, want)
+			}
+			if len(rows) > 1 && len(rows[1]) > 0 && strings.ContainsRune(rows[1][0], '\ufeff') {
+				t.Errorf("first header cell %q holds U+FEFF", rows[1][0])
+			}
+			if result.RowsAppended != 2 {
+				t.Errorf("RowsAppended = %d, want 2", result.RowsAppended)
+			}
+		})
+	}
+}
+
+func TestFilterFirstColumnAfterByteOrderMark(t *testing.T) {
+	dir := t.TempDir()
+	// Without a header line the mark starts the first value matched
+	input := writeInput(t, dir, "in.csv", utf8BOM+"svchost.exe,C:\\Windows,SYSTEM\ncmd.exe,C:\\Temp,bob\n")
+	result, rows := appendInput(t, dir, input, Options{StartRow: 1, Where: []string{"1=svchost.exe"}})
+	want := [][]string{{"Name", "Path", "Owner"}, {"svchost.exe", "C:\\Windows", "SYSTEM"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("sheet rows = %q, want %q", rows, want)
+	}
+	if result.FilteredOut != 1 {
+		t.Errorf("FilteredOut = %d, want 1", result.FilteredOut)
+	}
+}
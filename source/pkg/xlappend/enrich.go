@@ -0,0 +1,138 @@
+package xlappend
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// enrichColumn is an -enrich directive: the input column whose values are
+// looked up and the table they are looked up in.
+type enrichColumn struct {
+	column string              // input column number or header name
+	names  []string            // names of the columns added, the table's header after the key
+	values map[string][]string // the table's rows by key, lower case
+	header string              // the column's header in the file being read, empty when it has none
+}
+
+// parseEnrich parses an -enrich directive, COL:FILE, and loads its lookup
+// table, as in EventID:eventids.csv.
+func parseEnrich(directive string) (enrichColumn, error) {
+	column, path, ok := strings.Cut(directive, ":")
+	if !ok || strings.TrimSpace(column) == "" || strings.TrimSpace(path) == "" {
+		return enrichColumn{}, fmt.Errorf("%q is not COL:FILE", directive)
+	}
+	ec := enrichColumn{column: strings.TrimSpace(column)}
+	var err error
+	if ec.names, ec.values, err = loadLookup(strings.TrimSpace(path)); err != nil {
+		return enrichColumn{}, err
+	}
+	return ec, nil
+}
+
+// loadLookup reads an -enrich lookup table, a CSV file whose first line is
+// its header, the key column first and then the columns added, such as
+//
+//	EventID,Description
+//	4624,An account was successfully logged on
+//
+// Keys are matched ignoring case and surrounding whitespace; lines starting
+// with # are skipped and a key listed twice is an error.
+func loadLookup(path string) ([]string, map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("%s is empty", path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(header) < 2 {
+		return nil, nil, fmt.Errorf("%s: the header names no column after the key", path)
+	}
+	names := make([]string, len(header)-1)
+	for i, name := range header[1:] {
+		names[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+	}
+	values := make(map[string][]string)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		key := strings.ToLower(strings.TrimSpace(row[0]))
+		if _, ok := values[key]; ok {
+			line, _ := r.FieldPos(0)
+			return nil, nil, fmt.Errorf("%s: line %d: key %q is listed twice", path, line, row[0])
+		}
+		fields := make([]string, len(names))
+		copy(fields, row[1:])
+		values[key] = fields
+	}
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("%s has no rows", path)
+	}
+	return names, values, nil
+}
+
+// enrichRecord returns record with the columns of each Enrich table added
+// after the column looked up in it, holding the table's row for the value,
+// or nothing when the table does not have it. The columns are looked up in
+// the first line of each file, which is its header when a column is named
+// or its field in the column is not in the table; the header line and the
+// lines repeating it get the names of the table's columns instead, so that
+// filters, header matching and a created header see them.
+func (a *sheetAppender) enrichRecord(record []string) ([]string, error) {
+	if !a.sawFields {
+		a.enrichCols = make(map[int][]*enrichColumn)
+		for i := range a.enriches {
+			ec := &a.enriches[i]
+			j, err := resolveColumn(ec.column, record)
+			if err == nil && j >= len(record) {
+				err = fmt.Errorf("invalid column %q", ec.column)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("-enrich %s: %v of %s", ec.column, err, a.inputName)
+			}
+			ec.header = ""
+			if _, err := strconv.Atoi(ec.column); err != nil {
+				ec.header = record[j]
+			} else if _, ok := ec.values[strings.ToLower(strings.TrimSpace(record[j]))]; !ok {
+				ec.header = record[j]
+			}
+			a.enrichCols[j] = append(a.enrichCols[j], ec)
+		}
+	}
+	enriched := make([]string, 0, len(record)+len(a.enriches))
+	for j, value := range record {
+		enriched = append(enriched, value)
+		for _, ec := range a.enrichCols[j] {
+			if ec.header != "" && value == ec.header {
+				enriched = append(enriched, ec.names...)
+				continue
+			}
+			fields, ok := ec.values[strings.ToLower(strings.TrimSpace(value))]
+			if !ok {
+				fields = make([]string, len(ec.names))
+				if strings.TrimSpace(value) != "" && a.lineNumber >= a.opts.StartRow-1 && a.records > a.skipRecords && !a.splitRest {
+					a.result.EnrichMisses++
+				}
+			}
+			enriched = append(enriched, fields...)
+		}
+	}
+	return enriched, nil
+}
@@ -0,0 +1,248 @@
+package xlappend
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Kinds of error log entries, as written to the csv and json formats.
+const (
+	logSkippedPattern = "skipped_pattern"
+	logSkippedFile    = "skipped_file"
+	logReadError      = "read_error"
+	logNotAppended    = "not_appended"
+	logTypeMismatch   = "type_mismatch"
+	logNotCoerced     = "not_coerced"
+	logTruncated      = "truncated"
+	logNotFlattened   = "not_flattened"
+	logNotDecoded     = "not_decoded"
+)
+
+// logLabels are the words the text format starts each kind of entry with.
+// Read errors are labelled with their line numbers instead.
+var logLabels = map[string]string{
+	logSkippedPattern: "Skipped input pattern",
+	logSkippedFile:    "Skipped input file",
+	logNotAppended:    "Not appended",
+	logTypeMismatch:   "Type mismatch",
+	logNotCoerced:     "Not coerced",
+	logTruncated:      "Truncated",
+	logNotFlattened:   "Not flattened",
+	logNotDecoded:     "Not decoded",
+}
+
+// logFormats are the error log formats: text to read, or csv and json,
+// one object per line, to load into another tool.
+var logFormats = map[string]bool{"text": true, "csv": true, "json": true}
+
+// logColumns is the header of the csv format, in the order of the fields
+// of logEntry.
+var logColumns = []string{"kind", "file", "line", "last_line", "reason", "text", "more_lines"}
+
+// logEntry is one rejected input line, value or file.
+type logEntry struct {
+	Kind     string `json:"kind"`
+	File     string `json:"file,omitempty"`      // base name of the input file
+	Line     int    `json:"line,omitempty"`      // first input line, 0 when not known
+	LastLine int    `json:"last_line,omitempty"` // last input line of a record over several lines
+	Reason   string `json:"reason,omitempty"`    // the parse error, or the column and type expected
+	Text     string `json:"text,omitempty"`      // the input as it is in the file, lines separated by "\n"
+	More     int    `json:"more_lines,omitempty"`
+}
+
+// text returns the entry as a line of the text format, or several for a
+// record over several lines, each indented below the first.
+func (e logEntry) text() string {
+	label := logLabels[e.Kind]
+	if e.Kind == logReadError && e.LastLine > e.Line {
+		label = fmt.Sprintf("Error reading lines %d-%d", e.Line, e.LastLine)
+	} else if e.Kind == logReadError {
+		label = fmt.Sprintf("Error reading line %d", e.Line)
+	} else if e.Line > 0 {
+		label += fmt.Sprintf(" at line %d", e.Line)
+	}
+	switch {
+	case e.Reason != "" && e.Text == "":
+		label += ": " + e.Reason
+	case e.Reason != "":
+		label += " (" + e.Reason + ")"
+	}
+	if e.Text == "" {
+		return label
+	}
+	if !strings.Contains(e.Text, "\n") && e.More == 0 {
+		return label + ": " + e.Text
+	}
+	text := label + ":\n  " + strings.ReplaceAll(e.Text, "\n", "\n  ")
+	if e.More > 0 {
+		text += fmt.Sprintf("\n  ... %d more lines", e.More)
+	}
+	return text
+}
+
+// errorLog writes rejected input lines to a log file that is only created
+// once there is something to log, or to standard error when it has no
+// path.
+type errorLog struct {
+	path      string
+	format    string
+	nameFiles bool // start text entries with the name of their input file
+
+	out    io.Writer
+	file   *os.File
+	buf    *bufio.Writer
+	csv    *csv.Writer
+	closed bool
+}
+
+// newErrorLog returns a log in format, one of logFormats, written to path,
+// or to standard error when path is empty.
+func newErrorLog(path, format string) *errorLog {
+	return &errorLog{path: path, format: format}
+}
+
+// Log writes an entry to the log, creating the file on first use.
+func (l *errorLog) Log(e logEntry) error {
+	if l.out == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+	switch l.format {
+	case "csv":
+		err := l.csv.Write([]string{e.Kind, e.File, lineText(e.Line), lineText(e.LastLine), e.Reason, e.Text, lineText(e.More)})
+		l.csv.Flush()
+		if err == nil {
+			err = l.csv.Error()
+		}
+		return err
+	case "json":
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = l.out.Write(append(data, '\n'))
+		return err
+	}
+	text := e.text()
+	if l.nameFiles && e.File != "" {
+		text = e.File + ": " + text
+	}
+	_, err := io.WriteString(l.out, text+"\n")
+	return err
+}
+
+// lineText returns n as text, or an empty string for 0.
+func lineText(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// open creates the log file, buffered, and starts a csv log with its header.
+func (l *errorLog) open() error {
+	l.out = os.Stderr
+	if l.path != "" {
+		file, err := os.Create(l.path)
+		if err != nil {
+			return fmt.Errorf("failed to create error log file: %v", err)
+		}
+		l.file = file
+		l.buf = bufio.NewWriter(file)
+		l.out = l.buf
+	}
+	if l.format == "csv" {
+		l.csv = csv.NewWriter(l.out)
+		if err := l.csv.Write(logColumns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeFrom continues the log file of an interrupted run, see
+// Options.Resume, cut back to size, the size it had at the run's last
+// checkpoint: the entries after that are logged again as their lines are
+// read again. A log that was empty then is started over.
+func (l *errorLog) resumeFrom(size int64) error {
+	if l.path == "" {
+		return nil
+	}
+	if size == 0 {
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove error log file: %v", err)
+		}
+		return nil
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open error log file: %v", err)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open error log file: %v", err)
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open error log file: %v", err)
+	}
+	l.file = file
+	l.buf = bufio.NewWriter(file)
+	l.out = l.buf
+	if l.format == "csv" {
+		l.csv = csv.NewWriter(l.out)
+	}
+	return nil
+}
+
+// flush writes out the buffered entries and returns the size of the log
+// file, 0 when nothing was logged to one.
+func (l *errorLog) flush() (int64, error) {
+	if l.file == nil {
+		return 0, nil
+	}
+	if err := l.buf.Flush(); err != nil {
+		return 0, err
+	}
+	return l.file.Seek(0, io.SeekCurrent)
+}
+
+// Path returns the log file path, or an empty string if nothing was logged
+// to a file.
+func (l *errorLog) Path() string {
+	if l.file == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Where names where the entries went, for messages that point to them.
+func (l *errorLog) Where() string {
+	if l.path == "" {
+		return "the errors above"
+	}
+	return "the log at " + l.path
+}
+
+// Close flushes and closes the log file if it was created. Only the first
+// call does anything.
+func (l *errorLog) Close() error {
+	if l.closed || l.file == nil {
+		l.closed = true
+		return nil
+	}
+	l.closed = true
+	err := l.buf.Flush()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
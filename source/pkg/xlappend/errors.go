@@ -0,0 +1,31 @@
+package xlappend
+
+import "errors"
+
+// The kinds of failure an error of Append or AppendJobs may be, which
+// errors.Is tells apart. Other errors come from the options or from the
+// lines read, such as MaxErrors being exceeded.
+var (
+	ErrInput    = errors.New("input error")    // an input file could not be found, opened or read
+	ErrTemplate = errors.New("template error") // the template could not be opened, or its sheet not used
+	ErrSave     = errors.New("save error")     // the output workbook or its checksum could not be written
+)
+
+// kindError is an error of one of the kinds above, with the message of the
+// error it wraps.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string        { return e.err.Error() }
+func (e *kindError) Unwrap() error        { return e.err }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// withKind returns err as an error of kind, or nil for no error.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
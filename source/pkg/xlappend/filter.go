@@ -0,0 +1,172 @@
+package xlappend
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patterns for a -where predicate. Word operators need spaces around them,
+// so they are tried before the symbols.
+var (
+	wordFilterPattern   = regexp.MustCompile(`^\s*(.+?)\s+(contains|startswith|matches)\s+(.*)$`)
+	symbolFilterPattern = regexp.MustCompile(`^\s*(.+?)\s*(!=|==|>=|<=|=|>|<)\s*(.*)$`)
+)
+
+// rowFilter is one -where predicate, COLUMN OP VALUE.
+type rowFilter struct {
+	column  string // 1-based column number or header name
+	op      string // =, !=, contains, startswith, matches, >, <, >= or <=
+	value   string
+	pattern *regexp.Regexp // the compiled value of matches
+	col     int            // 0-based input column, see resolve
+}
+
+// filterExpr is a -where or -exclude expression: predicates joined by &&,
+// which binds tighter, and ||, as in "EventID = 4624 && LogonType != 5".
+type filterExpr struct {
+	text    string
+	any     [][]*rowFilter // the alternatives, each holding when all its predicates do
+	exclude bool           // a line the expression holds for is skipped
+}
+
+// parseFilterExpr parses a -where expression, or a -exclude one when
+// exclude is set. Values cannot hold && or ||.
+func parseFilterExpr(expr string, exclude bool) (filterExpr, error) {
+	fe := filterExpr{text: expr, exclude: exclude}
+	for _, alternative := range strings.Split(expr, "||") {
+		var all []*rowFilter
+		for _, predicate := range strings.Split(alternative, "&&") {
+			rf, err := parseFilter(predicate)
+			if err != nil {
+				return filterExpr{}, err
+			}
+			all = append(all, &rf)
+		}
+		fe.any = append(fe.any, all)
+	}
+	return fe, nil
+}
+
+// resolve looks up the columns of the expression's predicates in header.
+func (fe filterExpr) resolve(header []string) error {
+	for _, all := range fe.any {
+		for _, rf := range all {
+			col, err := lookupColumn(rf.column, header)
+			if err != nil {
+				return err
+			}
+			rf.col = col
+		}
+	}
+	return nil
+}
+
+// match reports whether the expression holds for record.
+func (fe filterExpr) match(record []string) bool {
+	for _, all := range fe.any {
+		holds := true
+		for _, rf := range all {
+			if !rf.match(record) {
+				holds = false
+				break
+			}
+		}
+		if holds {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilter parses a -where predicate such as "4 = svchost.exe",
+// "Image contains \Temp\" or "User matches ^svc_". == is the same as =.
+func parseFilter(expr string) (rowFilter, error) {
+	m := wordFilterPattern.FindStringSubmatch(expr)
+	if m == nil {
+		m = symbolFilterPattern.FindStringSubmatch(expr)
+	}
+	if m == nil {
+		return rowFilter{}, fmt.Errorf("%q is not COLUMN OP VALUE", expr)
+	}
+	if col, err := strconv.Atoi(m[1]); err == nil && col < 1 {
+		return rowFilter{}, fmt.Errorf("invalid column %q", m[1])
+	}
+	rf := rowFilter{column: m[1], op: m[2], value: strings.TrimSpace(m[3])}
+	switch rf.op {
+	case "==":
+		rf.op = "="
+	case "matches":
+		pattern, err := regexp.Compile(rf.value)
+		if err != nil {
+			return rowFilter{}, fmt.Errorf("invalid regular expression %q: %v", rf.value, err)
+		}
+		rf.pattern = pattern
+	}
+	return rf, nil
+}
+
+// resolveColumn returns the 0-based column that column, a 1-based number
+// or a name, stands for in header, the one lookup of a column option
+// shares. A number must be one of header's, unless header is empty, and a
+// name is looked up in header, ignoring case and surrounding whitespace.
+func resolveColumn(column string, header []string) (int, error) {
+	col, err := lookupColumn(column, header)
+	if err == nil && len(header) > 0 && col >= len(header) {
+		return 0, fmt.Errorf("column %q is not in the header", column)
+	}
+	return col, err
+}
+
+// lookupColumn is resolveColumn without checking a column number against
+// header, for -where, where a field past the end of a line compares as
+// empty.
+func lookupColumn(column string, header []string) (int, error) {
+	if col, err := strconv.Atoi(column); err == nil {
+		if col < 1 {
+			return 0, fmt.Errorf("column %q is not in the header", column)
+		}
+		return col - 1, nil
+	}
+	for j, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(column)) {
+			return j, nil
+		}
+	}
+	return 0, fmt.Errorf("column %q is not in the header", column)
+}
+
+// field returns the field in column rf.col of record, empty when missing.
+func (rf *rowFilter) field(record []string) string {
+	if rf.col < len(record) {
+		return record[rf.col]
+	}
+	return ""
+}
+
+// match reports whether the field in column rf.col of record satisfies the
+// predicate. A missing field compares as empty. >, <, >= and <= compare
+// numbers numerically and anything else as text, like -sort-sheet.
+func (rf *rowFilter) match(record []string) bool {
+	field := rf.field(record)
+	switch rf.op {
+	case "=":
+		return field == rf.value
+	case "!=":
+		return field != rf.value
+	case "contains":
+		return strings.Contains(field, rf.value)
+	case "startswith":
+		return strings.HasPrefix(field, rf.value)
+	case "matches":
+		return rf.pattern.MatchString(field)
+	case ">":
+		return compareValues(field, rf.value) > 0
+	case ">=":
+		return compareValues(field, rf.value) >= 0
+	case "<=":
+		return compareValues(field, rf.value) <= 0
+	}
+	return compareValues(field, rf.value) < 0
+}
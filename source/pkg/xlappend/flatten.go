@@ -0,0 +1,274 @@
+package xlappend
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A flattenPath is one of the FlattenFields: the names leading from the
+// payload's top level to a value, as in EventData.TargetUserName.
+type flattenPath []string
+
+// parseFlattenFields returns the paths of fields, a comma separated list of
+// dotted field names.
+func parseFlattenFields(fields string) ([]flattenPath, error) {
+	var paths []flattenPath
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		path := flattenPath(strings.Split(field, "."))
+		for _, name := range path {
+			if strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("invalid field %q", field)
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// flattenRecord returns record with a field added at its end for each of
+// the FlattenFields, holding the value found at its path in the payload of
+// the Flatten column. A payload is read as JSON when it starts with { or [
+// and as XML, such as the event XML of Windows event logs, when it starts
+// with <; one that does not parse is logged, unless empty, and leaves the
+// fields empty. The first line of a file is its header when its field in
+// the column is not a payload, and it and the lines repeating it get the
+// names of the new columns instead, the column's header and the field
+// joined by a dot, so that filters, header matching and a created header
+// see them.
+func (a *sheetAppender) flattenRecord(record []string, line int) ([]string, error) {
+	if !a.sawFields {
+		j, err := resolveColumn(strings.TrimSpace(a.opts.Flatten), record)
+		if err == nil && j >= len(record) {
+			err = fmt.Errorf("invalid column %q", a.opts.Flatten)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("-flatten %s: %v of %s", a.opts.Flatten, err, a.inputName)
+		}
+		a.flattenCol, a.flattenHeader = j, ""
+		if !isPayload(record[j]) {
+			a.flattenHeader = record[j]
+		}
+	}
+	var payload string
+	if a.flattenCol < len(record) {
+		payload = record[a.flattenCol]
+	}
+	fields := make([]string, len(a.flattenPaths))
+	if a.flattenHeader != "" && payload == a.flattenHeader {
+		for k, path := range a.flattenPaths {
+			fields[k] = strings.TrimSpace(a.flattenHeader) + "." + strings.Join(path, ".")
+		}
+		return append(record, fields...), nil
+	}
+	if strings.TrimSpace(payload) != "" {
+		err := flattenPayload(payload, a.flattenPaths, fields)
+		if err != nil && a.lineNumber >= a.opts.StartRow-1 && a.records > a.skipRecords && !a.splitRest {
+			reason := fmt.Sprintf("column %d: %v", a.flattenCol+1, err)
+			if err := a.errLog.Log(logEntry{Kind: logNotFlattened, File: a.inputFile, Line: line, Reason: reason, Text: payload}); err != nil {
+				return nil, err
+			}
+			a.result.FlattenFailures++
+		}
+	}
+	return append(record, fields...), nil
+}
+
+// isPayload reports whether value is read as a JSON or XML payload.
+func isPayload(value string) bool {
+	text := strings.TrimSpace(value)
+	return strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "<")
+}
+
+// flattenPayload sets fields to the values of payload at paths.
+func flattenPayload(payload string, paths []flattenPath, fields []string) error {
+	text := strings.TrimSpace(payload)
+	switch {
+	case !isPayload(text):
+		return errors.New("neither JSON nor XML")
+	case strings.HasPrefix(text, "{") || strings.HasPrefix(text, "["):
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var doc interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			return fmt.Errorf("not valid JSON: %v", err)
+		}
+		for k, path := range paths {
+			fields[k] = jsonField(doc, path)
+		}
+	default:
+		root, err := parseXMLPayload(text)
+		if err != nil {
+			return fmt.Errorf("not valid XML: %v", err)
+		}
+		for k, path := range paths {
+			fields[k] = root.field(path)
+		}
+	}
+	return nil
+}
+
+// jsonField returns the value at path in the decoded JSON doc, empty when
+// there is none. A name picks the member of an object, a number the element
+// of an array, and a name no member has the element of an array member
+// whose @Name is that name, as EvtxECmd writes the event data:
+//
+//	{"EventData": {"Data": [{"@Name": "TargetUserName", "#text": "bob"}]}}
+//
+// An object holding #text stands for its text, and other objects and arrays
+// are written as JSON.
+func jsonField(doc interface{}, path flattenPath) string {
+	value := doc
+	for _, name := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			member, ok := v[name]
+			if !ok {
+				members := make([]interface{}, 0, len(v))
+				for _, m := range v {
+					members = append(members, m)
+				}
+				member = namedElement(members, name)
+			}
+			value = member
+		case []interface{}:
+			if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(v) {
+				value = v[i]
+			} else {
+				value = namedElement(v, name)
+			}
+		default:
+			value = nil
+		}
+		if value == nil {
+			return ""
+		}
+	}
+	if v, ok := value.(map[string]interface{}); ok {
+		if text, ok := v["#text"]; ok {
+			value = text
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// namedElement returns the object among values, or the elements of those
+// that are arrays, whose @Name is name, nil when there is none.
+func namedElement(values []interface{}, name string) interface{} {
+	for _, value := range values {
+		elements, ok := value.([]interface{})
+		if !ok {
+			elements = []interface{}{value}
+		}
+		for _, element := range elements {
+			if e, ok := element.(map[string]interface{}); ok && e["@Name"] == name {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// xmlNode is an element of an XML payload.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     strings.Builder
+	children []*xmlNode
+}
+
+// parseXMLPayload returns the root element of the XML document text.
+func parseXMLPayload(text string) (*xmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = false
+	var root *xmlNode
+	var open []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			open = append(open, node)
+		case xml.EndElement:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case xml.CharData:
+			if len(open) > 0 {
+				open[len(open)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no element")
+	}
+	return root, nil
+}
+
+// field returns the value at path below the root element n, empty when
+// there is none. A name picks the child element of that name or, failing
+// one, the child whose Name attribute is that name, as the Data elements of
+// an event's EventData are named; the last name may also pick an attribute,
+// as in System.TimeCreated.SystemTime. An element stands for its text.
+func (n *xmlNode) field(path flattenPath) string {
+	node := n
+	for i, name := range path {
+		next := node.child(name)
+		if next == nil && i == len(path)-1 {
+			for _, attr := range node.attrs {
+				if attr.Name.Local == name {
+					return attr.Value
+				}
+			}
+		}
+		if next == nil {
+			return ""
+		}
+		node = next
+	}
+	return strings.TrimSpace(node.text.String())
+}
+
+// child returns the child element of n named name, or else the one whose
+// Name attribute is name.
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+	for _, child := range n.children {
+		for _, attr := range child.attrs {
+			if attr.Name.Local == "Name" && attr.Value == name {
+				return child
+			}
+		}
+	}
+	return nil
+}
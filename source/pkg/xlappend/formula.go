@@ -0,0 +1,45 @@
+package xlappend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// formulaRowPlaceholder in a -formula expression stands for the sheet row
+// the formula is written to.
+const formulaRowPlaceholder = "{row}"
+
+// formulaColumn is a -formula directive: a formula written into one sheet
+// column of every appended row.
+type formulaColumn struct {
+	col  int    // 1-based sheet column
+	expr string // formula without the leading =, may contain {row}
+}
+
+// parseFormula parses a -formula directive such as
+// "G=VLOOKUP(B{row},Hosts!A:B,2,FALSE)". The column is a letter or a
+// 1-based number and the expression may start with =.
+func parseFormula(directive string) (formulaColumn, error) {
+	parts := strings.SplitN(directive, "=", 2)
+	if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+		return formulaColumn{}, fmt.Errorf("%q is not COL=EXPR", directive)
+	}
+	name := strings.TrimSpace(parts[0])
+	col, err := strconv.Atoi(name)
+	if err != nil {
+		col, err = excelize.ColumnNameToNumber(name)
+	}
+	if err != nil || col < 1 || col > excelize.MaxColumns {
+		return formulaColumn{}, fmt.Errorf("invalid column %q", name)
+	}
+	expr := strings.TrimPrefix(strings.TrimSpace(parts[1]), "=")
+	return formulaColumn{col: col, expr: expr}, nil
+}
+
+// at returns the formula for sheet row row.
+func (fc formulaColumn) at(row int) string {
+	return strings.ReplaceAll(fc.expr, formulaRowPlaceholder, strconv.Itoa(row))
+}
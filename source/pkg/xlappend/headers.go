@@ -0,0 +1,226 @@
+package xlappend
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// intersectColumns matches the input header against the sheet header by
+// name, ignoring case and surrounding whitespace. The returned map holds,
+// for each sheet column, the index of the matching input column or -1.
+// dropped lists input columns with no sheet column and blank lists sheet
+// columns with no input column.
+func intersectColumns(inputHeader, sheetHeader []string) (columnMap []int, dropped, blank []string) {
+	used := make([]bool, len(inputHeader))
+	columnMap = make([]int, len(sheetHeader))
+	for i, name := range sheetHeader {
+		columnMap[i] = -1
+		for j, inputName := range inputHeader {
+			if !used[j] && strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(inputName)) {
+				columnMap[i] = j
+				used[j] = true
+				break
+			}
+		}
+		if columnMap[i] == -1 {
+			blank = append(blank, name)
+		}
+	}
+	for j, inputName := range inputHeader {
+		if !used[j] {
+			dropped = append(dropped, inputName)
+		}
+	}
+	return columnMap, dropped, blank
+}
+
+// unmatchedColumns returns, in input order, the indexes of the inputWidth
+// input columns that columnMap does not place anywhere.
+func unmatchedColumns(columnMap []int, inputWidth int) []int {
+	used := make([]bool, inputWidth)
+	for _, j := range columnMap {
+		if j >= 0 && j < inputWidth {
+			used[j] = true
+		}
+	}
+	var unmatched []int
+	for j := range used {
+		if !used[j] {
+			unmatched = append(unmatched, j)
+		}
+	}
+	return unmatched
+}
+
+// parseColumns parses a -cols list of 1-based input column numbers and
+// ranges such as "3,1,7,7,9-12" into a column map for remapRecord. Columns
+// may repeat.
+func parseColumns(spec string) ([]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var columnMap []int
+	for _, part := range strings.Split(spec, ",") {
+		first, last, ok := parseColumnRange(part)
+		if !ok {
+			return nil, fmt.Errorf("invalid column %q", part)
+		}
+		for col := first; col <= last; col++ {
+			columnMap = append(columnMap, col-1)
+		}
+	}
+	return columnMap, nil
+}
+
+// parseColumnRange parses a 1-based column number, or a range of them such
+// as "5-9", into its first and last column.
+func parseColumnRange(part string) (first, last int, ok bool) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+	first, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil || first < 1 {
+		return 0, 0, false
+	}
+	last = first
+	if isRange {
+		if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || last < first {
+			return 0, 0, false
+		}
+	}
+	return first, last, true
+}
+
+// dropColumns resolves a -drop-cols list of 1-based input column numbers,
+// ranges and header names, ignoring case and surrounding whitespace, into
+// the set of 0-based columns to leave out. Names are looked up in header.
+func dropColumns(spec string, header []string) (map[int]bool, error) {
+	dropped := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		if first, last, ok := parseColumnRange(part); ok {
+			for col := first; col <= last; col++ {
+				dropped[col-1] = true
+			}
+			continue
+		}
+		found := false
+		for j, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(part)) {
+				dropped[j] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %q is not in the header", strings.TrimSpace(part))
+		}
+	}
+	return dropped, nil
+}
+
+// keptColumns returns the column map for remapRecord that leaves the
+// dropped ones out of n columns.
+func keptColumns(n int, dropped map[int]bool) []int {
+	columnMap := make([]int, 0, n)
+	for j := 0; j < n; j++ {
+		if !dropped[j] {
+			columnMap = append(columnMap, j)
+		}
+	}
+	return columnMap
+}
+
+// repeatsHeader reports whether record, the next of the file being read,
+// is the header again: the first record of its file, later in the file, as
+// in exports concatenated into one, or the first record of the run, in a
+// later file, as each input of a glob starts with. It notes the headers as
+// their records are read. A blank header is not looked for.
+func (a *sheetAppender) repeatsHeader(record []string) bool {
+	if a.records == 1 {
+		a.fileHeader = append([]string(nil), record...)
+		if a.runHeader == nil {
+			a.runHeader = a.fileHeader
+			return false
+		}
+	} else if !a.opts.KeepHeaders && sameFields(record, a.fileHeader) {
+		return true
+	}
+	return !a.opts.KeepHeaders && sameFields(record, a.runHeader)
+}
+
+// sameFields reports whether record holds the fields of header, which is
+// not blank.
+func sameFields(record, header []string) bool {
+	if len(record) != len(header) || isBlankRecord(header) {
+		return false
+	}
+	for i := range record {
+		if record[i] != header[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// remapRecord reorders the fields of record to follow columnMap. Columns
+// mapped to -1, or to a field the record does not have, are left empty.
+func remapRecord(record []string, columnMap []int) []string {
+	mapped := make([]string, len(columnMap))
+	for i, j := range columnMap {
+		if j >= 0 && j < len(record) {
+			mapped[i] = record[j]
+		}
+	}
+	return mapped
+}
+
+// remapColumns is remapRecord for column indexes: it returns which of cols
+// each column of columnMap holds, -1 for none.
+func remapColumns(cols []int, columnMap []int) []int {
+	mapped := make([]int, len(columnMap))
+	for i, j := range columnMap {
+		mapped[i] = -1
+		if j >= 0 && j < len(cols) {
+			mapped[i] = cols[j]
+		}
+	}
+	return mapped
+}
+
+// rowKey returns the fields of row named by keyCols, or all of them when
+// keyCols is nil, that duplicate rows are detected by. Trailing empty
+// fields are dropped, since sheet rows are read without them.
+func rowKey(row []string, keyCols []int) []string {
+	if keyCols != nil {
+		row = remapRecord(row, keyCols)
+	}
+	end := len(row)
+	for end > 0 && row[end-1] == "" {
+		end--
+	}
+	return row[:end]
+}
+
+// skipSeen reports whether the row whose rowSignature is key is to be
+// skipped, counting it in seen. With Dedupe every row already on the sheet
+// or written before is; with Incremental a row is skipped as many times as
+// it is on the sheet, so that a growing log appended again adds its new
+// lines, repeats of earlier ones among them, and the rows written are not
+// counted.
+func (a *sheetAppender) skipSeen(seen map[string]int, key string) bool {
+	if a.opts.Incremental {
+		if seen[key] > 0 {
+			seen[key]--
+			return true
+		}
+		return false
+	}
+	seen[key]++
+	return seen[key] > 1
+}
+
+// rowSignature returns the SHA-256 hash of the rowKey fields, so that every
+// row remembered for -dedupe takes 32 bytes however wide it is.
+func rowSignature(row []string, keyCols []int) string {
+	sum := sha256.Sum256([]byte(strings.Join(rowKey(row, keyCols), "\x00")))
+	return string(sum[:])
+}
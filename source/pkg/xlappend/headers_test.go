@@ -0,0 +1,71 @@
+package xlappend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestIntersectColumns(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		input, sheet   []string
+		columnMap      []int
+		dropped, blank []string
+	}{
+		{"same", []string{"Name", "Path", "Owner"}, []string{"Name", "Path", "Owner"}, []int{0, 1, 2}, nil, nil},
+		{"reordered", []string{"Owner", "Name", "Path"}, []string{"Name", "Path", "Owner"}, []int{1, 2, 0}, nil, nil},
+		{"case and spaces", []string{" name", "PATH "}, []string{"Name", "Path"}, []int{0, 1}, nil, nil},
+		{"partial overlap", []string{"Name", "Hash", "Owner"}, []string{"Name", "Path", "Owner"}, []int{0, -1, 2}, []string{"Hash"}, []string{"Path"}},
+		{"no overlap", []string{"A", "B"}, []string{"Name", "Path"}, []int{-1, -1}, []string{"A", "B"}, []string{"Name", "Path"}},
+		// A repeated heading matches one column each
+		{"repeated", []string{"User", "User"}, []string{"User", "Host", "User"}, []int{0, -1, 1}, nil, []string{"Host"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			columnMap, dropped, blank := intersectColumns(tc.input, tc.sheet)
+			if !reflect.DeepEqual(columnMap, tc.columnMap) || !reflect.DeepEqual(dropped, tc.dropped) || !reflect.DeepEqual(blank, tc.blank) {
+				t.Errorf("intersectColumns = %v, dropped %q, blank %q; want %v, dropped %q, blank %q",
+					columnMap, dropped, blank, tc.columnMap, tc.dropped, tc.blank)
+			}
+		})
+	}
+}
+
+func TestAppendIntersectHeaders(t *testing.T) {
+	dir := t.TempDir()
+	input := writeInput(t, dir, "in.csv", "Owner,Hash,Name\nSYSTEM,d41d8cd9,svchost.exe\nbob,9e107d9d,cmd.exe\n")
+	var logged []string
+	result, rows := appendInput(t, dir, input, Options{
+		IntersectHeaders: true,
+		Logf:             func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) },
+	})
+	want := [][]string{
+		{"Name", "Path", "Owner"},
+		{"svchost.exe", "", "SYSTEM"},
+		{"cmd.exe", "", "bob"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("sheet rows = %q, want %q", rows, want)
+	}
+	if result.RowsAppended != 2 || result.NotAppendedCount != 0 {
+		t.Errorf("Result = %d appended, %d not appended; want 2, 0", result.RowsAppended, result.NotAppendedCount)
+	}
+	for _, line := range []string{
+		"Sheet columns not in input header (left blank): Path\n",
+		"Input columns not in sheet header (dropped): Hash\n",
+	} {
+		if !contains(logged, line) {
+			t.Errorf("messages %q do not include %q", logged, line)
+		}
+	}
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package xlappend
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// defaultHighlightColor is the fill of the -highlight hits without a
+// -highlight-color, Excel's yellow.
+const defaultHighlightColor = "FFFF00"
+
+// colorPattern matches an RGB or ARGB colour in hex, as Excel writes them.
+var colorPattern = regexp.MustCompile(`^#?([0-9A-Fa-f]{2})?([0-9A-Fa-f]{6})$`)
+
+// loadHighlights reads a -highlight file of keywords and indicators of
+// compromise, one per line, into a pattern matching any of them anywhere
+// in a value, ignoring case. Blank lines and lines starting with # are
+// skipped.
+func loadHighlights(path string) (*regexp.Regexp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var keywords []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keywords = append(keywords, regexp.QuoteMeta(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keywords) == 0 {
+		return nil, fmt.Errorf("%s has no keywords", path)
+	}
+	return regexp.Compile("(?i)" + strings.Join(keywords, "|"))
+}
+
+// parseColor returns the RGB part of an RGB or ARGB hex colour such as
+// FFCC0000, which is how excelize takes fill colours.
+func parseColor(color string) (string, error) {
+	m := colorPattern.FindStringSubmatch(color)
+	if m == nil {
+		return "", fmt.Errorf("invalid colour: %s", color)
+	}
+	return strings.ToUpper(m[2]), nil
+}
+
+// highlightStyle returns style base with the -highlight fill, creating the
+// style on first use.
+func (a *sheetAppender) highlightStyle(base int) (int, error) {
+	if style, ok := a.highlightStyles[base]; ok {
+		return style, nil
+	}
+	spec := &excelize.Style{}
+	if base != 0 {
+		var err error
+		if spec, err = a.f.GetStyle(base); err != nil {
+			return 0, fmt.Errorf("failed to read cell style: %v", err)
+		}
+	}
+	spec.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{a.highlightColor}}
+	style, err := a.f.NewStyle(spec)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create cell style: %v", err)
+	}
+	a.highlightStyles[base] = style
+	return style, nil
+}
@@ -0,0 +1,94 @@
+package xlappend
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// insertCount returns how many of the buffered rows flushRows will write:
+// those that fit the sheet and, when deduplicating, are neither on the
+// sheet nor earlier in the input.
+func (a *sheetAppender) insertCount() int {
+	n := 0
+	var seen map[string]int
+	if a.seen != nil {
+		seen = make(map[string]int, len(a.seen))
+		for key, n := range a.seen {
+			seen[key] = n
+		}
+	}
+	for _, row := range a.csvData {
+		if a.colOffset+len(row) > a.maxCols && a.opts.Ragged == "truncate" {
+			row = a.sheetFields(row)
+		} else if a.colOffset+len(row) > a.maxCols {
+			continue
+		}
+		if seen != nil && a.skipSeen(seen, rowSignature(row, a.dedupeCols)) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// insertRows makes room for n rows at a.nextRow by moving the rows from
+// there on down. excelize moves the cells, formulas, merged cells,
+// conditional formats, data validations and defined names, but it rewrites
+// table parts without their extensions and breaks a table reaching the
+// last row of the sheet, so the tables are moved here instead, see
+// shiftTable.
+func (a *sheetAppender) insertRows(n int) error {
+	if a.templateRows+a.result.RowsAppended+n > excelize.TotalRows {
+		return fmt.Errorf("sheet %s is full: Excel sheets hold at most %d rows", a.sheet, excelize.TotalRows)
+	}
+	parts := make(map[string]interface{})
+	for _, table := range a.tables {
+		if name, _ := findTablePart(a.f, table.Name); name != "" {
+			parts[name], _ = a.f.Pkg.Load(name)
+		}
+	}
+	if err := a.f.InsertRows(a.sheet, a.nextRow, n); err != nil {
+		return err
+	}
+	for name, content := range parts {
+		a.f.Pkg.Store(name, content)
+	}
+	for i := range a.tables {
+		if err := shiftTable(a.f, &a.tables[i], a.nextRow, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftTable moves the rows of table from row on down by n, as inserting n
+// rows above row does, and updates table.Range to match. A table reaching
+// the last row of the sheet keeps covering whole columns.
+func shiftTable(f *excelize.File, table *excelize.Table, row, n int) error {
+	col1, row1, col2, row2, err := tableRange(table)
+	if err != nil {
+		return err
+	}
+	if row2 < row || row1 < row && row2 == excelize.TotalRows {
+		return nil
+	}
+	if row1 >= row {
+		row1 += n
+	}
+	if row2 += n; row2 > excelize.TotalRows {
+		row2 = excelize.TotalRows
+	}
+	partName, _ := findTablePart(f, table.Name)
+	if partName == "" {
+		return fmt.Errorf("table %s not found in the workbook", table.Name)
+	}
+	topLeft, _ := excelize.CoordinatesToCellName(col1, row1)
+	bottomRight, _ := excelize.CoordinatesToCellName(col2, row2)
+	ref := []byte("${1}" + topLeft + ":" + bottomRight + "${2}")
+	content, _ := f.Pkg.Load(partName)
+	updated := tableRefPattern.ReplaceAll(content.([]byte), ref)
+	f.Pkg.Store(partName, autoFilterRefPattern.ReplaceAll(updated, ref))
+	table.Range = topLeft + ":" + bottomRight
+	return nil
+}
@@ -0,0 +1,206 @@
+package xlappend
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxIOCRefs is how many cell references the IOC sheet lists for each
+// indicator; its count goes on past them.
+const maxIOCRefs = 50
+
+// maxHyperlinks is the most hyperlinks Excel keeps on one sheet.
+const maxHyperlinks = 65530
+
+// Patterns for the indicators of compromise -iocs extracts. IPv6 candidates
+// are checked with netip, since the pattern also matches times of day and
+// MAC addresses, and domains must end in a top level domain, see
+// domainTLDs.
+var (
+	urlPattern    = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s"'<>]+`)
+	ipv4Pattern   = regexp.MustCompile(`\b(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])(?:\.(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])){3}\b`)
+	ipv6Pattern   = regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}`)
+	domainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+([a-z]{2,24})\b`)
+	hashPattern   = regexp.MustCompile(`\b(?:[0-9A-Fa-f]{64}|[0-9A-Fa-f]{40}|[0-9A-Fa-f]{32})\b`)
+)
+
+// domainTLDs are the top level domains a domain may end in besides the two
+// letter country codes. Names such as svchost.exe and setup.log are file
+// names, not domains, so the rest are left out.
+var domainTLDs = map[string]bool{
+	"com": true, "net": true, "org": true, "edu": true, "gov": true, "mil": true, "int": true,
+	"info": true, "biz": true, "name": true, "pro": true, "mobi": true, "arpa": true, "onion": true,
+	"xyz": true, "top": true, "online": true, "site": true, "club": true, "shop": true, "store": true,
+	"app": true, "dev": true, "cloud": true, "live": true, "tech": true, "space": true, "website": true,
+	"icu": true, "vip": true, "work": true, "link": true, "click": true, "buzz": true, "win": true,
+	"local": true, "corp": true, "lan": true, "internal": true,
+}
+
+// fileExtensionTLDs are the two letter country codes that name file types
+// more often than domains in forensic exports.
+var fileExtensionTLDs = map[string]bool{
+	"cs": true, "db": true, "gz": true, "js": true, "md": true, "pl": true, "ps": true,
+	"py": true, "rb": true, "rs": true, "sh": true, "so": true, "ts": true, "vb": true, "xz": true,
+}
+
+// isDomainTLD reports whether tld ends a domain rather than a file name.
+func isDomainTLD(tld string) bool {
+	tld = strings.ToLower(tld)
+	return domainTLDs[tld] || len(tld) == 2 && !fileExtensionTLDs[tld]
+}
+
+// extractIOCs calls found with each indicator in value, once each, and its
+// kind: url, ipv4, ipv6, domain, md5, sha1 or sha256. Domains and hashes are
+// lower cased.
+func extractIOCs(value string, found func(indicator, kind string)) {
+	seen := make(map[string]bool)
+	report := func(indicator, kind string) {
+		if !seen[kind+"\x00"+indicator] {
+			seen[kind+"\x00"+indicator] = true
+			found(indicator, kind)
+		}
+	}
+	for _, url := range urlPattern.FindAllString(value, -1) {
+		report(strings.TrimRight(url, ".,;:!?)]}"), "url")
+	}
+	for _, ip := range ipv4Pattern.FindAllString(value, -1) {
+		report(ip, "ipv4")
+	}
+	if strings.Count(value, ":") >= 2 {
+		for _, candidate := range ipv6Pattern.FindAllString(value, -1) {
+			if addr, err := netip.ParseAddr(candidate); err == nil && addr.Is6() && !addr.IsUnspecified() {
+				report(addr.String(), "ipv6")
+			}
+		}
+	}
+	for _, m := range domainPattern.FindAllStringSubmatch(value, -1) {
+		if isDomainTLD(m[1]) {
+			report(strings.ToLower(m[0]), "domain")
+		}
+	}
+	for _, hash := range hashPattern.FindAllString(value, -1) {
+		kind := "md5"
+		switch len(hash) {
+		case 40:
+			kind = "sha1"
+		case 64:
+			kind = "sha256"
+		}
+		report(strings.ToLower(hash), kind)
+	}
+}
+
+// iocEntry is one row of the IOC sheet.
+type iocEntry struct {
+	indicator, kind string
+	count           int      // cells the indicator appeared in
+	refs            []string // the first maxIOCRefs of those cells, as Sheet!A1
+}
+
+// iocIndex collects the distinct indicators in the order they are found.
+type iocIndex struct {
+	entries map[string]*iocEntry
+	order   []*iocEntry
+}
+
+func newIOCIndex() *iocIndex {
+	return &iocIndex{entries: make(map[string]*iocEntry)}
+}
+
+// add counts count more cells holding indicator, refs among them.
+func (x *iocIndex) add(indicator, kind string, count int, refs ...string) {
+	key := kind + "\x00" + indicator
+	entry, ok := x.entries[key]
+	if !ok {
+		entry = &iocEntry{indicator: indicator, kind: kind}
+		x.entries[key] = entry
+		x.order = append(x.order, entry)
+	}
+	entry.count += count
+	for _, ref := range refs {
+		if len(entry.refs) < maxIOCRefs {
+			entry.refs = append(entry.refs, ref)
+		}
+	}
+}
+
+// addIOCs adds the indicators convertRow found in the value written to cell
+// of the current sheet to a.iocs.
+func (a *sheetAppender) addIOCs(found []foundIOC, cell string) {
+	ref := quoteSheetName(a.sheet) + "!" + cell
+	for _, ioc := range found {
+		a.iocs.add(ioc.indicator, ioc.kind, 1, ref)
+	}
+}
+
+// writeIOCSheet lists the indicators found on the IOCSheet, one row each
+// under an Indicator, Type, Count and References header, the indicator
+// linking to the first cell it was found in. The indicators an existing
+// IOC sheet already lists are kept and counted on, so a later run or the
+// next job adds to the same list.
+func (a *sheetAppender) writeIOCSheet() error {
+	name := a.opts.IOCSheet
+	index := newIOCIndex()
+	if i, _ := a.f.GetSheetIndex(name); i < 0 {
+		if _, err := a.f.NewSheet(name); err != nil {
+			return err
+		}
+		for col, width := range map[string]float64{"A": 48, "B": 10, "C": 8, "D": 60} {
+			if err := a.f.SetColWidth(name, col, col, width); err != nil {
+				return err
+			}
+		}
+	} else {
+		rows, err := a.f.GetRows(name)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows[min(1, len(rows)):] {
+			if len(row) < 2 || row[0] == "" {
+				continue
+			}
+			count := 0
+			if len(row) > 2 {
+				count, _ = strconv.Atoi(row[2])
+			}
+			var refs []string
+			if len(row) > 3 && row[3] != "" {
+				refs = strings.Split(row[3], ", ")
+			}
+			index.add(row[0], row[1], count, refs...)
+		}
+	}
+	for _, entry := range a.iocs.order {
+		index.add(entry.indicator, entry.kind, entry.count, entry.refs...)
+	}
+
+	if err := a.f.SetSheetRow(name, "A1", &[]interface{}{"Indicator", "Type", "Count", "References"}); err != nil {
+		return err
+	}
+	bold, err := a.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	if err := a.f.SetCellStyle(name, "A1", "D1", bold); err != nil {
+		return err
+	}
+	for i, entry := range index.order {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		row := []interface{}{entry.indicator, entry.kind, entry.count, strings.Join(entry.refs, ", ")}
+		if err := a.f.SetSheetRow(name, cell, &row); err != nil {
+			return err
+		}
+		if len(entry.refs) > 0 && i < maxHyperlinks {
+			if err := a.f.SetCellHyperLink(name, cell, entry.refs[0], "Location"); err != nil {
+				return fmt.Errorf("failed to link %s: %v", entry.indicator, err)
+			}
+		}
+	}
+	a.opts.Verbosef("Listed %d indicators on sheet %s\n", len(index.order), name)
+	return nil
+}
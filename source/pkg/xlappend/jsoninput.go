@@ -0,0 +1,254 @@
+package xlappend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// jsonReader reads a JSON array of objects, or JSON Lines with one object
+// per line, as records. The first record is a header of every key in the
+// input, in the order the keys first appear, with nested objects flattened
+// into dotted keys, and each object follows as a record of its values under
+// those keys. An element of the array that is itself an array is a record
+// of its values in order, like a CSV line, and input of nothing but arrays
+// has no header. The whole input is parsed before the first record is
+// returned, since the header depends on every object.
+type jsonReader struct {
+	keys    []string
+	objects []jsonObject
+	next    int // index of the next record, the header, if any, being 0
+	line    int // input line of the last record returned
+}
+
+// jsonObject is one parsed object, or the error that stopped it parsing
+// and the text that failed.
+type jsonObject struct {
+	line   int
+	values map[string]string
+	fields []string // values of an array element, in order
+	array  bool
+	err    error
+	raw    []byte
+}
+
+// newJSONReader parses input, telling an array from JSON Lines by its first
+// character. An object that does not parse is returned by Read as a
+// *csv.ParseError for its line, like a malformed CSV line. A malformed
+// array cannot be parsed past the error, so that fails the whole input.
+func newJSONReader(input io.Reader) (*jsonReader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte(utf8BOM))
+	r := &jsonReader{}
+	seen := make(map[string]bool)
+	add := func(line int, raw []byte) {
+		if bytes.TrimLeft(raw, " \t")[0] == '[' {
+			fields, err := parseJSONArray(raw)
+			object := jsonObject{line: line, fields: fields, array: true, err: err}
+			if err != nil {
+				object.raw = raw
+			}
+			r.objects = append(r.objects, object)
+			return
+		}
+		keys, values, err := parseJSONObject(raw)
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				r.keys = append(r.keys, key)
+			}
+		}
+		object := jsonObject{line: line, values: values, err: err}
+		if err != nil {
+			object.raw = raw
+		}
+		r.objects = append(r.objects, object)
+	}
+
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		for i, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				add(i+1, line)
+			}
+		}
+		return r, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		// The element starts after the separating comma and whitespace
+		start := int(decoder.InputOffset())
+		start += len(data[start:]) - len(bytes.TrimLeft(data[start:], " \t\r\n,"))
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		add(1+bytes.Count(data[:start], []byte("\n")), raw)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON array")
+	}
+	return r, nil
+}
+
+// parseJSONObject returns the keys of the JSON object raw, in order, and
+// the text of each value, see jsonText. The fields of a nested object are
+// flattened into keys joined by dots, as in Event.System.EventID, and an
+// empty nested object is kept as {}. A repeated key keeps its last value.
+func parseJSONObject(raw []byte) ([]string, map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	} else if token != json.Delim('{') {
+		return nil, nil, errors.New("not a JSON object or array")
+	}
+	var keys []string
+	values := make(map[string]string)
+	if err := flattenJSONObject(decoder, "", &keys, values); err != nil {
+		return nil, nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, nil, errors.New("unexpected data after the JSON object")
+	}
+	return keys, values, nil
+}
+
+// flattenJSONObject adds the fields of the object being decoded, whose
+// opening brace has been read, to keys and values under prefix, and reads
+// its closing brace.
+func flattenJSONObject(decoder *json.Decoder, prefix string, keys *[]string, values map[string]string) error {
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := prefix + token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if value[0] == '{' && len(bytes.TrimSpace(value[1:len(value)-1])) > 0 {
+			nested := json.NewDecoder(bytes.NewReader(value))
+			nested.Token()
+			if err := flattenJSONObject(nested, key+".", keys, values); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			*keys = append(*keys, key)
+		}
+		if values[key], err = jsonText(value); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// parseJSONArray returns the text of each value of the JSON array raw, see
+// jsonText. Nested objects are not flattened, since an array has no keys.
+func parseJSONArray(raw []byte) ([]string, error) {
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if fields[i], err = jsonText(value); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// jsonText returns the cell text of a JSON value: strings unquoted, null as
+// empty, and numbers, booleans, arrays and objects as compact JSON.
+func jsonText(value json.RawMessage) (string, error) {
+	switch value[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(value, &s)
+		return s, err
+	case 'n':
+		return "", nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		return "", err
+	}
+	return compact.String(), nil
+}
+
+// Read returns the header, if there is one, then the values of each object
+// under it, or of each array, with trailing empty values dropped, so that a
+// key only some objects have does not make the others too wide for the
+// sheet.
+func (r *jsonReader) Read() ([]string, error) {
+	if r.next == 0 && len(r.keys) == 0 {
+		r.next = 1
+	}
+	if r.next > len(r.objects) || len(r.objects) == 0 {
+		return nil, io.EOF
+	}
+	r.next++
+	if r.next == 1 {
+		r.line = r.objects[0].line
+		return append([]string(nil), r.keys...), nil
+	}
+	object := r.objects[r.next-2]
+	r.line = object.line
+	if object.err != nil {
+		return nil, &csv.ParseError{StartLine: object.line, Line: object.line, Err: object.err}
+	}
+	record := object.fields
+	if !object.array {
+		record = make([]string, len(r.keys))
+		for i, key := range r.keys {
+			record[i] = object.values[key]
+		}
+	}
+	end := len(record)
+	for end > 0 && record[end-1] == "" {
+		end--
+	}
+	return record[:end], nil
+}
+
+// rawLines returns the text of the object starting on line first that
+// failed to parse. Only those objects are kept.
+func (r *jsonReader) rawLines(first, last int) []string {
+	for _, object := range r.objects {
+		if object.line == first && object.raw != nil {
+			lines := strings.Split(string(object.raw), "\n")
+			for i := range lines {
+				lines[i] = strings.TrimSuffix(lines[i], "\r")
+			}
+			return lines
+		}
+	}
+	return nil
+}
+
+// forget does nothing, since the whole input is held anyway.
+func (r *jsonReader) forget(before int) {}
+
+// FieldPos returns the input line of the last record read. The header is
+// given the line of the first object.
+func (r *jsonReader) FieldPos(field int) (line, column int) {
+	return r.line, 1
+}
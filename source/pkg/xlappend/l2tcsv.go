@@ -0,0 +1,51 @@
+package xlappend
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// l2tcsvFields is the number of columns of Plaso's l2tcsv output:
+// date,time,timezone,MACB,source,sourcetype,type,user,host,short,desc,
+// version,filename,inode,notes,format,extra.
+const l2tcsvFields = 17
+
+// l2tcsvReader reads Plaso's l2tcsv output, as psort -o l2tcsv writes it,
+// from a comma delimited reader. The date and time columns, MM/DD/YYYY and
+// HH:MM:SS in the output's timezone, are joined into a single datetime
+// column of yyyy-mm-dd hh:mm:ss, so each line becomes 16 fields and the
+// header, if the input has one, starts with datetime instead of date and
+// time. A date Plaso could not work out, such as 00/00/0000, is kept as
+// written.
+type l2tcsvReader struct {
+	*csv.Reader
+}
+
+// Read returns the next line with its date and time joined. A line without
+// the 17 l2tcsv columns is a read error confined to that line.
+func (r l2tcsvReader) Read() ([]string, error) {
+	record, err := r.Reader.Read()
+	if err != nil {
+		return record, err
+	}
+	if len(record) != l2tcsvFields {
+		line, _ := r.FieldPos(0)
+		return nil, &csv.ParseError{StartLine: line, Line: line, Err: fmt.Errorf("an l2tcsv line has %d fields, not %d", len(record), l2tcsvFields)}
+	}
+	datetime := record[0] + " " + record[1]
+	if strings.EqualFold(record[0], "date") && strings.EqualFold(record[1], "time") {
+		datetime = "datetime"
+	} else if t, err := time.Parse("01/02/2006 15:04:05", datetime); err == nil {
+		datetime = t.Format("2006-01-02 15:04:05")
+	}
+	return append([]string{datetime}, record[2:]...), nil
+}
+
+// inputTypes gives the datetime column date and time cells.
+func (r l2tcsvReader) inputTypes() []columnType {
+	types := make([]columnType, l2tcsvFields-1)
+	types[0] = columnType{kind: "timestamp"}
+	return types
+}
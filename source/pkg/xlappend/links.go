@@ -0,0 +1,91 @@
+package xlappend
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// linkValuePlaceholder in a -link-cols URL stands for the cell's value.
+const linkValuePlaceholder = "{value}"
+
+// linkColumns is a -link-cols directive: the columns whose cells link to
+// the URL made from their value.
+type linkColumns struct {
+	columns []string // 1-based written column numbers or sheet header names
+	url     string   // URL holding {value}
+}
+
+// parseLinkColumns parses a -link-cols directive such as
+// "SHA256,MD5=https://www.virustotal.com/gui/file/{value}".
+func parseLinkColumns(directive string) (linkColumns, error) {
+	columns, link, ok := strings.Cut(directive, "=")
+	if !ok || strings.TrimSpace(columns) == "" {
+		return linkColumns{}, fmt.Errorf("%q is not COLUMNS=URL", directive)
+	}
+	if !strings.Contains(link, linkValuePlaceholder) {
+		return linkColumns{}, fmt.Errorf("the URL %s has no %s", link, linkValuePlaceholder)
+	}
+	lc := linkColumns{url: strings.TrimSpace(link)}
+	for _, column := range strings.Split(columns, ",") {
+		lc.columns = append(lc.columns, strings.TrimSpace(column))
+	}
+	return lc, nil
+}
+
+// linkTarget returns the URL of template for value. A value within the
+// query of the URL is query escaped and one in its path path escaped, while
+// a template of just {value} links to the value as it is, for columns
+// holding URLs.
+func linkTarget(template, value string) string {
+	if template == linkValuePlaceholder {
+		return value
+	}
+	escaped := url.PathEscape(value)
+	if q := strings.Index(template, "?"); q >= 0 && q < strings.Index(template, linkValuePlaceholder) {
+		escaped = url.QueryEscape(value)
+	}
+	return strings.ReplaceAll(template, linkValuePlaceholder, escaped)
+}
+
+// setLink links cell of the current sheet to the -link-cols URL of value.
+// Excel keeps at most maxHyperlinks on a sheet, so the cells past them are
+// left as text, with a warning.
+func (a *sheetAppender) setLink(cell, template, value string) error {
+	if a.sheetLinks == maxHyperlinks {
+		a.opts.Logf("Warning: sheet %s has %d links, the most Excel keeps; the rest of its cells are not linked\n", a.sheet, maxHyperlinks)
+	}
+	if a.sheetLinks++; a.sheetLinks > maxHyperlinks {
+		return nil
+	}
+	return a.f.SetCellHyperLink(a.sheet, cell, linkTarget(template, value), "External")
+}
+
+// linkStyle returns style base with the blue, underlined font Excel gives
+// hyperlinks, creating the style on first use.
+func (a *sheetAppender) linkStyle(base int) (int, error) {
+	if style, ok := a.linkStyles[base]; ok {
+		return style, nil
+	}
+	spec := &excelize.Style{}
+	if base != 0 {
+		var err error
+		if spec, err = a.f.GetStyle(base); err != nil {
+			return 0, fmt.Errorf("failed to read cell style: %v", err)
+		}
+	}
+	font := excelize.Font{}
+	if spec.Font != nil {
+		font = *spec.Font
+	}
+	font.Color, font.Underline = "0563C1", "single"
+	spec.Font = &font
+	style, err := a.f.NewStyle(spec)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create cell style: %v", err)
+	}
+	a.linkStyles[base] = style
+	return style, nil
+}
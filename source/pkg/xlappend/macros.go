@@ -0,0 +1,58 @@
+package xlappend
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// vbaProjectPart is the part of a macro-enabled workbook holding its VBA
+// project. excelize keeps it, and the buttons and controls of the sheets
+// calling its macros, as the template has them.
+const vbaProjectPart = "xl/vbaProject.bin"
+
+// outputFormats are the extensions an output file may have: those excelize
+// saves, the macro-enabled ones keeping the template's VBA project, and
+// .ods, see saveODS.
+var outputFormats = map[string]bool{".xlsx": true, ".xlsm": true, ".xltx": true, ".xltm": true, ".ods": true}
+
+// checkOutputFormat returns an error unless path has one of outputFormats,
+// so that a workbook excelize cannot save is turned down before the input
+// is read.
+func checkOutputFormat(path string) error {
+	if ext := strings.ToLower(filepath.Ext(path)); !outputFormats[ext] {
+		return fmt.Errorf("cannot save the workbook as %s: name the output .xlsx, .xlsm, .xltx, .xltm or .ods", filepath.Base(path))
+	}
+	return nil
+}
+
+// macroEnabled reports whether path names a workbook or template that may
+// hold macros.
+func macroEnabled(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".xlsm" || ext == ".xltm"
+}
+
+// hasVBAProject reports whether f holds a VBA project.
+func hasVBAProject(f *excelize.File) bool {
+	_, ok := f.Pkg.Load(vbaProjectPart)
+	return ok
+}
+
+// checkMacros returns an error when the template's VBA project would be
+// saved in a workbook whose type does not allow macros, which Excel then
+// refuses to open.
+func (a *sheetAppender) checkMacros() error {
+	if !hasVBAProject(a.f) || a.opts.OutputFormat == "csv" {
+		return nil
+	}
+	output := a.opts.OutputPath
+	if !macroEnabled(output) && !isODS(output) {
+		stem := strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+		return fmt.Errorf("the template holds macros, which %s cannot keep; name the output %s.xlsm", filepath.Base(output), stem)
+	}
+	a.opts.Verbosef("Keeping the template's VBA project in %s\n", output)
+	return nil
+}
@@ -0,0 +1,109 @@
+package xlappend
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// manifestSuffix is added to the output path to name its manifest.
+const manifestSuffix = ".manifest.json"
+
+// manifest is the document Manifest writes next to the saved workbook,
+// for tooling that tracks and verifies the workbooks it is handed.
+type manifest struct {
+	Output       string          `json:"output"`
+	SHA256       string          `json:"sha256"`
+	Bytes        int64           `json:"bytes"`
+	Created      string          `json:"created"`        // UTC time the workbook was saved
+	Tool         string          `json:"tool,omitempty"` // Options.Tool
+	Template     string          `json:"template"`
+	Encrypted    bool            `json:"encrypted"`
+	Inputs       []manifestInput `json:"inputs"`
+	Sheets       []manifestSheet `json:"sheets"`
+	RowsAppended int             `json:"rows_appended"`
+	ReadErrors   int             `json:"lines_with_read_errors"`
+	NotAppended  int             `json:"lines_not_appended"`
+	FilteredOut  int             `json:"lines_filtered_out"`
+	Duplicates   int             `json:"duplicates_skipped"`
+	BlankSkipped int             `json:"blank_lines_skipped"`
+	FilesSkipped int             `json:"files_skipped"`
+	ErrorLogs    []string        `json:"error_logs,omitempty"`
+}
+
+// manifestSheet is a sheet the rows were written to.
+type manifestSheet struct {
+	Name  string `json:"name"`
+	Rows  int    `json:"rows"`
+	Range string `json:"range,omitempty"`
+}
+
+// manifestInput is what a manifest records of one input file read.
+type manifestInput struct {
+	Path         string `json:"path"`
+	Sheet        string `json:"sheet"`
+	SHA256       string `json:"sha256"`
+	MD5          string `json:"md5"`
+	Bytes        int64  `json:"bytes"`
+	LinesRead    int    `json:"lines_read"`
+	RowsAppended int    `json:"rows_appended"`
+	LinesFailed  int    `json:"lines_failed"`
+}
+
+// writeManifest hashes the saved workbook and writes its manifest to
+// <output>.manifest.json, listing the inputs and counts of this import
+// and, for AppendJobs, of the jobs before it. It returns the manifest path.
+func (a *sheetAppender) writeManifest() (string, error) {
+	digest, size, err := fileDigest(a.opts.OutputPath, "sha256")
+	if err != nil {
+		return "", err
+	}
+	m := manifest{
+		Output:    a.opts.OutputPath,
+		SHA256:    digest,
+		Bytes:     size,
+		Created:   time.Now().UTC().Format(time.RFC3339),
+		Tool:      a.opts.Tool,
+		Template:  a.templatePath(),
+		Encrypted: a.opts.Password != "",
+		Inputs:    []manifestInput{},
+		Sheets:    []manifestSheet{},
+	}
+	logs := make(map[string]bool)
+	for _, job := range append(a.earlier, a) {
+		r := job.result
+		for i, record := range job.inputRecords {
+			file := r.Files[i]
+			m.Inputs = append(m.Inputs, manifestInput{
+				Path:         file.Path,
+				Sheet:        job.opts.SheetName,
+				SHA256:       record.sha256,
+				MD5:          record.md5,
+				Bytes:        record.size,
+				LinesRead:    record.lines,
+				RowsAppended: file.Rows,
+				LinesFailed:  file.Failed,
+			})
+		}
+		for _, part := range r.Sheets {
+			m.Sheets = append(m.Sheets, manifestSheet{Name: part.Name, Rows: part.Rows, Range: part.Range})
+		}
+		m.RowsAppended += r.RowsAppended
+		m.ReadErrors += r.ErrorCount
+		m.NotAppended += r.NotAppendedCount
+		m.FilteredOut += r.FilteredOut
+		m.Duplicates += r.Duplicates
+		m.BlankSkipped += r.BlankSkipped
+		m.FilesSkipped += r.FilesSkipped
+		if path := job.errLog.Path(); path != "" && !logs[path] {
+			logs[path] = true
+			m.ErrorLogs = append(m.ErrorLogs, path)
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := a.opts.OutputPath + manifestSuffix
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
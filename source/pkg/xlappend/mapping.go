@@ -0,0 +1,150 @@
+package xlappend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// mappedColumn is one entry of a -map file: the sheet column written and
+// where its value comes from.
+type mappedColumn struct {
+	sheet    string // sheet header name or column letter
+	col      int    // 0-based written column, from the start column, once resolved
+	source   string // input column number or header name, empty for a constant
+	value    string // constant value written to every row
+	constant bool
+}
+
+// loadColumnMap reads a -map file, a JSON object keyed by sheet column
+// whose values give the input column, by 1-based number or header name, or
+// a constant as {"value": "..."}:
+//
+//	{"A": "Time", "B": 3, "Case": {"value": "2024-017"}}
+//
+// Sheet columns are resolved by resolveMapSheet and input columns by
+// resolveMapSources. Entries are returned in key order so that errors come
+// out the same way on every run.
+func loadColumnMap(path string) ([]mappedColumn, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var entries map[string]interface{}
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s maps no columns", path)
+	}
+	var mapping []mappedColumn
+	for sheet, value := range entries {
+		mc := mappedColumn{sheet: strings.TrimSpace(sheet)}
+		switch v := value.(type) {
+		case json.Number:
+			if n, err := strconv.Atoi(v.String()); err != nil || n < 1 {
+				return nil, fmt.Errorf("%s: column %s: invalid input column %s", path, sheet, v)
+			}
+			mc.source = v.String()
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return nil, fmt.Errorf("%s: column %s: empty input column name", path, sheet)
+			}
+			mc.source = v
+		case map[string]interface{}:
+			constant, ok := v["value"]
+			if !ok || len(v) != 1 {
+				return nil, fmt.Errorf("%s: column %s: a constant is written as {\"value\": ...}", path, sheet)
+			}
+			mc.value, mc.constant = fmt.Sprint(constant), true
+		default:
+			return nil, fmt.Errorf("%s: column %s: expected an input column number or name, or {\"value\": ...}", path, sheet)
+		}
+		mapping = append(mapping, mc)
+	}
+	sort.Slice(mapping, func(i, j int) bool { return mapping[i].sheet < mapping[j].sheet })
+	return mapping, nil
+}
+
+// resolveMapSheet resolves the sheet column of each -map entry, a name
+// looked up in header, the sheet header from the start column on, ignoring
+// case and surrounding whitespace, or else a column letter.
+func (a *sheetAppender) resolveMapSheet(header []string) error {
+	used := make(map[int]string)
+	for i := range a.mapping {
+		mc := &a.mapping[i]
+		mc.col = -1
+		for j, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), mc.sheet) {
+				mc.col = j
+				break
+			}
+		}
+		if mc.col < 0 {
+			col, err := excelize.ColumnNameToNumber(mc.sheet)
+			if err != nil {
+				return fmt.Errorf("column %q is neither in the sheet header nor a column letter", mc.sheet)
+			}
+			if col <= a.colOffset {
+				return fmt.Errorf("column %s is before the start column", mc.sheet)
+			}
+			mc.col = col - a.colOffset - 1
+		}
+		if other, ok := used[mc.col]; ok {
+			return fmt.Errorf("%s and %s are the same sheet column", other, mc.sheet)
+		}
+		used[mc.col] = mc.sheet
+	}
+	return nil
+}
+
+// resolveMapSources builds the column map for remapRecord from the -map
+// entries, looking input column names up in header, the first line of the
+// current input file. Constants and sheet columns no entry names map to -1
+// and are filled in by mapRecord.
+func (a *sheetAppender) resolveMapSources(header []string) error {
+	width := 0
+	for _, mc := range a.mapping {
+		if mc.col >= width {
+			width = mc.col + 1
+		}
+	}
+	a.mapCols = make([]int, width)
+	for i := range a.mapCols {
+		a.mapCols[i] = -1
+	}
+	for _, mc := range a.mapping {
+		if mc.constant {
+			continue
+		}
+		j, err := resolveColumn(mc.source, header)
+		if err != nil {
+			return fmt.Errorf("-map column %s: %v of %s", mc.sheet, err, a.inputName)
+		}
+		a.mapCols[mc.col] = j
+	}
+	return nil
+}
+
+// mapRecord places the fields of record in the sheet columns of the -map
+// entries and writes the constants.
+func (a *sheetAppender) mapRecord(record []string) []string {
+	record = remapRecord(record, a.mapCols)
+	for _, mc := range a.mapping {
+		if mc.constant {
+			record[mc.col] = mc.value
+		}
+	}
+	return record
+}
@@ -0,0 +1,155 @@
+package xlappend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ndjsonExport is the file ExportNDJSON writes the appended rows to, one
+// JSON object a line, as they are written to the sheet. The rows go to a
+// temporary file in the same directory, which save renames over the path
+// once the output is saved, so that a failed run leaves no partial export.
+type ndjsonExport struct {
+	path string
+	tmp  *os.File
+	out  *bufio.Writer
+	keys []string        // key of each written column, from the sheet header
+	used map[string]bool // the keys given so far
+	line bytes.Buffer
+}
+
+// exportPath resolves the ExportNDJSON path given for the input paths or
+// patterns as outputPath does the output, InputToken standing for the name
+// of the first input file. Unless force is set an existing file is not
+// replaced, and the export never replaces the output.
+func exportPath(export string, inputs []string, output string, force bool) (string, error) {
+	path, err := OutputName(export, inputs[0])
+	if err != nil {
+		return "", err
+	}
+	if OutputIsDir(export) {
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + ".ndjson"
+	}
+	if filepath.Clean(path) == filepath.Clean(output) {
+		return "", fmt.Errorf("the NDJSON export %s would replace the output; name another file", path)
+	}
+	if info, err := os.Stat(path); err == nil && !force {
+		if info.IsDir() {
+			return "", fmt.Errorf("NDJSON export path %s is a directory", path)
+		}
+		return "", fmt.Errorf("NDJSON export file %s already exists; use -force to replace it", path)
+	}
+	return path, nil
+}
+
+// openExport starts the ExportNDJSON file, unless none is asked for or the
+// run is a dry run.
+func (a *sheetAppender) openExport() error {
+	if a.opts.ExportNDJSON == "" || a.opts.DryRun {
+		return nil
+	}
+	path := a.opts.ExportNDJSON
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = path
+		}
+		return fmt.Errorf("failed to start NDJSON export: %v", err)
+	}
+	a.export = &ndjsonExport{path: path, tmp: tmp, out: bufio.NewWriter(tmp), used: make(map[string]bool)}
+	return nil
+}
+
+// closeExport removes the temporary file of an export saveExport did not
+// finish.
+func (a *sheetAppender) closeExport() {
+	if a.export == nil {
+		return
+	}
+	a.export.tmp.Close()
+	os.Remove(a.export.tmp.Name())
+	a.export = nil
+}
+
+// exportRow writes row, as its cells were converted for the sheet, to the
+// export as a JSON object whose keys are the sheet's headings, from the
+// start column on. A column without a heading is keyed by its letter, as
+// is one whose heading an earlier column has, after the heading. Numbers,
+// booleans and dates keep their types, dates in RFC 3339, and empty cells
+// are left out.
+func (a *sheetAppender) exportRow(row []string, cells []convertedCell) error {
+	e := a.export
+	for len(e.keys) < len(row) {
+		j := len(e.keys)
+		name, _ := excelize.ColumnNumberToName(a.colOffset + j + 1)
+		key := name
+		if j < len(a.exportHeader) && strings.TrimSpace(a.exportHeader[j]) != "" {
+			key = strings.TrimSpace(a.exportHeader[j])
+			if e.used[key] {
+				key += " (" + name + ")"
+			}
+		}
+		e.keys = append(e.keys, key)
+		e.used[key] = true
+	}
+	e.line.Reset()
+	e.line.WriteByte('{')
+	enc := json.NewEncoder(&e.line)
+	enc.SetEscapeHTML(false)
+	first := true
+	for j, value := range row {
+		typed := cells[j].typed
+		if typed == nil || typed == "" {
+			continue
+		}
+		if !first {
+			e.line.WriteByte(',')
+		}
+		first = false
+		if err := enc.Encode(e.keys[j]); err != nil {
+			return err
+		}
+		e.line.Truncate(e.line.Len() - 1)
+		e.line.WriteByte(':')
+		// NaN and the infinities have no JSON number
+		if err := enc.Encode(typed); err != nil {
+			if err := enc.Encode(value); err != nil {
+				return err
+			}
+		}
+		e.line.Truncate(e.line.Len() - 1)
+	}
+	e.line.WriteString("}\n")
+	_, err := e.out.Write(e.line.Bytes())
+	return err
+}
+
+// saveExport completes the export, once the output is saved, renaming it
+// over its path.
+func (a *sheetAppender) saveExport() (string, error) {
+	e := a.export
+	err := e.out.Flush()
+	if closeErr := e.tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(e.tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(e.tmp.Name(), e.path)
+	}
+	if err != nil {
+		os.Remove(e.tmp.Name())
+	}
+	a.export = nil
+	return e.path, err
+}
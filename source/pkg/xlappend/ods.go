@@ -0,0 +1,122 @@
+package xlappend
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sofficeEnv names the LibreOffice program saveODS converts with, when it
+// is not found on the PATH or where LibreOffice installs it.
+const sofficeEnv = "CSV2XL_SOFFICE"
+
+// isODS reports whether path names an OpenDocument spreadsheet, which the
+// workbook is converted to for saving, see saveODS.
+func isODS(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ods")
+}
+
+// sofficePath returns the LibreOffice program that converts workbooks to
+// OpenDocument: $CSV2XL_SOFFICE, soffice or libreoffice on the PATH, or
+// the program where the LibreOffice installer puts it.
+func sofficePath() (string, error) {
+	if path := os.Getenv(sofficeEnv); path != "" {
+		return path, nil
+	}
+	for _, name := range []string{"soffice", "libreoffice"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	var installed []string
+	switch runtime.GOOS {
+	case "windows":
+		for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)"} {
+			if dir := os.Getenv(env); dir != "" {
+				installed = append(installed, filepath.Join(dir, "LibreOffice", "program", "soffice.exe"))
+			}
+		}
+	case "darwin":
+		installed = append(installed, "/Applications/LibreOffice.app/Contents/MacOS/soffice")
+	}
+	for _, path := range installed {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("saving an OpenDocument spreadsheet needs LibreOffice: put soffice on the PATH or name it in $%s", sofficeEnv)
+}
+
+// saveODS saves f as the OpenDocument spreadsheet path. excelize only
+// writes Office Open XML, so the workbook is saved as XLSX in a temporary
+// directory next to path and converted there by LibreOffice, running
+// headless with a profile of its own so that a LibreOffice already open
+// does not take the conversion over, and the result renamed over path.
+// The saved file keeps the permissions of the file it replaces.
+func saveODS(f *excelize.File, path string) error {
+	soffice, err := sofficePath()
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = path
+		}
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	xlsx := filepath.Join(dir, stem+".xlsx")
+	out, err := os.Create(xlsx)
+	if err != nil {
+		return err
+	}
+	f.Path = xlsx
+	err = f.Write(out, excelize.Options{})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	f.Path = path
+	if err != nil {
+		return err
+	}
+
+	profile, err := filepath.Abs(filepath.Join(dir, "profile"))
+	if err != nil {
+		return err
+	}
+	// A file URL of a Windows path, C:/..., needs a slash before its drive
+	profileURL := url.URL{Scheme: "file", Path: filepath.ToSlash(profile)}
+	if !strings.HasPrefix(profileURL.Path, "/") {
+		profileURL.Path = "/" + profileURL.Path
+	}
+	cmd := exec.Command(soffice, "-env:UserInstallation="+profileURL.String(), "--headless", "--norestore",
+		"--convert-to", "ods", "--outdir", dir, xlsx)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("LibreOffice could not convert the workbook: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	// soffice exits cleanly even when it converted nothing
+	converted := filepath.Join(dir, stem+".ods")
+	if _, err := os.Stat(converted); err != nil {
+		return fmt.Errorf("LibreOffice did not convert the workbook: %s", strings.TrimSpace(string(output)))
+	}
+	if err := os.Chmod(converted, mode); err != nil {
+		return err
+	}
+	return os.Rename(converted, path)
+}
@@ -0,0 +1,157 @@
+package xlappend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// StdinPath as an input path reads standard input, or Options.Stdin.
+const StdinPath = "-"
+
+// stdinName names standard input in messages, the error log, the source
+// column and output names.
+const stdinName = "stdin"
+
+// inputName returns the name of the input path in messages, a remote one
+// without its query string, see remoteName.
+func inputName(path string) string {
+	if path == StdinPath {
+		return stdinName
+	}
+	if IsRemotePath(path) {
+		return remoteName(path)
+	}
+	return path
+}
+
+// InputToken in the output path stands for the name of the first input
+// file without its extensions.
+const InputToken = "{input}"
+
+// outputPath resolves the output path given with -o against the input paths
+// or patterns. InputToken is replaced by the name of the first input file,
+// and a directory, or a path ending in a separator, gets a workbook named
+// after it. Unless force is set an existing file is not replaced.
+func outputPath(output string, inputs []string, force bool) (string, error) {
+	output, err := OutputName(output, inputs[0])
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(output); err == nil && !force {
+		if info.IsDir() {
+			return "", fmt.Errorf("output path %s is a directory", output)
+		}
+		return "", fmt.Errorf("output file %s already exists; use -force to replace it, or -backup to keep a copy first", output)
+	}
+	return output, nil
+}
+
+// saveWorkbook saves f as path, encrypted with password unless it is empty,
+// through a temporary file in the same directory that is renamed over path
+// once it is complete, so that a failed or interrupted save never leaves a
+// truncated workbook behind, least of all over one saved before. The saved
+// file keeps the permissions of the file it replaces. A path ending in .ods
+// is saved as an OpenDocument spreadsheet, see saveODS.
+func saveWorkbook(f *excelize.File, path, password string) error {
+	if isODS(path) {
+		return saveODS(f, path)
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		// Name the output rather than the temporary file it failed on
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			pathErr.Path = path
+		}
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// The options are always given, since excelize would otherwise
+	// encrypt the output with the template password, and the path, whose
+	// extension decides the content type, is the final one
+	f.Path = path
+	err = f.Write(tmp, excelize.Options{Password: password})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// OutputName returns the output file the output path names for the input
+// path or pattern, see outputPath.
+func OutputName(output, input string) (string, error) {
+	isDir := OutputIsDir(output)
+	if !isDir && !strings.Contains(output, InputToken) {
+		return output, nil
+	}
+	name, err := inputStem(input)
+	if err != nil {
+		return "", err
+	}
+	output = strings.ReplaceAll(output, InputToken, name)
+	if isDir {
+		output = filepath.Join(output, name+".xlsx")
+	}
+	return output, nil
+}
+
+// OutputIsDir reports whether the output path names a directory: one that
+// exists, or any path ending in a separator.
+func OutputIsDir(output string) bool {
+	if strings.HasSuffix(output, string(filepath.Separator)) || strings.HasSuffix(output, "/") {
+		return true
+	}
+	info, err := os.Stat(output)
+	return err == nil && info.IsDir()
+}
+
+// inputStem returns the base name of the input path without its extension,
+// and without ".gz" first for compressed input, so "evtx.csv.gz" gives
+// "evtx". A pattern is named by the first file it matches, a zip archive
+// member by its own name and other zip paths by the archive, a URL by the
+// last part of its path and StdinPath is named stdin.
+func inputStem(path string) (string, error) {
+	if path == StdinPath {
+		return stdinName, nil
+	}
+	if IsRemotePath(path) {
+		name := remoteName(path)
+		if path = name[strings.LastIndex(name, "/")+1:]; path == "" {
+			return "", fmt.Errorf("cannot name the output file after URL %s, whose path has no file name", name)
+		}
+	} else if archive, member, ok := splitZipPath(path); ok {
+		path = member
+		if member == "" || strings.ContainsAny(member, "*?[") {
+			path = archive
+		}
+	}
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil || len(matches) == 0 {
+			return "", fmt.Errorf("cannot name the output file after input pattern %s, which matches no files", path)
+		}
+		sort.Strings(matches)
+		path = matches[0]
+	}
+	name := filepath.Base(path)
+	if strings.HasSuffix(strings.ToLower(name), ".gz") {
+		name = name[:len(name)-len(".gz")]
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)), nil
+}
@@ -0,0 +1,148 @@
+package xlappend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxCellChars is the most characters an Excel cell holds, counted as
+// UTF-16 code units, so that a character outside the Basic Multilingual
+// Plane, such as an emoji, counts twice.
+const maxCellChars = excelize.TotalCellChars
+
+// overflowValue is a value cut short by fitCell, with the cell it was
+// written to as Sheet!A1 and the line it came from.
+type overflowValue struct {
+	ref, file string
+	line      int
+	value     string
+}
+
+// cellRuneChars returns the UTF-16 code units of r.
+func cellRuneChars(r rune) int {
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
+
+// cellChars returns the length of value as Excel counts it.
+func cellChars(value string) int {
+	n := 0
+	for _, r := range value {
+		n += cellRuneChars(r)
+	}
+	return n
+}
+
+// fitCell returns value, when it is too long for a cell, cut at a
+// character boundary so that it fits with TruncateMarker after it, and
+// true. Left to excelize, the value would be cut without a word, at
+// maxCellChars characters counted otherwise than Excel counts them.
+func (a *sheetAppender) fitCell(value string) (string, bool) {
+	if len(value) <= maxCellChars || cellChars(value) <= maxCellChars {
+		return value, false
+	}
+	room := max(maxCellChars-cellChars(a.opts.TruncateMarker), 0)
+	n := 0
+	for i, r := range value {
+		if n+cellRuneChars(r) > room {
+			return value[:i] + a.opts.TruncateMarker, true
+		}
+		n += cellRuneChars(r)
+	}
+	return value, false
+}
+
+// logTruncated logs a value fitCell cut short as it was written to cell,
+// with its full text, or keeps it for the OverflowSheet to hold instead.
+func (a *sheetAppender) logTruncated(cell, file string, line int, value string) error {
+	entry := logEntry{Kind: logTruncated, File: file, Line: line, Reason: fmt.Sprintf("cell %s, %d characters", cell, cellChars(value)), Text: value}
+	if a.opts.OverflowSheet != "" {
+		entry.Text = ""
+		entry.Reason += ", continued on sheet " + a.opts.OverflowSheet
+		a.overflow = append(a.overflow, overflowValue{quoteSheetName(a.sheet) + "!" + cell, file, line, value})
+	}
+	a.result.TruncatedCells++
+	return a.errLog.Log(entry)
+}
+
+// overflowParts splits value into the parts OverflowSheet writes a row
+// each, which fit in a cell.
+func overflowParts(value string) []string {
+	var parts []string
+	for value != "" {
+		n, end := 0, len(value)
+		for i, r := range value {
+			if n+cellRuneChars(r) > maxCellChars {
+				end = i
+				break
+			}
+			n += cellRuneChars(r)
+		}
+		parts = append(parts, value[:end])
+		value = value[end:]
+	}
+	return parts
+}
+
+// writeOverflowSheet writes the full text of the values fitCell cut short
+// to the OverflowSheet, below the rows already on it, under a Cell, File,
+// Line, Part and Text header. A value longer than one cell holds takes a
+// row for each part of it, numbered in Part, and the Cell of its first row
+// links to the cell the truncated value was written to.
+func (a *sheetAppender) writeOverflowSheet() error {
+	name := a.opts.OverflowSheet
+	next := 2
+	if i, _ := a.f.GetSheetIndex(name); i < 0 {
+		if _, err := a.f.NewSheet(name); err != nil {
+			return err
+		}
+		for col, width := range map[string]float64{"A": 16, "B": 24, "C": 8, "D": 6, "E": 100} {
+			if err := a.f.SetColWidth(name, col, col, width); err != nil {
+				return err
+			}
+		}
+		if err := a.f.SetSheetRow(name, "A1", &[]interface{}{"Cell", "File", "Line", "Part", "Text"}); err != nil {
+			return err
+		}
+		bold, err := a.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		if err != nil {
+			return err
+		}
+		if err := a.f.SetCellStyle(name, "A1", "E1", bold); err != nil {
+			return err
+		}
+	} else {
+		rows, err := a.f.GetRows(name)
+		if err != nil {
+			return err
+		}
+		next = max(len(rows)+1, 2)
+	}
+
+	for i, v := range a.overflow {
+		first := next
+		for part, text := range overflowParts(v.value) {
+			if next > excelize.TotalRows {
+				return errors.New("the sheet is full")
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, next)
+			row := []interface{}{v.ref, v.file, v.line, part + 1, text}
+			if err := a.f.SetSheetRow(name, cell, &row); err != nil {
+				return err
+			}
+			next++
+		}
+		if i < maxHyperlinks {
+			cell, _ := excelize.CoordinatesToCellName(1, first)
+			if err := a.f.SetCellHyperLink(name, cell, v.ref, "Location"); err != nil {
+				return fmt.Errorf("failed to link %s: %v", v.ref, err)
+			}
+		}
+	}
+	a.opts.Verbosef("Wrote the full text of %d truncated values to sheet %s\n", len(a.overflow), name)
+	return nil
+}
@@ -0,0 +1,69 @@
+package xlappend
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestAppendOverwriteFitsTable(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		opts      Options
+		input     string
+		want      [][]string
+		wantRange string
+	}{
+		{"overwrite", Options{Overwrite: true}, "Name,Size,Tag\na.exe,1,y\n",
+			[][]string{{"Name", "Size", "Tag"}, {"a.exe", "1", "y"}}, "A1:C2"},
+		{"overwrite from row 1", Options{Overwrite: true, StartRow: 1}, "Name,Size,Tag\na.exe,1,y\n",
+			[][]string{{"Name", "Size", "Tag"}, {"a.exe", "1", "y"}}, "A1:C2"},
+		{"replace", Options{Replace: true}, "Name,Size,Tag\na.exe,1,y\n",
+			[][]string{{"Name", "Size", "Tag"}, {"a.exe", "1", "y"}}, "A1:C2"},
+		// A table keeps one data row, blank, when nothing is written
+		{"overwrite with no rows", Options{Overwrite: true}, "Name,Size,Tag\n",
+			[][]string{{"Name", "Size", "Tag"}}, "A1:C2"},
+		{"overwrite with more rows", Options{Overwrite: true}, "Name,Size,Tag\na,1,y\nb,2,y\nc,3,y\nd,4,y\ne,5,y\n",
+			[][]string{{"Name", "Size", "Tag"}, {"a", "1", "y"}, {"b", "2", "y"}, {"c", "3", "y"}, {"d", "4", "y"}, {"e", "5", "y"}}, "A1:C6"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			template := newTemplate(t, dir, "T",
+				[]string{"Name", "Size", "Tag"},
+				[]string{"b.exe", "2", "x"},
+				[]string{"c.exe", "3", "x"},
+				[]string{"d.exe", "10", "y"},
+				[]string{"e.exe", "4", "y"})
+			addTable(t, template, "T", "A1:C5")
+			opts := tc.opts
+			opts.InputPaths = []string{writeInput(t, dir, "in.csv", tc.input)}
+			opts.TemplatePath, opts.SheetName, opts.OutputPath = template, "T", filepath.Join(dir, "out.xlsx")
+			if opts.StartRow == 0 {
+				opts.StartRow = 2
+			}
+			var im Importer
+			if _, err := im.Append(context.Background(), opts); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			output := opts.OutputPath
+			if rows := sheetRows(t, output, "T"); !reflect.DeepEqual(rows, tc.want) {
+				t.Errorf("sheet rows = %q, want %q", rows, tc.want)
+			}
+			f, err := excelize.OpenFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			tables, err := f.GetTables("T")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tables) != 1 || tables[0].Range != tc.wantRange {
+				t.Errorf("tables = %+v, want one over %s", tables, tc.wantRange)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package xlappend
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// frozenPanes returns the panes that keep the top rows of a sheet in view
+// as the rows below them scroll.
+func frozenPanes(rows int) *excelize.Panes {
+	topLeft, _ := excelize.CoordinatesToCellName(1, rows+1)
+	return &excelize.Panes{Freeze: true, YSplit: rows, TopLeftCell: topLeft, ActivePane: "bottomLeft"}
+}
+
+// filterDatabaseName is the sheet-scoped defined name Excel keeps the range
+// of a sheet's AutoFilter in.
+const filterDatabaseName = "_xlnm._FilterDatabase"
+
+// setAutoFilter sets the AutoFilter of sheet over ref, an absolute range
+// such as $A$1:$E$40. excelize 2.8.1 records the range under
+// _xlnm.Criteria, the name of an advanced filter's criteria, so that name
+// is moved to filterDatabaseName, replacing the one of any earlier filter.
+func setAutoFilter(f *excelize.File, sheet, ref string) error {
+	if err := f.AutoFilter(sheet, ref, nil); err != nil {
+		return err
+	}
+	filterRange := fmt.Sprintf("'%s'!%s", sheet, ref)
+	for _, dn := range f.GetDefinedName() {
+		if dn.Scope != sheet || !(dn.Name == "_xlnm.Criteria" && dn.RefersTo == filterRange || dn.Name == filterDatabaseName) {
+			continue
+		}
+		if err := f.DeleteDefinedName(&excelize.DefinedName{Name: dn.Name, Scope: sheet}); err != nil {
+			return err
+		}
+	}
+	return f.SetDefinedName(&excelize.DefinedName{Name: filterDatabaseName, RefersTo: filterRange, Scope: sheet})
+}
+
+// streamPanes returns the panes a stream starts with, since a StreamWriter
+// takes them before its first row: those of FreezeRows, or nil to start
+// without.
+func (a *sheetAppender) streamPanes() *excelize.Panes {
+	if a.opts.FreezeRows == 0 {
+		return nil
+	}
+	return frozenPanes(a.opts.FreezeRows)
+}
+
+// setView applies FreezeRows and AutoFilter to the sheets written, the
+// first of which holds its data down to lastRow; streamed sheets were
+// frozen as their streams started, see streamPanes. The filter covers each
+// sheet's header row and the rows below it, from the first written column
+// to the last; a sheet without a header row, or whose data is in a table,
+// which has a filter of its own, is left unfiltered.
+func (a *sheetAppender) setView(lastRow int) error {
+	for i, part := range a.result.Sheets {
+		if a.opts.FreezeRows > 0 && a.stream == nil {
+			if err := a.f.SetPanes(part.Name, frozenPanes(a.opts.FreezeRows)); err != nil {
+				return fmt.Errorf("failed to freeze the top rows of sheet %s: %v", part.Name, err)
+			}
+		}
+		if !a.opts.AutoFilter {
+			continue
+		}
+		headerRow, last := a.headerRow, lastRow
+		if i > 0 {
+			headerRow = 0
+			if a.header != nil {
+				headerRow = 1
+			}
+			last = headerRow + part.Rows
+		}
+		switch {
+		case headerRow == 0:
+			a.opts.Logf("Sheet %s has no header row to filter on; no AutoFilter was set\n", part.Name)
+			continue
+		case i == 0 && headerTable(a.tables, headerRow, a.colOffset+1) != nil:
+			a.opts.Logf("Sheet %s keeps its data in a table, which has a filter of its own; no AutoFilter was set\n", part.Name)
+			continue
+		}
+		topLeft, _ := excelize.CoordinatesToCellName(a.colOffset+1, headerRow, true)
+		bottomRight, _ := excelize.CoordinatesToCellName(max(a.lastCol, a.colOffset+1), max(last, headerRow+1), true)
+		if err := setAutoFilter(a.f, part.Name, topLeft+":"+bottomRight); err != nil {
+			return fmt.Errorf("failed to set an AutoFilter on sheet %s: %v", part.Name, err)
+		}
+		a.opts.Verbosef("AutoFilter set on %s!%s:%s\n", part.Name, topLeft, bottomRight)
+	}
+	return nil
+}
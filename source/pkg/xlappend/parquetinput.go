@@ -0,0 +1,297 @@
+package xlappend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic = "PAR1"
+
+// julianUnixEpoch is the Julian day number of 1970-01-01, which INT96
+// timestamps count their days from.
+const julianUnixEpoch = 2440588
+
+// parquetReader reads the rows of a Parquet file as records. The first
+// record is a header of the leaf column paths, nested fields joined by dots
+// like flattened JSON keys, and each row follows as a record of its values,
+// see parquetColumn.text. Rows are numbered like lines, the header being
+// line 1. Rows are read a page at a time, so files of any size can be read.
+type parquetReader struct {
+	reader  *parquet.Reader
+	columns []parquetColumn
+	rows    []parquet.Row
+	line    int
+}
+
+// parquetColumn is a leaf column of a Parquet schema.
+type parquetColumn struct {
+	name     string
+	kind     parquet.Kind
+	logical  *format.LogicalType
+	repeated bool
+}
+
+// newParquetReader opens the Parquet file file. A malformed schema makes
+// the parquet package panic rather than return an error, so that is
+// recovered from.
+func newParquetReader(file *os.File) (r *parquetReader, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r, err = nil, fmt.Errorf("malformed Parquet file: %v", p)
+		}
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pf, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	schema := pf.Schema()
+	r = &parquetReader{reader: parquet.NewReader(pf), rows: make([]parquet.Row, 1)}
+	for _, path := range schema.Columns() {
+		leaf, _ := schema.Lookup(path...)
+		// A list's values sit under the list.element group the format
+		// requires, which adds nothing to the column name
+		name := strings.Join(path, ".")
+		if leaf.MaxRepetitionLevel > 0 {
+			name = strings.TrimSuffix(strings.TrimSuffix(name, ".list.element"), ".list.item")
+		}
+		r.columns = append(r.columns, parquetColumn{
+			name:     name,
+			kind:     leaf.Node.Type().Kind(),
+			logical:  leaf.Node.Type().LogicalType(),
+			repeated: leaf.MaxRepetitionLevel > 0,
+		})
+	}
+	return r, nil
+}
+
+// Read returns the column names, then the values of each row with trailing
+// empty values dropped, like jsonReader. The values of a repeated column
+// are written as a JSON array.
+func (r *parquetReader) Read() ([]string, error) {
+	r.line++
+	if r.line == 1 {
+		header := make([]string, len(r.columns))
+		for i, column := range r.columns {
+			header[i] = column.name
+		}
+		return header, nil
+	}
+	n, err := r.reader.ReadRows(r.rows)
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	values := make([][]string, len(r.columns))
+	for _, value := range r.rows[0] {
+		if value.IsNull() {
+			continue
+		}
+		i := value.Column()
+		values[i] = append(values[i], r.columns[i].text(value))
+	}
+	record := make([]string, len(r.columns))
+	end := 0
+	for i, column := range r.columns {
+		switch {
+		case column.repeated && values[i] != nil:
+			record[i] = column.list(values[i])
+		case values[i] != nil:
+			record[i] = values[i][0]
+		}
+		if record[i] != "" {
+			end = i + 1
+		}
+	}
+	return record[:end], nil
+}
+
+// text returns the cell text of a value of the column: numbers in Go's
+// shortest form, decimals scaled, dates as yyyy-mm-dd, timestamps, INT96
+// ones included, as yyyy-mm-dd hh:mm:ss with any fraction and times of day
+// as hh:mm:ss, strings as they are and other byte arrays that are not UTF-8
+// text as hex. Timestamps are written as stored, whether UTC or local.
+func (c parquetColumn) text(value parquet.Value) string {
+	lt := c.logical
+	switch {
+	case lt != nil && lt.Decimal != nil:
+		return decimalText(c.unscaled(value), int(lt.Decimal.Scale))
+	case lt != nil && lt.Date != nil:
+		return time.Unix(int64(value.Int32())*86400, 0).UTC().Format("2006-01-02")
+	case lt != nil && lt.Timestamp != nil:
+		return unitTime(value.Int64(), lt.Timestamp.Unit).Format("2006-01-02 15:04:05.999999999")
+	case lt != nil && lt.Time != nil:
+		ticks := value.Int64()
+		if c.kind == parquet.Int32 {
+			ticks = int64(value.Int32())
+		}
+		return unitTime(ticks, lt.Time.Unit).Format("15:04:05.999999999")
+	case lt != nil && lt.Integer != nil && !lt.Integer.IsSigned && c.kind == parquet.Int64:
+		return strconv.FormatUint(uint64(value.Int64()), 10)
+	case lt != nil && lt.Integer != nil && !lt.Integer.IsSigned:
+		return strconv.FormatUint(uint64(uint32(value.Int32())), 10)
+	case lt != nil && lt.UUID != nil:
+		b := value.ByteArray()
+		if len(b) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+		}
+	}
+	switch c.kind {
+	case parquet.Boolean:
+		return strconv.FormatBool(value.Boolean())
+	case parquet.Int32:
+		return strconv.FormatInt(int64(value.Int32()), 10)
+	case parquet.Int64:
+		return strconv.FormatInt(value.Int64(), 10)
+	case parquet.Int96:
+		i := value.Int96()
+		nanos := int64(i[1])<<32 | int64(i[0])
+		return time.Unix((int64(i[2])-julianUnixEpoch)*86400, nanos).UTC().Format("2006-01-02 15:04:05.999999999")
+	case parquet.Float:
+		return strconv.FormatFloat(float64(value.Float()), 'g', -1, 32)
+	case parquet.Double:
+		return strconv.FormatFloat(value.Double(), 'g', -1, 64)
+	}
+	b := value.ByteArray()
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// unscaled returns the unscaled value of a decimal, stored as an integer
+// or as big-endian two's complement bytes.
+func (c parquetColumn) unscaled(value parquet.Value) *big.Int {
+	switch c.kind {
+	case parquet.Int32:
+		return big.NewInt(int64(value.Int32()))
+	case parquet.Int64:
+		return big.NewInt(value.Int64())
+	}
+	b := value.ByteArray()
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return n
+}
+
+// list returns the values of a repeated column as a JSON array, with
+// numbers and booleans unquoted unless, like NaN, JSON has no such value.
+func (c parquetColumn) list(values []string) string {
+	kind := c.columnType().kind
+	bare := kind == "int" || kind == "number" || kind == "bool"
+	items := make([]json.RawMessage, len(values))
+	for i, value := range values {
+		if bare && json.Valid([]byte(value)) {
+			items[i] = json.RawMessage(value)
+		} else {
+			items[i], _ = json.Marshal(value)
+		}
+	}
+	text, _ := json.Marshal(items)
+	return string(text)
+}
+
+// columnType returns the type cells of the column are written as: numbers,
+// booleans, dates and timestamps are native cells, and anything else, such
+// as strings, times of day and repeated columns, is left as it is.
+func (c parquetColumn) columnType() columnType {
+	lt := c.logical
+	switch {
+	case lt != nil && lt.Decimal != nil:
+		return columnType{kind: "number"}
+	case lt != nil && lt.Date != nil:
+		return columnType{kind: "date", layout: "2006-01-02"}
+	case lt != nil && lt.Timestamp != nil:
+		return columnType{kind: "timestamp", utc: lt.Timestamp.IsAdjustedToUTC}
+	case lt != nil && (lt.Time != nil || lt.UUID != nil):
+		return columnType{}
+	}
+	switch c.kind {
+	case parquet.Boolean:
+		return columnType{kind: "bool"}
+	case parquet.Int32, parquet.Int64:
+		return columnType{kind: "int"}
+	case parquet.Int96:
+		return columnType{kind: "timestamp"}
+	case parquet.Float, parquet.Double:
+		return columnType{kind: "number"}
+	}
+	return columnType{}
+}
+
+// inputTypes returns the type of each column, see columnType. A repeated
+// column holds a JSON array, so it has none.
+func (r *parquetReader) inputTypes() []columnType {
+	types := make([]columnType, len(r.columns))
+	for i, column := range r.columns {
+		if !column.repeated {
+			types[i] = column.columnType()
+		}
+	}
+	return types
+}
+
+// unitTime returns the UTC time ticks units after the Unix epoch.
+func unitTime(ticks int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(ticks).UTC()
+	case unit.Micros != nil:
+		return time.UnixMicro(ticks).UTC()
+	}
+	return time.Unix(0, ticks).UTC()
+}
+
+// decimalText returns unscaled divided by 10 to the power scale in decimal
+// notation, exactly.
+func decimalText(unscaled *big.Int, scale int) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits + strings.Repeat("0", -scale)
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// FieldPos returns the row number of the last record read.
+func (r *parquetReader) FieldPos(field int) (line, column int) {
+	return r.line, 1
+}
+
+// rawLines returns nil: a row has no input text.
+func (r *parquetReader) rawLines(first, last int) []string {
+	return nil
+}
+
+// forget does nothing, since rows are not kept.
+func (r *parquetReader) forget(before int) {}
+
+// Close releases the reader's buffers.
+func (r *parquetReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,246 @@
+package xlappend
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// readAheadBatch is how many records the reading goroutine hands over at a
+// time, and readAheadBatches how many batches it may get ahead by, see
+// readAhead.
+const (
+	readAheadBatch   = 256
+	readAheadBatches = 8
+)
+
+// convertBlockRows is how many rows a converting goroutine takes at a time;
+// a flush of no more rows than this is converted as it is written, see
+// convertRows.
+const convertBlockRows = 1024
+
+// workers returns how many goroutines convert rows, see Workers.
+func (a *sheetAppender) workers() int {
+	if a.opts.Workers > 0 {
+		return a.opts.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// parsedRecord is one result of reader.Read, with the input line the record
+// starts on.
+type parsedRecord struct {
+	record []string
+	err    error
+	line   int
+}
+
+// readRecord reads the next record of reader.
+func (a *sheetAppender) readRecord(reader recordReader) parsedRecord {
+	record, err := reader.Read()
+	if a.opts.Quoting == "none" {
+		restoreQuotes(record)
+	}
+	if a.opts.Separator != "" {
+		restoreSeparators(record, a.opts.Separator)
+	}
+	return parsedRecord{record, err, recordLine(reader, record, err)}
+}
+
+// readAhead returns the records of the current input file in order, parsed
+// by a goroutine of their own while the ones before are appended, until
+// stop is called. The goroutine stops at the end of the input or at a read
+// that fails other than to parse, as readRecords does. With one worker the
+// records are read as they are asked for instead.
+func (a *sheetAppender) readAhead() (next func() parsedRecord, stop func()) {
+	reader := a.reader
+	if a.workers() == 1 {
+		return func() parsedRecord { return a.readRecord(reader) }, func() {}
+	}
+	batches := make(chan []parsedRecord, readAheadBatches)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(batches)
+		for last := false; !last; {
+			batch := make([]parsedRecord, 0, readAheadBatch)
+			for len(batch) < readAheadBatch && !last {
+				pr := a.readRecord(reader)
+				batch = append(batch, pr)
+				var parseErr *csv.ParseError
+				last = pr.err != nil && !errors.As(pr.err, &parseErr)
+			}
+			select {
+			case batches <- batch:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var batch []parsedRecord
+	next = func() parsedRecord {
+		for len(batch) == 0 {
+			var ok bool
+			if batch, ok = <-batches; !ok {
+				return parsedRecord{err: io.EOF}
+			}
+		}
+		pr := batch[0]
+		batch = batch[1:]
+		return pr
+	}
+	stop = func() {
+		close(quit)
+		// The input is closed, or read on by finishDigest, once the
+		// goroutine is done with it, but a cancelled run is not kept
+		// waiting on a read that may never end, such as one of stdin
+		if a.ctx.Err() == nil {
+			<-done
+		}
+	}
+	return next, stop
+}
+
+// convertedCell is a value of a buffered row converted to what its cell is
+// written as, see convertRow.
+type convertedCell struct {
+	typed     interface{}
+	code      string // number format of the cell, empty for its style's own
+	err       error  // why the value did not fit its column's type; it is written as it is
+	width     int    // textWidth of the value, for AutoFit
+	highlight bool   // the value holds a -highlight keyword
+	iocs      []foundIOC
+}
+
+// foundIOC is an indicator extractIOCs found in a value.
+type foundIOC struct {
+	indicator, kind string
+}
+
+// convertRow converts each value of a buffered row, from the input file
+// whose column types are fileTypes, to the cell it is written as. It only
+// reads the appender's settings, so that several goroutines convert rows at
+// once; what it finds is logged and counted as the row is written.
+func (a *sheetAppender) convertRow(row []string, fileTypes map[int]columnType) []convertedCell {
+	cells := make([]convertedCell, len(row))
+	for j, value := range row {
+		c := &cells[j]
+		c.typed = value
+		if a.contentWidths != nil {
+			c.width = textWidth(value)
+		}
+		if ct, ok := a.columnTypes[j+1]; ok {
+			if c.typed, c.code, c.err = ct.cellValue(value, a.displayFmt, a.zones); c.err != nil {
+				c.typed, c.code = value, ""
+			}
+			// The template's style keeps its own number format
+			if ct.validated {
+				c.code = ""
+			}
+		} else if ct, ok := fileTypes[j+1]; ok {
+			// A value the input's type does not fit, such as the header,
+			// is written as it is
+			var err error
+			if value == "" {
+				c.typed = nil
+			} else if c.typed, c.code, err = ct.cellValue(value, a.displayFmt, a.zones); err != nil {
+				c.typed, c.code = value, ""
+			}
+		} else if a.opts.Locale != "" || a.opts.Infer {
+			// Leave empty fields as empty cells rather than empty strings
+			if value == "" {
+				c.typed = nil
+			} else {
+				c.typed, c.code = a.displayFmt.cellValue(value)
+			}
+		}
+		if c.code == "" && !a.columnTypes[j+1].validated {
+			c.code = a.opts.NumberFormat
+		}
+		c.highlight = a.highlight != nil && a.highlight.MatchString(value)
+		if a.iocs != nil && value != "" {
+			extractIOCs(value, func(indicator, kind string) {
+				c.iocs = append(c.iocs, foundIOC{indicator, kind})
+			})
+		}
+	}
+	return cells
+}
+
+// convertRows returns the buffered rows converted by convertRow, in order,
+// until stop is called. The rows are converted a block at a time by the
+// workers, each block while the ones before it are written, and at most two
+// blocks a worker ahead of the writing. A flush of a single block, or with
+// one worker, is converted a row at a time as it is written.
+func (a *sheetAppender) convertRows() (next func() []convertedCell, stop func()) {
+	rows, files := a.csvData, a.rowFiles
+	workers := a.workers()
+	if workers == 1 || len(rows) <= convertBlockRows {
+		i := 0
+		next = func() []convertedCell {
+			cells := a.convertRow(rows[i], a.fileTypes[files[i]])
+			i++
+			return cells
+		}
+		return next, func() {}
+	}
+
+	type block struct {
+		start int
+		out   chan [][]convertedCell
+	}
+	blocks := make(chan block)
+	order := make(chan chan [][]convertedCell, 2*workers)
+	quit := make(chan struct{})
+	go func() {
+		defer close(blocks)
+		defer close(order)
+		for start := 0; start < len(rows); start += convertBlockRows {
+			b := block{start, make(chan [][]convertedCell, 1)}
+			select {
+			case order <- b.out:
+			case <-quit:
+				return
+			}
+			select {
+			case blocks <- b:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range blocks {
+				end := min(b.start+convertBlockRows, len(rows))
+				converted := make([][]convertedCell, 0, end-b.start)
+				for i := b.start; i < end; i++ {
+					converted = append(converted, a.convertRow(rows[i], a.fileTypes[files[i]]))
+				}
+				b.out <- converted
+			}
+		}()
+	}
+
+	var current [][]convertedCell
+	next = func() []convertedCell {
+		if len(current) == 0 {
+			current = <-<-order
+		}
+		cells := current[0]
+		current = current[1:]
+		return cells
+	}
+	stop = func() {
+		close(quit)
+		wg.Wait()
+	}
+	return next, stop
+}
@@ -0,0 +1,78 @@
+package xlappend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// printAreaName is the defined name Excel uses for a sheet's print area.
+const printAreaName = "_xlnm.Print_Area"
+
+// fitPrintArea compares the data extent of sheet, given as its last column
+// and row, with the sheet-scoped _xlnm.Print_Area defined name and reports a
+// warning through logf when data falls outside it. With extend set, the
+// bottom-right corner of the print area is moved out to cover the data
+// instead.
+func fitPrintArea(f *excelize.File, sheet string, lastCol, lastRow int, extend bool, logf func(string, ...interface{})) error {
+	var area *excelize.DefinedName
+	for _, dn := range f.GetDefinedName() {
+		if dn.Name == printAreaName && dn.Scope == sheet {
+			area = &dn
+			break
+		}
+	}
+	if area == nil {
+		logf("Sheet %s has no print area defined; the whole sheet will print\n", sheet)
+		return nil
+	}
+	if strings.Contains(area.RefersTo, ",") {
+		logf("Warning: print area %s has several ranges and was not checked\n", area.RefersTo)
+		return nil
+	}
+
+	// A print area looks like 'Sheet name'!$A$1:$H$40
+	bang := strings.LastIndex(area.RefersTo, "!")
+	prefix, ref := area.RefersTo[:bang+1], area.RefersTo[bang+1:]
+	corners := strings.Split(strings.ReplaceAll(ref, "$", ""), ":")
+	if len(corners) != 2 {
+		return fmt.Errorf("unrecognised print area %s", area.RefersTo)
+	}
+	col1, row1, err := excelize.CellNameToCoordinates(corners[0])
+	if err != nil {
+		return err
+	}
+	col2, row2, err := excelize.CellNameToCoordinates(corners[1])
+	if err != nil {
+		return err
+	}
+	if lastCol <= col2 && lastRow <= row2 {
+		return nil
+	}
+	if !extend {
+		logf("Warning: data extends to row %d, column %d, beyond print area %s\n", lastRow, lastCol, area.RefersTo)
+		return nil
+	}
+
+	if lastCol > col2 {
+		col2 = lastCol
+	}
+	if lastRow > row2 {
+		row2 = lastRow
+	}
+	topLeft, _ := excelize.CoordinatesToCellName(col1, row1, true)
+	bottomRight, err := excelize.CoordinatesToCellName(col2, row2, true)
+	if err != nil {
+		return err
+	}
+	extended := excelize.DefinedName{Name: printAreaName, Scope: sheet, RefersTo: prefix + topLeft + ":" + bottomRight}
+	if err := f.DeleteDefinedName(area); err != nil {
+		return err
+	}
+	if err := f.SetDefinedName(&extended); err != nil {
+		return err
+	}
+	logf("Print area extended from %s to %s\n", area.RefersTo, extended.RefersTo)
+	return nil
+}
@@ -0,0 +1,129 @@
+package xlappend
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often Options.Progress is called while the input
+// is read.
+const progressInterval = time.Second
+
+// progressCheckRecords is how many records are read between looks at the
+// clock, which would otherwise cost more than reading a short line.
+const progressCheckRecords = 256
+
+// Progress is how far an import has got, as given to Options.Progress.
+type Progress struct {
+	File        string        // input file being read
+	LinesRead   int           // input lines read, from every file so far
+	RowsWritten int           // rows appended to the sheet so far
+	BytesRead   int64         // bytes read from the input files
+	BytesTotal  int64         // size of the input files, 0 when one of them, such as stdin, has no known size
+	Elapsed     time.Duration // time since the first file was opened
+	Done        bool          // every input has been read; the workbook is saved next
+}
+
+// Rate returns the input lines read per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.LinesRead) / p.Elapsed.Seconds()
+}
+
+// Remaining estimates the time left to read the rest of the input from the
+// share of BytesTotal read so far, or returns false without a size.
+func (p Progress) Remaining() (time.Duration, bool) {
+	if p.BytesTotal <= 0 || p.BytesRead <= 0 || p.BytesRead > p.BytesTotal {
+		return 0, false
+	}
+	share := float64(p.BytesRead) / float64(p.BytesTotal)
+	return time.Duration(float64(p.Elapsed) * (1 - share) / share), true
+}
+
+// progressMeter tracks the Progress of one import.
+type progressMeter struct {
+	report    func(Progress)
+	start     time.Time
+	last      time.Time
+	records   int
+	bytesRead atomic.Int64 // Progress.BytesRead, counted on the goroutine reading ahead
+	state     Progress
+}
+
+// startProgress starts the meter for Options.Progress over the inputs.
+// Only plain files that are read through have a size, so databases and
+// Parquet files, which are not, leave BytesTotal 0; a compressed file
+// counts its compressed bytes.
+func (a *sheetAppender) startProgress() {
+	if a.opts.Progress == nil {
+		return
+	}
+	now := time.Now()
+	a.progress = &progressMeter{report: a.opts.Progress, start: now, last: now}
+	if a.opts.Format == "sqlite" || a.opts.Format == "parquet" {
+		return
+	}
+	for _, path := range a.inputs {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			a.progress.state.BytesTotal = 0
+			return
+		}
+		a.progress.state.BytesTotal += info.Size()
+	}
+}
+
+// countBytes returns r, counting the bytes read through it for Progress.
+func (a *sheetAppender) countBytes(r io.Reader) io.Reader {
+	if a.progress == nil {
+		return r
+	}
+	return &countingReader{r: r, n: &a.progress.bytesRead}
+}
+
+// tickProgress counts a record read from file and calls Options.Progress
+// once progressInterval has passed since the last call.
+func (a *sheetAppender) tickProgress(file string) {
+	if a.progress == nil {
+		return
+	}
+	p := a.progress
+	p.state.LinesRead++
+	if p.records++; p.records%progressCheckRecords != 0 {
+		return
+	}
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.state.File = file
+		a.reportProgress(false)
+	}
+}
+
+// reportProgress calls Options.Progress with the current Progress.
+func (a *sheetAppender) reportProgress(done bool) {
+	if a.progress == nil {
+		return
+	}
+	p := a.progress
+	p.state.RowsWritten = a.result.RowsAppended
+	p.state.BytesRead = p.bytesRead.Load()
+	p.state.Elapsed = time.Since(p.start)
+	p.state.Done = done
+	p.report(p.state)
+}
+
+// countingReader adds the number of bytes read through it to *n.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,152 @@
+package xlappend
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ImportLogSheet is the hidden sheet Provenance records each import on.
+const ImportLogSheet = "Import Log"
+
+// importLogHeader heads the columns of the ImportLogSheet, one row of which
+// describes each input file read.
+var importLogHeader = []interface{}{
+	"Imported (UTC)", "Source File", "SHA256", "MD5", "Bytes", "Lines Read", "Rows Appended", "Lines Failed",
+	"Sheet", "Operator", "Host", "Tool", "Command Line",
+}
+
+// inputDigest hashes the bytes of one input file as they are read, see
+// hashInput.
+type inputDigest struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+	size   int64
+	input  io.Reader // the file, read through the hashes
+}
+
+func (d *inputDigest) Read(p []byte) (int, error) {
+	n, err := d.input.Read(p)
+	d.sha256.Write(p[:n])
+	d.md5.Write(p[:n])
+	d.size += int64(n)
+	return n, err
+}
+
+// inputRecord is what the ImportLogSheet records of one input file.
+type inputRecord struct {
+	sha256, md5 string
+	size        int64
+	lines       int
+}
+
+// hashInput returns file, as it is before any decompression, hashing the
+// bytes read through it for Provenance and Manifest.
+func (a *sheetAppender) hashInput(file io.Reader) io.Reader {
+	if !a.opts.Provenance && !a.opts.Manifest {
+		return file
+	}
+	a.digest = &inputDigest{sha256: sha256.New(), md5: md5.New(), input: file}
+	return a.digest
+}
+
+// finishDigest reads what is left of the input file, past its last line
+// read or the part a database or Parquet reader took by itself, so that the
+// hashes cover the whole file, and records it with the lines read.
+func (a *sheetAppender) finishDigest() error {
+	if a.digest == nil {
+		return nil
+	}
+	d := a.digest
+	a.digest = nil
+	if _, err := io.Copy(io.Discard, d); err != nil {
+		return err
+	}
+	a.inputRecords = append(a.inputRecords, inputRecord{
+		sha256: hex.EncodeToString(d.sha256.Sum(nil)),
+		md5:    hex.EncodeToString(d.md5.Sum(nil)),
+		size:   d.size,
+		lines:  a.lineNumber,
+	})
+	return nil
+}
+
+// operator returns the name of the account running the import, from the
+// environment when the user database cannot say.
+func operator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// writeImportLog adds a row for each input file read to the ImportLogSheet,
+// creating the sheet, hidden, when the workbook does not have one yet, so
+// that the workbook carries the chain of custody of its rows from run to
+// run and job to job. Every row of a run shares its UTC time.
+func (a *sheetAppender) writeImportLog() error {
+	name := ImportLogSheet
+	next := 2
+	if i, _ := a.f.GetSheetIndex(name); i < 0 {
+		if _, err := a.f.NewSheet(name); err != nil {
+			return err
+		}
+		if err := a.f.SetSheetVisible(name, false); err != nil {
+			return err
+		}
+		if err := a.f.SetSheetRow(name, "A1", &importLogHeader); err != nil {
+			return err
+		}
+		bold, err := a.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		if err != nil {
+			return err
+		}
+		lastCell, _ := excelize.CoordinatesToCellName(len(importLogHeader), 1)
+		if err := a.f.SetCellStyle(name, "A1", lastCell, bold); err != nil {
+			return err
+		}
+		for col, width := range map[string]float64{"A": 21, "B": 40, "C": 66, "D": 34, "M": 80} {
+			if err := a.f.SetColWidth(name, col, col, width); err != nil {
+				return err
+			}
+		}
+	} else {
+		rows, err := a.f.GetRows(name)
+		if err != nil {
+			return err
+		}
+		next = max(len(rows)+1, 2)
+	}
+
+	host, _ := os.Hostname()
+	imported := time.Now().UTC().Format(time.RFC3339)
+	var sheets []string
+	for _, part := range a.result.Sheets {
+		sheets = append(sheets, part.Name)
+	}
+	sheet := strings.Join(sheets, ", ")
+	for i, record := range a.inputRecords {
+		file := a.result.Files[i]
+		cell, _ := excelize.CoordinatesToCellName(1, next+i)
+		row := []interface{}{
+			imported, file.Path, record.sha256, record.md5, record.size, record.lines, file.Rows, file.Failed,
+			sheet, operator(), host, a.opts.Tool, a.opts.CommandLine,
+		}
+		if err := a.f.SetSheetRow(name, cell, &row); err != nil {
+			return err
+		}
+	}
+	a.opts.Verbosef("Recorded %d input files on sheet %s\n", len(a.inputRecords), name)
+	return nil
+}
@@ -0,0 +1,113 @@
+package xlappend
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/text/transform"
+)
+
+// quoteStandIn takes the place of every quotation mark in the input with
+// -quote none, so that csv.Reader sees no quoting at all. U+FDD0 is a
+// noncharacter, which does not occur in interchanged text.
+const quoteStandIn = "\ufdd0"
+
+// quoteHider is a transform.Transformer replacing quotation marks with
+// quoteStandIn. It works on bytes, so invalid UTF-8 passes through as is.
+type quoteHider struct{ transform.NopResetter }
+
+func (quoteHider) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		if src[nSrc] != '"' {
+			if nDst == len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = src[nSrc]
+			nDst++
+			continue
+		}
+		if nDst+len(quoteStandIn) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], quoteStandIn)
+	}
+	return nDst, nSrc, nil
+}
+
+// hideQuotes returns r with its quotation marks replaced by quoteStandIn.
+func hideQuotes(r io.Reader) io.Reader {
+	return transform.NewReader(r, quoteHider{})
+}
+
+// restoreQuotes turns the stand-ins in record back into quotation marks.
+func restoreQuotes(record []string) {
+	for i, field := range record {
+		if strings.Contains(field, quoteStandIn) {
+			record[i] = strings.ReplaceAll(field, quoteStandIn, `"`)
+		}
+	}
+}
+
+// separatorStandIn takes the place of a Separator of several characters in
+// the input, so that csv.Reader splits the fields at a single rune. Like
+// quoteStandIn it is a noncharacter.
+const separatorStandIn = "\ufdd1"
+
+// separatorReplacer is a transform.Transformer replacing every occurrence
+// of sep with separatorStandIn.
+type separatorReplacer struct {
+	transform.NopResetter
+	sep []byte
+}
+
+func (s separatorReplacer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if src[nSrc] == s.sep[0] {
+			rest := src[nSrc:]
+			if bytes.HasPrefix(rest, s.sep) {
+				if nDst+len(separatorStandIn) > len(dst) {
+					return nDst, nSrc, transform.ErrShortDst
+				}
+				nDst += copy(dst[nDst:], separatorStandIn)
+				nSrc += len(s.sep)
+				continue
+			}
+			// The separator may go on in the next chunk of input
+			if !atEOF && len(rest) < len(s.sep) && bytes.HasPrefix(s.sep, rest) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+		}
+		if nDst == len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = src[nSrc]
+		nDst++
+		nSrc++
+	}
+	return nDst, nSrc, nil
+}
+
+// replaceSeparator returns r with every sep replaced by separatorStandIn.
+func replaceSeparator(r io.Reader, sep string) io.Reader {
+	return transform.NewReader(r, separatorReplacer{sep: []byte(sep)})
+}
+
+// restoreSeparators turns the stand-ins left in record, by separators
+// inside quoted fields, back into sep.
+func restoreSeparators(record []string, sep string) {
+	for i, field := range record {
+		if strings.Contains(field, separatorStandIn) {
+			record[i] = strings.ReplaceAll(field, separatorStandIn, sep)
+		}
+	}
+}
+
+// delimiter returns the delimiter the fields of the input are joined with
+// again for messages and the error log.
+func (a *sheetAppender) delimiter() string {
+	if a.opts.Separator != "" {
+		return a.opts.Separator
+	}
+	return string(a.delim)
+}
@@ -0,0 +1,36 @@
+package xlappend
+
+import (
+	"encoding/csv"
+	"errors"
+)
+
+// fitRecord pads a record with fewer fields than the first record of its
+// file with empty ones, for Ragged "pad" and "truncate", and reports
+// whether it did. A field count error Strict raised for the record is
+// cleared when it is padded, or with "truncate" when it is longer, since
+// writeRows then cuts it to the sheet's width instead of logging it.
+func (a *sheetAppender) fitRecord(record []string, err error) ([]string, bool, error) {
+	if a.opts.Ragged == "error" || record == nil {
+		return record, false, err
+	}
+	if a.records == 1 {
+		a.inputFields = len(record)
+	}
+	if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+		return record, false, err
+	}
+	switch {
+	case len(record) < a.inputFields:
+		return append(record, make([]string, a.inputFields-len(record))...), true, nil
+	case len(record) > a.inputFields && a.opts.Ragged == "truncate":
+		return record, false, nil
+	}
+	return record, false, err
+}
+
+// sheetFields returns the fields of row that fit the sheet's columns from
+// the start column on, for Ragged "truncate".
+func (a *sheetAppender) sheetFields(row []string) []string {
+	return row[:max(a.maxCols-a.colOffset, 0)]
+}
@@ -0,0 +1,84 @@
+package xlappend
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// maxLoggedLines is how many input lines of a record that failed to parse
+// are copied to the error log.
+const maxLoggedLines = 10
+
+// rawLineSource gives the input text of lines that failed to parse, so the
+// error log can show them as they are in the file.
+type rawLineSource interface {
+	// rawLines returns the text of input lines first to last, without line
+	// endings, or nil when they are no longer held.
+	rawLines(first, last int) []string
+	// forget releases the lines before line before.
+	forget(before int)
+}
+
+// lineRecorder passes input through while keeping the lines read since the
+// last call to forget, numbered from 1 like csv.Reader numbers them. The
+// input is read on the goroutine reading ahead, see readAhead, while the
+// lines are asked for on the one appending the records.
+type lineRecorder struct {
+	r     io.Reader
+	mu    sync.Mutex
+	first int      // number of lines[0]
+	lines []string // complete lines, without their line endings
+	part  []byte   // start of a line whose end has not been read yet
+}
+
+func newLineRecorder(r io.Reader) *lineRecorder {
+	return &lineRecorder{r: r, first: 1}
+}
+
+func (l *lineRecorder) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	data := p[:n]
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			l.part = append(l.part, data...)
+			break
+		}
+		line := string(append(l.part, data[:end]...))
+		l.lines = append(l.lines, strings.TrimSuffix(line, "\r"))
+		l.part = l.part[:0]
+		data = data[end+1:]
+	}
+	return n, err
+}
+
+// rawLines includes the final line of input without a line ending.
+func (l *lineRecorder) rawLines(first, last int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := l.lines
+	if len(l.part) > 0 {
+		lines = append(lines[:len(lines):len(lines)], strings.TrimSuffix(string(l.part), "\r"))
+	}
+	if first < l.first || first > last || last-l.first >= len(lines) {
+		return nil
+	}
+	return append([]string(nil), lines[first-l.first:last-l.first+1]...)
+}
+
+func (l *lineRecorder) forget(before int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	drop := before - l.first
+	if drop > len(l.lines) {
+		drop = len(l.lines)
+	}
+	if drop > 0 {
+		l.lines = append(l.lines[:0], l.lines[drop:]...)
+		l.first += drop
+	}
+}
@@ -0,0 +1,243 @@
+package xlappend
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IsRemotePath reports whether an input path is an http://, https:// or
+// s3:// URL, which is streamed from where it is stored rather than opened
+// as a file, see openRemote. UNC paths such as \\server\share\file.csv are
+// files to the operating system and not remote paths here.
+func IsRemotePath(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "s3://")
+}
+
+// remoteName returns a remote path without its query string, which may
+// hold the signature of a presigned URL, for messages, the error log and
+// the names derived from it.
+func remoteName(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// remoteClient fetches remote inputs. It has no overall timeout, which
+// would cut off a large file part way through; ctx stops it instead.
+var remoteClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	TLSHandshakeTimeout:   30 * time.Second,
+	ResponseHeaderTimeout: time.Minute,
+}}
+
+// openRemote starts a GET of the remote path and returns its body, to be
+// read as it arrives. An s3:// URL is fetched from the S3 endpoint of its
+// bucket, signed with the credentials s3Credentials finds, or unsigned,
+// for a public bucket, when there are none.
+func openRemote(ctx context.Context, path string) (io.ReadCloser, error) {
+	name := remoteName(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if strings.HasPrefix(strings.ToLower(path), "s3://") {
+		req, err = newS3Request(ctx, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %v", name, err)
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		// The error would repeat the URL, signature and all
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// s3Credentials are the keys requests to S3 are signed with.
+type s3Credentials struct {
+	accessKey, secretKey, sessionToken string
+}
+
+// findS3Credentials looks for S3 credentials as the AWS tools do, in the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables and then in the AWS_PROFILE profile, or default,
+// of the shared credentials file. It returns nil when there are none.
+// Instance roles and SSO sessions are not looked up.
+func findS3Credentials() (*s3Credentials, error) {
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		return &s3Credentials{key, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	profile := awsProfile()
+	values, err := readAWSFile(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), "credentials", profile)
+	if err != nil || values["aws_access_key_id"] == "" {
+		return nil, err
+	}
+	return &s3Credentials{values["aws_access_key_id"], values["aws_secret_access_key"], values["aws_session_token"]}, nil
+}
+
+// awsProfile returns the profile of the shared AWS files in use.
+func awsProfile() string {
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// s3Region returns the region of the S3 requests: AWS_REGION or
+// AWS_DEFAULT_REGION, or that of the profile in the shared config file,
+// us-east-1 when none is set.
+func s3Region() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	section := "profile " + awsProfile()
+	if awsProfile() == "default" {
+		section = "default"
+	}
+	if values, err := readAWSFile(os.Getenv("AWS_CONFIG_FILE"), "config", section); err == nil && values["region"] != "" {
+		return values["region"]
+	}
+	return "us-east-1"
+}
+
+// readAWSFile returns the keys of one section of a shared AWS file, path
+// or ~/.aws/name when path is empty. A missing file has no keys.
+func readAWSFile(path, name, section string) (map[string]string, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".aws", name)
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	values := make(map[string]string)
+	inSection := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			inSection = strings.TrimSpace(strings.Trim(line, "[]")) == section
+		case inSection:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values, scanner.Err()
+}
+
+// newS3Request returns the GET of the object an s3://bucket/key URL names,
+// from AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, as for MinIO, with the
+// bucket in the path, or else from the bucket's virtual host on AWS.
+func newS3Request(ctx context.Context, path string) (*http.Request, error) {
+	bucket, key, _ := strings.Cut(path[len("s3://"):], "/")
+	if bucket == "" || key == "" {
+		return nil, errors.New("an S3 URL is s3://bucket/key")
+	}
+	region := s3Region()
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	target := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, s3EscapePath(key))
+	if endpoint != "" {
+		target = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + s3EscapePath(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := findS3Credentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS credentials: %v", err)
+	}
+	if creds != nil {
+		signS3Request(req, creds, region, time.Now().UTC())
+	}
+	return req, nil
+}
+
+// s3EscapePath escapes an object key for a URL path as S3 signatures
+// expect: every byte but unreserved characters and the slashes.
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signS3Request signs a GET, which has no body, with AWS Signature Version
+// 4 for the S3 service of region, along with its Range header if it has one.
+func signS3Request(req *http.Request, creds *s3Credentials, region string, now time.Time) {
+	// The SHA256 of the empty body
+	const payload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	stamp, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	signed, headers := "host", "host:"+req.URL.Host+"\n"
+	if r := req.Header.Get("Range"); r != "" {
+		signed += ";range"
+		headers += "range:" + strings.TrimSpace(r) + "\n"
+	}
+	signed += ";x-amz-content-sha256;x-amz-date"
+	headers += fmt.Sprintf("x-amz-content-sha256:%s\nx-amz-date:%s\n", payload, stamp)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+		signed += ";x-amz-security-token"
+		headers += "x-amz-security-token:" + creds.sessionToken + "\n"
+	}
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, headers, signed, payload}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := []byte("AWS4" + creds.secretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.accessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
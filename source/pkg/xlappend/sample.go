@@ -0,0 +1,50 @@
+package xlappend
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// sampleRow buffers record, read on line, for the Sample, by reservoir
+// sampling: the first Sample selected lines are buffered, and each later
+// one replaces a buffered row, picked at random, with probability Sample
+// in the number of lines selected so far. Every selected line of the run is
+// then as likely to be in the sample, however long the input, while only
+// Sample rows are held.
+func (a *sheetAppender) sampleRow(record []string, line int) {
+	i := len(a.csvData)
+	if i >= a.opts.Sample {
+		if i = rand.Intn(a.taken); i >= a.opts.Sample {
+			return
+		}
+		a.bufferedBytes -= recordBytes(a.csvData[i])
+		a.csvData[i], a.rowFiles[i], a.rowLines[i], a.sampleOrder[i] = record, len(a.result.Files)-1, line, a.taken
+	} else {
+		a.csvData = append(a.csvData, record)
+		a.rowFiles = append(a.rowFiles, len(a.result.Files)-1)
+		a.rowLines = append(a.rowLines, line)
+		a.sampleOrder = append(a.sampleOrder, a.taken)
+	}
+	a.bufferedBytes += recordBytes(record)
+}
+
+// orderSample puts the rows sampleRow kept back in the order they were
+// read.
+func (a *sheetAppender) orderSample() {
+	a.result.SampledFrom = a.taken
+	order := make([]int, len(a.csvData))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(x, y int) bool {
+		return a.sampleOrder[order[x]] < a.sampleOrder[order[y]]
+	})
+	rows := make([][]string, len(order))
+	files := make([]int, len(order))
+	lines := make([]int, len(order))
+	for i, j := range order {
+		rows[i], files[i], lines[i] = a.csvData[j], a.rowFiles[j], a.rowLines[j]
+	}
+	a.csvData, a.rowFiles, a.rowLines, a.sampleOrder = rows, files, lines, nil
+	a.opts.Verbosef("Sampled %d rows of the %d lines selected\n", len(rows), a.taken)
+}
@@ -0,0 +1,135 @@
+package xlappend
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// timeToken in a sheet copy name stands for the time of the run.
+const timeToken = "{time}"
+
+// sheetNameReplacer replaces the characters Excel does not allow in a sheet
+// name with underscores.
+var sheetNameReplacer = strings.NewReplacer("[", "_", "]", "_", ":", "_", "*", "_", "?", "_", "/", "_", "\\", "_")
+
+// sheetCopyName returns the name of the sheet copy for the run started at
+// now, replacing timeToken in name, and InputToken with the name of the
+// input file input, see inputStem, without the characters a sheet name
+// cannot hold.
+func sheetCopyName(name, input string, now time.Time) string {
+	name = strings.ReplaceAll(name, timeToken, now.Format("20060102-150405"))
+	if strings.Contains(name, InputToken) {
+		stem, err := inputStem(input)
+		if err != nil {
+			stem = "input"
+		}
+		name = strings.ReplaceAll(name, InputToken, strings.Trim(sheetNameReplacer.Replace(stem), "'"))
+	}
+	return name
+}
+
+// unusedSheetName returns name, shortened to Excel's 31 character limit,
+// or, when f has a sheet of that name, the first of "name (2)", "name (3)"
+// and so on that it does not, as several inputs of the same name copying
+// a sheet named after them need.
+func unusedSheetName(f *excelize.File, name string) string {
+	if runes := []rune(name); len(runes) > excelize.MaxSheetNameLength {
+		name = string(runes[:excelize.MaxSheetNameLength])
+	}
+	for n := 2; ; n++ {
+		if index, _ := f.GetSheetIndex(name); index == -1 {
+			return name
+		}
+		name = splitSheetName(name, n)
+	}
+}
+
+// copySheet copies the sheet from to a new sheet named to, with its cells,
+// styles, column widths, conditional formats and data validations. CopySheet
+// leaves tables off the copy, so each table is added again under a new name;
+// its sheet-scoped defined names, such as the print area, are added for the
+// copy too. Slicers, pivot tables and charts stay with the original, which
+// is reported to logf.
+func copySheet(f *excelize.File, from, to string, logf, verbosef func(string, ...interface{})) error {
+	if index, _ := f.GetSheetIndex(to); index != -1 {
+		return fmt.Errorf("sheet '%s' already exists", to)
+	}
+	fromIndex, err := f.GetSheetIndex(from)
+	if err != nil {
+		return err
+	}
+	toIndex, err := f.NewSheet(to)
+	if err != nil {
+		return err
+	}
+	if err := f.CopySheet(fromIndex, toIndex); err != nil {
+		return err
+	}
+
+	tables, err := f.GetTables(from)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, table := range tables {
+		copied := table
+		if copied.Name, err = unusedTableName(f, table.Name); err != nil {
+			return err
+		}
+		if err := f.AddTable(to, &copied); err != nil {
+			return fmt.Errorf("failed to copy table %s: %v", table.Name, err)
+		}
+		verbosef("Copied table %s to sheet %s as %s\n", table.Name, to, copied.Name)
+		names = append(names, table.Name)
+	}
+	if len(names) > 0 {
+		logf("Slicers and pivot tables on table %s keep showing sheet %s, not the copy\n", strings.Join(names, ", "), from)
+	}
+	if cells, err := f.GetPictureCells(from); err == nil && len(cells) > 0 {
+		logf("Pictures and charts on sheet %s are not copied\n", from)
+	}
+
+	for _, dn := range f.GetDefinedName() {
+		if dn.Scope != from {
+			continue
+		}
+		copied := dn
+		copied.Scope = to
+		copied.RefersTo = strings.ReplaceAll(dn.RefersTo, quoteSheetName(from)+"!", quoteSheetName(to)+"!")
+		copied.RefersTo = strings.ReplaceAll(copied.RefersTo, from+"!", quoteSheetName(to)+"!")
+		if err := f.SetDefinedName(&copied); err != nil {
+			return fmt.Errorf("failed to copy defined name %s: %v", dn.Name, err)
+		}
+	}
+	return nil
+}
+
+// unusedTableName returns base with the lowest suffix _2, _3, ... that no
+// table in the workbook has.
+func unusedTableName(f *excelize.File, base string) (string, error) {
+	used := make(map[string]bool)
+	for _, sheet := range f.GetSheetList() {
+		tables, err := f.GetTables(sheet)
+		if err != nil {
+			return "", err
+		}
+		for _, table := range tables {
+			used[strings.ToLower(table.Name)] = true
+		}
+	}
+	for n := 2; ; n++ {
+		name := fmt.Sprintf("%s_%d", base, n)
+		if !used[strings.ToLower(name)] {
+			return name, nil
+		}
+	}
+}
+
+// quoteSheetName returns name quoted for a cell reference, as in
+// 'Pf-Table'!$A$1.
+func quoteSheetName(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
@@ -0,0 +1,246 @@
+package xlappend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sortKey is one column of a -sort-sheet specification.
+type sortKey struct {
+	col        int // 1-based sheet column
+	descending bool
+}
+
+// parseSortKeys parses a -sort-sheet value such as "3,1:desc".
+func parseSortKeys(spec string) ([]sortKey, error) {
+	var keys []sortKey
+	if spec == "" {
+		return keys, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		col, err := strconv.Atoi(fields[0])
+		if err != nil || col < 1 || col > excelize.MaxColumns {
+			return nil, fmt.Errorf("invalid column %q", fields[0])
+		}
+		key := sortKey{col: col}
+		if len(fields) == 2 {
+			switch fields[1] {
+			case "asc":
+			case "desc":
+				key.descending = true
+			default:
+				return nil, fmt.Errorf("unknown sort order %q", fields[1])
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sheetCell is a cell captured by readSheetCells so it can be rewritten at
+// another row or into a stream.
+type sheetCell struct {
+	value   string
+	kind    excelize.CellType
+	style   int
+	formula string
+}
+
+// sortSheetRows sorts rows firstRow to lastRow of sheet in place by keys,
+// moving cell values, types and styles for columns 1 to lastCol. Values
+// that both parse as numbers, which includes dates, compare numerically and
+// anything else compares as text. Formulas are moved unchanged, so their
+// references are not adjusted. The whole region is held in memory.
+func sortSheetRows(f *excelize.File, sheet string, firstRow, lastRow, lastCol int, keys []sortKey) error {
+	if lastRow-firstRow < 1 || lastCol == 0 {
+		return nil
+	}
+	region, err := readSheetCells(f, sheet, firstRow, lastRow, lastCol)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(region, func(a, b int) bool {
+		for _, key := range keys {
+			var va, vb string
+			if key.col <= lastCol {
+				va, vb = region[a][key.col-1].value, region[b][key.col-1].value
+			}
+			cmp := compareValues(va, vb)
+			if cmp == 0 {
+				continue
+			}
+			if key.descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	for i, row := range region {
+		for c, sc := range row {
+			cell, _ := excelize.CoordinatesToCellName(c+1, firstRow+i)
+			var err error
+			if sc.formula != "" {
+				err = f.SetCellFormula(sheet, cell, sc.formula)
+			} else {
+				err = f.SetCellValue(sheet, cell, sc.typedValue())
+			}
+			if err != nil {
+				return err
+			}
+			if err := f.SetCellStyle(sheet, cell, cell, sc.style); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readSheetCells captures the values, types, styles and formulas of rows
+// firstRow to lastRow of sheet, columns 1 to lastCol.
+func readSheetCells(f *excelize.File, sheet string, firstRow, lastRow, lastCol int) ([][]sheetCell, error) {
+	raw := excelize.Options{RawCellValue: true}
+	region := make([][]sheetCell, 0, lastRow-firstRow+1)
+	for r := firstRow; r <= lastRow; r++ {
+		row := make([]sheetCell, lastCol)
+		for c := 1; c <= lastCol; c++ {
+			cell, _ := excelize.CoordinatesToCellName(c, r)
+			var err error
+			sc := &row[c-1]
+			if sc.value, err = f.GetCellValue(sheet, cell, raw); err != nil {
+				return nil, err
+			}
+			if sc.kind, err = f.GetCellType(sheet, cell); err != nil {
+				return nil, err
+			}
+			if sc.style, err = f.GetCellStyle(sheet, cell); err != nil {
+				return nil, err
+			}
+			if sc.formula, err = f.GetCellFormula(sheet, cell); err != nil {
+				return nil, err
+			}
+		}
+		region = append(region, row)
+	}
+	return region, nil
+}
+
+// typedValue returns the captured value as the type it was stored with:
+// nil for an empty cell, a bool, a float64 for numbers and dates, or a
+// string.
+func (sc sheetCell) typedValue() interface{} {
+	switch {
+	case sc.value == "":
+		return nil
+	case sc.kind == excelize.CellTypeBool:
+		return sc.value == "1"
+	case sc.kind == excelize.CellTypeUnset || sc.kind == excelize.CellTypeNumber:
+		if n, err := strconv.ParseFloat(sc.value, 64); err == nil {
+			return n
+		}
+	}
+	return sc.value
+}
+
+// compareValues orders two cell values numerically when both are numbers
+// and as text otherwise.
+func compareValues(a, b string) int {
+	na, errA := strconv.ParseFloat(a, 64)
+	nb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// rowSortKey is the value of a buffered row's SortBy column as sortBuffered
+// compares it: as a number, else as a timestamp in a layout of the locale
+// or one parseTimestamp knows, else as text. Numbers and dates are read as
+// the -locale language tag writes them.
+type rowSortKey struct {
+	text   string
+	number float64
+	time   time.Time
+	kind   int // 0 for text, 1 for a number, 2 for a timestamp
+}
+
+func newRowSortKey(value string, now time.Time, lf localeFormat) rowSortKey {
+	key := rowSortKey{text: value}
+	plain, _ := lf.number(value)
+	if n, err := strconv.ParseFloat(plain, 64); err == nil {
+		key.number, key.kind = n, 1
+	} else if t, _, ok := lf.parseDate(value, now.Location()); ok {
+		key.time, key.kind = t, 2
+	} else if t, _, err := parseTimestamp(value, now); err == nil {
+		key.time, key.kind = t, 2
+	}
+	return key
+}
+
+// compare orders two keys of the same kind by their values and any others
+// as text, as compareValues does.
+func (k rowSortKey) compare(other rowSortKey) int {
+	switch {
+	case k.kind != other.kind || k.kind == 0:
+		return strings.Compare(k.text, other.text)
+	case k.kind == 1 && k.number != other.number:
+		if k.number < other.number {
+			return -1
+		}
+		return 1
+	case k.kind == 2:
+		return k.time.Compare(other.time)
+	}
+	return 0
+}
+
+// sortBuffered sorts the rows buffered from every input file by their
+// SortBy column before they are written, keeping rows with equal values in
+// the order they were read. Timestamps in different layouts, such as those
+// of timelines merged from several tools, sort by the time they stand for;
+// those without an offset are taken as UTC.
+func (a *sheetAppender) sortBuffered() {
+	now := time.Now().UTC()
+	keys := make([]rowSortKey, len(a.csvData))
+	for i, row := range a.csvData {
+		var value string
+		if a.sortCol < len(row) {
+			value = row[a.sortCol]
+		}
+		keys[i] = newRowSortKey(value, now, a.displayFmt)
+	}
+	order := make([]int, len(a.csvData))
+	for i := range order {
+		order[i] = i
+	}
+	descending := a.opts.SortOrder == "desc"
+	sort.SliceStable(order, func(x, y int) bool {
+		cmp := keys[order[x]].compare(keys[order[y]])
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	rows := make([][]string, len(order))
+	files := make([]int, len(order))
+	lines := make([]int, len(order))
+	for i, j := range order {
+		rows[i], files[i], lines[i] = a.csvData[j], a.rowFiles[j], a.rowLines[j]
+	}
+	a.csvData, a.rowFiles, a.rowLines = rows, files, lines
+	a.opts.Verbosef("Sorted %d rows by column %s\n", len(rows), a.opts.SortBy)
+}
@@ -0,0 +1,78 @@
+package xlappend
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestAppendSortSheet(t *testing.T) {
+	for _, tc := range []struct {
+		keys string
+		want [][]string
+	}{
+		// Numbers compare as numbers, so 10 sorts after 3
+		{"2", [][]string{{"a.exe", "1", "y"}, {"b.exe", "2", "x"}, {"c.exe", "3", "x"}, {"d.exe", "10", "y"}}},
+		{"2:desc", [][]string{{"d.exe", "10", "y"}, {"c.exe", "3", "x"}, {"b.exe", "2", "x"}, {"a.exe", "1", "y"}}},
+		{"3,1:desc", [][]string{{"c.exe", "3", "x"}, {"b.exe", "2", "x"}, {"d.exe", "10", "y"}, {"a.exe", "1", "y"}}},
+	} {
+		t.Run(tc.keys, func(t *testing.T) {
+			dir := t.TempDir()
+			template := newTemplate(t, dir, "T",
+				[]string{"Name", "Size", "Tag"},
+				[]string{"b.exe", "2", "x"},
+				[]string{"d.exe", "10", "y"})
+			addTable(t, template, "T", "A1:C3")
+			input := writeInput(t, dir, "in.csv", "Name,Size,Tag\na.exe,1,y\nc.exe,3,x\n")
+			output := filepath.Join(dir, "out.xlsx")
+			var im Importer
+			result, err := im.Append(context.Background(), Options{
+				InputPaths: []string{input}, TemplatePath: template, SheetName: "T", StartRow: 2,
+				OutputPath: output, SortSheet: tc.keys,
+			})
+			if err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			if result.RowsAppended != 2 {
+				t.Errorf("RowsAppended = %d, want 2", result.RowsAppended)
+			}
+			want := append([][]string{{"Name", "Size", "Tag"}}, tc.want...)
+			if rows := sheetRows(t, output, "T"); !reflect.DeepEqual(rows, want) {
+				t.Errorf("sheet rows = %q, want %q", rows, want)
+			}
+
+			// The table still has its header and covers every row
+			f, err := excelize.OpenFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			tables, err := f.GetTables("T")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tables) != 1 || tables[0].Range != "A1:C5" {
+				t.Errorf("tables = %+v, want one over A1:C5", tables)
+			}
+		})
+	}
+}
+
+// addTable adds a table over ref of sheet to the workbook at path.
+func addTable(t testing.TB, path, sheet, ref string) {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.AddTable(sheet, &excelize.Table{Range: ref, Name: "Events"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,314 @@
+package xlappend
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// dataSource is the worksheet data a slicer or pivot table in the workbook
+// reads: a table, or a range of a sheet, or a defined name.
+type dataSource struct {
+	user  string // the slicer or pivot table, as in "pivot table PivotTable2"
+	table string // table or defined name read, empty for a range
+	sheet string // sheet of the range
+	ref   string // range, such as A1:E100
+	cache string // pivot cache part read by a pivot table
+}
+
+// worksheetSourceRefPattern matches the ref attribute of a pivot cache's
+// worksheetSource, and pivotCacheRefreshPattern the refreshOnLoad
+// attribute of its root element.
+var (
+	worksheetSourceRefPattern = regexp.MustCompile(`(<worksheetSource\b[^>]*?\sref=")[^"]*(")`)
+	pivotCacheRefreshPattern  = regexp.MustCompile(`(<pivotCacheDefinition\b[^>]*?\srefreshOnLoad=")[^"]*(")`)
+)
+
+// pivotCacheDefinition holds the source of a pivot cache part.
+type pivotCacheDefinition struct {
+	Source struct {
+		Ref   string `xml:"ref,attr"`
+		Sheet string `xml:"sheet,attr"`
+		Name  string `xml:"name,attr"`
+	} `xml:"cacheSource>worksheetSource"`
+}
+
+// pivotTableDefinition holds the name of a pivot table part.
+type pivotTableDefinition struct {
+	Name string `xml:"name,attr"`
+}
+
+// slicerCacheDefinition holds the name of a slicer cache part and, for a
+// slicer on a table rather than a pivot table, the id of the table.
+type slicerCacheDefinition struct {
+	Name  string `xml:"name,attr"`
+	Table struct {
+		ID int `xml:"tableId,attr"`
+	} `xml:"extLst>ext>tableSlicerCache"`
+}
+
+// partRelationships holds the relationships of a package part.
+type partRelationships struct {
+	Relationships []struct {
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// workbookDataSources returns what each pivot table and each table slicer
+// in the workbook reads, sorted by their names. A slicer on a pivot table
+// filters the pivot table's data, so it is covered by the pivot table.
+// excelize does not read these parts, so they are decoded from the package
+// directly; parts that do not decode are skipped.
+func workbookDataSources(f *excelize.File) []dataSource {
+	tableNames := make(map[int]string)
+	parts := make(map[string][]byte)
+	f.Pkg.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		switch {
+		case strings.HasPrefix(name, "xl/tables/") && strings.HasSuffix(name, ".xml"):
+			var table tablePart
+			if err := xml.NewDecoder(bytes.NewReader(value.([]byte))).Decode(&table); err == nil {
+				tableNames[table.ID] = table.Name
+			}
+		case strings.HasPrefix(name, "xl/pivotTables/"), strings.HasPrefix(name, "xl/pivotCache/pivotCacheDefinition"),
+			strings.HasPrefix(name, "xl/slicerCaches/"):
+			parts[name] = value.([]byte)
+		}
+		return true
+	})
+
+	var sources []dataSource
+	for name, content := range parts {
+		switch {
+		case strings.HasPrefix(name, "xl/slicerCaches/"):
+			var slicer slicerCacheDefinition
+			if err := xml.Unmarshal(content, &slicer); err != nil {
+				continue
+			}
+			if table, ok := tableNames[slicer.Table.ID]; ok && slicer.Table.ID != 0 {
+				sources = append(sources, dataSource{user: "slicer " + slicer.Name, table: table})
+			}
+		case strings.HasPrefix(name, "xl/pivotTables/") && !strings.Contains(name, "/_rels/"):
+			var pivot pivotTableDefinition
+			if err := xml.Unmarshal(content, &pivot); err != nil {
+				continue
+			}
+			var rels partRelationships
+			relsName := path.Join(path.Dir(name), "_rels", path.Base(name)+".rels")
+			if err := xml.Unmarshal(parts[relsName], &rels); err != nil {
+				continue
+			}
+			for _, rel := range rels.Relationships {
+				if rel.Type != excelize.SourceRelationshipPivotCache {
+					continue
+				}
+				target := strings.TrimPrefix(rel.Target, "/")
+				if !strings.HasPrefix(rel.Target, "/") {
+					target = path.Join(path.Dir(name), rel.Target)
+				}
+				var cache pivotCacheDefinition
+				if err := xml.Unmarshal(parts[target], &cache); err != nil {
+					continue
+				}
+				source := cache.Source
+				sources = append(sources, dataSource{user: "pivot table " + pivot.Name, table: source.Name, sheet: source.Sheet, ref: source.Ref, cache: target})
+			}
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].user < sources[j].user })
+	return sources
+}
+
+// rangeCoordinates returns the columns and rows of the corners of ref, a
+// cell range such as A1:E100 or $A:$E, or a single cell. Whole columns run
+// to the last row of the sheet.
+func rangeCoordinates(ref string) (col1, row1, col2, row2 int, err error) {
+	corners := strings.Split(strings.ReplaceAll(ref, "$", ""), ":")
+	if len(corners) == 1 {
+		corners = append(corners, corners[0])
+	}
+	if len(corners) != 2 {
+		return 0, 0, 0, 0, fmt.Errorf("unrecognised range %s", ref)
+	}
+	coords := make([]int, 0, 4)
+	for i, corner := range corners {
+		if col, err := excelize.ColumnNameToNumber(corner); err == nil {
+			coords = append(coords, col, []int{1, excelize.TotalRows}[i])
+			continue
+		}
+		col, row, err := excelize.CellNameToCoordinates(corner)
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("unrecognised range %s", ref)
+		}
+		coords = append(coords, col, row)
+	}
+	return coords[0], coords[1], coords[2], coords[3], nil
+}
+
+// sheetSources returns the sources of workbookDataSources that read the
+// target sheet, with the range of each table or defined name resolved into
+// ref. Tables are looked up among the sheet's tables and defined names
+// among the workbook-scoped ones.
+func (a *sheetAppender) sheetSources() []dataSource {
+	sources := workbookDataSources(a.f)
+	if len(sources) == 0 {
+		return nil
+	}
+	sheet := a.opts.SheetName
+	definedNames := make(map[string]string)
+	for _, dn := range a.f.GetDefinedName() {
+		if dn.Scope == "" || dn.Scope == "Workbook" {
+			definedNames[strings.ToLower(dn.Name)] = dn.RefersTo
+		}
+	}
+	var reading []dataSource
+	for _, source := range sources {
+		if source.table != "" {
+			source.ref = ""
+			for _, table := range a.tables {
+				if strings.EqualFold(table.Name, source.table) {
+					source.sheet, source.ref = sheet, table.Range
+				}
+			}
+			if refersTo, ok := definedNames[strings.ToLower(source.table)]; ok && source.ref == "" {
+				if i := strings.LastIndex(refersTo, "!"); i > 0 {
+					source.sheet = strings.ReplaceAll(strings.Trim(refersTo[:i], "'"), "''", "'")
+					source.ref = refersTo[i+1:]
+				}
+			}
+		}
+		if source.sheet == sheet {
+			reading = append(reading, source)
+		}
+	}
+	return reading
+}
+
+// grownTable returns the name of the table extendTable will grow over the
+// appended rows, or "" when there is none.
+func (a *sheetAppender) grownTable() string {
+	if table := headerTable(a.tables, a.headerRow, a.colOffset+1); table != nil && a.templateRows > 0 {
+		if _, part := findTablePart(a.f, table.Name); part.TotalsRowCount == 0 {
+			return table.Name
+		}
+	}
+	return ""
+}
+
+// extendsRange reports whether extendPivotCaches will grow source, a range
+// of the target sheet that a pivot cache reads, over the appended rows:
+// the range has to end on the last row of the template's data.
+func (a *sheetAppender) extendsRange(source dataSource) bool {
+	if source.cache == "" || source.table != "" || a.templateRows == 0 {
+		return false
+	}
+	_, _, _, row2, err := rangeCoordinates(source.ref)
+	return err == nil && row2 == a.templateRows
+}
+
+// checkDataSources makes sure the slicers and pivot tables that read the
+// target sheet will see the rows about to be appended, from the first one
+// on, in each of the written columns. The table extendTable grows covers
+// them, and so does a pivot cache range extendPivotCaches grows; any other
+// table or range must already reach that far. A workbook with slicers or
+// pivot tables none of which read the sheet is reported too. Each problem
+// is a warning, and with Strict an error, since slicers that miss the new
+// rows go on showing the old counts without any sign.
+func (a *sheetAppender) checkDataSources() error {
+	if len(workbookDataSources(a.f)) == 0 {
+		return nil
+	}
+	sheet := a.opts.SheetName
+	grown := a.grownTable()
+
+	firstCol, lastCol := a.colOffset+1, a.maxCols
+	if lastCol < firstCol {
+		lastCol = firstCol
+	}
+	var problems []string
+	sources := a.sheetSources()
+	for _, source := range sources {
+		if strings.EqualFold(source.table, grown) && grown != "" {
+			continue
+		}
+		ref := source.ref
+		col1, _, col2, row2, err := rangeCoordinates(ref)
+		if err != nil {
+			a.opts.Verbosef("%s reads %s, which cannot be checked: %v\n", source.user, source.table, err)
+			continue
+		}
+		if a.extendsRange(source) {
+			row2 = excelize.TotalRows
+		}
+		name := sheet + "!" + ref
+		if source.table != "" {
+			name = source.table + " (" + ref + ")"
+		}
+		switch {
+		case a.nextRow > row2:
+			problems = append(problems, fmt.Sprintf("%s reads %s, which ends above the first appended row %d", source.user, name, a.nextRow))
+		case firstCol < col1 || lastCol > col2:
+			from, _ := excelize.ColumnNumberToName(firstCol)
+			to, _ := excelize.ColumnNumberToName(lastCol)
+			problems = append(problems, fmt.Sprintf("%s reads %s, which leaves out some of the written columns %s to %s", source.user, name, from, to))
+		}
+	}
+	if len(sources) == 0 && !a.result.SheetCreated && a.result.CopiedFrom == "" {
+		problems = append(problems, fmt.Sprintf("no slicer or pivot table reads sheet %s, so none will show the appended rows", sheet))
+	}
+
+	if len(problems) > 0 && a.opts.Strict {
+		return errors.New(strings.Join(problems, "; ") + " (-strict)")
+	}
+	for _, problem := range problems {
+		a.opts.Logf("Warning: %s\n", problem)
+	}
+	return nil
+}
+
+// extendPivotCaches updates the pivot caches that read the target sheet
+// once lastRow has been written. A cache over a range of the sheet that
+// ends on the last row of the template's data is grown down to lastRow;
+// one over the table extendTable grows already follows it. Every cache on
+// the sheet is also marked to refresh when the workbook is opened, since
+// its saved records do not include the appended rows. excelize does not
+// write pivot cache parts, so they are rewritten in the package directly.
+func (a *sheetAppender) extendPivotCaches(lastRow int) error {
+	done := make(map[string]bool)
+	for _, source := range a.sheetSources() {
+		if source.cache == "" || done[source.cache] {
+			continue
+		}
+		done[source.cache] = true
+		value, ok := a.f.Pkg.Load(source.cache)
+		if !ok {
+			continue
+		}
+		content := value.([]byte)
+		if a.extendsRange(source) && lastRow > a.templateRows {
+			col1, row1, col2, _, _ := rangeCoordinates(source.ref)
+			topLeft, _ := excelize.CoordinatesToCellName(col1, row1)
+			bottomRight, err := excelize.CoordinatesToCellName(col2, lastRow)
+			if err != nil {
+				return err
+			}
+			content = worksheetSourceRefPattern.ReplaceAll(content, []byte("${1}"+topLeft+":"+bottomRight+"${2}"))
+			a.opts.Verbosef("Pivot cache of %s extended from %s to %s:%s\n", source.user, source.ref, topLeft, bottomRight)
+		}
+		if pivotCacheRefreshPattern.Match(content) {
+			content = pivotCacheRefreshPattern.ReplaceAll(content, []byte("${1}1${2}"))
+		} else {
+			content = bytes.Replace(content, []byte("<pivotCacheDefinition "), []byte(`<pivotCacheDefinition refreshOnLoad="1" `), 1)
+		}
+		a.f.Pkg.Store(source.cache, content)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package xlappend
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rowSpill is the temporary file the buffered rows are moved to once they
+// hold more than MaxMemory bytes, as gob encoded spilledBatches, until the
+// next flush writes them to the sheet.
+type rowSpill struct {
+	file    *os.File
+	out     *bufio.Writer
+	enc     *gob.Encoder
+	batches int
+	rows    int
+}
+
+// spilledBatch is the csvData, rowFiles and rowLines of one spill.
+type spilledBatch struct {
+	Rows  [][]string
+	Files []int
+	Lines []int
+}
+
+// recordBytes estimates the memory a buffered record holds: its fields and
+// the string and slice headers pointing at them.
+func recordBytes(record []string) int64 {
+	n := int64(24 + 16*len(record))
+	for _, field := range record {
+		n += int64(len(field))
+	}
+	return n
+}
+
+// spillRows moves the buffered rows to the spill file, creating it on first
+// use, and releases them.
+func (a *sheetAppender) spillRows() error {
+	if a.spill == nil {
+		file, err := os.CreateTemp("", "csv2XLsheet-spill-*.gob")
+		if err != nil {
+			return fmt.Errorf("failed to spill rows to disk: %v", err)
+		}
+		a.spill = &rowSpill{file: file}
+		a.spill.reset()
+		a.opts.Verbosef("Buffered rows passed the memory limit of %d bytes; spilling them to %s\n", a.opts.MaxMemory, file.Name())
+	}
+	s := a.spill
+	if err := s.enc.Encode(spilledBatch{a.csvData, a.rowFiles, a.rowLines}); err != nil {
+		return fmt.Errorf("failed to spill rows to disk: %v", err)
+	}
+	s.batches++
+	s.rows += len(a.csvData)
+	a.opts.Debugf("Spilled %d rows to disk, %d in all\n", len(a.csvData), s.rows)
+	// Reslicing would keep the rows' fields alive in the old array
+	a.csvData, a.rowFiles, a.rowLines = nil, nil, nil
+	a.bufferedBytes = 0
+	return nil
+}
+
+// writeSpilled writes the spilled rows to the sheet, a batch at a time and
+// before those still buffered, and empties the spill file.
+func (a *sheetAppender) writeSpilled() error {
+	s := a.spill
+	if s == nil || s.batches == 0 {
+		return nil
+	}
+	if err := s.out.Flush(); err != nil {
+		return fmt.Errorf("failed to spill rows to disk: %v", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read spilled rows: %v", err)
+	}
+	held, heldFiles, heldLines := a.csvData, a.rowFiles, a.rowLines
+	defer func() { a.csvData, a.rowFiles, a.rowLines = held, heldFiles, heldLines }()
+	dec := gob.NewDecoder(bufio.NewReader(s.file))
+	for i := 0; i < s.batches; i++ {
+		var batch spilledBatch
+		if err := dec.Decode(&batch); err != nil {
+			return fmt.Errorf("failed to read spilled rows: %v", err)
+		}
+		a.csvData, a.rowFiles, a.rowLines = batch.Rows, batch.Files, batch.Lines
+		if err := a.writeRows(); err != nil {
+			return err
+		}
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to empty the spill file: %v", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to empty the spill file: %v", err)
+	}
+	s.reset()
+	return nil
+}
+
+// reset starts the spill file over, empty; a gob stream only describes its
+// types once, at its start.
+func (s *rowSpill) reset() {
+	s.out = bufio.NewWriter(s.file)
+	s.enc = gob.NewEncoder(s.out)
+	s.batches, s.rows = 0, 0
+}
+
+// closeSpill removes the spill file, if rows were spilled.
+func (a *sheetAppender) closeSpill() {
+	if a.spill == nil {
+		return
+	}
+	a.spill.file.Close()
+	os.Remove(a.spill.file.Name())
+	a.spill = nil
+}
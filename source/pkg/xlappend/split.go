@@ -0,0 +1,116 @@
+package xlappend
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// keepHeader captures row 1 of the target sheet, columns 1 to lastCol,
+// with the custom widths of those columns, for nextSheet to copy.
+func (a *sheetAppender) keepHeader(lastCol int) error {
+	region, err := readSheetCells(a.f, a.sheet, 1, 1, lastCol)
+	if err != nil {
+		return err
+	}
+	a.header = region[0]
+	defaultWidth, err := a.f.GetColWidth(a.sheet, "XFD")
+	if err != nil {
+		return err
+	}
+	for c := 1; c <= lastCol; c++ {
+		name, _ := excelize.ColumnNumberToName(c)
+		width, err := a.f.GetColWidth(a.sheet, name)
+		if err != nil {
+			return err
+		}
+		if width == defaultWidth {
+			width = 0
+		}
+		a.headerWidths = append(a.headerWidths, width)
+	}
+	return nil
+}
+
+// nextSheet is called once the current sheet holds excelize.TotalRows rows.
+// Without Split that is an error. With it, the rows continue on a new sheet
+// named after SheetName with a number, see splitSheetName, which starts
+// with a copy of the header row and its column widths.
+func (a *sheetAppender) nextSheet() error {
+	if !a.opts.Split {
+		return fmt.Errorf("sheet %s is full: Excel sheets hold at most %d rows. Use -split to continue on new sheets", a.sheet, excelize.TotalRows)
+	}
+	if len(a.sortKeys) > 0 {
+		return fmt.Errorf("sheet %s is full and rows split across sheets cannot be sorted; drop -sort-sheet", a.sheet)
+	}
+	if a.stream != nil {
+		if err := a.stream.Flush(); err != nil {
+			return fmt.Errorf("failed to finish streaming the sheet: %v", err)
+		}
+	}
+
+	name := splitSheetName(a.opts.SheetName, len(a.result.Sheets)+1)
+	if index, _ := a.f.GetSheetIndex(name); index != -1 {
+		return fmt.Errorf("sheet %s is full and the next sheet, %s, already exists", a.sheet, name)
+	}
+	if _, err := a.f.NewSheet(name); err != nil {
+		return fmt.Errorf("failed to create sheet '%s': %v", name, err)
+	}
+	a.sheetLinks = 0
+	a.sheetComments = 0
+	for c, sc := range a.header {
+		cell, _ := excelize.CoordinatesToCellName(c+1, 1)
+		var err error
+		if sc.formula != "" {
+			err = a.f.SetCellFormula(name, cell, sc.formula)
+		} else {
+			err = a.f.SetCellValue(name, cell, sc.typedValue())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy header to sheet '%s': %v", name, err)
+		}
+		if sc.style != 0 {
+			if err := a.f.SetCellStyle(name, cell, cell, sc.style); err != nil {
+				return fmt.Errorf("failed to copy header to sheet '%s': %v", name, err)
+			}
+		}
+	}
+	for c, width := range a.headerWidths {
+		if width == 0 {
+			continue
+		}
+		col, _ := excelize.ColumnNumberToName(c + 1)
+		if err := a.f.SetColWidth(name, col, col, width); err != nil {
+			return fmt.Errorf("failed to copy column widths to sheet '%s': %v", name, err)
+		}
+	}
+
+	headerRows := 0
+	if a.header != nil {
+		headerRows = 1
+	}
+	if a.stream != nil {
+		var err error
+		if a.stream, err = newSheetStream(a.f, name, headerRows, len(a.header), a.streamPanes()); err != nil {
+			return fmt.Errorf("failed to start streaming the sheet: %v", err)
+		}
+	}
+	a.opts.Logf("Sheet %s is full; continuing on new sheet %s\n", a.sheet, name)
+	a.sheet = name
+	a.nextRow = headerRows + 1
+	a.result.Sheets = append(a.result.Sheets, SheetRows{Name: name})
+	return nil
+}
+
+// splitSheetName returns the name of the nth sheet of a split, numbered as
+// Excel numbers copies of a sheet: "Pf-Table (2)", "Pf-Table (3)" and so
+// on. The name is shortened to fit Excel's 31 character limit on sheet
+// names.
+func splitSheetName(sheet string, n int) string {
+	suffix := fmt.Sprintf(" (%d)", n)
+	name := []rune(sheet)
+	if max := excelize.MaxSheetNameLength - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	return string(name) + suffix
+}
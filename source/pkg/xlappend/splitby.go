@@ -0,0 +1,114 @@
+package xlappend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxSplitSheets is the most sheets SplitJobs makes, since every value of
+// the column costs another read of the input.
+const maxSplitSheets = 200
+
+// blankSplitSheet names the sheet of the lines whose SplitBy column is
+// empty.
+const blankSplitSheet = "(blank)"
+
+// SplitJobs returns the jobs that append the input of opts to a sheet for
+// each value of its SplitBy column, in the order of the values, for
+// AppendJobs to run. The input is read once first, as Append would read it
+// but saving nothing, for the values of the lines it would append; every
+// job then reads it again for the lines holding its value. Each sheet is
+// named after its value: one the template has is appended to, and any
+// other is made as a copy of SheetName, the prototype, or created with
+// CreateSheet when the template does not have SheetName either.
+func (im *Importer) SplitJobs(ctx context.Context, opts Options) ([]Options, error) {
+	switch {
+	case opts.SplitBy == "":
+		return nil, errors.New("no column to split by")
+	case opts.SheetCopy != "":
+		return nil, errors.New("-split-by names the sheets after the values; drop -sheet-copy")
+	}
+	scan := opts
+	scan.DryRun = true
+	scan.Logf, scan.Verbosef, scan.Debugf, scan.Progress = nil, nil, nil, nil
+	a, err := newSheetAppender(scan)
+	if err != nil {
+		return nil, err
+	}
+	a.ctx = ctx
+	a.errLog = &errorLog{out: io.Discard}
+	a.splitValues = make(map[string]bool)
+	if err := a.run(); err != nil {
+		return nil, err
+	}
+	if len(a.splitValues) == 0 {
+		return nil, fmt.Errorf("no lines to split by %s", opts.SplitBy)
+	}
+	if len(a.splitValues) > maxSplitSheets {
+		return nil, fmt.Errorf("column %s holds %d values, more than the %d sheets -split-by makes; split by a column with fewer", opts.SplitBy, len(a.splitValues), maxSplitSheets)
+	}
+	values := make([]string, 0, len(a.splitValues))
+	for value := range a.splitValues {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	// Sheet names are not case sensitive
+	existing := make(map[string]string)
+	for _, sheet := range a.f.GetSheetList() {
+		existing[strings.ToLower(sheet)] = sheet
+	}
+	taken := make(map[string]bool)
+	jobs := make([]Options, len(values))
+	for i, value := range values {
+		base := splitSheetFor(value)
+		name := base
+		for n := 2; taken[strings.ToLower(name)]; n++ {
+			name = splitSheetName(base, n)
+		}
+		taken[strings.ToLower(name)] = true
+		job := opts
+		job.SplitValue = value
+		switch sheet, ok := existing[strings.ToLower(name)]; {
+		case ok:
+			job.SheetName = sheet
+		case a.result.SheetCreated:
+			job.SheetName = name
+		default:
+			job.SheetCopy = name
+		}
+		jobs[i] = job
+	}
+	return jobs, nil
+}
+
+// splitSheetFor returns the name of the sheet for the SplitBy value value,
+// without the characters a sheet name cannot hold and shortened to Excel's
+// limit.
+func splitSheetFor(value string) string {
+	name := strings.Trim(sheetNameReplacer.Replace(strings.TrimSpace(value)), "'")
+	if name == "" {
+		return blankSplitSheet
+	}
+	if runes := []rune(name); len(runes) > excelize.MaxSheetNameLength {
+		name = string(runes[:excelize.MaxSheetNameLength])
+	}
+	return name
+}
+
+// resolveSplit finds the SplitBy column in record, the first line of an
+// input file.
+func (a *sheetAppender) resolveSplit(record []string) error {
+	col, err := resolveColumn(a.splitBy.column, record)
+	if err != nil {
+		return fmt.Errorf("-split-by %s: %v of %s", a.opts.SplitBy, err, a.inputName)
+	}
+	a.splitBy.col = col
+	return nil
+}
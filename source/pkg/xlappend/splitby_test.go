@@ -0,0 +1,51 @@
+package xlappend
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitJobs(t *testing.T) {
+	const input = "Name,Host,Owner\na.exe,WKS01,o\nb.exe,WKS02,o\nc.exe,,o\nd.exe,WKS01,o\n"
+	for _, tc := range []struct {
+		column string
+		want   []string
+		err    string
+	}{
+		{"Host", []string{"", "WKS01", "WKS02"}, ""},
+		{"2", []string{"", "WKS01", "WKS02"}, ""},
+		{"3", []string{"o"}, ""},
+		// A column past the line would put every line on the (blank) sheet
+		{"99", nil, `column "99" is not in the header`},
+		{"0", nil, `column "0" is not in the header`},
+		{"Computer", nil, `column "Computer" is not in the header`},
+	} {
+		t.Run(tc.column, func(t *testing.T) {
+			dir := t.TempDir()
+			var im Importer
+			steps, err := im.SplitJobs(context.Background(), Options{
+				InputPaths: []string{writeInput(t, dir, "in.csv", input)}, TemplatePath: newTemplate(t, dir, "T", []string{"Name", "Host", "Owner"}),
+				SheetName: "T", StartRow: 2, OutputPath: filepath.Join(dir, "out.xlsx"), SplitBy: tc.column,
+			})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("SplitJobs error = %v, want one with %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitJobs: %v", err)
+			}
+			var values []string
+			for _, step := range steps {
+				values = append(values, step.SplitValue)
+			}
+			if !reflect.DeepEqual(values, tc.want) {
+				t.Errorf("split values = %q, want %q", values, tc.want)
+			}
+		})
+	}
+}
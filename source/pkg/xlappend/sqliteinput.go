@@ -0,0 +1,135 @@
+package xlappend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	// Registers the pure Go "sqlite" driver, so builds need no C compiler
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMagic starts every SQLite 3 database file.
+const sqliteMagic = "SQLite format 3\x00"
+
+// sqliteReader reads the result of a query against a SQLite database as
+// records. The first record is a header of the result's column names and
+// each result row follows as a record of its values, see sqliteText. Rows
+// are numbered like lines, the header being line 1.
+type sqliteReader struct {
+	db   *sql.DB
+	rows *sql.Rows
+	cols []string
+	line int
+}
+
+// newSQLiteReader opens the database at path read-only and runs query on
+// it. The database and its journal are never written, so evidence can be
+// queried in place; ctx cancels the query.
+func newSQLiteReader(ctx context.Context, path, query string) (*sqliteReader, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dsn := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, err
+	}
+	return &sqliteReader{db: db, rows: rows, cols: cols}, nil
+}
+
+// Read returns the column names, then the values of each result row with
+// trailing empty values dropped, like jsonReader.
+func (r *sqliteReader) Read() ([]string, error) {
+	r.line++
+	if r.line == 1 {
+		return append([]string(nil), r.cols...), nil
+	}
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	values := make([]interface{}, len(r.cols))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(values))
+	end := 0
+	for i, value := range values {
+		if record[i] = sqliteText(value); record[i] != "" {
+			end = i + 1
+		}
+	}
+	return record[:end], nil
+}
+
+// sqliteText returns the cell text of a SQLite value: NULL as empty, text
+// as it is, numbers in Go's shortest form, times as yyyy-mm-dd hh:mm:ss
+// with any fraction so -infer recognises them, and blobs that are not
+// UTF-8 text as hex.
+func sqliteText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return hex.EncodeToString(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999999")
+	}
+	return fmt.Sprint(value)
+}
+
+// FieldPos returns the row number of the last record read.
+func (r *sqliteReader) FieldPos(field int) (line, column int) {
+	return r.line, 1
+}
+
+// rawLines returns nil: a result row has no input text.
+func (r *sqliteReader) rawLines(first, last int) []string {
+	return nil
+}
+
+// forget does nothing, since rows are not kept.
+func (r *sqliteReader) forget(before int) {}
+
+// Close closes the query and the database.
+func (r *sqliteReader) Close() error {
+	r.rows.Close()
+	return r.db.Close()
+}
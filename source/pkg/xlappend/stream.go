@@ -0,0 +1,98 @@
+package xlappend
+
+import "github.com/xuri/excelize/v2"
+
+// newSheetStream replaces the contents of sheet with a StreamWriter so that
+// appended rows are written out as they arrive instead of being held in the
+// workbook. A stream always starts an empty sheet, so rows 1 to lastRow,
+// columns 1 to lastCol, are copied into it first together with merged
+// cells, custom column widths and custom row heights, under panes unless
+// that is nil. Rows must then be written in ascending order.
+func newSheetStream(f *excelize.File, sheet string, lastRow, lastCol int, panes *excelize.Panes) (*excelize.StreamWriter, error) {
+	var region [][]sheetCell
+	var merges []excelize.MergeCell
+	var widths []float64
+	var heights []float64
+	var hidden []bool
+	if lastRow > 0 {
+		var err error
+		if region, err = readSheetCells(f, sheet, 1, lastRow, lastCol); err != nil {
+			return nil, err
+		}
+		if merges, err = f.GetMergeCells(sheet); err != nil {
+			return nil, err
+		}
+
+		// Widths and heights equal to those of the last column and row
+		// are the sheet defaults and are not copied
+		defaultWidth, err := f.GetColWidth(sheet, "XFD")
+		if err != nil {
+			return nil, err
+		}
+		for c := 1; c <= lastCol; c++ {
+			name, _ := excelize.ColumnNumberToName(c)
+			width, err := f.GetColWidth(sheet, name)
+			if err != nil {
+				return nil, err
+			}
+			if width == defaultWidth {
+				width = 0
+			}
+			widths = append(widths, width)
+		}
+		defaultHeight, err := f.GetRowHeight(sheet, excelize.TotalRows)
+		if err != nil {
+			return nil, err
+		}
+		for r := 1; r <= lastRow; r++ {
+			height, err := f.GetRowHeight(sheet, r)
+			if err != nil {
+				return nil, err
+			}
+			if height == defaultHeight {
+				height = 0
+			}
+			visible, err := f.GetRowVisible(sheet, r)
+			if err != nil {
+				return nil, err
+			}
+			heights = append(heights, height)
+			hidden = append(hidden, !visible)
+		}
+	}
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	if panes != nil {
+		if err := sw.SetPanes(panes); err != nil {
+			return nil, err
+		}
+	}
+	for c, width := range widths {
+		if width > 0 {
+			if err := sw.SetColWidth(c+1, c+1, width); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, row := range region {
+		values := make([]interface{}, len(row))
+		for c, sc := range row {
+			if value := sc.typedValue(); value != nil || sc.style != 0 || sc.formula != "" {
+				values[c] = excelize.Cell{StyleID: sc.style, Formula: sc.formula, Value: value}
+			}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := sw.SetRow(cell, values, excelize.RowOpts{Height: heights[i], Hidden: hidden[i]}); err != nil {
+			return nil, err
+		}
+	}
+	for _, mc := range merges {
+		if err := sw.MergeCell(mc.GetStartAxis(), mc.GetEndAxis()); err != nil {
+			return nil, err
+		}
+	}
+	return sw, nil
+}
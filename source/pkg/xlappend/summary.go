@@ -0,0 +1,213 @@
+package xlappend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SummarySheet is the sheet Summary writes an overview of each import to.
+const SummarySheet = "Summary"
+
+// defaultSummaryTop is how many values Summary lists for each of the
+// SummaryColumns when SummaryTop is 0.
+const defaultSummaryTop = 10
+
+// blankValue stands for an empty field in the value counts, as it does in
+// Excel's filters and slicers.
+const blankValue = "(blank)"
+
+// valueCount is how often a value was written to one of the SummaryColumns.
+type valueCount struct {
+	value string
+	count int
+}
+
+// noteTime widens the span of timestamps written to the sheet to take in t.
+func (part *SheetRows) noteTime(t time.Time) {
+	if part.Earliest.IsZero() || t.Before(part.Earliest) {
+		part.Earliest = t
+	}
+	if part.Latest.IsZero() || t.After(part.Latest) {
+		part.Latest = t
+	}
+}
+
+// countValues counts the values of the SummaryColumns in row, a written
+// row.
+func (a *sheetAppender) countValues(row []string) {
+	for k, col := range a.summaryCols {
+		value := blankValue
+		if col < len(row) && row[col] != "" {
+			value = row[col]
+		}
+		a.valueCounts[k][value]++
+	}
+}
+
+// topValues returns the SummaryTop values counted most often in counts,
+// the most frequent first and equal counts in value order.
+func (a *sheetAppender) topValues(counts map[string]int) []valueCount {
+	top := make([]valueCount, 0, len(counts))
+	for value, count := range counts {
+		top = append(top, valueCount{value, count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].count != top[j].count {
+			return top[i].count > top[j].count
+		}
+		return top[i].value < top[j].value
+	})
+	n := a.opts.SummaryTop
+	if n == 0 {
+		n = defaultSummaryTop
+	}
+	return top[:min(n, len(top))]
+}
+
+// writeSummary writes an overview of the import to the SummarySheet, below
+// the rows already on it, so that a later run or the next job adds its own:
+// the rows appended from each input file, the counts of lines not appended
+// and values changed, the rows and span of timestamps written to each sheet,
+// and the values most often written to each of the SummaryColumns.
+func (a *sheetAppender) writeSummary() error {
+	name := SummarySheet
+	next := 1
+	if i, _ := a.f.GetSheetIndex(name); i < 0 {
+		if _, err := a.f.NewSheet(name); err != nil {
+			return err
+		}
+		for col, width := range map[string]float64{"A": 48, "B": 14, "C": 16, "D": 20, "E": 20} {
+			if err := a.f.SetColWidth(name, col, col, width); err != nil {
+				return err
+			}
+		}
+	} else {
+		rows, err := a.f.GetRows(name)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			next = len(rows) + 2
+		}
+	}
+	bold, err := a.f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	dateTime, err := a.f.NewStyle(&excelize.Style{CustomNumFmt: &a.displayFmt.dateTime})
+	if err != nil {
+		return err
+	}
+
+	// heading and row write the next row, in bold for a heading
+	row := func(values ...interface{}) error {
+		cell, _ := excelize.CoordinatesToCellName(1, next)
+		next++
+		return a.f.SetSheetRow(name, cell, &values)
+	}
+	heading := func(values ...interface{}) error {
+		first, _ := excelize.CoordinatesToCellName(1, next)
+		last, _ := excelize.CoordinatesToCellName(len(values), next)
+		if err := row(values...); err != nil {
+			return err
+		}
+		return a.f.SetCellStyle(name, first, last, bold)
+	}
+
+	var sheets []string
+	for _, part := range a.result.Sheets {
+		sheets = append(sheets, part.Name)
+	}
+	title := fmt.Sprintf("Import to %s, %s", strings.Join(sheets, ", "), time.Now().UTC().Format(time.RFC3339))
+	if err := heading(title); err != nil {
+		return err
+	}
+	next++
+
+	if err := heading("Input file", "Rows appended", "Failed lines"); err != nil {
+		return err
+	}
+	for _, file := range a.result.Files {
+		if err := row(file.Path, file.Rows, file.Failed); err != nil {
+			return err
+		}
+	}
+	next++
+
+	if err := heading("Lines and values", "Count"); err != nil {
+		return err
+	}
+	mismatches := 0
+	for _, n := range a.result.TypeMismatches {
+		mismatches += n
+	}
+	counts := []struct {
+		label  string
+		count  int
+		always bool
+	}{
+		{"Rows appended", a.result.RowsAppended, true},
+		{"Lines with read errors", a.result.ErrorCount, true},
+		{"Lines not appended (too many fields)", a.result.NotAppendedCount, true},
+		{"Rows padded (too few fields)", a.result.PaddedRows, false},
+		{"Rows truncated (too many fields)", a.result.TruncatedRows, false},
+		{"Lines filtered out", a.result.FilteredOut, false},
+		{"Duplicate rows skipped", a.result.Duplicates, false},
+		{"Repeated header lines skipped", a.result.RepeatedHeaders, false},
+		{"Blank lines skipped", a.result.BlankSkipped, false},
+		{"Values not converted (-coerce)", a.result.CoerceFailures, false},
+		{"Payloads not flattened (-flatten)", a.result.FlattenFailures, false},
+		{"Values not decoded (-decode)", a.result.DecodeFailures, false},
+		{"Values not in the -enrich table", a.result.EnrichMisses, false},
+		{"Values not of the template's type", mismatches, false},
+		{"Values cut to fit in a cell", a.result.TruncatedCells, false},
+		{"Values sanitized against formula injection", a.result.SanitizedCells, false},
+		{"Values changed by -transforms", a.result.TransformedCells, false},
+		{"Rows with highlighted keywords", a.result.HighlightedRows, false},
+		{"Input files skipped", a.result.FilesSkipped, false},
+	}
+	for _, c := range counts {
+		if c.always || c.count > 0 {
+			if err := row(c.label, c.count); err != nil {
+				return err
+			}
+		}
+	}
+	next++
+
+	if err := heading("Sheet", "Rows appended", "Cells", "Earliest timestamp", "Latest timestamp"); err != nil {
+		return err
+	}
+	for _, part := range a.result.Sheets {
+		values := []interface{}{part.Name, part.Rows, part.Range}
+		if !part.Earliest.IsZero() {
+			values = append(values, part.Earliest, part.Latest)
+		}
+		if err := row(values...); err != nil {
+			return err
+		}
+		first, _ := excelize.CoordinatesToCellName(4, next-1)
+		last, _ := excelize.CoordinatesToCellName(5, next-1)
+		if err := a.f.SetCellStyle(name, first, last, dateTime); err != nil {
+			return err
+		}
+	}
+
+	for k := range a.summaryCols {
+		next++
+		if err := heading("Top values of "+a.summaryNames[k], "Count"); err != nil {
+			return err
+		}
+		for _, vc := range a.topValues(a.valueCounts[k]) {
+			if err := row(vc.value, vc.count); err != nil {
+				return err
+			}
+		}
+	}
+	a.opts.Verbosef("Wrote a summary of the import to sheet %s\n", name)
+	return nil
+}
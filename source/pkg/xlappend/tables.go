@@ -0,0 +1,206 @@
+package xlappend
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// tableRefPattern and autoFilterRefPattern match the ref attribute of a
+// table part's root element and of its autoFilter.
+var (
+	tableRefPattern      = regexp.MustCompile(`(<table\b[^>]*?\sref=")[^"]*(")`)
+	autoFilterRefPattern = regexp.MustCompile(`(<autoFilter\b[^>]*?\sref=")[^"]*(")`)
+	columnCountPattern   = regexp.MustCompile(`(<tableColumns\b[^>]*?\scount=")[^"]*(")`)
+	columnIDPattern      = regexp.MustCompile(`<tableColumn\b[^>]*?\sid="(\d+)"`)
+)
+
+// tablePart holds the attributes of a table part needed to resize it.
+type tablePart struct {
+	ID             int    `xml:"id,attr"`
+	Name           string `xml:"name,attr"`
+	Ref            string `xml:"ref,attr"`
+	TotalsRowCount int    `xml:"totalsRowCount,attr"`
+}
+
+// tableRange returns the columns and rows of the corners of table's range.
+func tableRange(table *excelize.Table) (col1, row1, col2, row2 int, err error) {
+	corners := strings.Split(strings.ReplaceAll(table.Range, "$", ""), ":")
+	if len(corners) == 2 {
+		if col1, row1, err = excelize.CellNameToCoordinates(corners[0]); err == nil {
+			col2, row2, err = excelize.CellNameToCoordinates(corners[1])
+		}
+	}
+	if len(corners) != 2 || err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("unrecognised range %s of table %s", table.Range, table.Name)
+	}
+	return col1, row1, col2, row2, nil
+}
+
+// extendTable grows table, the one headerTable picks, down to lastRow so
+// that slicers and pivot tables using it see the appended rows. The table
+// was read before the sheet was written, since a large streamed sheet
+// cannot be read back. When header, the sheet's header row, runs past the
+// table, the table also gains a column for each of its extra cells.
+// With shrink the table ends at lastRow even when that is above its old
+// end, after its rows were overwritten or replaced, keeping at least one
+// data row; a table reaching the last row of the sheet is left to cover
+// whole columns.
+// Warnings go to logf and the resize itself is reported to verbosef.
+// excelize has no API to resize a table, so the table part is rewritten in
+// the package directly.
+func extendTable(f *excelize.File, table *excelize.Table, lastRow int, header []string, shrink bool, logf, verbosef func(string, ...interface{})) error {
+	col1, row1, col2, row2, err := tableRange(table)
+	if err != nil {
+		return err
+	}
+	switch {
+	case shrink && row2 == excelize.TotalRows:
+		return nil
+	case shrink && lastRow <= row1:
+		lastRow = row1 + 1
+	case !shrink && lastRow < row2:
+		lastRow = row2
+	}
+	lastCol := col2
+	if len(header) > col2 {
+		lastCol = len(header)
+	}
+	if lastRow == row2 && lastCol == col2 {
+		return nil
+	}
+
+	partName, part := findTablePart(f, table.Name)
+	if partName == "" {
+		return fmt.Errorf("table %s not found in the workbook", table.Name)
+	}
+	if part.TotalsRowCount > 0 {
+		logf("Warning: table %s has a totals row and was not extended to the appended rows\n", table.Name)
+		return nil
+	}
+
+	topLeft, _ := excelize.CoordinatesToCellName(col1, row1)
+	bottomRight, err := excelize.CoordinatesToCellName(lastCol, lastRow)
+	if err != nil {
+		return err
+	}
+	ref := []byte("${1}" + topLeft + ":" + bottomRight + "${2}")
+	content, _ := f.Pkg.Load(partName)
+	updated := tableRefPattern.ReplaceAll(content.([]byte), ref)
+	updated = autoFilterRefPattern.ReplaceAll(updated, ref)
+	if lastCol > col2 {
+		updated = addTableColumns(updated, header[col2:lastCol], lastCol)
+	}
+	f.Pkg.Store(partName, updated)
+	verbosef("Table %s resized from %s to %s:%s\n", table.Name, table.Range, topLeft, bottomRight)
+	return nil
+}
+
+// headerTable returns the table of tables that holds the sheet's data, the
+// one extendTable grows: the table whose header is on headerRow and whose
+// columns include firstCol, the first written column. It returns nil when
+// there is none.
+func headerTable(tables []excelize.Table, headerRow, firstCol int) *excelize.Table {
+	for i := range tables {
+		col1, row1, col2, _, err := tableRange(&tables[i])
+		if err == nil && row1 == headerRow && col1 <= firstCol && firstCol <= col2 {
+			return &tables[i]
+		}
+	}
+	return nil
+}
+
+// findTablePart returns the package part of the table with the given name,
+// which is unique within the workbook, or an empty part name.
+func findTablePart(f *excelize.File, table string) (string, tablePart) {
+	var partName string
+	var part tablePart
+	f.Pkg.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		if !strings.HasPrefix(name, "xl/tables/") {
+			return true
+		}
+		var p tablePart
+		if err := xml.NewDecoder(bytes.NewReader(value.([]byte))).Decode(&p); err == nil && p.Name == table {
+			partName, part = name, p
+			return false
+		}
+		return true
+	})
+	return partName, part
+}
+
+// addTableColumns appends a tableColumn named after each of names to the
+// table part content, which then has count columns. Column ids continue
+// from the largest one in use and blank names get Excel's ColumnN default.
+func addTableColumns(content []byte, names []string, count int) []byte {
+	id := 0
+	for _, m := range columnIDPattern.FindAllSubmatch(content, -1) {
+		if n, _ := strconv.Atoi(string(m[1])); n > id {
+			id = n
+		}
+	}
+	var columns bytes.Buffer
+	for i, name := range names {
+		if strings.TrimSpace(name) == "" {
+			name = fmt.Sprintf("Column%d", count-len(names)+i+1)
+		}
+		id++
+		fmt.Fprintf(&columns, `<tableColumn id="%d" name="`, id)
+		xml.EscapeText(&columns, []byte(name))
+		columns.WriteString(`"/>`)
+	}
+	columns.WriteString("</tableColumns>")
+	content = bytes.Replace(content, []byte("</tableColumns>"), columns.Bytes(), 1)
+	return columnCountPattern.ReplaceAll(content, []byte("${1}"+strconv.Itoa(count)+"${2}"))
+}
+
+// dataTableStyle is the style of the table TableName creates: medium blue,
+// with banded rows.
+const dataTableStyle = "TableStyleMedium2"
+
+// addDataTable puts the sheet's header row and the rows down to lastRow,
+// from the first written column to the last, in a new table named
+// TableName, so that structured references, slicers and pivot tables can use
+// them. A sheet without a header row that was empty before the run takes
+// the first row written as its header. Data already in a table, which
+// extendTable grows instead, is left as it is. excelize names the columns
+// whose header cells are empty or repeat an earlier one Column1, Column2 and
+// so on, as Excel would.
+func (a *sheetAppender) addDataTable(lastRow int) error {
+	if table := headerTable(a.tables, a.headerRow, a.colOffset+1); table != nil {
+		if table.Name != a.opts.TableName {
+			a.opts.Logf("Sheet %s keeps its data in table %s already; no table %s was added\n", a.opts.SheetName, table.Name, a.opts.TableName)
+		}
+		return nil
+	}
+	headerRow := a.headerRow
+	if headerRow == 0 && a.templateRows == 0 && a.result.RowsAppended > 0 {
+		headerRow = a.result.Sheets[0].firstRow
+	}
+	if headerRow == 0 {
+		return fmt.Errorf("sheet %s has no header row to head the table", a.opts.SheetName)
+	}
+	col1, col2, row2 := a.colOffset+1, max(a.lastCol, a.colOffset+1), max(lastRow, headerRow+1)
+	for i := range a.tables {
+		c1, r1, c2, r2, err := tableRange(&a.tables[i])
+		if err == nil && c1 <= col2 && col1 <= c2 && r1 <= row2 && headerRow <= r2 {
+			return fmt.Errorf("it would overlap table %s (%s)", a.tables[i].Name, a.tables[i].Range)
+		}
+	}
+	topLeft, _ := excelize.CoordinatesToCellName(col1, headerRow)
+	bottomRight, _ := excelize.CoordinatesToCellName(col2, row2)
+	stripes := true
+	table := excelize.Table{Range: topLeft + ":" + bottomRight, Name: a.opts.TableName, StyleName: dataTableStyle, ShowRowStripes: &stripes}
+	if err := a.f.AddTable(a.opts.SheetName, &table); err != nil {
+		return err
+	}
+	a.tables = append(a.tables, table)
+	a.opts.Verbosef("Added table %s over %s!%s\n", table.Name, a.opts.SheetName, table.Range)
+	return nil
+}
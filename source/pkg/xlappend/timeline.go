@@ -0,0 +1,51 @@
+package xlappend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// timelineHeader is the header of a sheet TimeColumns creates, see
+// timelineRecord.
+var timelineHeader = []string{"Time", "Source", "Description"}
+
+// readTimelineHeader notes record, the first of the input file being read,
+// as the header its other records are described by, and finds its timestamp
+// column, given by number or header name in TimeColumns.
+func (a *sheetAppender) readTimelineHeader(record []string) error {
+	spec := a.opts.TimeColumns[0]
+	if len(a.opts.TimeColumns) > 1 {
+		spec = a.inputTimeCols[a.inputIndex]
+	}
+	j, err := resolveColumn(strings.TrimSpace(spec), record)
+	if err != nil {
+		return withKind(ErrInput, fmt.Errorf("no timestamp column in %s: %v", inputName(a.inputName), err))
+	}
+	a.timeCol = j
+	a.timeHeader = append([]string(nil), record...)
+	a.opts.Debugf(a.logPrefix+"Timestamps of %s read from column %d\n", inputName(a.inputName), j+1)
+	return nil
+}
+
+// timelineRecord returns record as a row of the merged timeline: its
+// timestamp, the source label of its file and a description joining the
+// other non-empty fields as "Header: value", separated by semicolons. A
+// field past the file's header is named by its column number.
+func (a *sheetAppender) timelineRecord(record []string) []string {
+	var timestamp string
+	if a.timeCol < len(record) {
+		timestamp = record[a.timeCol]
+	}
+	var desc []string
+	for j, value := range record {
+		if j == a.timeCol || value == "" {
+			continue
+		}
+		name := fmt.Sprintf("Column %d", j+1)
+		if j < len(a.timeHeader) && strings.TrimSpace(a.timeHeader[j]) != "" {
+			name = strings.TrimSpace(a.timeHeader[j])
+		}
+		desc = append(desc, name+": "+value)
+	}
+	return []string{timestamp, a.sourceLabel, strings.Join(desc, "; ")}
+}
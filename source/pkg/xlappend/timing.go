@@ -0,0 +1,20 @@
+package xlappend
+
+import "time"
+
+// Timing is how long the parts of a run took, as Result.Timing, to tell
+// where the time of a large import goes. Read and Write interleave while
+// the rows are written in chunks, so each leaves out the other.
+type Timing struct {
+	Open  time.Duration // opening the template
+	Read  time.Duration // reading, parsing and filtering the input
+	Write time.Duration // preparing the sheet and converting and writing the rows
+	Save  time.Duration // saving the output, with its checksum, manifest and export
+}
+
+// timeTo returns a func adding the time from now until it is called to *d,
+// for a defer.
+func timeTo(d *time.Duration) func() {
+	start := time.Now()
+	return func() { *d += time.Since(start) }
+}
@@ -0,0 +1,108 @@
+package xlappend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// transformRule is one rule of a -transforms file: a pattern replaced in
+// the values of a column.
+type transformRule struct {
+	column  string         // written column number or sheet header name, empty for every column
+	col     int            // 0-based written column once resolved, -1 for every column
+	pattern *regexp.Regexp // what is replaced
+	replace string         // its replacement, in which $1 or ${name} stand for submatches
+}
+
+// loadTransforms reads a -transforms file, a JSON list of rules each
+// replacing the matches of the regular expression find in a column's values
+// with replace, as regexp.ReplaceAllString does:
+//
+//	[{"column": "Path", "find": "^\\\\\\\\\\?\\\\", "replace": ""},
+//	 {"column": 4, "find": "/", "replace": "\\"},
+//	 {"find": "(?i)(\\\\Users\\\\)[^\\\\]+", "replace": "${1}REDACTED"}]
+//
+// The column is a written column number or a sheet header name, resolved
+// by resolveTransforms; a rule without one applies to every column. Rules
+// apply in the order the file gives them.
+func loadTransforms(path string) ([]transformRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		Column  interface{} `json:"column"`
+		Find    *string     `json:"find"`
+		Replace string      `json:"replace"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s has no rules", path)
+	}
+	rules := make([]transformRule, len(entries))
+	for i, entry := range entries {
+		rule := transformRule{replace: entry.Replace}
+		switch v := entry.Column.(type) {
+		case nil:
+		case json.Number:
+			rule.column = v.String()
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return nil, fmt.Errorf("%s: rule %d: empty column name", path, i+1)
+			}
+			rule.column = strings.TrimSpace(v)
+		default:
+			return nil, fmt.Errorf("%s: rule %d: expected a column number or name", path, i+1)
+		}
+		if entry.Find == nil || *entry.Find == "" {
+			return nil, fmt.Errorf("%s: rule %d: no find pattern", path, i+1)
+		}
+		if rule.pattern, err = regexp.Compile(*entry.Find); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+// resolveTransforms resolves the column of each -transforms rule in header,
+// the sheet header from the start column on.
+func (a *sheetAppender) resolveTransforms(header []string) error {
+	for i := range a.transforms {
+		rule := &a.transforms[i]
+		if rule.column == "" {
+			rule.col = -1
+			continue
+		}
+		j, err := resolveColumn(rule.column, header)
+		if err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		rule.col = j
+	}
+	return nil
+}
+
+// transform applies the -transforms rules for written column j to value,
+// reporting whether any of them changed it.
+func (a *sheetAppender) transform(j int, value string) (string, bool) {
+	changed := false
+	for _, rule := range a.transforms {
+		if rule.col != j && rule.col != -1 {
+			continue
+		}
+		if v := rule.pattern.ReplaceAllString(value, rule.replace); v != value {
+			value, changed = v, true
+		}
+	}
+	return value, changed
+}
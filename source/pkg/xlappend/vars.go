@@ -0,0 +1,117 @@
+package xlappend
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// placeholder matches a {{NAME}} placeholder of the template, with its name
+// as the submatch.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// parseVars parses the Vars, each NAME=VALUE, into the value of each name.
+func parseVars(vars []string) (map[string]string, error) {
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		name, value, ok := strings.Cut(v, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !placeholder.MatchString("{{"+name+"}}") {
+			return nil, fmt.Errorf("%q is not NAME=VALUE", v)
+		}
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("%s is given twice", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// replaceVars replaces the {{NAME}} placeholders of the Vars in the cells,
+// headers and footers of every sheet of the open template, so that a title
+// block can name the case, analyst or date of the run. Formulas are left
+// as they are, rich text keeps the formatting of each run, and placeholders
+// no Var names are kept and reported.
+func (a *sheetAppender) replaceVars() error {
+	if len(a.vars) == 0 {
+		return nil
+	}
+	unknown := make(map[string]bool)
+	replace := func(text string) string {
+		return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+			name := placeholder.FindStringSubmatch(match)[1]
+			value, ok := a.vars[name]
+			if !ok {
+				unknown[name] = true
+				return match
+			}
+			a.result.VarsReplaced++
+			return value
+		})
+	}
+	for _, sheet := range a.f.GetSheetList() {
+		rows, err := a.f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return fmt.Errorf("failed to read sheet %s: %v", sheet, err)
+		}
+		for r, row := range rows {
+			for c, value := range row {
+				if !placeholder.MatchString(value) {
+					continue
+				}
+				cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				if err := a.replaceCellVars(sheet, cell, value, replace); err != nil {
+					return fmt.Errorf("failed to fill in cell %s of sheet %s: %v", cell, sheet, err)
+				}
+			}
+		}
+		hf, err := a.f.GetHeaderFooter(sheet)
+		if err != nil {
+			return fmt.Errorf("failed to read the header and footer of sheet %s: %v", sheet, err)
+		}
+		if hf == nil {
+			continue
+		}
+		filled := *hf
+		for _, text := range []*string{&filled.OddHeader, &filled.OddFooter, &filled.EvenHeader, &filled.EvenFooter, &filled.FirstHeader, &filled.FirstFooter} {
+			*text = replace(*text)
+		}
+		if filled != *hf {
+			if err := a.f.SetHeaderFooter(sheet, &filled); err != nil {
+				return fmt.Errorf("failed to fill in the header and footer of sheet %s: %v", sheet, err)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		names := make([]string, 0, len(unknown))
+		for name := range unknown {
+			names = append(names, "{{"+name+"}}")
+		}
+		sort.Strings(names)
+		a.opts.Logf("Template placeholders without a -var, left as they are: %s\n", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// replaceCellVars replaces the placeholders in value, the text of cell,
+// unless the cell holds a formula.
+func (a *sheetAppender) replaceCellVars(sheet, cell, value string, replace func(string) string) error {
+	if formula, err := a.f.GetCellFormula(sheet, cell); err != nil || formula != "" {
+		return err
+	}
+	runs, err := a.f.GetCellRichText(sheet, cell)
+	if err != nil {
+		return err
+	}
+	// Plain text reads back as a single run without a font
+	if len(runs) == 0 || len(runs) == 1 && runs[0].Font == nil {
+		return a.f.SetCellStr(sheet, cell, replace(value))
+	}
+	for i := range runs {
+		runs[i].Text = replace(runs[i].Text)
+	}
+	return a.f.SetCellRichText(sheet, cell, runs)
+}
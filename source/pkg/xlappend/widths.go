@@ -0,0 +1,76 @@
+package xlappend
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxAutoFitWidth caps the width -autofit gives a column unless
+// -autofit-max says otherwise, so that a single long command line does not
+// make a column span several screens.
+const maxAutoFitWidth = 80
+
+// textWidth returns the length in characters of the longest line of value.
+func textWidth(value string) int {
+	width := 0
+	for _, line := range strings.Split(value, "\n") {
+		if n := utf8.RuneCountInString(line); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+// fitColumnWidths sets the width of each sheet column in contentWidths,
+// which holds the widest value written to it. With fixed greater than zero
+// every such column gets that width. Otherwise each one is sized to its
+// content and the cell in headerRow, when that is not zero, plus a margin
+// and capped at maxChars characters; columns already wider are left as
+// they are. It returns how many columns were changed.
+func fitColumnWidths(f *excelize.File, sheet string, contentWidths map[int]int, headerRow int, fixed float64, maxChars int) (int, error) {
+	cols := make([]int, 0, len(contentWidths))
+	for col := range contentWidths {
+		cols = append(cols, col)
+	}
+	sort.Ints(cols)
+	changed := 0
+	for _, col := range cols {
+		name, err := excelize.ColumnNumberToName(col)
+		if err != nil {
+			return changed, err
+		}
+		width := fixed
+		if fixed <= 0 {
+			chars := contentWidths[col]
+			if headerRow > 0 {
+				cell, _ := excelize.CoordinatesToCellName(col, headerRow)
+				header, err := f.GetCellValue(sheet, cell)
+				if err != nil {
+					return changed, err
+				}
+				if n := textWidth(header); n > chars {
+					chars = n
+				}
+			}
+			if chars > maxChars {
+				chars = maxChars
+			}
+			width = float64(chars + 2)
+			current, err := f.GetColWidth(sheet, name)
+			if err != nil {
+				return changed, err
+			}
+			if current >= width {
+				continue
+			}
+		}
+		if err := f.SetColWidth(sheet, name, name, width); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,109 @@
+package xlappend
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// zipMemberSeparator joins a zip archive and the name of one of its members
+// in an input path, as in triage.zip:EvtxECmd/Security.csv.
+const zipMemberSeparator = ":"
+
+// splitZipPath splits an input path into the zip archive it names and the
+// member of it given after zipMemberSeparator, which is empty for the
+// archive alone. ok is false for a path that is not a zip archive. Only a
+// separator right after ".zip" counts, so Windows drive letters are safe.
+func splitZipPath(p string) (archive, member string, ok bool) {
+	lower := strings.ToLower(p)
+	if strings.HasSuffix(lower, ".zip") {
+		return p, "", true
+	}
+	i := strings.Index(lower, ".zip"+zipMemberSeparator)
+	if i < 0 {
+		return "", "", false
+	}
+	return p[:i+len(".zip")], p[i+len(".zip"+zipMemberSeparator):], true
+}
+
+// zipMembers returns the input paths of the members of archive that pattern
+// selects, sorted by name. pattern is a member name or a path.Match glob
+// tried against the whole member name and, when it has no slash, against
+// the base name too, so "*.csv" finds CSV files in any folder. An empty
+// pattern selects the only file in the archive; an archive holding several
+// files needs one named.
+func zipMembers(archive, pattern string) ([]string, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var names []string
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if pattern == "" || file.Name == pattern || zipMatch(pattern, file.Name) {
+			names = append(names, file.Name)
+		}
+	}
+	if pattern == "" && len(names) > 1 {
+		return nil, fmt.Errorf("%s holds %d files; name the ones to read as %s%s<member or pattern>", archive, len(names), archive, zipMemberSeparator)
+	}
+	sort.Strings(names)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = archive + zipMemberSeparator + name
+	}
+	return paths, nil
+}
+
+// zipMatch reports whether pattern matches the member name, or its base
+// name for a pattern without a slash.
+func zipMatch(pattern, name string) bool {
+	if matched, _ := path.Match(pattern, name); matched {
+		return true
+	}
+	matched, _ := path.Match(pattern, path.Base(name))
+	return matched && !strings.Contains(pattern, "/")
+}
+
+// zipMemberReader reads a zip archive member; closing it closes the
+// archive as well.
+type zipMemberReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (r zipMemberReader) Close() error {
+	err := r.ReadCloser.Close()
+	if archiveErr := r.archive.Close(); err == nil {
+		err = archiveErr
+	}
+	return err
+}
+
+// openZipMember opens member of archive for reading. The member is
+// decompressed as it is read, with no temporary file.
+func openZipMember(archive, member string) (io.ReadCloser, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range zr.File {
+		if file.Name != member {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			zr.Close()
+			return nil, fmt.Errorf("%s%s%s: %v", archive, zipMemberSeparator, member, err)
+		}
+		return zipMemberReader{ReadCloser: rc, archive: zr}, nil
+	}
+	zr.Close()
+	return nil, fmt.Errorf("%s has no member %s", archive, member)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// progressLine shows the Progress of an import on one line of a terminal,
+// rewritten in place. Lines are overwritten with spaces rather than
+// cleared with an escape sequence, which not every Windows console knows.
+type progressLine struct {
+	out   *os.File
+	width int // length of the line shown, 0 when none is
+}
+
+// newProgressLine returns a progressLine on stderr, or nil when stderr is
+// not a terminal, as in scripted runs, whose logs would fill with status
+// lines.
+func newProgressLine() *progressLine {
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progressLine{out: os.Stderr}
+}
+
+// show replaces the line with the status p gives: the lines read and rows
+// written, the rate and, for input of a known size, the share read and an
+// estimate of the time left. It is cleared once the input is read.
+func (pl *progressLine) show(p xlappend.Progress) {
+	if p.Done {
+		pl.clear()
+		return
+	}
+	status := fmt.Sprintf("%s: %d lines read, %d rows written, %.0f lines/s", filepath.Base(p.File), p.LinesRead, p.RowsWritten, p.Rate())
+	if p.BytesTotal > 0 {
+		status += fmt.Sprintf(", %d%%", 100*p.BytesRead/p.BytesTotal)
+	}
+	if left, ok := p.Remaining(); ok {
+		status += ", " + left.Round(time.Second).String() + " left"
+	}
+	fmt.Fprintf(pl.out, "\r%-*s", pl.width, status)
+	pl.width = len(status)
+}
+
+// clear blanks the line, if one is shown, so that a message can be printed
+// in its place.
+func (pl *progressLine) clear() {
+	if pl.width == 0 {
+		return
+	}
+	fmt.Fprintf(pl.out, "\r%s\r", strings.Repeat(" ", pl.width))
+	pl.width = 0
+}
+
+// Write writes a message to stderr in place of the line, so that messages
+// and the log package's fatal errors do not run on from it.
+func (pl *progressLine) Write(b []byte) (int, error) {
+	pl.clear()
+	return pl.out.Write(b)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// sheetToken in the -log path of a -rules run stands for the sheet of each
+// rule, which has an error log of its own.
+const sheetToken = "{sheet}"
+
+// sheetRule is one entry of a -rules file: the input files it takes and the
+// sheet they are appended to, with the options that differ from the
+// command line's for them.
+type sheetRule struct {
+	Pattern string `json:"pattern"`
+	Sheet   string `json:"sheet"`
+	sheetOptions
+
+	files []string
+}
+
+// loadRules reads a -rules file, a JSON array of rules in the order their
+// sheets are filled:
+//
+//	[{"pattern": "*_MFTECmd_$MFT_Output.csv", "sheet": "MFT", "r": 2}]
+func loadRules(file string) ([]*sheetRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var rules []*sheetRule
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s has no rules", file)
+	}
+	for i, rule := range rules {
+		if rule.Pattern == "" || rule.Sheet == "" {
+			return nil, fmt.Errorf("%s: rule %d needs a pattern and a sheet", file, i+1)
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: invalid pattern %s", file, i+1, rule.Pattern)
+		}
+	}
+	return rules, nil
+}
+
+// match reports whether the rule takes the file at rel, a slash separated
+// path below the walked directory. A pattern without a slash is tried
+// against the base name too, so "*_EvtxECmd_Output.csv" finds the file in
+// any folder.
+func (rule *sheetRule) match(rel string) bool {
+	if matched, _ := path.Match(rule.Pattern, rel); matched {
+		return true
+	}
+	matched, _ := path.Match(rule.Pattern, path.Base(rel))
+	return matched && !strings.Contains(rule.Pattern, "/")
+}
+
+// matchRules walks the input directories, such as KAPE module output, and
+// gives every file found to the first rule that takes it. A file input is
+// matched by its name. Files no rule takes are reported with -v.
+func matchRules(rules []*sheetRule, inputs []string, verbosef func(string, ...interface{})) error {
+	for _, input := range inputs {
+		err := filepath.WalkDir(input, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(input, file)
+			if err != nil || rel == "." {
+				rel = filepath.Base(file)
+			}
+			for _, rule := range rules {
+				if rule.match(filepath.ToSlash(rel)) {
+					rule.files = append(rule.files, file)
+					return nil
+				}
+			}
+			verbosef("No rule for %s\n", file)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendRules appends the files each rule takes to its sheet, one rule
+// after another, in the single workbook opts.OutputPath names, which is
+// saved once after the last rule. Every rule's error log is named after its
+// sheet, see sheetToken. The files a rule's options name are resolved
+// against relativeTo. It returns the exit status, exitLineErrors if any
+// rule lost lines.
+func appendRules(ctx context.Context, opts xlappend.Options, rules []*sheetRule, relativeTo string, messages *console) int {
+	if err := matchRules(rules, opts.InputPaths, messages.verbosef); err != nil {
+		log.Fatalf("Failed to read input directory: %v", err)
+	}
+	var todo []*sheetRule
+	for _, rule := range rules {
+		if len(rule.files) == 0 {
+			messages.logf("No input files for rule %s (sheet %s)\n", rule.Pattern, rule.Sheet)
+			continue
+		}
+		todo = append(todo, rule)
+	}
+	if len(todo) == 0 {
+		log.Fatal("No input files match any rule")
+	}
+
+	output, err := xlappend.OutputName(opts.OutputPath, opts.InputPaths[0])
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	stem := strings.TrimSuffix(output, filepath.Ext(output))
+	steps := make([]xlappend.Options, len(todo))
+	headings := make([]string, len(todo))
+	logNames := make(map[string]int)
+	for i, rule := range todo {
+		step := opts
+		step.InputPaths = rule.files
+		step.SourceLabels = nil
+		step.SheetName = rule.Sheet
+		step.OutputPath = output
+		if err := rule.apply(&step, relativeTo); err != nil {
+			log.Fatalf("Rule %s: %v", rule.Pattern, err)
+		}
+		// Rules filling the same sheet number their error logs
+		name := rule.Sheet
+		if logNames[rule.Sheet]++; logNames[rule.Sheet] > 1 {
+			name = fmt.Sprintf("%s_%d", rule.Sheet, logNames[rule.Sheet])
+		}
+		if step.ErrorLogPath == "" {
+			step.ErrorLogPath = stem + "-" + name + "-errors.log"
+		} else {
+			step.ErrorLogPath = strings.ReplaceAll(step.ErrorLogPath, sheetToken, name)
+		}
+		steps[i] = step
+		headings[i] = fmt.Sprintf("Rule %s: %d files to sheet %s\n", rule.Pattern, len(rule.files), rule.Sheet)
+	}
+	return appendSheets(ctx, steps, headings, messages)
+}
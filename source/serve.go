@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// serveMaxUpload is the most a -serve request may send, its files and
+// fields together.
+const serveMaxUpload = 512 << 20
+
+// serveMemory is how much of an upload is held in memory; the rest of it is
+// spooled to temporary files.
+const serveMemory = 32 << 20
+
+// xlsxType is the media type of the workbooks -serve returns.
+const xlsxType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// jobOptionKeys are the keys of the sheetOptions, which a request may give.
+var jobOptionKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(sheetOptions{})
+	for i := 0; i < t.NumField(); i++ {
+		keys[t.Field(i).Tag.Get("yaml")] = true
+	}
+	return keys
+}()
+
+// conversionServer answers -serve requests, each appending the files
+// uploaded to a template and sending back the workbook.
+type conversionServer struct {
+	opts      xlappend.Options // the command line's options, which every request starts from
+	templates string           // directory of the templates a request chooses among, empty for the -t file alone
+	messages  *console
+}
+
+// serveConversions runs an HTTP server on addr until ctx is done, see
+// conversionServer.append. It returns the exit status.
+func serveConversions(ctx context.Context, opts xlappend.Options, addr string, messages *console) int {
+	s := &conversionServer{opts: opts, messages: messages}
+	if info, err := os.Stat(opts.TemplatePath); err != nil {
+		log.Fatalf("Failed to open Excel template: %v", err)
+	} else if info.IsDir() {
+		s.templates = opts.TemplatePath
+	}
+	// The requests' own messages would interleave; each is summed up in a
+	// line of its own instead
+	s.opts.Logf, s.opts.Verbosef, s.opts.Debugf, s.opts.Progress = nil, nil, nil, nil
+	s.opts.Checksum, s.opts.Manifest, s.opts.DryRun = "", false, false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/append", s.append)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	messages.logf("Serving POST http://%s/append; Ctrl-C stops\n", addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+	messages.logf("Stopped serving\n")
+	return 0
+}
+
+// append handles POST /append: a multipart form whose "i" files are
+// appended, in order, to the sheet its "s" field names, or -s, of the
+// template its "template" field names in the -t directory, or the -t file.
+// Its other fields are the options of a -job entry, keyed by their flag
+// names, over the command line's. The workbook is sent back as an
+// attachment with the counts of the summary in X-Csv2xl headers; a request
+// that cannot be appended gets a plain text error.
+func (s *conversionServer) append(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxUpload)
+	if err := r.ParseMultipartForm(serveMemory); err != nil {
+		http.Error(w, fmt.Sprintf("invalid upload: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	uploads := r.MultipartForm.File["i"]
+	if len(uploads) == 0 {
+		http.Error(w, "no input files: upload them as the i field", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "csv2XLsheet-serve-")
+	if err != nil {
+		s.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	opts, err := s.requestOptions(r.MultipartForm.Value)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+	opts.InputPaths = nil
+	for i, upload := range uploads {
+		path, err := saveUpload(upload, filepath.Join(dir, strconv.Itoa(i+1)))
+		if err != nil {
+			s.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		opts.InputPaths = append(opts.InputPaths, path)
+	}
+	stem, _ := xlappend.OutputName(xlappend.InputToken, opts.InputPaths[0])
+	opts.OutputPath = filepath.Join(dir, stem+".xlsx")
+	opts.ErrorLogPath, opts.Force = filepath.Join(dir, "errors.log"), true
+
+	var importer xlappend.Importer
+	result, err := importer.Append(r.Context(), opts)
+	switch {
+	case errors.Is(err, xlappend.ErrSave):
+		s.fail(w, r, http.StatusInternalServerError, err)
+		return
+	case err != nil:
+		s.fail(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+	output, err := os.Open(result.OutputPath)
+	if err != nil {
+		s.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer output.Close()
+	header := w.Header()
+	header.Set("Content-Type", xlsxType)
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(result.OutputPath)))
+	header.Set("X-Csv2xl-Rows-Appended", strconv.Itoa(result.RowsAppended))
+	header.Set("X-Csv2xl-Read-Errors", strconv.Itoa(result.ErrorCount))
+	header.Set("X-Csv2xl-Not-Appended", strconv.Itoa(result.NotAppendedCount))
+	if len(result.Sheets) > 0 && result.Sheets[0].Range != "" {
+		header.Set("X-Csv2xl-Range", result.Sheets[0].Name+"!"+result.Sheets[0].Range)
+	}
+	if _, err := io.Copy(w, output); err != nil {
+		s.messages.errorf("%s: failed to send the workbook: %v\n", r.RemoteAddr, err)
+		return
+	}
+	s.messages.logf("%s: %d rows of %d files appended to sheet %s\n", r.RemoteAddr, result.RowsAppended, len(uploads), opts.SheetName)
+}
+
+// fail sends err as the response to r, with status, and logs it.
+func (s *conversionServer) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	s.messages.errorf("%s: %v\n", r.RemoteAddr, err)
+	http.Error(w, err.Error(), status)
+}
+
+// requestOptions returns the command line's options with a request's form
+// fields applied, see append. The fields naming files on the server, other
+// than the template, which must be one of those in the -t directory, are
+// refused.
+func (s *conversionServer) requestOptions(fields url.Values) (xlappend.Options, error) {
+	opts := s.opts
+	if sheet := fields.Get("s"); sheet != "" {
+		opts.SheetName = sheet
+	}
+	if opts.SheetName == "" {
+		return opts, errors.New("no sheet: give it as the s field")
+	}
+	if name := fields.Get("template"); name != "" {
+		if s.templates == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return opts, fmt.Errorf("unknown template: %s", name)
+		}
+		opts.TemplatePath = filepath.Join(s.templates, name)
+		if info, err := os.Stat(opts.TemplatePath); err != nil || !info.Mode().IsRegular() {
+			return opts, fmt.Errorf("unknown template: %s", name)
+		}
+	} else if s.templates != "" {
+		return opts, errors.New("no template: give the name of one in the template directory as the template field")
+	}
+
+	// Each field is decoded as the YAML of a -job entry would be, so that
+	// it takes the same values
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var options sheetOptions
+	for _, key := range keys {
+		switch {
+		case key == "s" || key == "template":
+			continue
+		case key == "map" || key == "transforms":
+			return opts, fmt.Errorf("the %s field names a file on the server and cannot be given", key)
+		case !jobOptionKeys[key]:
+			return opts, fmt.Errorf("unknown option: %s", key)
+		}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: fields[key][0]}
+		if key == "formula" {
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			for _, v := range fields[key] {
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: v, Style: yaml.DoubleQuotedStyle})
+			}
+		}
+		mapping := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: key}, value}}
+		if err := mapping.Decode(&options); err != nil {
+			return opts, fmt.Errorf("invalid %s: %s", key, strings.Join(fields[key], ", "))
+		}
+	}
+	return opts, options.apply(&opts, "")
+}
+
+// saveUpload writes an uploaded file to a directory of its own under dir,
+// under its base name, which names it in the source column and error log,
+// and returns its path.
+func saveUpload(upload *multipart.FileHeader, dir string) (string, error) {
+	name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(upload.Filename, `\`, "/")))
+	if name == "/" || name == "." {
+		name = "upload.csv"
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", err
+	}
+	in, err := upload.Open()
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+	return path, out.Close()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// appendSplit appends the inputs to a sheet for each value of the -split-by
+// column, named after it, in the one workbook opts names, which is saved
+// once. It returns the exit status.
+func appendSplit(ctx context.Context, opts xlappend.Options, messages *console) int {
+	var importer xlappend.Importer
+	steps, err := importer.SplitJobs(ctx, opts)
+	if err != nil {
+		messages.failRun(err)
+	}
+	messages.verbosef("Splitting the input by %s into %d sheets\n", opts.SplitBy, len(steps))
+	headings := make([]string, len(steps))
+	for i, step := range steps {
+		headings[i] = fmt.Sprintf("Lines with %s %q\n", opts.SplitBy, step.SplitValue)
+	}
+	return appendSheets(ctx, steps, headings, messages)
+}
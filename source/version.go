@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at build time by build.sh with
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// A plain go build inside the git checkout still records the commit and its
+// time, which stand in for values not given.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// versionString describes the running build, for -version and -v.
+func versionString() string {
+	rev, date, dated, modified := commit, buildDate, "built", false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if rev == "" && len(setting.Value) >= 7 {
+					rev = setting.Value[:7]
+				}
+			case "vcs.time":
+				if date == "" {
+					date, dated = setting.Value, "committed"
+				}
+			case "vcs.modified":
+				modified = commit == "" && setting.Value == "true"
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	} else if modified {
+		rev += "-modified"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("csv2XLsheet %s (commit %s, %s %s, %s %s/%s)", version, rev, dated, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// watchInterval is how often -watch looks in its directory. A file is
+// appended once its size and modification time are the same on two looks
+// in a row, so that one still being written is not read half done.
+const watchInterval = 2 * time.Second
+
+// watchedFile is what the last look saw of a file not yet appended.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// appendWatch appends every file that arrives in dir matching one of the
+// patterns, one after another as they settle, to the sheet of the single
+// workbook opts.OutputPath names, until ctx is done. The first file is
+// appended to opts.TemplatePath and each later one to the workbook the one
+// before saved, which every save replaces whole. Files already in dir are
+// left alone, as are files that fail, which are reported and not retried.
+// It returns the exit status: that of the first file that failed, see
+// runStatus, otherwise exitLineErrors if any lost lines.
+func appendWatch(ctx context.Context, opts xlappend.Options, dir string, patterns []string, messages *console) int {
+	seen := make(map[string]bool)
+	pending := make(map[string]watchedFile)
+	existing, err := watchMatches(dir, patterns)
+	if err != nil {
+		log.Fatalf("Failed to watch %s: %v", dir, err)
+	}
+	for _, path := range existing {
+		seen[path] = true
+	}
+	messages.logf("Watching %s for new %s files, leaving the %d already there; Ctrl-C stops\n", dir, strings.Join(patterns, ", "), len(existing))
+
+	status, saved := 0, false
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			messages.logf("Stopped watching %s\n", dir)
+			return status
+		case <-ticker.C:
+		}
+		matches, err := watchMatches(dir, patterns)
+		if err != nil {
+			messages.errorf("Failed to look in %s: %v\n", dir, err)
+			continue
+		}
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			now := watchedFile{size: info.Size(), modTime: info.ModTime()}
+			if last, ok := pending[path]; !ok || last != now {
+				pending[path] = now
+				continue
+			}
+			delete(pending, path)
+			seen[path] = true
+
+			step := opts
+			step.InputPaths = []string{path}
+			if saved {
+				step.TemplatePath, step.TemplatePass, step.Force = opts.OutputPath, opts.Password, true
+				step.Backup = false
+			}
+			messages.logf("Input file %s\n", path)
+			var importer xlappend.Importer
+			result, err := importer.Append(ctx, step)
+			switch {
+			case ctx.Err() != nil:
+				messages.errorf("Interrupted: %s was not appended\n", path)
+				return exitInterrupted
+			case err != nil:
+				// Failures are printed even when quiet, like fatal errors
+				messages.errorf("Failed to append %s: %v\n", path, err)
+				if status == 0 || status == exitLineErrors {
+					status = runStatus(err)
+				}
+				continue
+			}
+			saved = saved || !opts.DryRun
+			messages.summary("", step, result)
+			messages.logf("\n")
+			if lostLines(result) && status == 0 {
+				status = exitLineErrors
+			}
+		}
+	}
+}
+
+// watchMatches returns the files in dir matching any of the patterns, in
+// name order.
+func watchMatches(dir string, patterns []string) ([]string, error) {
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	found := make(map[string]bool)
+	var matches []string
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+		}
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && !found[path] {
+				found[path] = true
+				matches = append(matches, path)
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"my-go-project/pkg/xlappend"
+)
+
+// previewLines is how many input lines the wizard shows in the sheet's
+// columns before the import.
+const previewLines = 3
+
+// errWizardQuit ends the wizard when the input closes before the last
+// answer.
+var errWizardQuit = errors.New("no answer given")
+
+// wizard asks the questions of the interactive mode, run without flags on
+// a terminal, reading the answers from in and writing to out.
+type wizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// runWizard walks through choosing the input file, its delimiter, the
+// template and its sheet, shows the first lines as they would land in the
+// sheet's columns, and returns the command line arguments of the import.
+// It returns no arguments when the import is not wanted after all.
+func runWizard(in io.Reader, out io.Writer) ([]string, error) {
+	w := &wizard{in: bufio.NewScanner(in), out: out}
+	fmt.Fprintf(out, "%s, interactive mode: append a CSV or TSV file to a sheet of an Excel template.\n", programName())
+	fmt.Fprint(out, "Press Enter to take the answer in brackets, Ctrl-C to quit; -h lists the flags for scripts.\n\n")
+
+	input, err := w.askFile("Input CSV/TSV file", "")
+	if err != nil {
+		return nil, err
+	}
+	sample, err := readSample(input)
+	if err != nil {
+		return nil, err
+	}
+	detected, ok := xlappend.DetectDelimiter(sample)
+	if ok {
+		fmt.Fprintf(out, "The fields of %s are separated by %s.\n", filepath.Base(input), delimiterLabel(detected))
+	} else {
+		fmt.Fprintf(out, "The delimiter of %s could not be told from its first lines.\n", filepath.Base(input))
+	}
+	var delim rune
+	var separator, delimArg string
+	for {
+		answer, err := w.ask("Delimiter: csv, tab or the character(s)", delimiterArg(detected))
+		if err != nil {
+			return nil, err
+		}
+		if answer == "auto" || answer == "bodyfile" {
+			fmt.Fprintln(out, "  Give the delimiter itself here; -d lists the others.")
+			continue
+		}
+		if delim, separator, err = parseDelimiter(answer); err != nil {
+			fmt.Fprintf(out, "  %v\n", err)
+			continue
+		}
+		delimArg = answer
+		break
+	}
+	records := sampleRecords(sample, delim, separator, previewLines+1)
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s has no lines to append", input)
+	}
+	hasHeader, err := w.confirm("Is the first line a header of column names", true)
+	if err != nil {
+		return nil, err
+	}
+	var inputHeader []string
+	if hasHeader {
+		inputHeader, records = records[0], records[1:]
+	}
+	if len(records) > previewLines {
+		records = records[:previewLines]
+	}
+
+	var template, sheet string
+	var sheetHeader []string
+	for {
+		if template, err = w.askFile("Excel template (.xlsx, .xltx, .xlsm or .xltm)", ""); err != nil {
+			return nil, err
+		}
+		f, err := excelize.OpenFile(template)
+		if err != nil {
+			fmt.Fprintf(out, "  Cannot open %s: %v\n", template, err)
+			continue
+		}
+		sheet, err = w.choose("Sheet to append to", f.GetSheetList(), f.GetSheetName(f.GetActiveSheetIndex()))
+		if err == nil {
+			sheetHeader, err = sheetHeadings(f, sheet)
+		}
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	w.preview(sheet, sheetHeader, inputHeader, records)
+
+	stem := strings.TrimSuffix(input, filepath.Ext(input))
+	output, err := w.ask("Output workbook", stem+".xlsx")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-i", input}
+	if delimArg != "csv" {
+		args = append(args, "-d", delimArg)
+	}
+	args = append(args, "-t", template, "-s", sheet)
+	if hasHeader {
+		args = append(args, "-r", "2")
+	}
+	args = append(args, "-o", output)
+	if _, err := os.Stat(output); err == nil {
+		replace, err := w.confirm(output+" exists; replace it", false)
+		if err != nil {
+			return nil, err
+		}
+		if !replace {
+			fmt.Fprintln(out, "Nothing imported.")
+			return nil, nil
+		}
+		args = append(args, "-force")
+	}
+
+	fmt.Fprintf(out, "\nThe same import from a script:\n  %s\n\n", commandLine(append([]string{programName()}, args...)))
+	run, err := w.confirm("Run the import now", true)
+	if err != nil {
+		return nil, err
+	}
+	if !run {
+		fmt.Fprintln(out, "Nothing imported.")
+		return nil, nil
+	}
+	fmt.Fprintln(out)
+	return args, nil
+}
+
+// readLine prints prompt and returns the line typed, trimmed.
+func (w *wizard) readLine(prompt string) (string, error) {
+	fmt.Fprint(w.out, prompt+": ")
+	if !w.in.Scan() {
+		fmt.Fprintln(w.out)
+		if err := w.in.Err(); err != nil {
+			return "", err
+		}
+		return "", errWizardQuit
+	}
+	return strings.TrimSpace(w.in.Text()), nil
+}
+
+// ask prints prompt with the answer def taken on Enter, if any, and returns
+// the answer, asking again until there is one.
+func (w *wizard) ask(prompt, def string) (string, error) {
+	if def != "" {
+		prompt += " [" + def + "]"
+	}
+	for {
+		answer, err := w.readLine(prompt)
+		if answer == "" {
+			answer = def
+		}
+		if err != nil || answer != "" {
+			return answer, err
+		}
+	}
+}
+
+// askFile asks for the path of an existing file, asking again until one is
+// given.
+func (w *wizard) askFile(prompt, def string) (string, error) {
+	for {
+		path, err := w.ask(prompt, def)
+		if err != nil {
+			return "", err
+		}
+		// Paths dragged onto a terminal arrive quoted
+		path = strings.Trim(path, `"'`)
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			fmt.Fprintf(w.out, "  %s does not exist\n", path)
+		case err != nil:
+			fmt.Fprintf(w.out, "  %v\n", err)
+		case info.IsDir():
+			fmt.Fprintf(w.out, "  %s is a directory; give a file in it\n", path)
+		default:
+			return path, nil
+		}
+	}
+}
+
+// confirm asks a yes or no question, def answering it on Enter.
+func (w *wizard) confirm(prompt string, def bool) (bool, error) {
+	choices := "Y/n"
+	if !def {
+		choices = "y/N"
+	}
+	for {
+		answer, err := w.readLine(prompt + "? " + choices)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(w.out, "  Answer y or n")
+	}
+}
+
+// choose lists options, numbered, and returns the one picked by number or
+// name, def on Enter.
+func (w *wizard) choose(prompt string, options []string, def string) (string, error) {
+	for i, option := range options {
+		fmt.Fprintf(w.out, "  %d  %s\n", i+1, option)
+	}
+	for {
+		answer, err := w.ask(prompt, def)
+		if err != nil {
+			return "", err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return options[n-1], nil
+		}
+		for _, option := range options {
+			if strings.EqualFold(option, answer) {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(w.out, "  Give a number from 1 to %d or a sheet name\n", len(options))
+	}
+}
+
+// preview prints the first records as they would land in the columns of
+// sheet, from column A on, next to the sheet's headings and the input's
+// own, and warns when the lines hold more fields than the sheet has
+// columns.
+func (w *wizard) preview(sheet string, sheetHeader, inputHeader []string, records [][]string) {
+	width := len(sheetHeader)
+	fields := len(inputHeader)
+	for _, record := range records {
+		fields = max(fields, len(record))
+	}
+	fmt.Fprintf(w.out, "\nThe first lines as they would land in sheet %s:\n", sheet)
+	heading := []string{"Column", "Sheet heading"}
+	if inputHeader != nil {
+		heading = append(heading, "Input heading")
+	}
+	for i := range records {
+		heading = append(heading, fmt.Sprintf("Line %d", i+1))
+	}
+	rows := [][]string{heading}
+	for j := 0; j < max(width, fields); j++ {
+		col, _ := excelize.ColumnNumberToName(j + 1)
+		row := []string{col, cell(sheetHeader, j)}
+		if inputHeader != nil {
+			row = append(row, cell(inputHeader, j))
+		}
+		for _, record := range records {
+			row = append(row, cell(record, j))
+		}
+		rows = append(rows, row)
+	}
+	printColumns(w.out, rows)
+	if width > 0 && fields > width {
+		fmt.Fprintf(w.out, "The input has %d fields but the sheet %d columns: lines with fields past column %s are not appended.\n",
+			fields, width, columnName(width))
+	}
+	fmt.Fprintln(w.out, "The rows are appended below the last row of the sheet.")
+	fmt.Fprintln(w.out)
+}
+
+// sheetHeadings returns the headings of sheet: the header row of its first
+// table, or else the widest of its first 5 rows, as the import takes them.
+func sheetHeadings(f *excelize.File, sheet string) ([]string, error) {
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	headerRow := 0
+	if tables, err := f.GetTables(sheet); err == nil && len(tables) > 0 {
+		ref, _, _ := strings.Cut(tables[0].Range, ":")
+		_, headerRow, _ = excelize.CellNameToCoordinates(ref)
+	} else {
+		for i := 0; i < min(5, len(rows)); i++ {
+			if len(rows[i]) > 0 && (headerRow == 0 || len(rows[i]) > len(rows[headerRow-1])) {
+				headerRow = i + 1
+			}
+		}
+	}
+	if headerRow == 0 || headerRow > len(rows) {
+		return nil, nil
+	}
+	return rows[headerRow-1], nil
+}
+
+// readSample returns the start of the file at path, as much as delimiter
+// detection looks at, without a UTF-8 byte order mark.
+func readSample(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sample, err := io.ReadAll(io.LimitReader(file, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(sample, []byte("\xef\xbb\xbf")), nil
+}
+
+// sampleRecords returns up to n records of sample split by delim, or by
+// separator when the delimiter has several characters.
+func sampleRecords(sample []byte, delim rune, separator string, n int) [][]string {
+	var records [][]string
+	if separator != "" {
+		for _, line := range strings.Split(string(sample), "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" && len(records) < n {
+				records = append(records, strings.Split(line, separator))
+			}
+		}
+		return records
+	}
+	reader := csv.NewReader(bytes.NewReader(sample))
+	reader.Comma = delim
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	for len(records) < n {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// delimiterArg returns the -d value of delim.
+func delimiterArg(delim rune) string {
+	switch delim {
+	case ',':
+		return "csv"
+	case '\t':
+		return "tab"
+	}
+	return string(delim)
+}
+
+// delimiterLabel describes delim for the wizard.
+func delimiterLabel(delim rune) string {
+	switch delim {
+	case ',':
+		return "commas"
+	case '\t':
+		return "tabs"
+	}
+	return "'" + string(delim) + "'"
+}
+
+// printColumns prints rows as a table of columns padded to the widest
+// value, values cut to 30 characters.
+func printColumns(out io.Writer, rows [][]string) {
+	const maxWidth = 30
+	var widths []int
+	for _, row := range rows {
+		for j, value := range row {
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], min(len([]rune(value)), maxWidth))
+		}
+	}
+	for _, row := range rows {
+		var line strings.Builder
+		for j, value := range row {
+			if runes := []rune(value); len(runes) > maxWidth {
+				value = string(runes[:maxWidth-1]) + "…"
+			}
+			line.WriteString("  " + value + strings.Repeat(" ", widths[j]-len([]rune(value))))
+		}
+		fmt.Fprintln(out, strings.TrimRight(line.String(), " "))
+	}
+}
+
+// cell returns field j of record, empty past its end.
+func cell(record []string, j int) string {
+	if j < len(record) {
+		return record[j]
+	}
+	return ""
+}
+
+// columnName returns the letter of sheet column col.
+func columnName(col int) string {
+	name, _ := excelize.ColumnNumberToName(col)
+	return name
+}